@@ -0,0 +1,192 @@
+package soy
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// The default limits on the size of template archives, which may be changed
+// with ArchiveLimits.
+const (
+	DefaultMaxArchiveSize     = 64 << 20 // bytes in an archive, compressed or not
+	DefaultMaxArchiveFileSize = 4 << 20  // bytes in each file within an archive
+)
+
+// maxManifestSize limits the size of the manifest fetched by a Remote.
+const maxManifestSize = 1 << 20
+
+// ArchiveLimits sets the maximum size, in bytes, of the template archives
+// added to the bundle (both as given, and once decompressed), and of each
+// *.soy file within them.  An archive that exceeds either limit fails the
+// bundle, so that a corrupt or malicious archive can not exhaust memory.  A
+// limit of zero leaves the default, DefaultMaxArchiveSize or
+// DefaultMaxArchiveFileSize.  It should be called before adding archives.
+func (b *Bundle) ArchiveLimits(maxSize, maxFileSize int64) *Bundle {
+	b.maxArchiveSize, b.maxArchiveFileSize = maxSize, maxFileSize
+	return b
+}
+
+func (b *Bundle) archiveLimits() (maxSize, maxFileSize int64) {
+	maxSize, maxFileSize = b.maxArchiveSize, b.maxArchiveFileSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxArchiveSize
+	}
+	if maxFileSize <= 0 {
+		maxFileSize = DefaultMaxArchiveFileSize
+	}
+	return maxSize, maxFileSize
+}
+
+// AddTemplateArchive adds the *.soy files within the given archive to the
+// bundle.  The archive may be a zip file or a tar file, optionally gzipped.
+// Each file is named by its path within the archive, and the given name of the
+// archive is only used for error messages.  The sizes of the archive and its
+// files are limited by ArchiveLimits.
+func (b *Bundle) AddTemplateArchive(name string, archive []byte) *Bundle {
+	var maxSize, maxFileSize = b.archiveLimits()
+	var err error
+	switch {
+	case int64(len(archive)) > maxSize:
+		err = fmt.Errorf("archive exceeds the limit of %d bytes", maxSize)
+	case bytes.HasPrefix(archive, []byte("PK\x03\x04")):
+		err = b.addZip(archive, maxSize, maxFileSize)
+	case bytes.HasPrefix(archive, []byte("\x1f\x8b")):
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(bytes.NewReader(archive)); err == nil {
+			err = b.addTar(newLimitReader(gz, maxSize, "decompressed archive"), maxFileSize)
+		}
+	default:
+		err = b.addTar(bytes.NewReader(archive), maxFileSize)
+	}
+	if err != nil {
+		b.err = fmt.Errorf("template archive %s: %w", name, err)
+	}
+	return b
+}
+
+// AddTemplateArchiveURL fetches the archive at the given URL, verifies that
+// its SHA-256 checksum is the given hex digest, and adds its *.soy files to
+// the bundle, like AddTemplateArchive.  A versioned URL and the checksum of
+// that version allow templates to be deployed separately from the binary,
+// while pinning the templates that it runs with.  See Remote to follow the
+// latest version instead.
+func (b *Bundle) AddTemplateArchiveURL(url, checksum string) *Bundle {
+	var maxSize, _ = b.archiveLimits()
+	var archive, err = fetchArchive(context.Background(), http.DefaultClient, url, checksum, maxSize)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	return b.AddTemplateArchive(url, archive)
+}
+
+func (b *Bundle) addZip(archive []byte, maxSize, maxFileSize int64) error {
+	var zr, err = zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !strings.HasSuffix(f.Name, ".soy") {
+			continue
+		}
+		var r, err = f.Open()
+		if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadAll(newLimitReader(r, maxFileSize, "file"))
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		if total += int64(len(content)); total > maxSize {
+			return fmt.Errorf("decompressed archive exceeds the limit of %d bytes", maxSize)
+		}
+		b.AddTemplateString(f.Name, string(content))
+	}
+	return nil
+}
+
+func (b *Bundle) addTar(r io.Reader, maxFileSize int64) error {
+	var tr = tar.NewReader(r)
+	for {
+		var hdr, err = tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg || !strings.HasSuffix(hdr.Name, ".soy") {
+			continue
+		}
+		content, err := ioutil.ReadAll(newLimitReader(tr, maxFileSize, "file"))
+		if err != nil {
+			return fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		b.AddTemplateString(hdr.Name, string(content))
+	}
+}
+
+// fetchArchive returns the content at the given URL, failing unless its
+// SHA-256 checksum is the given hex digest, or if it exceeds maxSize bytes.
+func fetchArchive(ctx context.Context, client *http.Client, url, checksum string, maxSize int64) ([]byte, error) {
+	var body, err = fetch(ctx, client, url, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	var sum = sha256.Sum256(body)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), checksum) {
+		return nil, fmt.Errorf("template archive %s: expected sha256 %s, got %x", url, checksum, sum)
+	}
+	return body, nil
+}
+
+// fetch returns the body of a successful GET of the given URL, failing if it
+// exceeds maxSize bytes.
+func fetch(ctx context.Context, client *http.Client, url string, maxSize int64) ([]byte, error) {
+	var req, err = http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(newLimitReader(resp.Body, maxSize, "GET "+url))
+}
+
+// limitReader reads from an io.LimitReader that allows one byte more than the
+// limit, and fails with an error once that byte is read, so that content that
+// exceeds the limit is rejected rather than silently truncated.
+type limitReader struct {
+	r     *io.LimitedReader
+	limit int64
+	name  string // of the content, for the error
+}
+
+func newLimitReader(r io.Reader, limit int64, name string) *limitReader {
+	return &limitReader{io.LimitReader(r, limit+1).(*io.LimitedReader), limit, name}
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	var n, err = l.r.Read(p)
+	if l.r.N == 0 {
+		return n, fmt.Errorf("%s exceeds the limit of %d bytes", l.name, l.limit)
+	}
+	return n, err
+}
@@ -0,0 +1,189 @@
+package soy
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type archiveFile struct{ name, content string }
+
+// testArchiveFiles returns the files within the test archives, including a
+// directory and a file that is not a template, with the given greeting.
+func testArchiveFiles(greeting string) []archiveFile {
+	return []archiveFile{
+		{"views/", ""},
+		{"views/page.soy", `{namespace page}
+/** @param name */
+{template .hello}{call widget.greeting data="all" /}{/template}`},
+		{"views/widget.soy", `{namespace widget}
+/** @param name */
+{template .greeting}` + greeting + ` {$name}{/template}`},
+		{"README", "not a template"},
+	}
+}
+
+func zipArchive(t *testing.T, files []archiveFile) []byte {
+	var buf bytes.Buffer
+	var zw = zip.NewWriter(&buf)
+	for _, f := range files {
+		var w, err = zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(f.content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarArchive(t *testing.T, files []archiveFile) []byte {
+	var buf bytes.Buffer
+	var tw = tar.NewWriter(&buf)
+	for _, f := range files {
+		var hdr = &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.content)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(f.name, "/") {
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(f.content))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipArchive(t *testing.T, archive []byte) []byte {
+	var buf bytes.Buffer
+	var gw = gzip.NewWriter(&buf)
+	gw.Write(archive)
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func checksum(archive []byte) string {
+	var sum = sha256.Sum256(archive)
+	return hex.EncodeToString(sum[:])
+}
+
+func renderHello(t *testing.T, b *Bundle) string {
+	var tofu, err = b.CompileToTofu()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = tofu.Render(&buf, "page.hello", map[string]string{"name": "Rob"}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestAddTemplateArchive(t *testing.T) {
+	var files = testArchiveFiles("Hello")
+	var tests = []struct {
+		name    string
+		archive []byte
+	}{
+		{"templates.zip", zipArchive(t, files)},
+		{"templates.tar", tarArchive(t, files)},
+		{"templates.tar.gz", gzipArchive(t, tarArchive(t, files))},
+	}
+	for _, test := range tests {
+		var b = NewBundle().AddTemplateArchive(test.name, test.archive)
+		if len(b.files) != 2 || b.files[0].name != "views/page.soy" {
+			t.Errorf("%s: expected the two templates, got %v", test.name, b.files)
+			continue
+		}
+		if out := renderHello(t, b); out != "Hello Rob" {
+			t.Errorf("%s: expected %q, got %q", test.name, "Hello Rob", out)
+		}
+	}
+
+	var _, err = NewBundle().AddTemplateArchive("corrupt.zip", zipArchive(t, files)[:40]).Compile()
+	if err == nil || !strings.Contains(err.Error(), "corrupt.zip") {
+		t.Errorf("expected an error for a corrupt archive, got %v", err)
+	}
+}
+
+func TestAddTemplateArchiveURL(t *testing.T) {
+	var archive = zipArchive(t, testArchiveFiles("Hello"))
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/templates-1.zip" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	var b = NewBundle().AddTemplateArchiveURL(server.URL+"/templates-1.zip", checksum(archive))
+	if out := renderHello(t, b); out != "Hello Rob" {
+		t.Errorf("expected %q, got %q", "Hello Rob", out)
+	}
+
+	var failures = []struct{ path, checksum, err string }{
+		{"/templates-1.zip", checksum([]byte("other")), "expected sha256"},
+		{"/templates-1.zip", "", "expected sha256"},
+		{"/templates-2.zip", checksum(archive), "404 Not Found"},
+	}
+	for _, test := range failures {
+		var _, err = NewBundle().AddTemplateArchiveURL(server.URL+test.path, test.checksum).Compile()
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s %q: expected error %q, got %v", test.path, test.checksum, test.err, err)
+		}
+	}
+}
+
+func TestArchiveLimits(t *testing.T) {
+	var files = testArchiveFiles("Hello")
+	var large = append(testArchiveFiles("Hello"), archiveFile{"views/large.soy", strings.Repeat(" ", 2000)})
+	var tests = []struct {
+		name                 string
+		archive              []byte
+		maxSize, maxFileSize int64
+		err                  string
+	}{
+		{"templates.zip", zipArchive(t, files), 0, 0, ""},
+		{"templates.zip", zipArchive(t, files), 100, 0, "archive exceeds the limit of 100 bytes"},
+		{"templates.zip", zipArchive(t, large), 0, 1000, "views/large.soy: file exceeds the limit of 1000 bytes"},
+		{"templates.zip", zipArchive(t, large), 1500, 0, "decompressed archive exceeds the limit of 1500 bytes"},
+		{"templates.tar", tarArchive(t, large), 0, 1000, "views/large.soy: file exceeds the limit of 1000 bytes"},
+		{"templates.tar.gz", gzipArchive(t, tarArchive(t, large)), 3000, 0, "decompressed archive exceeds the limit of 3000 bytes"},
+	}
+	for _, test := range tests {
+		var _, err = NewBundle(WithArchiveLimits(test.maxSize, test.maxFileSize)).
+			AddTemplateArchive(test.name, test.archive).
+			Compile()
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s %d/%d: expected error %q, got %v", test.name, test.maxSize, test.maxFileSize, test.err, err)
+		}
+	}
+
+	// Archives are limited as they are fetched.
+	var archive = zipArchive(t, files)
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	defer server.Close()
+	var _, err = NewBundle().
+		ArchiveLimits(100, 0).
+		AddTemplateArchiveURL(server.URL+"/templates.zip", checksum(archive)).
+		Compile()
+	if err == nil || !strings.Contains(err.Error(), "exceeds the limit of 100 bytes") {
+		t.Errorf("expected the fetched archive to exceed the limit, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package ast
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update api.txt with the current API")
+
+// apiNodes lists every node type, to record their exported fields.
+var apiNodes = []Node{
+	&SoyFileNode{}, &ListNode{}, &RawTextNode{}, &NamespaceNode{}, &TemplateNode{},
+	&SoyDocNode{}, &SoyDocParamNode{}, &PrintNode{}, &PrintDirectiveNode{}, &LiteralNode{},
+	&CssNode{}, &LogNode{}, &DebuggerNode{}, &AssertNode{}, &KeyNode{},
+	&LetValueNode{}, &LetContentNode{}, &IdentNode{}, &MsgNode{}, &MsgPlaceholderNode{},
+	&MsgHtmlTagNode{}, &MsgPluralNode{}, &MsgPluralCaseNode{}, &CallNode{}, &CallParamValueNode{},
+	&CallParamContentNode{}, &IfNode{}, &IfCondNode{}, &SwitchNode{}, &SwitchCaseNode{},
+	&ForNode{}, &NullNode{}, &BoolNode{}, &IntNode{}, &FloatNode{},
+	&StringNode{}, &GlobalNode{}, &ConstantNode{}, &FunctionNode{}, &ListLiteralNode{},
+	&MapLiteralNode{}, &DataRefNode{}, &DataRefIndexNode{}, &DataRefExprNode{}, &DataRefKeyNode{},
+	&NotNode{}, &NegateNode{}, &BinaryOpNode{}, &TernNode{},
+	&MulNode{}, &DivNode{}, &ModNode{}, &AddNode{}, &SubNode{},
+	&EqNode{}, &NotEqNode{}, &GtNode{}, &GteNode{}, &LtNode{},
+	&LteNode{}, &OrNode{}, &AndNode{}, &ElvisNode{}, &ShiftLeftNode{},
+	&ShiftRightNode{}, &BitAndNode{}, &BitOrNode{}, &BitXorNode{},
+}
+
+// TestAPI verifies that no exported field has been removed or changed since
+// the api.txt was last updated, and that any additions have been recorded.
+func TestAPI(t *testing.T) {
+	var current []string
+	for _, node := range apiNodes {
+		var typ = reflect.TypeOf(node).Elem()
+		for i := 0; i < typ.NumField(); i++ {
+			var field = typ.Field(i)
+			if field.PkgPath == "" {
+				current = append(current, fmt.Sprintf("%s.%s %s", typ.Name(), field.Name, field.Type))
+			}
+		}
+	}
+	sort.Strings(current)
+	if *update {
+		if err := ioutil.WriteFile("api.txt", []byte(strings.Join(current, "\n")+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	var buf, err = ioutil.ReadFile("api.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recorded = strings.Split(strings.TrimSpace(string(buf)), "\n")
+	var have = make(map[string]bool)
+	for _, line := range current {
+		have[line] = true
+	}
+	for _, line := range recorded {
+		if !have[line] {
+			t.Errorf("breaking change: %s was removed (requires a major APIVersion)", line)
+		}
+		delete(have, line)
+	}
+	for _, line := range current {
+		if have[line] {
+			t.Errorf("new API: %s (run go test -update to record it)", line)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	var tree = &ListNode{0, []Node{
+		&PrintNode{0, &AddNode{BinaryOpNode{"+", 0, &IntNode{0, 1}, &IntNode{0, 2}}}, nil},
+		&CallNode{0, "a", false, nil, nil, false, 0, ""},
+		&IfNode{0, []*IfCondNode{{0, &BoolNode{0, true}, &ListNode{0, []Node{&RawTextNode{0, []byte("skip")}}}}}},
+	}}
+	var visited []string
+	Inspect(tree, func(node Node) bool {
+		visited = append(visited, fmt.Sprintf("%T", node))
+		_, isCond := node.(*IfCondNode)
+		return !isCond
+	})
+	var expected = "*ast.ListNode *ast.PrintNode *ast.AddNode *ast.IntNode *ast.IntNode " +
+		"*ast.CallNode *ast.IfNode *ast.IfCondNode"
+	if actual := strings.Join(visited, " "); actual != expected {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
@@ -0,0 +1,30 @@
+/*
+Package ast contains definitions for the in-memory representation of a Soy
+template.
+
+# Compatibility
+
+The node types are a stable API for tools outside of this repository, such as
+linters, language servers, and codemods, versioned by APIVersion according to
+semantic versioning:
+
+  - A patch version changes only the documentation or the String output of
+    nodes.
+  - A minor version adds node types, or adds fields to the end of existing
+    node types.  Tools should construct nodes with keyed struct literals, so
+    that they are not broken by the added fields.
+  - A major version removes or renames node types or fields, or changes their
+    types.  Where possible, the old form is kept alongside the new one,
+    deprecated, for at least one minor version before it is removed.
+
+The exported fields of each node type are recorded in api.txt, which is
+verified by the tests of this package.
+
+Tools should traverse the tree with Inspect or the Children of each
+ParentNode, rather than enumerating the node types, so that they continue to
+find the nodes they are interested in when new node types are added.
+*/
+package ast
+
+// APIVersion is the semantic version of the node types in this package.
+const APIVersion = "1.1.0"
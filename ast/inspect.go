@@ -0,0 +1,15 @@
+package ast
+
+// Inspect traverses the tree rooted at node in depth-first order.  It calls
+// f(node) for each node, and if f returns true, continues with each of its
+// children.
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+	if parent, ok := node.(ParentNode); ok {
+		for _, child := range parent.Children() {
+			Inspect(child, f)
+		}
+	}
+}
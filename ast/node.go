@@ -1,11 +1,11 @@
-// Package ast contains definitions for the in-memory representation of a Soy
-// template.
 package ast
 
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strconv"
+	"time"
 
 	"github.com/robfig/soy/data"
 )
@@ -89,10 +89,20 @@ type NamespaceNode struct {
 	Pos
 	Name       string
 	Autoescape AutoescapeType
+	Attrs      map[string]string // all attributes of the declaration, by name
 }
 
 func (c *NamespaceNode) String() string {
-	return "{namespace " + c.Name + "}"
+	var names []string
+	for name := range c.Attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var expr = "{namespace " + c.Name
+	for _, name := range names {
+		expr += fmt.Sprintf(" %s=%q", name, c.Attrs[name])
+	}
+	return expr + "}"
 }
 
 type AutoescapeType int
@@ -102,6 +112,7 @@ const (
 	AutoescapeOn
 	AutoescapeOff
 	AutoescapeContextual
+	AutoescapeStrict
 )
 
 // TemplateNode holds a template body.
@@ -111,6 +122,7 @@ type TemplateNode struct {
 	Body       *ListNode
 	Autoescape AutoescapeType
 	Private    bool
+	Kind       string // the content kind, e.g. "html" or "text", if specified
 }
 
 func (n *TemplateNode) String() string {
@@ -261,6 +273,38 @@ func (n *DebuggerNode) String() string {
 	return "{debugger}"
 }
 
+// AssertNode is an {assert} command, which fails the render with the message
+// if the expression is false.  Asserts may be removed from production builds
+// with parsepasses.StripAsserts.
+type AssertNode struct {
+	Pos
+	Expr    Node
+	Message string
+}
+
+func (n *AssertNode) String() string {
+	return fmt.Sprintf("{assert %s, %q}", n.Expr, n.Message)
+}
+
+func (n *AssertNode) Children() []Node {
+	return []Node{n.Expr}
+}
+
+// KeyNode is a {key} command, which gives an element a key for reconciliation
+// by incremental DOM.  It has no effect on the string-based backends.
+type KeyNode struct {
+	Pos
+	Key Node
+}
+
+func (n *KeyNode) String() string {
+	return "{key " + n.Key.String() + "}"
+}
+
+func (n *KeyNode) Children() []Node {
+	return []Node{n.Key}
+}
+
 type LetValueNode struct {
 	Pos
 	Name string
@@ -406,10 +450,16 @@ func (n *MsgPluralCaseNode) Children() []Node {
 
 type CallNode struct {
 	Pos
-	Name    string
-	AllData bool
-	Data    Node
-	Params  []Node
+	Name     string
+	AllData  bool
+	Data     Node
+	Params   []Node
+	Fragment bool // true if the call may be rendered as an edge side include
+
+	// Budget is the time allowed to render the call, after which the Fallback
+	// template is rendered in its place, or 0 if the call is not budgeted.
+	Budget   time.Duration
+	Fallback string
 }
 
 func (n *CallNode) String() string {
@@ -419,6 +469,12 @@ func (n *CallNode) String() string {
 	} else if n.Data != nil {
 		expr += fmt.Sprintf(` data="%s"`, n.Data.String())
 	}
+	if n.Fragment {
+		expr += ` fragment="true"`
+	}
+	if n.Budget > 0 {
+		expr += fmt.Sprintf(` budget="%v" fallback="%s"`, n.Budget, n.Fallback)
+	}
 	if n.Params == nil {
 		return expr + "/}"
 	}
@@ -456,9 +512,13 @@ type CallParamContentNode struct {
 	Pos
 	Key     string
 	Content Node
+	Kind    string // the content kind, e.g. "html" or "attributes", if specified
 }
 
 func (n *CallParamContentNode) String() string {
+	if n.Kind != "" {
+		return fmt.Sprintf("{param %s kind=%q}%s{/param}", n.Key, n.Kind, n.Content.String())
+	}
 	return fmt.Sprintf("{param %s}%s{/param}", n.Key, n.Content.String())
 }
 
@@ -657,6 +717,18 @@ func (n *GlobalNode) String() string {
 	return n.Name
 }
 
+// ConstantNode is a call to a zero-argument function whose value was fixed
+// when the templates were compiled.  See parsepasses.FoldConstantFuncs.
+type ConstantNode struct {
+	Pos
+	Name string // the function name
+	data.Value
+}
+
+func (n *ConstantNode) String() string {
+	return n.Name + "()"
+}
+
 type FunctionNode struct {
 	Pos
 	Name string
@@ -850,6 +922,12 @@ type (
 	OrNode    struct{ BinaryOpNode }
 	AndNode   struct{ BinaryOpNode }
 	ElvisNode struct{ BinaryOpNode }
+
+	ShiftLeftNode  struct{ BinaryOpNode }
+	ShiftRightNode struct{ BinaryOpNode }
+	BitAndNode     struct{ BinaryOpNode }
+	BitOrNode      struct{ BinaryOpNode }
+	BitXorNode     struct{ BinaryOpNode }
 )
 
 type TernNode struct {
@@ -10,10 +10,12 @@ import (
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/robfig/soy/ast"
 	"github.com/robfig/soy/data"
 	"github.com/robfig/soy/parse"
 	"github.com/robfig/soy/parsepasses"
 	"github.com/robfig/soy/soyhtml"
+	"github.com/robfig/soy/soymsg"
 	"github.com/robfig/soy/template"
 )
 
@@ -28,15 +30,29 @@ type soyFile struct{ name, content string }
 type Bundle struct {
 	files                 []soyFile
 	globals               data.Map
+	constants             data.Map
+	denylist              []string
 	err                   error
 	watcher               *fsnotify.Watcher
 	parsepasses           []func(template.Registry) error
 	recompilationCallback func(*template.Registry)
+	callers               map[string]map[string]bool // callee => callers, when watching
+	lazy                  bool
+	stripAsserts          bool
+	renderOptions         soyhtml.Options
+	funcs                 map[string]soyhtml.Func
+	msgs                  soymsg.Bundle
+	maxArchiveSize        int64
+	maxArchiveFileSize    int64
 }
 
-// NewBundle returns an empty bundle.
-func NewBundle() *Bundle {
-	return &Bundle{globals: make(data.Map)}
+// NewBundle returns an empty bundle, configured by the given options.
+func NewBundle(opts ...Option) *Bundle {
+	var b = &Bundle{globals: make(data.Map), constants: make(data.Map)}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
 }
 
 // WatchFiles tells soy to watch any template files added to this bundle,
@@ -49,6 +65,29 @@ func (b *Bundle) WatchFiles(watch bool) *Bundle {
 	return b
 }
 
+// LazyParse tells soy to defer parsing each template file until one of its
+// templates is first rendered.  This reduces start-up time for bundles that are
+// large relative to the set of templates that are used.
+//
+// Since lazily parsed templates are not available when the bundle is compiled,
+// compilation does not apply parse passes to them or check their data
+// references, and syntax errors are reported (to the standard logger) only when
+// they are loaded.  Use Registry.Warmup to load and check templates ahead of
+// time.  Lazy parsing is disabled when watching files.
+func (b *Bundle) LazyParse(lazy bool) *Bundle {
+	b.lazy = lazy
+	return b
+}
+
+// StripAsserts tells soy to remove the {assert} commands from the templates
+// once their data references have been checked, so that production renders do
+// not pay for checks meant for development.  Lazily parsed templates are
+// stripped when they are first looked up (or warmed up).
+func (b *Bundle) StripAsserts(strip bool) *Bundle {
+	b.stripAsserts = strip
+	return b
+}
+
 // AddTemplateDir adds all *.soy files found within the given directory
 // (including sub-directories) to the bundle.
 func (b *Bundle) AddTemplateDir(root string) *Bundle {
@@ -119,6 +158,30 @@ func (b *Bundle) AddGlobalsMap(globals data.Map) *Bundle {
 	return b
 }
 
+// AddConstantFuncs adds zero-argument functions to the bundle whose values are
+// fixed when it is compiled, such as isDebug() or buildVersion().  Calls to
+// them are replaced by their values, so they may be used to vary the output by
+// environment without passing the values as params to every render.
+func (b *Bundle) AddConstantFuncs(funcs data.Map) *Bundle {
+	for k, v := range funcs {
+		if existing, ok := b.constants[k]; ok {
+			b.err = fmt.Errorf("constant function %q already defined as %q", k, existing)
+			return b
+		}
+		b.constants[k] = v
+	}
+	return b
+}
+
+// Deny makes the use of any of the named functions or print directives in the
+// bundle's templates a compile error.  For example, it may be used to prevent
+// nondeterministic functions such as randomInt from being used in templates
+// whose output is cached.
+func (b *Bundle) Deny(names ...string) *Bundle {
+	b.denylist = append(b.denylist, names...)
+	return b
+}
+
 // SetRecompilationCallback assigns the bundle a function to call after
 // recompilation.  This is called before updating the in-use registry.
 func (b *Bundle) SetRecompilationCallback(c func(*template.Registry)) *Bundle {
@@ -142,6 +205,48 @@ func (b *Bundle) Compile() (*template.Registry, error) {
 
 	// Compile all the soy (globals are already parsed)
 	var registry = template.Registry{}
+	if b.lazy && b.watcher == nil {
+		var globals, constants, denylist, stripAsserts = b.globals, b.constants, b.denylist, b.stripAsserts
+		registry.OnLoad(func(loaded template.Registry) error {
+			if err := parsepasses.CheckDenylist(loaded, denylist); err != nil {
+				return err
+			}
+			if err := parsepasses.FoldConstantFuncs(loaded, constants); err != nil {
+				return err
+			}
+			if err := parsepasses.SetGlobals(loaded, globals); err != nil {
+				return err
+			}
+			parsepasses.ProcessMessages(loaded)
+			return nil
+		})
+		registry.OnWarmup(func(reg template.Registry, names []string) error {
+			if err := parsepasses.CheckTemplateDataRefs(reg, names); err != nil {
+				return err
+			}
+			if err := parsepasses.CheckRecursion(reg); err != nil {
+				return err
+			}
+			if !stripAsserts {
+				return nil
+			}
+			// Strip only the checked templates, which are not yet in use.
+			var checked template.Registry
+			for _, name := range names {
+				if t, ok := reg.Template(name); ok {
+					checked.Templates = append(checked.Templates, t)
+				}
+			}
+			return parsepasses.StripAsserts(checked)
+		})
+		for _, soyfile := range b.files {
+			if err := registry.AddLazy(soyfile.name, soyfile.content); err != nil {
+				return nil, err
+			}
+		}
+		return &registry, nil
+	}
+
 	for _, soyfile := range b.files {
 		var tree, err = parse.SoyFile(soyfile.name, soyfile.content)
 		if err != nil {
@@ -153,6 +258,12 @@ func (b *Bundle) Compile() (*template.Registry, error) {
 	}
 
 	// Apply the post-parse processing
+	if err := parsepasses.CheckDenylist(registry, b.denylist); err != nil {
+		return nil, err
+	}
+	if err := parsepasses.FoldConstantFuncs(registry, b.constants); err != nil {
+		return nil, err
+	}
 	for _, parsepass := range b.parsepasses {
 		if err := parsepass(registry); err != nil {
 			return nil, err
@@ -161,12 +272,21 @@ func (b *Bundle) Compile() (*template.Registry, error) {
 	if err := parsepasses.CheckDataRefs(registry); err != nil {
 		return nil, err
 	}
+	if err := parsepasses.CheckRecursion(registry); err != nil {
+		return nil, err
+	}
+	if b.stripAsserts {
+		if err := parsepasses.StripAsserts(registry); err != nil {
+			return nil, err
+		}
+	}
 	if err := parsepasses.SetGlobals(registry, b.globals); err != nil {
 		return nil, err
 	}
 	parsepasses.ProcessMessages(registry)
 
 	if b.watcher != nil {
+		b.indexCalls(registry)
 		go b.recompiler(&registry)
 	}
 	return &registry, nil
@@ -177,7 +297,10 @@ func (b *Bundle) Compile() (*template.Registry, error) {
 func (b *Bundle) CompileToTofu() (*soyhtml.Tofu, error) {
 	var registry, err = b.Compile()
 	// TODO: Verify all used funcs exist and have the right # args.
-	return soyhtml.NewTofu(registry), err
+	return soyhtml.NewTofu(registry).
+		WithOptions(b.renderOptions).
+		WithFuncs(b.funcs).
+		WithMessages(b.msgs), err
 }
 
 func (b *Bundle) recompiler(reg *template.Registry) {
@@ -193,13 +316,9 @@ func (b *Bundle) recompiler(reg *template.Registry) {
 				}
 			}
 
-			// Recompile all the soy.
-			var bundle = NewBundle().
-				AddGlobalsMap(b.globals)
-			for _, soyfile := range b.files {
-				bundle.AddTemplateFile(soyfile.name)
-			}
-			var registry, err = bundle.Compile()
+			// Recompile the changed file, or all the soy if it is not known.
+			var start = time.Now()
+			var registry, err = b.reload(reg, ev.Name)
 			if err != nil {
 				Logger.Println(err)
 				continue
@@ -213,7 +332,7 @@ func (b *Bundle) recompiler(reg *template.Registry) {
 			// (this is not goroutine-safe, but that seems ok for a development aid,
 			// as long as it works in practice)
 			*reg = *registry
-			Logger.Printf("update successful (%v)", ev)
+			Logger.Printf("update successful (%v) in %v", ev, time.Since(start))
 
 		case err := <-b.watcher.Errors:
 			// Nothing to do with errors
@@ -221,3 +340,148 @@ func (b *Bundle) recompiler(reg *template.Registry) {
 		}
 	}
 }
+
+// reload returns a new registry reflecting the current content of the given
+// file.  Only that file is re-parsed, and only its templates and their direct
+// callers are re-checked.  If the file is not part of the bundle, the entire
+// bundle is recompiled.
+func (b *Bundle) reload(reg *template.Registry, filename string) (*template.Registry, error) {
+	var index = -1
+	for i, soyfile := range b.files {
+		if soyfile.name == filename {
+			index = i
+		}
+	}
+	if index == -1 {
+		return b.recompile()
+	}
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := parse.SoyFile(filename, string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	// Replace the file in a copy of the registry.
+	var registry = *reg
+	var oldTree = registry.Remove(filename)
+	var numTemplates = len(registry.Templates)
+	if err = registry.Add(tree); err != nil {
+		return nil, err
+	}
+	var added = template.Registry{Templates: registry.Templates[numTemplates:]}
+	if err = parsepasses.CheckDenylist(registry, b.denylist); err != nil {
+		return nil, err
+	}
+	if err = parsepasses.FoldConstantFuncs(added, b.constants); err != nil {
+		return nil, err
+	}
+
+	// Find the affected templates: those in the file, and the callers of any
+	// template that was in the file before or after the change.
+	var oldNames, newNames []string
+	if oldTree != nil {
+		for _, node := range oldTree.Body {
+			if tn, ok := node.(*ast.TemplateNode); ok {
+				oldNames = append(oldNames, tn.Name)
+			}
+		}
+	}
+	for _, t := range added.Templates {
+		newNames = append(newNames, t.Node.Name)
+	}
+	var affected = make(map[string]bool)
+	for _, name := range newNames {
+		affected[name] = true
+	}
+	for _, name := range append(oldNames, newNames...) {
+		for caller := range b.callers[name] {
+			if _, ok := registry.Template(caller); ok {
+				affected[caller] = true
+			}
+		}
+	}
+	var affectedNames []string
+	for name := range affected {
+		affectedNames = append(affectedNames, name)
+	}
+
+	for _, parsepass := range b.parsepasses {
+		if err := parsepass(registry); err != nil {
+			return nil, err
+		}
+	}
+	if err := parsepasses.CheckTemplateDataRefs(registry, affectedNames); err != nil {
+		return nil, err
+	}
+	if err := parsepasses.CheckRecursion(registry); err != nil {
+		return nil, err
+	}
+	if b.stripAsserts {
+		if err := parsepasses.StripAsserts(added); err != nil {
+			return nil, err
+		}
+	}
+	if err := parsepasses.SetGlobals(added, b.globals); err != nil {
+		return nil, err
+	}
+	parsepasses.ProcessMessages(added)
+
+	// Success: record the new content and call graph.
+	b.files[index].content = string(content)
+	for _, name := range oldNames {
+		b.removeCalls(name)
+	}
+	for _, t := range added.Templates {
+		b.addCalls(t.Node.Name, parsepasses.Callees(t.Node))
+	}
+	return &registry, nil
+}
+
+// recompile compiles the current content of all of the files in the bundle.
+func (b *Bundle) recompile() (*template.Registry, error) {
+	var bundle = NewBundle().
+		AddGlobalsMap(b.globals).
+		AddConstantFuncs(b.constants)
+	bundle.parsepasses = b.parsepasses
+	bundle.denylist = b.denylist
+	bundle.stripAsserts = b.stripAsserts
+	for _, soyfile := range b.files {
+		bundle.AddTemplateFile(soyfile.name)
+	}
+	var registry, err = bundle.Compile()
+	if err != nil {
+		return nil, err
+	}
+	b.files = bundle.files
+	b.indexCalls(*registry)
+	return registry, nil
+}
+
+// indexCalls records the callers of each template in the registry.
+func (b *Bundle) indexCalls(reg template.Registry) {
+	b.callers = make(map[string]map[string]bool)
+	for caller, callees := range parsepasses.CallGraph(reg) {
+		b.addCalls(caller, callees)
+	}
+}
+
+// addCalls records that the caller calls each of the callees.
+func (b *Bundle) addCalls(caller string, callees []string) {
+	for _, callee := range callees {
+		if b.callers[callee] == nil {
+			b.callers[callee] = make(map[string]bool)
+		}
+		b.callers[callee][caller] = true
+	}
+}
+
+// removeCalls removes all calls made by the given caller.
+func (b *Bundle) removeCalls(caller string) {
+	for _, callers := range b.callers {
+		delete(callers, caller)
+	}
+}
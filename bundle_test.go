@@ -0,0 +1,344 @@
+package soy
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/errortypes"
+	"github.com/robfig/soy/soyhtml"
+	"github.com/robfig/soy/template"
+)
+
+func TestReload(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "soy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		pageFile   = filepath.Join(dir, "page.soy")
+		widgetFile = filepath.Join(dir, "widget.soy")
+	)
+	var write = func(filename, content string) {
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(pageFile, `{namespace page}
+/** @param name */
+{template .page}{call widget.hello data="all"/}{/template}`)
+	write(widgetFile, `{namespace widget}
+/** @param name */
+{template .hello}Hello {$name}{/template}`)
+
+	var bundle = NewBundle().
+		AddTemplateFile(pageFile).
+		AddTemplateFile(widgetFile)
+	registry, err := bundle.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle.indexCalls(*registry)
+
+	// A compatible change is picked up, and the old registry is unaffected.
+	write(widgetFile, `{namespace widget}
+/** @param name */
+{template .hello}Goodbye {$name}{/template}`)
+	updated, err := bundle.reload(registry, widgetFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = soyhtml.NewTofu(updated).Render(&buf, "page.page", map[string]string{"name": "Rob"}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "Goodbye Rob" {
+		t.Errorf("expected %q, got %q", "Goodbye Rob", buf.String())
+	}
+	if len(registry.Templates) != 2 || len(updated.Templates) != 2 {
+		t.Errorf("expected 2 templates, got %d and %d", len(registry.Templates), len(updated.Templates))
+	}
+
+	// A change that breaks a caller in another file is caught.
+	write(widgetFile, `{namespace widget}
+/** @param name @param required */
+{template .hello}Goodbye {$name}{$required}{/template}`)
+	if _, err = bundle.reload(updated, widgetFile); err == nil {
+		t.Error("expected an error for the missing required param in page.page")
+	}
+
+	// Removing the called template is caught too.
+	write(widgetFile, `{namespace widget}
+{template .renamed}{/template}`)
+	if _, err = bundle.reload(updated, widgetFile); err == nil {
+		t.Error("expected an error for the missing template widget.hello")
+	}
+}
+
+func TestLazyParse(t *testing.T) {
+	var registry, err = NewBundle().
+		LazyParse(true).
+		AddGlobalsMap(data.Map{"app.name": data.String("Soy")}).
+		AddTemplateString("page.soy", `{namespace page}
+/** @param name */
+{template .page}{call widget.hello data="all"/}{/template}`).
+		AddTemplateString("widget.soy", `{namespace widget}
+/** @param name */
+{template .hello}{msg desc=""}Hello {$name}{/msg} from {app.name}{/template}`).
+		AddTemplateString("broken.soy", `{namespace broken}
+{template .broken}{if}{/template}`).
+		AddTemplateString("unchecked.soy", `{namespace unchecked}
+{template .unchecked}{$undeclared}{/template}`).
+		AddTemplateString("caller.soy", `{namespace caller}
+{template .caller}{call broken.broken/}{/template}`).
+		Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(registry.Templates) != 0 {
+		t.Errorf("expected no templates to be parsed, got %d", len(registry.Templates))
+	}
+	if registry.Filename("widget.hello") != "widget.soy" {
+		t.Errorf("expected widget.soy, got %q", registry.Filename("widget.hello"))
+	}
+
+	var buf bytes.Buffer
+	if err = soyhtml.NewTofu(registry).Render(&buf, "page.page", map[string]string{"name": "Rob"}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "Hello Rob from Soy" {
+		t.Errorf("expected %q, got %q", "Hello Rob from Soy", buf.String())
+	}
+
+	// The broken file is only reported when it is used, and its error (or
+	// that of the check of a file that calls it) is returned rather than the
+	// template being rendered by the fallback for templates that are not found.
+	if _, ok := registry.Template("broken.broken"); ok {
+		t.Error("expected broken.broken to fail to load")
+	}
+	var tofu = soyhtml.NewTofu(registry).WithFallback(func(string) (*soyhtml.Tofu, string, bool) {
+		return soyhtml.NewTofu(registry), "page.page", true
+	})
+	var failures = []struct {
+		name string
+		kind error
+	}{
+		{"broken.broken", errortypes.ErrParse},
+		{"caller.caller", errortypes.ErrType},
+		{"unchecked.unchecked", errortypes.ErrType},
+	}
+	for _, test := range failures {
+		buf.Reset()
+		err = tofu.Render(&buf, test.name, map[string]string{"name": "Rob"})
+		if !errors.Is(err, test.kind) || buf.Len() > 0 {
+			t.Errorf("%s: expected a %v, got %v", test.name, test.kind, err)
+		}
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	var newRegistry = func(widget string) *template.Registry {
+		var registry, err = NewBundle().
+			LazyParse(true).
+			AddTemplateString("page.soy", `{namespace page}
+/** @param name */
+{template .page}{call widget.hello data="all"/}{/template}`).
+			AddTemplateString("widget.soy", widget).
+			AddTemplateString("other.soy", `{namespace other}
+{template .other}{/template}`).
+			Compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return registry
+	}
+
+	var registry = newRegistry(`{namespace widget}
+/** @param name */
+{template .hello}Hello {$name}{/template}`)
+	if err := registry.Warmup("page.page"); err != nil {
+		t.Fatal(err)
+	}
+	if len(registry.Templates) != 1 || registry.Templates[0].Node.Name != "page.page" {
+		t.Errorf("expected page.page to be loaded, got %v", registry.Templates)
+	}
+	if err := registry.Warmup(); err != nil {
+		t.Fatal(err)
+	}
+	if len(registry.Templates) != 3 {
+		t.Errorf("expected 3 templates, got %d", len(registry.Templates))
+	}
+	if err := registry.Warmup("page.missing"); err == nil {
+		t.Error("expected an error for a missing template")
+	}
+
+	// Warmup checks the data references of the loaded templates.
+	registry = newRegistry(`{namespace widget}
+/** @param name @param required */
+{template .hello}Hello {$name}{$required}{/template}`)
+	if err := registry.Warmup(); err == nil {
+		t.Error("expected an error for the missing required param in page.page")
+	}
+	if len(registry.Templates) != 0 {
+		t.Errorf("expected the registry to be unchanged, got %d templates", len(registry.Templates))
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	var tofu, err = NewBundle().
+		Configure(Prod).
+		AddTemplateString("hello.soy", `{namespace hello}
+/** @param? name */
+{template .hello}Hello {$name}!{/template}`).
+		CompileToTofu()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = tofu.Render(&buf, "hello.hello", nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "Hello !" {
+		t.Errorf("expected %q, got %q", "Hello !", buf.String())
+	}
+}
+
+func TestStripAsserts(t *testing.T) {
+	for _, lazy := range []bool{false, true} {
+		var tofu, err = NewBundle().
+			LazyParse(lazy).
+			StripAsserts(true).
+			AddTemplateString("checks.soy", `{namespace checks}
+/**
+ * @param id
+ * @param checked
+ */
+{template .page}{assert $id > 0, "id must be positive"}{assert $checked, "unchecked"}{$id}{/template}`).
+			CompileToTofu()
+		if err != nil {
+			t.Fatalf("lazy=%v: %v", lazy, err)
+		}
+		var buf bytes.Buffer
+		if err = tofu.Render(&buf, "checks.page", data.Map{"id": data.Int(0)}); err != nil {
+			t.Errorf("lazy=%v: expected the asserts to be stripped, got %v", lazy, err)
+		}
+		if buf.String() != "0" {
+			t.Errorf("lazy=%v: expected %q, got %q", lazy, "0", buf.String())
+		}
+	}
+}
+
+func TestBundleOptions(t *testing.T) {
+	var tofu, err = NewBundle(
+		WithGlobals(data.Map{"app.name": data.String("Soy")}),
+		WithFuncs(map[string]soyhtml.Func{
+			"shout": {func(args []data.Value) data.Value {
+				return data.String(strings.ToUpper(args[0].String()))
+			}, []int{1}},
+		})).
+		AddTemplateString("hello.soy", `{namespace hello}
+{template .hello}{shout(app.name)}{/template}`).
+		CompileToTofu()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = tofu.Render(&buf, "hello.hello", nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "SOY" {
+		t.Errorf("expected %q, got %q", "SOY", buf.String())
+	}
+	if _, ok := soyhtml.Funcs["shout"]; ok {
+		t.Error("expected the function to be local to the bundle")
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	var compile = func(soy string) (*soyhtml.Tofu, error) {
+		return NewBundle().
+			AddTemplateString("test.soy", "{namespace test}\n"+soy).
+			CompileToTofu()
+	}
+	var tests = []struct {
+		name string
+		soy  string
+		kind error
+	}{
+		{"parse", `{template .a}{if}{/template}`, errortypes.ErrParse},
+		{"type", `{template .a}{$undeclared}{/template}`, errortypes.ErrType},
+		{"missing call param", `{template .a}{call .b/}{/template}
+/** @param x */
+{template .b}{$x}{/template}`, errortypes.ErrMissingParam},
+		{"missing callee", `{template .a}{call .b/}{/template}`, errortypes.ErrTemplateNotFound},
+	}
+	for _, test := range tests {
+		var _, err = compile(test.soy)
+		if !errors.Is(err, test.kind) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.kind, err)
+		}
+	}
+
+	var tofu, err = compile(`{template .a}{call .b data="all"/}{/template}
+/** @param? x */
+{template .b}{$x}{/template}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tofu.Render(ioutil.Discard, "test.a", nil)
+	if !errors.Is(err, errortypes.ErrRender) || !errors.Is(err, errortypes.ErrMissingParam) {
+		t.Errorf("expected a render error for a missing param, got %v", err)
+	}
+	err = tofu.Render(ioutil.Discard, "test.missing", nil)
+	if !errors.Is(err, errortypes.ErrTemplateNotFound) || err != soyhtml.ErrTemplateNotFound {
+		t.Errorf("expected template not found, got %v", err)
+	}
+}
+
+func TestConstantFuncs(t *testing.T) {
+	var tofu, err = NewBundle(
+		WithConstantFuncs(data.Map{"isDebug": data.Bool(false), "buildVersion": data.String("1.2")})).
+		AddTemplateString("page.soy", `{namespace page}
+{template .page}{if isDebug()}<pre>debug</pre>{/if}v{buildVersion()}{/template}`).
+		CompileToTofu()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = tofu.Render(&buf, "page.page", nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "v1.2" {
+		t.Errorf("expected %q, got %q", "v1.2", buf.String())
+	}
+}
+
+func TestDenylist(t *testing.T) {
+	var bundle = func(opts ...Option) *Bundle {
+		return NewBundle(opts...).
+			AddTemplateString("page.soy", `{namespace page}
+{template .page}{randomInt(10)}{/template}`)
+	}
+	if _, err := bundle().Compile(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bundle(WithDenylist("randomInt")).Compile(); err == nil {
+		t.Error("expected an error for the denied function")
+	}
+
+	// Lazily parsed templates are checked when they are loaded.
+	registry, err := bundle(WithDenylist("randomInt")).LazyParse(true).Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = registry.Warmup(); err == nil || !strings.Contains(err.Error(), "page.soy:2:") {
+		t.Errorf("expected an error with the position of the denied function, got %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Command soy provides tools for working with soy templates.
+
+Usage:
+
+	soy expr [-data file.json] [expression ...]
+	soy serve [-addr host:port] [-examples dir] [-generate n] file.soy|dir ...
+	soy metrics file.soy|dir ...
+
+The expr command evaluates soy expressions with the same evaluator used to
+render templates, against the data in the given JSON file (available as
+$variables).  It is useful for answering questions about operator precedence
+and the handling of null and undefined values.  The expressions given as
+arguments are evaluated in turn; if there are none, expressions are read from
+standard input, one per line, like so:
+
+	$ echo '{"user": {"name": "Rob"}}' > data.json
+	$ soy expr -data data.json
+	> $user.name + '!'
+	Rob! (string)
+	> $user.age ?: 'unknown'
+	unknown (string)
+	> 1 + 2 * 3
+	7 (int)
+
+The serve command runs a playground for the templates in the given files and
+directories (default address localhost:9812).  It lists the templates, and
+renders the selected one with the JSON data entered in the page, as it is
+edited.  The templates are recompiled as their files change, and the page
+re-renders the output when they are.  Given a directory of examples (see
+package soycatalog), it also serves a catalog of them at /catalog/.  The
+catalog may also show n examples of each template with data generated from the
+way that it uses its params.
+
+The metrics command prints the size and complexity of each template in the
+given files and directories (see package soylint), marking with a * the values
+that exceed the limits of its complexity rules.
+*/
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/parse"
+	"github.com/robfig/soy/soyhtml"
+)
+
+func main() {
+	var err error
+	switch {
+	case len(os.Args) >= 2 && os.Args[1] == "expr":
+		err = expr(os.Args[2:], os.Stdin, os.Stdout)
+	case len(os.Args) >= 2 && os.Args[1] == "serve":
+		err = serve(os.Args[2:])
+	case len(os.Args) >= 2 && os.Args[1] == "metrics":
+		err = metrics(os.Args[2:], os.Stdout)
+	default:
+		fmt.Fprintln(os.Stderr, "usage:")
+		fmt.Fprintln(os.Stderr, "  soy expr [-data file.json] [expression ...]")
+		fmt.Fprintln(os.Stderr, "  soy serve [-addr host:port] [-examples dir] [-generate n] file.soy|dir ...")
+		fmt.Fprintln(os.Stderr, "  soy metrics file.soy|dir ...")
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// expr runs the expr command with the given arguments.
+func expr(args []string, in io.Reader, out io.Writer) error {
+	var flags = flag.NewFlagSet("expr", flag.ContinueOnError)
+	var dataFile = flags.String("data", "", "JSON file containing the data")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var vars = make(data.Map)
+	if *dataFile != "" {
+		var buf, err = ioutil.ReadFile(*dataFile)
+		if err != nil {
+			return err
+		}
+		if vars, err = parseData(buf); err != nil {
+			return fmt.Errorf("%s: %v", *dataFile, err)
+		}
+	}
+
+	if flags.NArg() > 0 {
+		for _, arg := range flags.Args() {
+			fmt.Fprintln(out, eval(arg, vars))
+		}
+		return nil
+	}
+
+	var scanner = bufio.NewScanner(in)
+	for fmt.Fprint(out, "> "); scanner.Scan(); fmt.Fprint(out, "> ") {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			fmt.Fprintln(out, eval(line, vars))
+		}
+	}
+	fmt.Fprintln(out)
+	return scanner.Err()
+}
+
+// parseData returns the data in the given JSON object.
+func parseData(buf []byte) (data.Map, error) {
+	var val, err = data.TryNew(json.RawMessage(buf))
+	if err != nil {
+		return nil, err
+	}
+	var m, ok = val.(data.Map)
+	if !ok {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+	return m, nil
+}
+
+// eval evaluates the given expression and describes the result.
+func eval(expr string, vars data.Map) string {
+	var node, err = parse.Expr(expr)
+	if err != nil {
+		return "parse error: " + err.Error()
+	}
+	val, err := soyhtml.EvalExprData(node, vars)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return describe(val)
+}
+
+// describe returns the value along with its type.
+func describe(val data.Value) string {
+	switch val := val.(type) {
+	case data.Undefined:
+		return "undefined"
+	case data.Null:
+		return "null"
+	case data.Bool:
+		return fmt.Sprintf("%v (bool)", val)
+	case data.Int:
+		return fmt.Sprintf("%v (int)", val)
+	case data.Float:
+		return fmt.Sprintf("%v (float)", val)
+	case data.String:
+		return fmt.Sprintf("%v (string)", val)
+	case data.List:
+		return fmt.Sprintf("%v (list)", val)
+	case data.Map, *data.OrderedMap:
+		return fmt.Sprintf("%v (map)", val)
+	}
+	return fmt.Sprintf("%v (%T)", val, val)
+}
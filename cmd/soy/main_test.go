@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpr(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "soyexpr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var dataFile = filepath.Join(dir, "data.json")
+	err = ioutil.WriteFile(dataFile, []byte(`{"user": {"name": "Rob", "age": null}, "n": 2}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var in = strings.NewReader(`$user.name + '!'
+
+$user.age ?: 'unknown'
+$user.age
+$missing
+1 + 2 * 3
+$n / 4
+[1, 'a']
+1 +
+$user.age.x
+`)
+	var out bytes.Buffer
+	if err = expr([]string{"-data", dataFile}, in, &out); err != nil {
+		t.Fatal(err)
+	}
+	var lines = strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	var expected = []string{
+		"> Rob! (string)",
+		"> > unknown (string)",
+		"> null",
+		"> undefined",
+		"> 7 (int)",
+		"> 0.5 (float)",
+		"> [1, a] (list)",
+		"> parse error: ",
+		"> error: ",
+		"> ",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got:\n%s", len(expected), out.String())
+	}
+	for i := range expected {
+		if !strings.HasPrefix(lines[i], expected[i]) {
+			t.Errorf("line %d: expected %q, got %q", i, expected[i], lines[i])
+		}
+	}
+}
+
+func TestExprArgs(t *testing.T) {
+	var out bytes.Buffer
+	if err := expr([]string{"null ?: 1", "'a' + 1"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "1 (int)\na1 (string)\n"; out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "soymetrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "a.soy"), []byte(`{namespace a}
+/** @param x */
+{template .t}{if $x}{call .u /}{/if}{/template}
+{template .u}{/template}
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err = metrics([]string{dir}, &out); err != nil {
+		t.Fatal(err)
+	}
+	var expected = `template  nodes  nesting  params  calls  expr
+a.t       6      1        1       1      1
+a.u       1      0        0       0      0
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	if err = metrics(nil, &out); err == nil {
+		t.Error("expected a usage error")
+	}
+}
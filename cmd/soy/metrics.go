@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/robfig/soy"
+	"github.com/robfig/soy/soylint"
+)
+
+// metrics runs the metrics command with the given arguments.
+func metrics(args []string, out io.Writer) error {
+	var flags = flag.NewFlagSet("metrics", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: soy metrics file.soy|dir ...")
+	}
+	var bundle = soy.NewBundle()
+	if err := addPaths(bundle, flags.Args()); err != nil {
+		return err
+	}
+	var registry, err = bundle.Compile()
+	if err != nil {
+		return err
+	}
+
+	var limits = soylint.DefaultLimits
+	var w = tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "template\tnodes\tnesting\tparams\tcalls\texpr")
+	for _, m := range soylint.Measure(*registry) {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			m.Template,
+			metric(m.Nodes, limits.Nodes),
+			metric(m.Nesting, limits.Nesting),
+			metric(m.Params, limits.Params),
+			metric(m.Calls, limits.Calls),
+			metric(m.Expr, limits.Expr))
+	}
+	return w.Flush()
+}
+
+// metric formats the value of a metric, marked with a * if it exceeds the
+// given limit.
+func metric(value, limit int) string {
+	if limit > 0 && value > limit {
+		return fmt.Sprintf("*%d", value)
+	}
+	return fmt.Sprint(value)
+}
+
+// addPaths adds the given soy files, and the soy files within the given
+// directories, to the bundle.
+func addPaths(bundle *soy.Bundle, paths []string) error {
+	for _, path := range paths {
+		var info, err = os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			bundle.AddTemplateDir(path)
+		} else {
+			bundle.AddTemplateFile(path)
+		}
+	}
+	return nil
+}
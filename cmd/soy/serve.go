@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/robfig/soy"
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/soycatalog"
+	"github.com/robfig/soy/soyhtml"
+	"github.com/robfig/soy/template"
+)
+
+// serve runs the serve command with the given arguments.
+func serve(args []string) error {
+	var flags = flag.NewFlagSet("serve", flag.ContinueOnError)
+	var addr = flags.String("addr", "localhost:9812", "address on which to listen")
+	var examples = flags.String("examples", "", "directory of template examples to serve as a catalog at /catalog/")
+	var generate = flags.Int("generate", 0, "number of examples to generate for each template in the catalog")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: soy serve [-addr host:port] [-examples dir] [-generate n] file.soy|dir ...")
+	}
+	var srv, err = newServer(flags.Args(), *examples, *generate)
+	if err != nil {
+		return err
+	}
+	var registry, _, _ = srv.current()
+	log.Printf("serving %d templates on http://%s", len(registry.Templates), *addr)
+	return http.ListenAndServe(*addr, srv)
+}
+
+// server is the template playground served by the serve command.  Its
+// templates are recompiled as their files change, and each successful
+// recompilation increments its version, which the page polls to reload.
+type server struct {
+	mux *http.ServeMux
+
+	mu       sync.RWMutex
+	registry *template.Registry
+	tofu     *soyhtml.Tofu
+	version  int
+}
+
+// newServer compiles the given soy files, and the soy files within the given
+// directories, and returns a server for them.  If examplesDir is not empty, the
+// server also serves a catalog of the examples within it, along with the given
+// number of examples generated for each template.
+func newServer(paths []string, examplesDir string, generate int) (*server, error) {
+	var srv = &server{mux: http.NewServeMux()}
+	var bundle = soy.NewBundle().
+		WatchFiles(true).
+		SetRecompilationCallback(srv.update)
+	if err := addPaths(bundle, paths); err != nil {
+		return nil, err
+	}
+	var registry, err = bundle.Compile()
+	if err != nil {
+		return nil, err
+	}
+	srv.mu.Lock()
+	if srv.registry == nil { // unless already recompiled
+		srv.registry, srv.tofu = registry, soyhtml.NewTofu(registry)
+	}
+	srv.mu.Unlock()
+
+	srv.mux.HandleFunc("/", srv.index)
+	srv.mux.HandleFunc("/templates", srv.templates)
+	srv.mux.HandleFunc("/render", srv.render)
+	srv.mux.HandleFunc("/version", srv.currentVersion)
+	if examplesDir != "" || generate > 0 {
+		srv.mux.Handle("/catalog/", srv.catalog(examplesDir, generate))
+	}
+	return srv, nil
+}
+
+// update replaces the templates with those recompiled.
+func (srv *server) update(registry *template.Registry) {
+	srv.mu.Lock()
+	srv.registry = registry
+	srv.tofu = soyhtml.NewTofu(registry)
+	srv.version++
+	srv.mu.Unlock()
+}
+
+// current returns the templates.
+func (srv *server) current() (*template.Registry, *soyhtml.Tofu, int) {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	return srv.registry, srv.tofu, srv.version
+}
+
+func (srv *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.mux.ServeHTTP(w, r)
+}
+
+// index serves the playground page.
+func (srv *server) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, playground)
+}
+
+// templates serves the schema of the templates, as JSON.
+func (srv *server) templates(w http.ResponseWriter, r *http.Request) {
+	var registry, _, _ = srv.current()
+	w.Header().Set("Content-Type", "application/json")
+	registry.WriteSchema(w)
+}
+
+// render renders the template named by the "template" query parameter with
+// the JSON object in the request body, if any.
+func (srv *server) render(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var params = make(data.Map)
+	if len(bytes.TrimSpace(body)) > 0 {
+		if params, err = parseData(body); err != nil {
+			http.Error(w, "invalid data: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var _, tofu, _ = srv.current()
+	var buf bytes.Buffer
+	if err = tofu.Render(&buf, r.URL.Query().Get("template"), params); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// catalog returns a handler that serves a catalog of the examples in the
+// given directory, if any, and of those generated for each template.  The
+// examples are reloaded, and regenerated, for each request.
+func (srv *server) catalog(examplesDir string, generate int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var registry, tofu, _ = srv.current()
+		var examples []soycatalog.Example
+		if examplesDir != "" {
+			var err error
+			if examples, err = soycatalog.LoadExamples(examplesDir); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		if generate > 0 {
+			var generated, err = soycatalog.NewGenerator(*registry, 1).Examples(generate)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			examples = append(examples, generated...)
+		}
+		soycatalog.New(tofu, examples).ServeHTTP(w, r)
+	})
+}
+
+// currentVersion serves the number of times the templates were recompiled.
+func (srv *server) currentVersion(w http.ResponseWriter, r *http.Request) {
+	var _, _, version = srv.current()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(version)
+}
+
+// playground is the page served at the root, which lists the templates and
+// renders the selected one with the data entered, as it is edited and as the
+// templates are recompiled.
+const playground = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>soy serve</title>
+<style>
+  body { margin: 0; font-family: sans-serif; display: flex; height: 100vh; }
+  #controls { width: 30em; padding: 1em; display: flex; flex-direction: column; gap: 0.5em; border-right: 1px solid #ccc; }
+  #data { flex: 1; font-family: monospace; }
+  #error { color: #b00; white-space: pre-wrap; font-family: monospace; }
+  #output { flex: 1; border: none; }
+</style>
+</head>
+<body>
+<div id="controls">
+  <select id="template"></select>
+  <textarea id="data" spellcheck="false">{}</textarea>
+  <div id="error"></div>
+</div>
+<iframe id="output"></iframe>
+<script>
+var templates = document.getElementById('template');
+var dataInput = document.getElementById('data');
+var errorDiv = document.getElementById('error');
+var output = document.getElementById('output');
+var saved = {};
+var version = null;
+
+function loadTemplates() {
+  return fetch('templates').then(function(r) { return r.json(); }).then(function(schema) {
+    var selected = templates.value || location.hash.slice(1);
+    templates.innerHTML = '';
+    schema.templates.forEach(function(t) {
+      var option = document.createElement('option');
+      option.value = option.textContent = t.name;
+      option.dataset.params = JSON.stringify(t.params.map(function(p) { return p.name; }));
+      templates.appendChild(option);
+    });
+    if (selected) templates.value = selected;
+  });
+}
+
+function selectTemplate() {
+  var name = templates.value;
+  location.hash = name;
+  if (!saved[name]) {
+    var example = {};
+    JSON.parse(templates.selectedOptions[0].dataset.params).forEach(function(p) { example[p] = null; });
+    saved[name] = JSON.stringify(example, null, 2);
+  }
+  dataInput.value = saved[name];
+  render();
+}
+
+function render() {
+  saved[templates.value] = dataInput.value;
+  fetch('render?template=' + encodeURIComponent(templates.value), {method: 'POST', body: dataInput.value})
+    .then(function(r) { return r.text().then(function(text) { return {ok: r.ok, text: text}; }); })
+    .then(function(result) {
+      errorDiv.textContent = result.ok ? '' : result.text;
+      if (result.ok) output.srcdoc = result.text;
+    });
+}
+
+function poll() {
+  fetch('version').then(function(r) { return r.json(); }).then(function(v) {
+    if (version !== null && v !== version) loadTemplates().then(render);
+    version = v;
+  }).finally(function() { setTimeout(poll, 1000); });
+}
+
+var timer;
+dataInput.addEventListener('input', function() { clearTimeout(timer); timer = setTimeout(render, 300); });
+templates.addEventListener('change', selectTemplate);
+loadTemplates().then(selectTemplate).then(poll);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServe(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "soyserve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var filename = filepath.Join(dir, "hello.soy")
+	var write = func(greeting string) {
+		var soy = `{namespace test}
+/** @param name */
+{template .hello}` + greeting + `, {$name}!{/template}`
+		if err := ioutil.WriteFile(filename, []byte(soy), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("Hello")
+
+	srv, err := newServer([]string{dir}, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var request = func(method, url, body string) (int, string) {
+		var w = httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w.Code, w.Body.String()
+	}
+
+	var tests = []struct {
+		method, url, body string
+		code              int
+		contains          string
+	}{
+		{"GET", "/", "", http.StatusOK, "<title>soy serve</title>"},
+		{"GET", "/missing", "", http.StatusNotFound, ""},
+		{"GET", "/templates", "", http.StatusOK, `"name": "test.hello"`},
+		{"GET", "/version", "", http.StatusOK, "0"},
+		{"POST", "/render?template=test.hello", `{"name": "Rob"}`, http.StatusOK, "Hello, Rob!"},
+		{"POST", "/render?template=test.hello", `[1]`, http.StatusBadRequest, "invalid data"},
+		{"POST", "/render?template=test.missing", ``, http.StatusUnprocessableEntity, "not found"},
+		{"GET", "/render?template=test.hello", ``, http.StatusMethodNotAllowed, ""},
+	}
+	for _, test := range tests {
+		var code, body = request(test.method, test.url, test.body)
+		if code != test.code || !strings.Contains(body, test.contains) {
+			t.Errorf("%s %s: expected %d containing %q, got %d: %s",
+				test.method, test.url, test.code, test.contains, code, body)
+		}
+	}
+
+	// Changing the file recompiles the templates.
+	write("Goodbye")
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if _, body := request("GET", "/version", ""); body != "0\n" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, body := request("POST", "/render?template=test.hello", `{"name": "Rob"}`); body != "Goodbye, Rob!" {
+		t.Errorf("expected the recompiled template, got %q", body)
+	}
+}
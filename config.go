@@ -0,0 +1,52 @@
+package soy
+
+import "github.com/robfig/soy/soyhtml"
+
+// RenderConfig groups the settings that typically differ between development
+// and production, so that they may be selected together.  Use one of the
+// presets, Dev or Prod, modified as necessary.
+type RenderConfig struct {
+	WatchFiles   bool            // recompile templates when their files change
+	LazyParse    bool            // parse template files on first use
+	StripAsserts bool            // remove {assert} commands once templates are checked
+	Render       soyhtml.Options // options for rendering templates
+}
+
+var (
+	// Dev fails renders that print undefined data, reports the template source
+	// around render errors, checks that the output of RenderJSON is valid JSON,
+	// and reloads templates as they are edited.
+	Dev = RenderConfig{
+		WatchFiles: true,
+		Render: soyhtml.Options{
+			DetailedErrors: true,
+			ValidateJSON:   true,
+		},
+	}
+
+	// Prod renders undefined data as the empty string, renders into pooled
+	// buffers (so that failed renders produce no output), caches template
+	// lookups, and strips {assert} commands.
+	Prod = RenderConfig{
+		StripAsserts: true,
+		Render: soyhtml.Options{
+			LenientData:    true,
+			PoolBuffers:    true,
+			CacheTemplates: true,
+		},
+	}
+)
+
+// Configure applies the given configuration to the bundle.  Like WatchFiles,
+// it should be called once, before adding any files.  The render options are
+// used by the Tofu returned from CompileToTofu.
+func (b *Bundle) Configure(config RenderConfig) *Bundle {
+	b.renderOptions = config.Render
+	if config.WatchFiles {
+		// Template lookups can not be cached while the registry may change.
+		b.renderOptions.CacheTemplates = false
+	}
+	return b.WatchFiles(config.WatchFiles).
+		LazyParse(config.LazyParse).
+		StripAsserts(config.StripAsserts)
+}
@@ -0,0 +1,45 @@
+package data
+
+import (
+	"math/big"
+	"reflect"
+)
+
+var bigIntType = reflect.TypeOf(big.Int{})
+
+// BigInt is an integer beyond the range of Int, such as a 128-bit ID.  It
+// prints all of its digits, and is marshaled to JSON as a number (which
+// javascript rounds, so IDs passed to the client are better given as strings).
+//
+// Templates may print and compare BigInts, but arithmetic on them is done in
+// floating point, as it is for an Int and a Float.
+type BigInt struct{ *big.Int }
+
+// NewBigInt returns the given integer as an Int if it is in range, or else as
+// a BigInt holding a copy of it.  New converts big.Ints with NewBigInt, as do
+// the JSON decoders for integers beyond the range of Int.
+func NewBigInt(x *big.Int) Value {
+	if x.IsInt64() {
+		return Int(x.Int64())
+	}
+	return BigInt{new(big.Int).Set(x)}
+}
+
+func (v BigInt) Truthy() bool { return v.Sign() != 0 }
+
+// Equals returns true if the other value is an Int or BigInt of the same value.
+func (v BigInt) Equals(other Value) bool {
+	switch o := other.(type) {
+	case BigInt:
+		return v.Cmp(o.Int) == 0
+	case Int:
+		return v.Cmp(big.NewInt(int64(o))) == 0
+	}
+	return false
+}
+
+// Float returns the nearest Float to the integer.
+func (v BigInt) Float() Float {
+	var f, _ = new(big.Float).SetInt(v.Int).Float64()
+	return Float(f)
+}
@@ -1,36 +1,197 @@
 package data
 
 import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"math/big"
+	"net"
+	"net/url"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 	"unicode"
 	"unicode/utf8"
 )
 
-var timeType = reflect.TypeOf(time.Time{})
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+	jsonNumberType = reflect.TypeOf(json.Number(""))
+	marshalerType  = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	valueType      = reflect.TypeOf((*Value)(nil)).Elem()
+	stringerType   = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	netIPType      = reflect.TypeOf(net.IP(nil))
+	urlType        = reflect.TypeOf(url.URL{})
+)
 
 // New converts the given data into a soy data value, using
-// DefaultStructOptions for structs.
+// DefaultStructOptions for structs.  It panics if the data can not be
+// converted; see TryNew.
+//
+// Maps are converted to Maps keyed by the string form of their keys: the
+// String method of keys that are fmt.Stringers, or else the keys themselves if
+// they are strings, integers, or bools.  For example, a map[int64]Thing keyed
+// by ID becomes a Map with keys such as "42".
+//
+// A json.Number, as decoded by a json.Decoder with UseNumber, is converted to
+// an Int if it is an integer, and a Float otherwise.  Nil pointers, slices,
+// and maps are converted to Null, wherever they appear, as encoding/json
+// marshals them to null for the generated javascript.  The nullable types of
+// database/sql, such as sql.NullString, are converted to Null if they are not
+// valid, and to their values otherwise.
+//
+// Protocol buffer messages, as generated by protoc-gen-go, are converted to
+// Maps keyed by the names of their fields in the .proto file (e.g. "user_id"),
+// following the JSON mapping of protocol buffers, except that fields with
+// default values are included: enums are converted to Strings of their names,
+// bytes to Strings of their base64 encoding, unset repeated and map fields to
+// an empty List and Map, and oneofs to the field that is set, if any.
+// Timestamps are converted like a time.Time, Durations to Strings such as
+// "1.500s", and Structs, Values, ListValues, and wrappers (e.g. StringValue) to
+// the values they hold.  Messages are recognized by the protobuf tags of their
+// fields, so this package does not depend on the protocol buffer runtime.
+//
+// Values of other types that are not supported, such as arrays (e.g. a
+// uuid.UUID), are converted to Strings by their String method if they are
+// fmt.Stringers.  Supported types are converted as usual, even if they are
+// fmt.Stringers, except that a net.IP and a url.URL are converted to Strings
+// of their usual form rather than to a List and a Map.
 func New(value interface{}) Value {
 	return NewWith(DefaultStructOptions, value)
 }
 
 // NewWith converts the given data value soy data value, using the provided
-// StructOptions for any structs encountered.
+// StructOptions for any structs encountered.  It panics if the data can not be
+// converted; see TryNewWith.
 func NewWith(convert StructOptions, value interface{}) Value {
+	var val, err = TryNewWith(convert, value)
+	if err != nil {
+		panic(err)
+	}
+	return val
+}
+
+// TryNew converts the given data into a soy data value, like New, but returns
+// an error rather than panicking if it can not be converted: if it contains a
+// value of an unsupported type (such as a complex number), a map with keys
+// that have no string form, or invalid JSON in a json.RawMessage.  The error
+// describes the path to the offending value, e.g.
+//
+//	data: items[2].price: unexpected data type: complex128 ((1+2i))
+func TryNew(value interface{}) (Value, error) {
+	return TryNewWith(DefaultStructOptions, value)
+}
+
+// TryNewWith converts the given data into a soy data value, like NewWith, but
+// returns an error rather than panicking if it can not be converted.
+func TryNewWith(convert StructOptions, value interface{}) (Value, error) {
+	return convert.newValue(value)
+}
+
+// convertError is an error converting the value at a path within the data
+// being converted (e.g. "items[2].price").  The path is built up as the error
+// is returned through the containing values, so that conversions that succeed
+// need not build paths at all.
+type convertError struct {
+	path string
+	msg  string
+}
+
+func (e *convertError) Error() string {
+	if e.path == "" {
+		return "data: " + e.msg
+	}
+	return "data: " + e.path + ": " + e.msg
+}
+
+// pathError returns an error for the value being converted.
+func pathError(format string, args ...interface{}) error {
+	return &convertError{"", fmt.Sprintf(format, args...)}
+}
+
+// atPath returns the given conversion error, moved to be within the given
+// map key or list index (e.g. "items" or "[2]").
+func atPath(err error, elem string) error {
+	var e, ok = err.(*convertError)
+	switch {
+	case !ok:
+		return err
+	case e.path == "", e.path[0] == '[':
+		e.path = elem + e.path
+	default:
+		e.path = elem + "." + e.path
+	}
+	return e
+}
+
+// newValue converts the given value.
+func (c StructOptions) newValue(value interface{}) (Value, error) {
 	// quick return if we're passed an existing data.Value
 	if val, ok := value.(Value); ok {
-		return val
+		if isNilPointer(value) {
+			return Null{}, nil // e.g. a nil *OrderedMap
+		}
+		return val, nil
 	}
 
 	if value == nil {
-		return Null{}
+		return Null{}, nil
+	}
+
+	// quick return for the most common concrete types, avoiding reflection
+	switch value := value.(type) {
+	case []string:
+		if value == nil {
+			return Null{}, nil
+		}
+		var list = make(List, len(value))
+		for i, elem := range value {
+			list[i] = String(elem)
+		}
+		return list, nil
+	case []int:
+		if value == nil {
+			return Null{}, nil
+		}
+		var list = make(List, len(value))
+		for i, elem := range value {
+			list[i] = NewInt(int64(elem))
+		}
+		return list, nil
+	case map[string]string:
+		if value == nil {
+			return Null{}, nil
+		}
+		var m = make(Map, len(value))
+		for k, elem := range value {
+			m[k] = String(elem)
+		}
+		return m, nil
+	case map[string]interface{}:
+		if value == nil {
+			return Null{}, nil
+		}
+		var m = make(Map, len(value))
+		for k, elem := range value {
+			var val, err = c.newValue(elem)
+			if err != nil {
+				return nil, atPath(err, k)
+			}
+			m[k] = val
+		}
+		return m, nil
 	}
 
 	// see if value implements MarshalValue
 	if mar, ok := value.(Marshaler); ok {
-		return mar.MarshalValue()
+		if isNilPointer(value) {
+			return Null{}, nil
+		}
+		return mar.MarshalValue(), nil
 	}
 
 	// drill through pointers and interfaces to the underlying type
@@ -39,47 +200,309 @@ func NewWith(convert StructOptions, value interface{}) Value {
 		v = v.Elem()
 	}
 	if !v.IsValid() {
-		return Null{}
+		return Null{}, nil
+	}
+
+	// see if a pointer to the value implements MarshalValue
+	if reflect.PtrTo(v.Type()).Implements(marshalerType) {
+		var ptr = reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		return ptr.Interface().(Marshaler).MarshalValue(), nil
 	}
 
 	if v.Type() == timeType {
-		return String(v.Interface().(time.Time).Format(convert.TimeFormat))
+		return c.formatTime(v.Interface().(time.Time)), nil
+	}
+	if v.Type().PkgPath() == "database/sql" {
+		if val, ok := c.sqlNull(v.Interface()); ok {
+			return val, nil
+		}
+	}
+	if v.Type() == bigIntType {
+		var x = v.Interface().(big.Int)
+		return NewBigInt(&x), nil
+	}
+	if v.Type() == rawMessageType {
+		var val, err = newFromJSON(c, v.Bytes())
+		if err != nil {
+			return nil, pathError("%v", err)
+		}
+		return val, nil
+	}
+	if v.Type() == jsonNumberType {
+		var val, err = newFromNumber(json.Number(v.String()))
+		if err != nil {
+			return nil, pathError("%v", err)
+		}
+		return val, nil
 	}
 
+	if isProtoEnum(v.Type()) {
+		return c.protoEnum(v)
+	}
+	if v.Type() == netIPType || v.Type() == urlType {
+		return stringerValue(v), nil
+	}
+	if val := primitive(v); val != nil {
+		return val, nil
+	}
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.IsNil() {
+			return Null{}, nil
+		}
+		var slice = make(List, v.Len())
+		if isPlainType(v.Type().Elem()) {
+			for i := range slice {
+				slice[i] = primitive(v.Index(i))
+			}
+			return slice, nil
+		}
+		for i := range slice {
+			var elem, err = c.newValue(v.Index(i).Interface())
+			if err != nil {
+				return nil, atPath(err, "["+strconv.Itoa(i)+"]")
+			}
+			slice[i] = elem
+		}
+		return slice, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return Null{}, nil
+		}
+		var m = make(map[string]Value, v.Len())
+		var plain = isPlainType(v.Type().Elem())
+		for iter := v.MapRange(); iter.Next(); {
+			var k, ok = mapKey(iter.Key())
+			if !ok {
+				return nil, pathError(
+					"map keys must be strings, integers, bools, or fmt.Stringers: %T", value)
+			}
+			if plain {
+				m[k] = primitive(iter.Value())
+				continue
+			}
+			var elem, err = c.newValue(iter.Value().Interface())
+			if err != nil {
+				return nil, atPath(err, k)
+			}
+			m[k] = elem
+		}
+		return Map(m), nil
+	case reflect.Struct:
+		if val, ok, err := c.protoMessage(v); ok {
+			return val, err
+		}
+		return c.data(v)
+	case reflect.Chan:
+		if v.Type().ChanDir()&reflect.RecvDir != 0 {
+			return newChanStream(c, v), nil
+		}
+	case reflect.Func:
+		if isIteratorFunc(v.Type()) && !v.IsNil() {
+			return newFuncStream(c, v), nil
+		}
+		if isSeqFunc(v.Type()) && !v.IsNil() {
+			return newSeqStream(c, v), nil
+		}
+		if isLazyFunc(v.Type()) && !v.IsNil() {
+			return newFuncLazy(c, v), nil
+		}
+	}
+
+	// fall back to the String method of types that are otherwise unsupported
+	if v.Type().Implements(stringerType) || reflect.PtrTo(v.Type()).Implements(stringerType) {
+		return stringerValue(v), nil
+	}
+	return nil, pathError("unexpected data type: %T (%v)", value, value)
+}
+
+// stringerValue converts the given value to a String by its String method,
+// which may have a value or pointer receiver.
+func stringerValue(v reflect.Value) Value {
+	if str, ok := v.Interface().(fmt.Stringer); ok {
+		return String(str.String())
+	}
+	var ptr = reflect.New(v.Type())
+	ptr.Elem().Set(v)
+	return String(ptr.Interface().(fmt.Stringer).String())
+}
+
+// sqlNull converts the given database/sql nullable type (e.g. a
+// sql.NullString) to Null if it is not valid, and to its value otherwise.  It
+// returns false if the value is not one of those types.
+func (c StructOptions) sqlNull(value interface{}) (Value, bool) {
+	switch value := value.(type) {
+	case sql.NullString:
+		if value.Valid {
+			return String(value.String), true
+		}
+	case sql.NullInt64:
+		if value.Valid {
+			return NewInt(value.Int64), true
+		}
+	case sql.NullInt32:
+		if value.Valid {
+			return NewInt(int64(value.Int32)), true
+		}
+	case sql.NullInt16:
+		if value.Valid {
+			return NewInt(int64(value.Int16)), true
+		}
+	case sql.NullByte:
+		if value.Valid {
+			return NewInt(int64(value.Byte)), true
+		}
+	case sql.NullFloat64:
+		if value.Valid {
+			return Float(value.Float64), true
+		}
+	case sql.NullBool:
+		if value.Valid {
+			return NewBool(value.Bool), true
+		}
+	case sql.NullTime:
+		if value.Valid {
+			return c.formatTime(value.Time), true
+		}
+	default:
+		return nil, false
+	}
+	return Null{}, true
+}
+
+// isNilPointer returns true if the given value is a nil pointer.
+func isNilPointer(value interface{}) bool {
+	var v = reflect.ValueOf(value)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// primitive converts the given value to a Bool, Int, Float, or String
+// according to its kind, or returns nil if it is of another kind.
+func primitive(v reflect.Value) Value {
 	switch v.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return Int(v.Int())
+		return NewInt(v.Int())
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return Int(v.Uint())
+		return NewInt(int64(v.Uint()))
 	case reflect.Float32, reflect.Float64:
 		return Float(v.Float())
 	case reflect.Bool:
-		return Bool(v.Bool())
+		return NewBool(v.Bool())
 	case reflect.String:
 		return String(v.String())
-	case reflect.Slice:
-		if v.IsNil() {
-			return List(nil)
+	}
+	return nil
+}
+
+// isPlainType returns true if values of the given type are converted by
+// primitive alone, so that the checks for Values and Marshalers in newValue
+// may be skipped.
+func isPlainType(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Bool, reflect.String:
+	default:
+		return false
+	}
+	return typ != jsonNumberType &&
+		!isProtoEnum(typ) &&
+		!typ.Implements(valueType) &&
+		!typ.Implements(marshalerType) &&
+		!reflect.PtrTo(typ).Implements(marshalerType)
+}
+
+// mapKey returns the string form of the given map key, which is given by its
+// String method if it is a fmt.Stringer, or else is the string, integer, or
+// bool itself.  It returns false if the key has no string form.
+func mapKey(key reflect.Value) (string, bool) {
+	if key.Kind() != reflect.Ptr && key.Kind() != reflect.Interface || !key.IsNil() {
+		if s, ok := key.Interface().(fmt.Stringer); ok {
+			return s.String(), true
 		}
-		slice := []Value{}
-		for i := 0; i < v.Len(); i++ {
-			slice = append(slice, NewWith(convert, v.Index(i).Interface()))
+	}
+	switch key.Kind() {
+	case reflect.String:
+		return key.String(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10), true
+	case reflect.Bool:
+		return strconv.FormatBool(key.Bool()), true
+	case reflect.Interface:
+		if !key.IsNil() {
+			return mapKey(key.Elem())
 		}
-		return List(slice)
-	case reflect.Map:
-		var m = make(map[string]Value)
-		for _, key := range v.MapKeys() {
-			if key.Kind() != reflect.String {
-				panic("map keys must be strings")
-			}
-			m[key.String()] = NewWith(convert, v.MapIndex(key).Interface())
+	}
+	return "", false
+}
+
+// newFromJSON converts the given JSON to a soy data value.  Numbers are
+// converted to Int (or BigInt, if out of range) if they are integers, and
+// Float otherwise.  Empty input (e.g. an unset json.RawMessage) is converted to
+// Null.
+func newFromJSON(convert StructOptions, raw []byte) (Value, error) {
+	if len(raw) == 0 {
+		return Null{}, nil
+	}
+	var dec = json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if convert.OrderedMaps {
+		var val, err = decodeOrderedJSON(dec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid json.RawMessage: %v", err)
 		}
-		return Map(m)
-	case reflect.Struct:
-		return convert.Data(v.Interface())
-	default:
-		panic(fmt.Errorf("unexpected data type: %T (%v)", value, value))
+		return val, nil
+	}
+	var obj interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("invalid json.RawMessage: %v", err)
+	}
+	return jsonValue(convert, obj), nil
+}
+
+// newFromNumber converts the given JSON number, as decoded by a json.Decoder
+// with UseNumber, to an Int (or BigInt, if out of range) if it is an integer,
+// and a Float otherwise.
+func newFromNumber(num json.Number) (Value, error) {
+	if i, err := num.Int64(); err == nil {
+		return NewInt(i), nil
 	}
+	if x, ok := new(big.Int).SetString(string(num), 10); ok {
+		return NewBigInt(x), nil
+	}
+	var f, err = num.Float64()
+	if err != nil {
+		return nil, fmt.Errorf("invalid number: %q", string(num))
+	}
+	return Float(f), nil
+}
+
+// jsonValue converts a value decoded from JSON to a soy data value.
+func jsonValue(convert StructOptions, obj interface{}) Value {
+	switch obj := obj.(type) {
+	case json.Number:
+		var val, err = newFromNumber(obj)
+		if err != nil {
+			panic(fmt.Errorf("%v in json.RawMessage", err))
+		}
+		return val
+	case []interface{}:
+		var list = make(List, len(obj))
+		for i, elem := range obj {
+			list[i] = jsonValue(convert, elem)
+		}
+		return list
+	case map[string]interface{}:
+		var m = make(Map, len(obj))
+		for k, elem := range obj {
+			m[k] = jsonValue(convert, elem)
+		}
+		return m
+	}
+	return NewWith(convert, obj)
 }
 
 var DefaultStructOptions = StructOptions{
@@ -89,31 +512,262 @@ var DefaultStructOptions = StructOptions{
 
 // StructOptions provides flexibility in conversion of structs to soy's
 // data.Map format.
+//
+// The conversion of each field may be customized with a "soy" struct tag, in
+// the manner of encoding/json: the tag gives the map key for the field, which
+// is used as is, and "-" omits the field.  The "omitempty" option omits the
+// field if it has an empty value: false, 0, a nil pointer or interface, or an
+// empty string, slice, map, or array.
+//
+//	Name   string `soy:"title"`          // key "title"
+//	Secret string `soy:"-"`              // omitted
+//	Count  int    `soy:",omitempty"`     // key "count", omitted if zero
+//	Items  []Item `soy:"list,omitempty"` // key "list", omitted if empty
+//
+// Also as in encoding/json, the fields of an embedded struct are promoted into
+// the map, unless the embedded field is given a key by its tag.
 type StructOptions struct {
 	LowerCamel bool   // if true, convert field names to lowerCamel.
 	TimeFormat string // format string for time.Time. (if empty, use ISO-8601)
+
+	// OrderedMaps converts structs and JSON objects (in a json.RawMessage) to
+	// *OrderedMaps, so that templates iterate their keys in the order of the
+	// fields or properties.  Go maps have no order, and remain Maps.
+	OrderedMaps bool
+}
+
+// FormatTime converts a time.Time to a soy value, given the TimeFormat of the
+// StructOptions in use (or ISO-8601, if that is empty).  By default, it
+// formats the time as a String.  It may be replaced before any data is
+// converted, e.g. to convert times to Ints of milliseconds since the epoch.
+var FormatTime = func(t time.Time, layout string) Value {
+	return String(t.Format(layout))
 }
 
+// formatTime converts the given time to a soy value.
+func (c StructOptions) formatTime(t time.Time) Value {
+	var layout = c.TimeFormat
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	return FormatTime(t, layout)
+}
+
+// Data converts the given struct to a map.  It panics if any of its fields can
+// not be converted.
 func (c StructOptions) Data(obj interface{}) Map {
-	var m = make(map[string]Value)
-	var v = reflect.ValueOf(obj)
-	var valType = v.Type()
-	for i := 0; i < valType.NumField(); i++ {
-		if !v.Field(i).CanInterface() {
+	var m, err = c.data(reflect.ValueOf(obj))
+	if err != nil {
+		panic(err)
+	}
+	if m, ok := m.(*OrderedMap); ok {
+		return m.Map
+	}
+	return m.(Map)
+}
+
+// data converts the given struct to a map.
+func (c StructOptions) data(v reflect.Value) (Value, error) {
+	var fields = c.fields(v.Type())
+	var m = make(map[string]Value, len(fields))
+	var ordered *OrderedMap
+	if c.OrderedMaps {
+		ordered = &OrderedMap{Map: m}
+	}
+	for _, field := range fields {
+		var fv, ok = fieldByIndex(v, field.index)
+		if !ok || field.omitEmpty && isEmptyValue(fv) {
 			continue
 		}
-		var key = valType.Field(i).Name
-		if c.LowerCamel {
-			var firstRune, size = utf8.DecodeRuneInString(key)
-			key = string(unicode.ToLower(firstRune)) + key[size:]
+		var val Value
+		if field.plain {
+			val = primitive(fv)
+		} else {
+			var err error
+			if val, err = c.newValue(fv.Interface()); err != nil {
+				return nil, atPath(err, field.key)
+			}
 		}
-		m[key] = NewWith(c, v.Field(i).Interface())
+		if ordered != nil {
+			ordered.Set(field.key, val)
+		} else {
+			m[field.key] = val
+		}
+	}
+	if ordered != nil {
+		return ordered, nil
+	}
+	return Map(m), nil
+}
+
+// structField describes a struct field that is converted to a map entry.
+type structField struct {
+	index     []int  // index sequence of the field, through embedded structs
+	key       string // map key for the field
+	omitEmpty bool   // true if the field is omitted when empty
+	plain     bool   // true if the field is of a type converted by primitive
+	tagged    bool   // true if the key is given by the field's tag
+}
+
+// structFieldsKey identifies the fields of a struct type as converted using a
+// particular set of options.
+type structFieldsKey struct {
+	typ        reflect.Type
+	lowerCamel bool
+}
+
+// structFieldsCache caches the fields of each struct type converted, so that
+// repeated conversions of the same type need not inspect it again.
+var structFieldsCache sync.Map // structFieldsKey => []structField
+
+// fields returns the fields of the given struct type to convert.
+//
+// As in encoding/json, the fields of embedded structs without a tag name are
+// promoted into the map, as if they were fields of the outer struct.  Of the
+// fields with the same key, the least deeply nested one is converted,
+// preferring one with a tag if there are several, and none of them are
+// converted if that does not choose one.
+func (c StructOptions) fields(typ reflect.Type) []structField {
+	var cacheKey = structFieldsKey{typ, c.LowerCamel}
+	if fields, ok := structFieldsCache.Load(cacheKey); ok {
+		return fields.([]structField)
+	}
+
+	var fields = c.appendFields(nil, typ, nil, map[reflect.Type]bool{typ: true})
+
+	// keep only the dominant field of each key: the least deeply nested, or
+	// else the only tagged one of those
+	var depth = make(map[string]int) // key => least depth
+	for _, field := range fields {
+		if d, ok := depth[field.key]; !ok || len(field.index) < d {
+			depth[field.key] = len(field.index)
+		}
+	}
+	var count, tagged = make(map[string]int), make(map[string]int)
+	for _, field := range fields {
+		if len(field.index) == depth[field.key] {
+			count[field.key]++
+			if field.tagged {
+				tagged[field.key]++
+			}
+		}
+	}
+	var result []structField
+	for _, field := range fields {
+		if len(field.index) == depth[field.key] &&
+			(count[field.key] == 1 || field.tagged && tagged[field.key] == 1) {
+			result = append(result, field)
+		}
+	}
+	structFieldsCache.Store(cacheKey, result)
+	return result
+}
+
+// appendFields appends the fields of the given struct type, which is reached
+// through the given index sequence, in the order of their declaration.  The
+// struct types being visited are given, so that a struct that embeds itself
+// through a pointer is not visited again.
+func (c StructOptions) appendFields(fields []structField, typ reflect.Type, index []int, visiting map[reflect.Type]bool) []structField {
+	for i := 0; i < typ.NumField(); i++ {
+		var field = typ.Field(i)
+		var tag = field.Tag.Get("soy")
+		if tag == "-" {
+			continue
+		}
+		var key, opts = tag, ""
+		if comma := strings.IndexByte(tag, ','); comma != -1 {
+			key, opts = tag[:comma], tag[comma+1:]
+		}
+		var fieldIndex = append(index[:len(index):len(index)], i)
+
+		if field.Anonymous && key == "" {
+			var embedded = field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if isPromoted(embedded) {
+				if !visiting[embedded] {
+					visiting[embedded] = true
+					fields = c.appendFields(fields, embedded, fieldIndex, visiting)
+					delete(visiting, embedded)
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+
+		var tagged = key != ""
+		if !tagged {
+			key = field.Name
+			if c.LowerCamel {
+				var firstRune, size = utf8.DecodeRuneInString(key)
+				key = string(unicode.ToLower(firstRune)) + key[size:]
+			}
+		}
+		fields = append(fields, structField{fieldIndex, key, opts == "omitempty", isPlainType(field.Type), tagged})
+	}
+	return fields
+}
+
+// isPromoted returns true if the fields of an embedded struct of the given type
+// are promoted, rather than the struct being converted as a single field.
+// Structs that are converted by other means, such as a time.Time or a
+// Marshaler, are not promoted.
+func isPromoted(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Struct &&
+		typ != timeType &&
+		typ != bigIntType &&
+		!typ.Implements(marshalerType) &&
+		!reflect.PtrTo(typ).Implements(marshalerType) &&
+		!typ.Implements(valueType)
+}
+
+// fieldByIndex returns the field of the given struct with the given index
+// sequence.  It returns false if the field is within an embedded struct
+// reached through a nil pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// isEmptyValue returns true if the given field value is omitted by the
+// omitempty option.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
 	}
-	return Map(m)
+	return false
 }
 
 // Marshaler is the interface implemented by entities that can marshal
-// themselves into a data.Value.
+// themselves into a data.Value, such as domain types (money, UUIDs, enums) that
+// need a particular representation in templates.  New uses it in preference to
+// converting the value by reflection, wherever the value appears: at the top
+// level, or as an element, map value, or struct field.
+//
+// Like encoding/json, New also uses the method of a pointer receiver on a
+// non-pointer value, and converts a nil pointer to Null without calling it.
 type Marshaler interface {
 	MarshalValue() Value
 }
@@ -1,7 +1,14 @@
 package data
 
 import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -20,15 +27,69 @@ func TestNew(t *testing.T) {
 		{uint32(0), Int(0)},
 		{float32(0), Float(0)},
 		{"", String("")},
-		{[]bool(nil), List(nil)},
+		{[]bool(nil), Null{}},
 		{[]bool{}, List{}},
 		{[]string{"a"}, List{String("a")}},
+		{[]string(nil), Null{}},
+		{[]int{1, 2}, List{Int(1), Int(2)}},
+		{[]int(nil), Null{}},
+		{[]float64{1.5}, List{Float(1.5)}},
 		{[]interface{}{"a"}, List{String("a")}},
 		{map[string]string{}, Map{}},
 		{map[string]string{"a": "b"}, Map{"a": String("b")}},
+		{map[string]string(nil), Null{}},
+		{map[string]interface{}(nil), Null{}},
+		{map[int]bool(nil), Null{}},
+		{map[string]int{"a": 1}, Map{"a": Int(1)}},
+
+		// fmt.Stringers
+		{testUUID{1, 2, 3, 255}, String("010203ff")},
+		{&testUUID{1, 2, 3, 4}, String("01020304")},
+		{testComplex(1 + 2i), String("(1+2i)")},
+		{[]interface{}{testUUID{}}, List{String("00000000")}},
+		{struct{ ID testUUID }{}, Map{"iD": String("00000000")}},
+		{net.ParseIP("10.0.0.1"), String("10.0.0.1")},
+		{url.URL{Scheme: "https", Host: "example.com", Path: "/a"}, String("https://example.com/a")},
+		{&url.URL{Path: "/a b"}, String("/a%20b")},
+		{[]net.IP{net.IPv4(127, 0, 0, 1)}, List{String("127.0.0.1")}},
+		{time.March, Int(3)},
+		{testTags{"a", "b"}, List{String("a"), String("b")}},
+		{&testUser{"rob"}, Map{"name": String("rob")}},
+
+		// json.Numbers, as decoded with UseNumber
+		{json.Number("42"), Int(42)},
+		{json.Number("-1.5e3"), Float(-1500)},
+		{json.Number("18446744073709551616"), BigInt{new(big.Int).Lsh(big.NewInt(1), 64)}},
+		{map[string]interface{}{"a": json.Number("1")}, Map{"a": Int(1)}},
+		{[]json.Number{"1", "2.5"}, List{Int(1), Float(2.5)}},
+		{struct{ N json.Number }{"7"}, Map{"n": Int(7)}},
+
+		// database/sql nullable types
+		{sql.NullString{"a", true}, String("a")},
+		{sql.NullString{"a", false}, Null{}},
+		{sql.NullInt64{1, true}, Int(1)},
+		{sql.NullInt32{1, true}, Int(1)},
+		{sql.NullInt16{1, true}, Int(1)},
+		{sql.NullByte{1, true}, Int(1)},
+		{sql.NullFloat64{1.5, true}, Float(1.5)},
+		{sql.NullFloat64{}, Null{}},
+		{sql.NullBool{true, true}, Bool(true)},
+		{sql.NullBool{}, Null{}},
+		{sql.NullTime{jan1, true}, String("2014-01-01T00:00:00Z")},
+		{sql.NullTime{}, Null{}},
+		{&sql.NullString{"a", true}, String("a")},
+		{struct{ Name sql.NullString }{}, Map{"name": Null{}}},
 		{map[string]interface{}{"a": nil}, Map{"a": Null{}}},
 		{map[string]interface{}{"a": []int{1}}, Map{"a": List{Int(1)}}},
 
+		// map keys that are not strings
+		{map[int64]string{-1: "a", 2: "b"}, Map{"-1": String("a"), "2": String("b")}},
+		{map[uint8]bool{255: true}, Map{"255": Bool(true)}},
+		{map[bool]int{true: 1, false: 0}, Map{"true": Int(1), "false": Int(0)}},
+		{map[testKey]int{{"a", 1}: 1}, Map{"a-1": Int(1)}},
+		{map[testEnumKey]int{1: 1}, Map{"published": Int(1)}},
+		{map[interface{}]int{"a": 1, 2: 2}, Map{"a": Int(1), "2": Int(2)}},
+
 		// type aliases
 		{[]Int{5}, List{Int(5)}},
 		{map[string]Value{"a": List{Int(1)}}, Map{"a": List{Int(1)}}},
@@ -52,10 +113,31 @@ func TestNew(t *testing.T) {
 			PI *AInt
 		}{{nil}},
 			List{Map{"pI": Null{}}}},
+
+		// nil pointers, slices, and maps are null at any depth
+		{struct {
+			P *AInt
+			S []string
+			M map[string]int
+			I interface{}
+		}{I: (*AInt)(nil)},
+			Map{"p": Null{}, "s": Null{}, "m": Null{}, "i": Null{}}},
+		{[]interface{}{(*int)(nil), []int(nil), map[string]string(nil), (*OrderedMap)(nil), (*Lazy)(nil)},
+			List{Null{}, Null{}, Null{}, Null{}, Null{}}},
+		{map[string]interface{}{"a": []interface{}{map[string][]bool{"b": nil}}},
+			Map{"a": List{Map{"b": Null{}}}}},
+		{&struct{ S *[]int }{new([]int)}, Map{"s": Null{}}},
+		{[][]*AInt{{nil}, nil}, List{List{Null{}}, Null{}}},
 		{testIDURL{1, "https://github.com/robfig/soy"},
 			Map{"iD": Int(1), "uRL": String("https://github.com/robfig/soy")}},
 		{testIDURLMarshaler{1, "https://github.com/robfig/soy"},
 			Map{"id": Int(1), "url": String("https://github.com/robfig/soy")}},
+
+		// json.RawMessage is decoded
+		{json.RawMessage(`{"a": [1, 2.5, "b", null, true]}`),
+			Map{"a": List{Int(1), Float(2.5), String("b"), Null{}, Bool(true)}}},
+		{struct{ Payload json.RawMessage }{json.RawMessage(`"x"`)}, Map{"payload": String("x")}},
+		{struct{ Payload json.RawMessage }{}, Map{"payload": Null{}}},
 	}
 
 	for _, test := range tests {
@@ -66,6 +148,41 @@ func TestNew(t *testing.T) {
 	}
 }
 
+// testUUID is an unsupported type (an array) that is a fmt.Stringer.
+type testUUID [4]byte
+
+func (u testUUID) String() string { return fmt.Sprintf("%x", u[:]) }
+
+// testComplex is an unsupported type that is a fmt.Stringer with a pointer
+// receiver.
+type testComplex complex128
+
+func (c *testComplex) String() string { return fmt.Sprint(complex128(*c)) }
+
+// testTags is a supported type (a slice) that is a fmt.Stringer.
+type testTags []string
+
+func (t testTags) String() string { return strings.Join(t, ",") }
+
+// testUser is a struct with a String method for debugging, which is converted
+// to a Map.
+type testUser struct{ Name string }
+
+func (u *testUser) String() string { return "User(" + u.Name + ")" }
+
+// testKey is a map key that is a fmt.Stringer.
+type testKey struct {
+	name string
+	id   int
+}
+
+func (k testKey) String() string { return fmt.Sprintf("%s-%d", k.name, k.id) }
+
+// testEnumKey is an integer map key that is a fmt.Stringer.
+type testEnumKey int
+
+func (k testEnumKey) String() string { return []string{"draft", "published"}[k] }
+
 type testIDURL struct {
 	ID  int
 	URL string
@@ -80,6 +197,104 @@ func (t testIDURLMarshaler) MarshalValue() Value {
 	}
 }
 
+func TestTryNew(t *testing.T) {
+	type item struct {
+		Name  string
+		Price interface{}
+	}
+	type order struct {
+		Items []item
+		Meta  map[string]interface{}
+	}
+	var tests = []struct {
+		input interface{}
+		err   string
+	}{
+		{complex(1, 2), "data: unexpected data type: complex128 ((1+2i))"},
+		{map[float64]string{1: "a"}, "data: map keys must be strings, integers, bools, or fmt.Stringers: map[float64]string"},
+		{map[float64]string{}, ""},
+		{json.Number("abc"), `data: invalid number: "abc"`},
+		{[]interface{}{1, []interface{}{make(chan<- int)}}, "data: [1][0]: unexpected data type: chan<- int"},
+		{order{Items: []item{{"a", 1}, {"b", 2}, {"c", complex(1, 2)}}},
+			"data: items[2].price: unexpected data type: complex128 ((1+2i))"},
+		{order{Meta: map[string]interface{}{"a": map[string]interface{}{"b": json.RawMessage("{")}}},
+			"data: meta.a.b: invalid json.RawMessage: unexpected EOF"},
+		{order{Items: []item{{"a", map[[2]int]int{{1, 2}: 1}}}},
+			"data: items[0].price: map keys must be strings, integers, bools, or fmt.Stringers: map[[2]int]int"},
+	}
+	for _, test := range tests {
+		var _, err = TryNew(test.input)
+		var actual string
+		if err != nil {
+			actual = err.Error()
+		}
+		if !strings.HasPrefix(actual, test.err) || (test.err == "") != (err == nil) {
+			t.Errorf("%#v: expected error %q, got %v", test.input, test.err, err)
+		}
+
+		// New panics with the same error.
+		func() {
+			defer func() {
+				var e = recover()
+				if (e == nil) != (err == nil) || e != nil && e.(error).Error() != actual {
+					t.Errorf("%#v: expected New to panic with %v, got %v", test.input, err, e)
+				}
+			}()
+			New(test.input)
+		}()
+	}
+}
+
+// testMoney marshals itself with a pointer receiver.
+type testMoney struct {
+	Cents    int64
+	Currency string
+}
+
+func (m *testMoney) MarshalValue() Value {
+	return String(fmt.Sprintf("%d.%02d %s", m.Cents/100, m.Cents%100, m.Currency))
+}
+
+// testEnum marshals itself with a value receiver.
+type testEnum int
+
+func (e testEnum) MarshalValue() Value {
+	return String([]string{"draft", "published"}[e])
+}
+
+func TestMarshaler(t *testing.T) {
+	type order struct {
+		Total  testMoney
+		Tax    *testMoney
+		Refund *testMoney
+		Status testEnum
+	}
+	var tests = []struct {
+		input    interface{}
+		expected Value
+	}{
+		{testMoney{1250, "USD"}, String("12.50 USD")},
+		{&testMoney{5, "EUR"}, String("0.05 EUR")},
+		{(*testMoney)(nil), Null{}},
+		{testEnum(1), String("published")},
+		{[]testMoney{{100, "USD"}}, List{String("1.00 USD")}},
+		{map[string]testEnum{"a": 0}, Map{"a": String("draft")}},
+		{[]testEnum{0, 1}, List{String("draft"), String("published")}},
+		{order{testMoney{100, "USD"}, &testMoney{7, "USD"}, nil, 1}, Map{
+			"total":  String("1.00 USD"),
+			"tax":    String("0.07 USD"),
+			"refund": Null{},
+			"status": String("published"),
+		}},
+	}
+	for _, test := range tests {
+		var output = New(test.input)
+		if !reflect.DeepEqual(test.expected, output) {
+			t.Errorf("%#v =>\n %#v, expected:\n%#v", test.input, output, test.expected)
+		}
+	}
+}
+
 func TestStructOptions(t *testing.T) {
 	var testStruct = struct {
 		CaseFormat int
@@ -135,8 +350,9 @@ func TestStructOptions(t *testing.T) {
 				String("a"),
 				Int(2),
 				Map{
-					"lowerCamel": Bool(true),
-					"timeFormat": String(time.RFC3339),
+					"lowerCamel":  Bool(true),
+					"timeFormat":  String(time.RFC3339),
+					"orderedMaps": Bool(false),
 				},
 				Bool(true),
 				Null{},
@@ -152,12 +368,13 @@ func TestStructOptions(t *testing.T) {
 				"nil":    Null{},
 				"slice":  List{Int(1), Int(2), Int(3)},
 				"Struct": Map{
-					"lowerCamel": Bool(true),
-					"timeFormat": String(time.RFC3339),
+					"lowerCamel":  Bool(true),
+					"timeFormat":  String(time.RFC3339),
+					"orderedMaps": Bool(false),
 				}},
 		}},
 
-		{testStruct, StructOptions{false, time.Stamp}, Map{
+		{testStruct, StructOptions{false, time.Stamp, false}, Map{
 			"CaseFormat": Int(5),
 			"Time":       String(jan1.Format(time.Stamp)),
 			"Nested": Map{
@@ -168,8 +385,9 @@ func TestStructOptions(t *testing.T) {
 				String("a"),
 				Int(2),
 				Map{
-					"LowerCamel": Bool(true),
-					"TimeFormat": String(time.RFC3339),
+					"LowerCamel":  Bool(true),
+					"TimeFormat":  String(time.RFC3339),
+					"OrderedMaps": Bool(false),
 				},
 				Bool(true),
 				Null{},
@@ -185,8 +403,9 @@ func TestStructOptions(t *testing.T) {
 				"nil":    Null{},
 				"slice":  List{Int(1), Int(2), Int(3)},
 				"Struct": Map{
-					"LowerCamel": Bool(true),
-					"TimeFormat": String(time.RFC3339),
+					"LowerCamel":  Bool(true),
+					"TimeFormat":  String(time.RFC3339),
+					"OrderedMaps": Bool(false),
 				}},
 		}},
 	}
@@ -199,6 +418,204 @@ func TestStructOptions(t *testing.T) {
 	}
 }
 
+func TestTimes(t *testing.T) {
+	type event struct {
+		Start time.Time
+		End   *time.Time
+	}
+	var end = jan1.Add(time.Hour)
+	var tests = []struct {
+		input    interface{}
+		convert  StructOptions
+		expected Value
+	}{
+		{jan1, DefaultStructOptions, String("2014-01-01T00:00:00Z")},
+		{jan1, StructOptions{}, String("2014-01-01T00:00:00Z")},
+		{jan1, StructOptions{TimeFormat: "2006-01-02"}, String("2014-01-01")},
+		{event{jan1, nil}, DefaultStructOptions, Map{
+			"start": String("2014-01-01T00:00:00Z"),
+			"end":   Null{},
+		}},
+		{[]*time.Time{&end}, DefaultStructOptions, List{String("2014-01-01T01:00:00Z")}},
+	}
+	for _, test := range tests {
+		var output = NewWith(test.convert, test.input)
+		if !reflect.DeepEqual(test.expected, output) {
+			t.Errorf("%#v =>\n%#v, expected:\n%#v", test.input, output, test.expected)
+		}
+	}
+
+	// FormatTime may convert times to other values.
+	defer func(formatTime func(time.Time, string) Value) { FormatTime = formatTime }(FormatTime)
+	FormatTime = func(t time.Time, _ string) Value { return Int(t.UnixNano() / int64(time.Millisecond)) }
+	var output = New(event{jan1, &end})
+	var expected = Map{"start": Int(1388534400000), "end": Int(1388538000000)}
+	if !reflect.DeepEqual(expected, output) {
+		t.Errorf("expected %v, got %v", expected, output)
+	}
+}
+
+func TestStructTags(t *testing.T) {
+	type tagged struct {
+		Name     string `soy:"title"`
+		Secret   string `soy:"-"`
+		Count    int    `soy:",omitempty"`
+		Items    []int  `soy:"list,omitempty"`
+		Ptr      *int   `soy:",omitempty"`
+		Flag     bool   `soy:"isSet,omitempty"`
+		Untagged string `json:"ignored"`
+	}
+
+	var tests = []struct {
+		input    tagged
+		convert  StructOptions
+		expected Map
+	}{
+		{tagged{}, DefaultStructOptions, Map{
+			"title":    String(""),
+			"untagged": String(""),
+		}},
+		{tagged{"a", "b", 1, []int{2}, pInt(3), true, "c"}, DefaultStructOptions, Map{
+			"title":    String("a"),
+			"count":    Int(1),
+			"list":     List{Int(2)},
+			"ptr":      Int(3),
+			"isSet":    Bool(true),
+			"untagged": String("c"),
+		}},
+		{tagged{Items: []int{}, Ptr: pInt(0)}, StructOptions{}, Map{
+			"title":    String(""),
+			"Ptr":      Int(0),
+			"Untagged": String(""),
+		}},
+	}
+	for _, test := range tests {
+		var output = test.convert.Data(test.input)
+		if !reflect.DeepEqual(test.expected, output) {
+			t.Errorf("%#v =>\n%#v, expected:\n%#v", test.input, output, test.expected)
+		}
+	}
+}
+
+type testHeader struct {
+	Title string
+	User  string
+}
+
+type testFooter struct {
+	Year int
+	Body string // shadowed by page.Body
+}
+
+type testLinks struct {
+	Next string `soy:"next"`
+	Prev string
+}
+
+type testRecursive struct {
+	Name string
+	*testRecursive
+}
+
+func TestEmbeddedStructs(t *testing.T) {
+	type tagged struct{ Name string }
+	type ambiguous struct{ User string } // conflicts with testHeader.User
+	type page struct {
+		testHeader
+		*testFooter
+		testLinks
+		ambiguous
+		Tagged tagged `soy:"tagged"`
+		time.Time
+		Body string
+	}
+
+	var tests = []struct {
+		input    interface{}
+		expected Map
+	}{
+		{page{
+			testHeader: testHeader{"Home", "rob"},
+			testFooter: &testFooter{2014, "footer"},
+			testLinks:  testLinks{"/2", "/0"},
+			ambiguous:  ambiguous{"bob"},
+			Tagged:     tagged{"t"},
+			Time:       jan1,
+			Body:       "body",
+		}, Map{
+			"title":  String("Home"),
+			"year":   Int(2014),
+			"next":   String("/2"),
+			"prev":   String("/0"),
+			"tagged": Map{"name": String("t")},
+			"time":   String("2014-01-01T00:00:00Z"),
+			"body":   String("body"),
+		}},
+
+		// the fields of a nil embedded pointer are omitted
+		{page{}, Map{
+			"title":  String(""),
+			"next":   String(""),
+			"prev":   String(""),
+			"tagged": Map{"name": String("")},
+			"time":   String("0001-01-01T00:00:00Z"),
+			"body":   String(""),
+		}},
+
+		// a struct embedding itself is visited once
+		{testRecursive{"a", &testRecursive{"b", nil}}, Map{"name": String("a")}},
+	}
+	for _, test := range tests {
+		var output = New(test.input)
+		if !reflect.DeepEqual(test.expected, output) {
+			t.Errorf("%#v =>\n%#v, expected:\n%#v", test.input, output, test.expected)
+		}
+	}
+
+	// promoted fields are ordered by declaration
+	var ordered = StructOptions{LowerCamel: true, OrderedMaps: true}
+	var keys = NewWith(ordered, struct {
+		A string
+		testLinks
+		Z string
+	}{}).(*OrderedMap).Keys()
+	if !reflect.DeepEqual(keys, []string{"a", "next", "prev", "z"}) {
+		t.Errorf("unexpected key order: %v", keys)
+	}
+}
+
+func TestOrderedMaps(t *testing.T) {
+	type item struct {
+		Zebra int
+		Apple string
+		Mango json.RawMessage
+	}
+	var convert = StructOptions{LowerCamel: true, OrderedMaps: true}
+	var val = NewWith(convert, item{1, "a", json.RawMessage(`{"y": {"q": 1, "p": 2}, "x": [{"b": 1, "a": 2}]}`)})
+	var m, ok = val.(*OrderedMap)
+	if !ok {
+		t.Fatalf("expected an OrderedMap, got %T", val)
+	}
+	if expected := []string{"zebra", "apple", "mango"}; !reflect.DeepEqual(m.Keys(), expected) {
+		t.Errorf("expected keys %v, got %v", expected, m.Keys())
+	}
+	var buf, err = json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"zebra":1,"apple":"a","mango":{"y":{"q":1,"p":2},"x":[{"b":1,"a":2}]}}`; string(buf) != expected {
+		t.Errorf("expected %s, got %s", expected, buf)
+	}
+
+	// Go maps have no order to preserve.
+	if val = NewWith(convert, map[string]int{"a": 1}); !reflect.DeepEqual(val, Map{"a": Int(1)}) {
+		t.Errorf("expected a Map, got %#v", val)
+	}
+	if expected := (Map{"zebra": Int(0), "apple": String(""), "mango": Null{}}); !reflect.DeepEqual(convert.Data(item{}), expected) {
+		t.Errorf("expected %v, got %v", expected, convert.Data(item{}))
+	}
+}
+
 func BenchmarkStructOptions(b *testing.B) {
 	var testStruct = struct {
 		CaseFormat int
@@ -251,3 +668,40 @@ func BenchmarkStructOptions(b *testing.B) {
 func pInt(i int) *int {
 	return &i
 }
+
+func BenchmarkStructs(b *testing.B) {
+	type item struct {
+		ID      int
+		Name    string
+		Price   float64
+		InStock bool
+		Tags    []string
+	}
+	var items = make([]item, 10000)
+	for i := range items {
+		items[i] = item{i, "name", 1.5, true, []string{"a", "b"}}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var output = New(items).(List)
+		if len(output) != len(items) {
+			b.Errorf("unexpected output")
+		}
+	}
+}
+
+func BenchmarkMaps(b *testing.B) {
+	var m = make(map[string]string, 1000)
+	for i := 0; i < 1000; i++ {
+		m[fmt.Sprint("key", i)] = fmt.Sprint("value", i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var output = New(m).(Map)
+		if len(output) != len(m) {
+			b.Errorf("unexpected output")
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package data
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Decode stores the given soy data value in the Go value pointed to by out,
+// using DefaultStructOptions for structs.  It is the inverse of New, so that
+// functions written in Go may accept their arguments as Go types, e.g.
+//
+//	var opts struct {
+//		Limit int
+//		Tags  []string
+//	}
+//	if err := data.Decode(args[0], &opts); err != nil { ... }
+//
+// Maps are decoded into structs using the same keys as New (e.g. lowerCamel
+// field names, or the names given by "soy" tags), and into maps.  Lists are
+// decoded into slices and arrays, and numbers into any numeric type that holds
+// them exactly: Ints into floats, but Floats into integers only if they are
+// whole numbers.  Strings formatted by New from times are parsed back into a
+// time.Time.  Null and Undefined set the Go value to its zero value, which is
+// nil for pointers, slices, and maps.
+//
+// A Go value whose type is a soy data type, such as a Value or a Map, is set
+// to the soy value as is, while an empty interface is set to the plain Go
+// form of the value: a bool, int64, float64, string, []interface{}, or
+// map[string]interface{}.
+//
+// It returns an error describing the path to the offending value if the value
+// can not be stored in the Go value, e.g.
+//
+//	data: items[2].price: cannot decode data.String into int
+func Decode(val Value, out interface{}) error {
+	return DecodeWith(DefaultStructOptions, val, out)
+}
+
+// DecodeWith stores the given soy data value in the Go value pointed to by
+// out, like Decode, using the provided StructOptions for any structs
+// encountered.
+func DecodeWith(convert StructOptions, val Value, out interface{}) error {
+	var ptr = reflect.ValueOf(out)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return pathError("Decode requires a non-nil pointer, got %T", out)
+	}
+	return convert.decode(val, ptr.Elem())
+}
+
+// As returns the given value as a T, converted as by Decode, e.g.
+//
+//	var tags, err = data.As[[]string](args[0])
+func As[T any](val Value) (T, error) {
+	var out T
+	var err = Decode(val, &out)
+	return out, err
+}
+
+// Get returns the value of the given key of the given Map or OrderedMap as a
+// T, converted as by Decode, e.g.
+//
+//	var count, err = data.Get[int](m, "count")
+//
+// It returns an error if the value is not a map or does not have the key.
+func Get[T any](m Value, key string) (T, error) {
+	var out T
+	var vals = entries(Resolve(m))
+	if vals == nil {
+		return out, pathError("Get requires a map, got %T", m)
+	}
+	var val, ok = vals[key]
+	if !ok {
+		return out, atPath(pathError("key not found"), key)
+	}
+	if err := Decode(val, &out); err != nil {
+		return out, atPath(err, key)
+	}
+	return out, nil
+}
+
+// decode stores the given value in the given settable Go value.
+func (c StructOptions) decode(val Value, v reflect.Value) error {
+	val = Resolve(val)
+	if val == nil {
+		val = Null{}
+	}
+	var typ = v.Type()
+
+	// values of soy data types are stored as is
+	if typ.Kind() != reflect.Interface || typ.NumMethod() > 0 {
+		if reflect.TypeOf(val).AssignableTo(typ) {
+			v.Set(reflect.ValueOf(val))
+			return nil
+		}
+	}
+
+	switch val.(type) {
+	case Null, Undefined:
+		v.Set(reflect.Zero(typ))
+		return nil
+	}
+
+	switch typ {
+	case timeType:
+		if str, ok := val.(String); ok {
+			var layout = c.TimeFormat
+			if layout == "" {
+				layout = time.RFC3339
+			}
+			var t, err = time.Parse(layout, string(str))
+			if err != nil {
+				return pathError("%v", err)
+			}
+			v.Set(reflect.ValueOf(t))
+			return nil
+		}
+	case bigIntType:
+		switch val := val.(type) {
+		case Int:
+			v.Set(reflect.ValueOf(*big.NewInt(int64(val))))
+			return nil
+		case BigInt:
+			v.Set(reflect.ValueOf(*new(big.Int).Set(val.Int)))
+			return nil
+		}
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		var elem = reflect.New(typ.Elem())
+		if err := c.decode(val, elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	case reflect.Interface:
+		if typ.NumMethod() == 0 {
+			v.Set(reflect.ValueOf(plain(val)))
+			return nil
+		}
+	case reflect.Bool:
+		if b, ok := val.(Bool); ok {
+			v.SetBool(bool(b))
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, ok := wholeNumber(val); ok && !v.OverflowInt(i) {
+			v.SetInt(i)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if i, ok := wholeNumber(val); ok && i >= 0 && !v.OverflowUint(uint64(i)) {
+			v.SetUint(uint64(i))
+			return nil
+		}
+		if b, ok := val.(BigInt); ok && b.IsUint64() && !v.OverflowUint(b.Uint64()) {
+			v.SetUint(b.Uint64())
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		var f, ok = number(val)
+		if ok && (typ.Kind() == reflect.Float64 || !v.OverflowFloat(f)) {
+			v.SetFloat(f)
+			return nil
+		}
+	case reflect.String:
+		switch val := val.(type) {
+		case String:
+			v.SetString(string(val))
+			return nil
+		case Sanitized:
+			v.SetString(val.String())
+			return nil
+		}
+	case reflect.Slice:
+		if list, ok := val.(List); ok {
+			var slice = reflect.MakeSlice(typ, len(list), len(list))
+			for i, elem := range list {
+				if err := c.decode(elem, slice.Index(i)); err != nil {
+					return atPath(err, "["+strconv.Itoa(i)+"]")
+				}
+			}
+			v.Set(slice)
+			return nil
+		}
+	case reflect.Array:
+		if list, ok := val.(List); ok {
+			for i := 0; i < v.Len(); i++ {
+				var elem Value = Null{}
+				if i < len(list) {
+					elem = list[i]
+				}
+				if err := c.decode(elem, v.Index(i)); err != nil {
+					return atPath(err, "["+strconv.Itoa(i)+"]")
+				}
+			}
+			return nil
+		}
+	case reflect.Map:
+		if m := entries(val); m != nil {
+			var result = reflect.MakeMapWithSize(typ, len(m))
+			for k, elem := range m {
+				var key = reflect.New(typ.Key()).Elem()
+				if err := decodeKey(k, key); err != nil {
+					return atPath(err, k)
+				}
+				var mv = reflect.New(typ.Elem()).Elem()
+				if err := c.decode(elem, mv); err != nil {
+					return atPath(err, k)
+				}
+				result.SetMapIndex(key, mv)
+			}
+			v.Set(result)
+			return nil
+		}
+	case reflect.Struct:
+		if m := entries(val); m != nil {
+			for _, field := range c.fields(typ) {
+				var elem, found = m[field.key]
+				if !found {
+					continue
+				}
+				var fv, settable = allocFieldByIndex(v, field.index)
+				if !settable {
+					continue
+				}
+				if err := c.decode(elem, fv); err != nil {
+					return atPath(err, field.key)
+				}
+			}
+			return nil
+		}
+	}
+	return pathError("cannot decode %T into %v", val, typ)
+}
+
+// decodeKey stores the given map key in the given Go value, which must be of
+// a string, integer, or bool kind.
+func decodeKey(k string, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(k)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i, err = strconv.ParseInt(k, 10, v.Type().Bits())
+		if err == nil {
+			v.SetInt(i)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var i, err = strconv.ParseUint(k, 10, v.Type().Bits())
+		if err == nil {
+			v.SetUint(i)
+			return nil
+		}
+	case reflect.Bool:
+		var b, err = strconv.ParseBool(k)
+		if err == nil {
+			v.SetBool(b)
+			return nil
+		}
+	}
+	return pathError("cannot decode map key %q into %v", k, v.Type())
+}
+
+// number returns the given Int, BigInt, or Float as a float64.
+func number(val Value) (float64, bool) {
+	switch val := val.(type) {
+	case Int:
+		return float64(val), true
+	case BigInt:
+		return float64(val.Float()), true
+	case Float:
+		return float64(val), true
+	}
+	return 0, false
+}
+
+// wholeNumber returns the given Int, or Float that is a whole number, as an
+// int64.
+func wholeNumber(val Value) (int64, bool) {
+	switch val := val.(type) {
+	case Int:
+		return int64(val), true
+	case Float:
+		var f = float64(val)
+		if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			return int64(f), true
+		}
+	}
+	return 0, false
+}
+
+// plain returns the plain Go form of the given value, for storing in an empty
+// interface.
+func plain(val Value) interface{} {
+	switch val := Resolve(val).(type) {
+	case Null, Undefined:
+		return nil
+	case Bool:
+		return bool(val)
+	case Int:
+		return int64(val)
+	case Float:
+		return float64(val)
+	case String:
+		return string(val)
+	case List:
+		var list = make([]interface{}, len(val))
+		for i, elem := range val {
+			list[i] = plain(elem)
+		}
+		return list
+	case Map:
+		var m = make(map[string]interface{}, len(val))
+		for k, elem := range val {
+			m[k] = plain(elem)
+		}
+		return m
+	case *OrderedMap:
+		return plain(val.Map)
+	case Sanitized:
+		return val.String()
+	}
+	return val
+}
+
+// allocFieldByIndex returns the field of the given struct with the given index
+// sequence, allocating any nil embedded pointers along the way.  It returns
+// false if a nil embedded pointer can not be set because it is unexported.
+func allocFieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
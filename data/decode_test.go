@@ -0,0 +1,192 @@
+package data
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type decodeItem struct {
+	Name  string
+	Price float64
+	Tags  []string `soy:"labels"`
+}
+
+type decodeOrder struct {
+	ID       int64
+	Items    []decodeItem
+	Customer *decodeItem
+	Created  time.Time
+	Meta     map[string]interface{}
+	Counts   map[int]uint8
+	Raw      Value
+	testHeader
+}
+
+func TestDecode(t *testing.T) {
+	var order = decodeOrder{
+		ID:         42,
+		Items:      []decodeItem{{"a", 1.5, []string{"x"}}, {"b", 2, nil}},
+		Customer:   &decodeItem{Name: "rob"},
+		Created:    jan1,
+		Meta:       map[string]interface{}{"n": int64(1), "list": []interface{}{"a", true, nil}},
+		Counts:     map[int]uint8{1: 2},
+		Raw:        Map{"a": Int(1)},
+		testHeader: testHeader{"title", "user"},
+	}
+
+	// Decoding the value of a struct gives the struct back.
+	var actual decodeOrder
+	if err := Decode(New(order), &actual); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, order) {
+		t.Errorf("expected %#v, got %#v", order, actual)
+	}
+
+	var tests = []struct {
+		val      Value
+		out      interface{} // pointer to the zero value of the type to decode
+		expected interface{}
+	}{
+		// numeric widening
+		{Int(1), new(float32), float32(1)},
+		{Float(2), new(int8), int8(2)},
+		{Int(255), new(uint8), uint8(255)},
+		{NewBigInt(new(big.Int).Lsh(big.NewInt(1), 63)), new(uint64), uint64(1 << 63)},
+		{Int(7), new(big.Int), *big.NewInt(7)},
+
+		// null and undefined give zero values
+		{Null{}, new(*int), (*int)(nil)},
+		{Undefined{}, new([]int), []int(nil)},
+		{Null{}, new(int), 0},
+
+		// pointers are allocated
+		{Int(1), new(*int), pInt(1)},
+
+		// sanitized content and ordered maps
+		{SanitizedHtml("<b>"), new(string), "<b>"},
+		{&OrderedMap{Map: Map{"name": String("a")}}, new(decodeItem), decodeItem{Name: "a"}},
+
+		// arrays are padded or truncated
+		{List{Int(1), Int(2), Int(3)}, new([2]int), [2]int{1, 2}},
+		{List{Int(1)}, new([2]int), [2]int{1, 0}},
+
+		// soy data types are stored as is
+		{Map{"a": Int(1)}, new(Map), Map{"a": Int(1)}},
+		{String("a"), new(Value), Value(String("a"))},
+
+		// lazy values are resolved
+		{NewLazy(func() Value { return Int(3) }), new(int), 3},
+
+		// empty interfaces hold plain Go values
+		{Map{"a": List{Float(1.5), SanitizedUri("/")}}, new(interface{}),
+			map[string]interface{}{"a": []interface{}{1.5, "/"}}},
+	}
+	for _, test := range tests {
+		if err := Decode(test.val, test.out); err != nil {
+			t.Errorf("%#v: %v", test.val, err)
+			continue
+		}
+		var out = reflect.ValueOf(test.out).Elem().Interface()
+		if !reflect.DeepEqual(out, test.expected) {
+			t.Errorf("%#v: expected %#v, got %#v", test.val, test.expected, out)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var tests = []struct {
+		val Value
+		out interface{}
+		err string
+	}{
+		{Int(1), decodeItem{}, "data: Decode requires a non-nil pointer, got data.decodeItem"},
+		{Int(1), (*int)(nil), "data: Decode requires a non-nil pointer, got *int"},
+		{String("1"), new(int), "data: cannot decode data.String into int"},
+		{Float(1.5), new(int), "data: cannot decode data.Float into int"},
+		{Int(256), new(uint8), "data: cannot decode data.Int into uint8"},
+		{Int(-1), new(uint), "data: cannot decode data.Int into uint"},
+		{Float(1e40), new(float32), "data: cannot decode data.Float into float32"},
+		{Map{"a": Int(1)}, new(map[int]int), `data: a: cannot decode map key "a" into int`},
+		{Map{"items": List{Map{}, Map{"price": String("free")}}}, new(decodeOrder),
+			"data: items[1].price: cannot decode data.String into float64"},
+		{Map{"created": String("yesterday")}, new(decodeOrder), "data: created: parsing time"},
+	}
+	for _, test := range tests {
+		var err = Decode(test.val, test.out)
+		if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("%#v into %T: expected error %q, got %v", test.val, test.out, test.err, err)
+		}
+	}
+}
+
+func TestAsAndGet(t *testing.T) {
+	var tags, err = As[[]string](List{String("a"), String("b")})
+	if err != nil || !reflect.DeepEqual(tags, []string{"a", "b"}) {
+		t.Errorf("As: expected [a b], got %v and %v", tags, err)
+	}
+	if _, err = As[int](String("a")); err == nil {
+		t.Errorf("As: expected an error")
+	}
+
+	var m = Map{"count": Int(3), "items": List{Map{"name": String("a")}}}
+	count, err := Get[int](m, "count")
+	if err != nil || count != 3 {
+		t.Errorf("Get: expected 3, got %v and %v", count, err)
+	}
+	items, err := Get[[]decodeItem](&OrderedMap{Map: m}, "items")
+	if err != nil || !reflect.DeepEqual(items, []decodeItem{{Name: "a"}}) {
+		t.Errorf("Get: expected items, got %v and %v", items, err)
+	}
+
+	var errTests = []struct {
+		m   Value
+		key string
+		err string
+	}{
+		{m, "missing", "data: missing: key not found"},
+		{m, "items", "data: items: cannot decode data.List into int"},
+		{List{}, "count", "data: Get requires a map, got data.List"},
+	}
+	for _, test := range errTests {
+		if _, err = Get[int](test.m, test.key); err == nil || err.Error() != test.err {
+			t.Errorf("Get(%v, %q): expected error %q, got %v", test.m, test.key, test.err, err)
+		}
+	}
+}
+
+func TestDecodeWith(t *testing.T) {
+	var convert = StructOptions{
+		LowerCamel:  false,
+		TimeFormat:  "2006-01-02",
+		OrderedMaps: true,
+	}
+	var order = decodeOrder{
+		ID:      7,
+		Items:   []decodeItem{{"a", 1, []string{"x", "y"}}},
+		Created: time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC),
+		Counts:  map[int]uint8{},
+		Raw:     Null{},
+	}
+
+	// Values built with the same options round trip.
+	var val = convert.Data(order)
+	var actual decodeOrder
+	if err := DecodeWith(convert, val, &actual); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, order) {
+		t.Errorf("expected %#v, got %#v", order, actual)
+	}
+
+	// Keys follow the options rather than the defaults.
+	if err := DecodeWith(convert, Map{"ID": Int(1), "id": Int(2)}, &actual); err != nil {
+		t.Fatal(err)
+	}
+	if actual.ID != 1 {
+		t.Errorf("expected the ID key to be decoded, got %v", actual.ID)
+	}
+}
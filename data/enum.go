@@ -0,0 +1,45 @@
+package data
+
+import "sync"
+
+// Enum maps the numbers of an enumerated type, such as a protocol buffer
+// enum, to their names and back.  Registered enums are used by the enumName
+// and enumValue functions, so that templates need not mirror the definitions
+// of enums (e.g. with a {switch}) to display them.
+type Enum struct {
+	Name   string           // fully-qualified name, e.g. "acme.Status"
+	Names  map[int32]string // names by number
+	Values map[string]int32 // numbers by name
+}
+
+var (
+	enumsMu sync.RWMutex
+	enums   = make(map[string]*Enum)
+)
+
+// RegisterEnum registers the enum with the given fully-qualified name, and
+// names by number.  The names map of a generated protocol buffer enum may be
+// registered directly, e.g.
+//
+//	data.RegisterEnum("acme.Status", acmepb.Status_name)
+//
+// Registering an enum again replaces it.
+func RegisterEnum(name string, names map[int32]string) *Enum {
+	var enum = &Enum{name, make(map[int32]string, len(names)), make(map[string]int32, len(names))}
+	for num, str := range names {
+		enum.Names[num] = str
+		enum.Values[str] = num
+	}
+	enumsMu.Lock()
+	enums[name] = enum
+	enumsMu.Unlock()
+	return enum
+}
+
+// LookupEnum returns the registered enum with the given name.
+func LookupEnum(name string) (*Enum, bool) {
+	enumsMu.RLock()
+	defer enumsMu.RUnlock()
+	var enum, ok = enums[name]
+	return enum, ok
+}
@@ -0,0 +1,114 @@
+package data
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"math/big"
+)
+
+// The Value types are registered with encoding/gob, so that a tree of values
+// (e.g. the data of a render, to be cached and replayed) may be encoded as a
+// Value, such as a Map, or within a struct field or map of type Value.
+//
+// Undefined and Null keep their identity, OrderedMaps keep their order, and
+// Lazy values and SyncMaps are encoded as their current values (and decoded
+// as computed Lazy values and new SyncMaps).  Streams can not be encoded,
+// since encoding would consume them.
+func init() {
+	for _, v := range []Value{
+		Undefined{}, Null{}, Bool(false), Int(0), Float(0), String(""),
+		List{}, Map{}, BigInt{}, &OrderedMap{}, &Lazy{}, &SyncMap{}, &Stream{},
+		SanitizedHtml(""), SanitizedJs(""), SanitizedUri(""), SanitizedCss(""),
+	} {
+		gob.Register(v)
+	}
+}
+
+// Undefined and Null have no fields, which gob does not allow, so they encode
+// as nothing.
+
+func (v Undefined) GobEncode() ([]byte, error) { return nil, nil }
+func (v Null) GobEncode() ([]byte, error)      { return nil, nil }
+func (v *Undefined) GobDecode([]byte) error    { return nil }
+func (v *Null) GobDecode([]byte) error         { return nil }
+
+// GobDecode allocates the big.Int, which gob would otherwise decode into
+// through a nil pointer.
+func (v *BigInt) GobDecode(buf []byte) error {
+	v.Int = new(big.Int)
+	return v.Int.GobDecode(buf)
+}
+
+// gobOrderedMap is the encoded form of an OrderedMap.
+type gobOrderedMap struct {
+	Keys   []string
+	Values []Value
+}
+
+func (v *OrderedMap) GobEncode() ([]byte, error) {
+	var m = gobOrderedMap{v.keys, make([]Value, len(v.keys))}
+	for i, k := range v.keys {
+		m.Values[i] = v.Map[k]
+	}
+	return gobEncode(m)
+}
+
+func (v *OrderedMap) GobDecode(buf []byte) error {
+	var m gobOrderedMap
+	if err := gob.NewDecoder(bytes.NewReader(buf)).Decode(&m); err != nil {
+		return err
+	}
+	if len(m.Keys) != len(m.Values) {
+		return errors.New("data: invalid gob encoding of OrderedMap")
+	}
+	*v = *NewOrderedMap()
+	for i, k := range m.Keys {
+		v.Set(k, m.Values[i])
+	}
+	return nil
+}
+
+func (v *Lazy) GobEncode() ([]byte, error) {
+	var val = v.Value()
+	return gobEncode(&val)
+}
+
+func (v *Lazy) GobDecode(buf []byte) error {
+	var val Value
+	if err := gob.NewDecoder(bytes.NewReader(buf)).Decode(&val); err != nil {
+		return err
+	}
+	v.once.Do(func() { v.val = val })
+	return nil
+}
+
+func (v *SyncMap) GobEncode() ([]byte, error) {
+	return gobEncode(v.Load())
+}
+
+func (v *SyncMap) GobDecode(buf []byte) error {
+	var m Map
+	if err := gob.NewDecoder(bytes.NewReader(buf)).Decode(&m); err != nil {
+		return err
+	}
+	v.Store(m)
+	return nil
+}
+
+func (v *Stream) GobEncode() ([]byte, error) {
+	return nil, errors.New("data: a Stream can not be gob encoded")
+}
+
+func (v *Stream) GobDecode([]byte) error {
+	return errors.New("data: a Stream can not be gob decoded")
+}
+
+// gobEncode returns the gob encoding of the given value.
+func gobEncode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,61 @@
+package data
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestGob(t *testing.T) {
+	var ordered = NewOrderedMap()
+	ordered.Set("z", Int(1))
+	ordered.Set("a", List{Null{}})
+	var val Value = Map{
+		"undefined": Undefined{},
+		"null":      Null{},
+		"bool":      Bool(true),
+		"int":       Int(-7),
+		"float":     Float(1.5),
+		"string":    String("a"),
+		"list":      List{Int(1), List{}, Map{}},
+		"big":       NewBigInt(new(big.Int).Lsh(big.NewInt(1), 70)),
+		"ordered":   ordered,
+		"html":      SanitizedHtml("<b>"),
+		"uri":       SanitizedUri("/a"),
+		"lazy":      NewLazy(func() Value { return String("computed") }),
+		"sync":      NewSyncMap(Map{"flag": Bool(true)}),
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&val); err != nil {
+		t.Fatal(err)
+	}
+	var actual Value
+	if err := gob.NewDecoder(&buf).Decode(&actual); err != nil {
+		t.Fatal(err)
+	}
+	if !DeepEqual(actual, val) {
+		t.Errorf("expected %v, got %v", val, actual)
+	}
+
+	var m = actual.(Map)
+	if m["undefined"] != (Undefined{}) || m["null"] != (Null{}) || m["html"] != SanitizedHtml("<b>") {
+		t.Errorf("expected the types to be kept, got %#v, %#v, %#v", m["undefined"], m["null"], m["html"])
+	}
+	if keys := m["ordered"].(*OrderedMap).Keys(); !reflect.DeepEqual(keys, []string{"z", "a"}) {
+		t.Errorf("expected the keys in order, got %v", keys)
+	}
+	if lazy, ok := m["lazy"].(*Lazy); !ok || lazy.Value() != String("computed") {
+		t.Errorf("expected a computed Lazy, got %#v", m["lazy"])
+	}
+	if sync, ok := m["sync"].(*SyncMap); !ok || sync.Key("flag") != Bool(true) {
+		t.Errorf("expected a SyncMap, got %#v", m["sync"])
+	}
+
+	val = Map{"stream": NewStream(func() (Value, bool) { return nil, false })}
+	if err := gob.NewEncoder(&buf).Encode(&val); err == nil {
+		t.Error("expected an error encoding a Stream")
+	}
+}
@@ -0,0 +1,75 @@
+package data
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+)
+
+// Lazy is a value that is computed when it is first accessed, so that
+// expensive values (e.g. the results of database queries) are computed only
+// for the templates that use them.  Once computed, the value is cached, and a
+// Lazy is safe to share across concurrent renders.
+//
+// Functions of the form func() T are converted to Lazy values by New.
+type Lazy struct {
+	once sync.Once
+	fn   func() Value
+	val  Value
+}
+
+// NewLazy returns a value that is computed by calling fn when it is first
+// accessed.  A nil result is treated as Null.
+func NewLazy(fn func() Value) *Lazy {
+	return &Lazy{fn: fn}
+}
+
+// Value returns the computed value, calling the function if it has not been
+// called yet.  It is never itself a Lazy.
+func (v *Lazy) Value() Value {
+	v.once.Do(func() {
+		v.val = v.fn()
+		if lazy, ok := v.val.(*Lazy); ok {
+			v.val = lazy.Value()
+		}
+		if v.val == nil {
+			v.val = Null{}
+		}
+		v.fn = nil
+	})
+	return v.val
+}
+
+func (v *Lazy) Truthy() bool                 { return v.Value().Truthy() }
+func (v *Lazy) String() string               { return v.Value().String() }
+func (v *Lazy) Equals(other Value) bool      { return v.Value().Equals(Resolve(other)) }
+func (v *Lazy) MarshalJSON() ([]byte, error) { return json.Marshal(v.Value()) }
+
+// Resolve returns the computed value of v if it is Lazy, the current entries of
+// v if it is a SyncMap, or else v itself.
+func Resolve(v Value) Value {
+	switch v := v.(type) {
+	case *Lazy:
+		return v.Value()
+	case *SyncMap:
+		return v.Load()
+	}
+	return v
+}
+
+// isLazyFunc returns true if the given type is of the form func() T.
+func isLazyFunc(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Func &&
+		typ.NumIn() == 0 &&
+		typ.NumOut() == 1
+}
+
+// newFuncLazy returns a value computed by the given function.
+func newFuncLazy(convert StructOptions, fn reflect.Value) *Lazy {
+	if fn, ok := fn.Interface().(func() Value); ok {
+		return NewLazy(fn)
+	}
+	return NewLazy(func() Value {
+		return NewWith(convert, fn.Call(nil)[0].Interface())
+	})
+}
@@ -0,0 +1,82 @@
+package data
+
+import "sort"
+
+// MergePolicy determines the value of a key that is present in both maps given
+// to Map.Merge.
+type MergePolicy int
+
+const (
+	// MergeOverwrite uses the value of the other map.
+	MergeOverwrite MergePolicy = iota
+
+	// MergeKeepExisting keeps the value of the map being merged into.
+	MergeKeepExisting
+
+	// MergeDeep merges maps (Maps or OrderedMaps) recursively and concatenates
+	// Lists.  Otherwise, it uses the value of the other map.
+	MergeDeep
+)
+
+// Merge returns a new map with the entries of the map and of the other map,
+// resolving keys present in both according to the given policy, e.g. to
+// compose the data of a page from several sources:
+//
+//	var obj = layoutData.Merge(pageData, data.MergeDeep)
+//
+// Neither map is modified, but values that are not merged are shared with
+// them (see Clone).
+func (v Map) Merge(other Map, policy MergePolicy) Map {
+	var result = make(Map, len(v)+len(other))
+	for k, val := range v {
+		result[k] = val
+	}
+	for k, val := range other {
+		var existing, ok = result[k]
+		switch {
+		case !ok, policy == MergeOverwrite:
+			result[k] = val
+		case policy == MergeDeep:
+			result[k] = mergeDeep(existing, val)
+		}
+	}
+	return result
+}
+
+// mergeDeep returns the value of a key present in both maps given to Merge,
+// according to MergeDeep.
+func mergeDeep(existing, val Value) Value {
+	existing, val = Resolve(existing), Resolve(val)
+	switch existing := existing.(type) {
+	case List:
+		if list, ok := val.(List); ok {
+			var merged = make(List, 0, len(existing)+len(list))
+			return append(append(merged, existing...), list...)
+		}
+	case Map:
+		if m := entries(val); m != nil {
+			return existing.Merge(m, MergeDeep)
+		}
+	case *OrderedMap:
+		if m := entries(val); m != nil {
+			// keep the existing order, followed by the added keys
+			var keys = append([]string(nil), existing.keys...)
+			var added []string
+			if ordered, ok := val.(*OrderedMap); ok {
+				added = ordered.keys
+			} else {
+				for k := range m {
+					added = append(added, k)
+				}
+				sort.Strings(added)
+			}
+			for _, k := range added {
+				if _, ok := existing.Map[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			return &OrderedMap{existing.Map.Merge(m, MergeDeep), keys}
+		}
+	}
+	return val
+}
@@ -0,0 +1,62 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	var ordered = NewOrderedMap()
+	ordered.Set("b", Int(1))
+	ordered.Set("a", Int(2))
+	var layout = Map{
+		"title": String("Site"),
+		"nav":   Map{"home": String("/"), "about": String("/about")},
+		"css":   List{String("site.css")},
+		"meta":  ordered,
+	}
+	var page = Map{
+		"title": String("Page"),
+		"nav":   Map{"about": String("/about-us"), "blog": String("/blog")},
+		"css":   List{String("page.css")},
+		"meta":  Map{"c": Int(3), "a": Int(4)},
+		"body":  String("body"),
+	}
+
+	var mergedMeta = NewOrderedMap()
+	mergedMeta.Set("b", Int(1))
+	mergedMeta.Set("a", Int(4))
+	mergedMeta.Set("c", Int(3))
+	var tests = []struct {
+		policy   MergePolicy
+		expected Map
+	}{
+		{MergeOverwrite, page},
+		{MergeKeepExisting, Map{
+			"title": String("Site"),
+			"nav":   layout["nav"],
+			"css":   layout["css"],
+			"meta":  ordered,
+			"body":  String("body"),
+		}},
+		{MergeDeep, Map{
+			"title": String("Page"),
+			"nav":   Map{"home": String("/"), "about": String("/about-us"), "blog": String("/blog")},
+			"css":   List{String("site.css"), String("page.css")},
+			"meta":  mergedMeta,
+			"body":  String("body"),
+		}},
+	}
+	for _, test := range tests {
+		var actual = layout.Merge(page, test.policy)
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("policy %d: expected %v, got %v", test.policy, test.expected, actual)
+		}
+	}
+
+	// Neither map is modified.
+	if len(layout) != 4 || len(layout["nav"].(Map)) != 2 || len(layout["css"].(List)) != 1 ||
+		!reflect.DeepEqual(ordered.Keys(), []string{"b", "a"}) || len(page) != 5 {
+		t.Errorf("expected the maps to be unmodified, got %v and %v", layout, page)
+	}
+}
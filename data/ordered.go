@@ -0,0 +1,169 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"strings"
+)
+
+// OrderedMap is a map that remembers the order in which its keys were added,
+// so that templates iterate it, with {foreach} or keys(), in that order rather
+// than sorting its keys.  Its entries may be read through the embedded Map,
+// but must be added and removed with Set and Delete.
+//
+// Structs and JSON objects are converted to ordered maps by NewWith if the
+// OrderedMaps option is set, with their keys in the order of the fields or
+// properties.
+type OrderedMap struct {
+	Map
+	keys []string
+}
+
+// NewOrderedMap returns an empty ordered map.
+func NewOrderedMap() *OrderedMap {
+	return &OrderedMap{Map: make(Map)}
+}
+
+// Set sets the value of the given key, adding it after the existing keys if
+// it is not present.
+func (v *OrderedMap) Set(key string, val Value) {
+	if _, ok := v.Map[key]; !ok {
+		v.keys = append(v.keys, key)
+	}
+	v.Map[key] = val
+}
+
+// Delete removes the given key.
+func (v *OrderedMap) Delete(key string) {
+	if _, ok := v.Map[key]; !ok {
+		return
+	}
+	delete(v.Map, key)
+	for i, k := range v.keys {
+		if k == key {
+			v.keys = append(v.keys[:i:i], v.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Keys returns the keys of the map in the order in which they were added.  The
+// returned slice must not be modified.
+func (v *OrderedMap) Keys() []string {
+	return v.keys
+}
+
+// All returns an iterator over the keys and values of the map, in the order in
+// which the keys were added.
+func (v *OrderedMap) All() iter.Seq2[string, Value] {
+	return func(yield func(string, Value) bool) {
+		for _, k := range v.keys {
+			if !yield(k, v.Map[k]) {
+				return
+			}
+		}
+	}
+}
+
+func (v *OrderedMap) String() string {
+	var items = make([]string, len(v.keys))
+	for i, k := range v.keys {
+		var vstr string
+		if _, ok := v.Map[k].(Undefined); ok {
+			vstr = "undefined"
+		} else {
+			vstr = v.Map[k].String()
+		}
+		items[i] = k + ": " + vstr
+	}
+	return "{" + strings.Join(items, ", ") + "}"
+}
+
+func (v *OrderedMap) Equals(other Value) bool {
+	o, ok := other.(*OrderedMap)
+	return ok && v == o
+}
+
+// MarshalJSON writes the map as a JSON object with its keys in order.
+func (v *OrderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range v.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		var key, err = json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		val, err := json.Marshal(v.Map[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON reads a JSON object into the map, with its keys in the order
+// of its properties.  Nested objects are also read as ordered maps.
+func (v *OrderedMap) UnmarshalJSON(buf []byte) error {
+	if string(buf) == "null" {
+		return nil // as encoding/json does for slices and maps
+	}
+	var dec = json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var val, err = decodeOrderedJSON(dec)
+	if err != nil {
+		return err
+	}
+	var m, ok = val.(*OrderedMap)
+	if !ok {
+		return fmt.Errorf("data: cannot unmarshal %s into OrderedMap", buf)
+	}
+	*v = *m
+	return nil
+}
+
+// decodeOrderedJSON reads the next JSON value from the decoder, which must use
+// numbers, converting objects to ordered maps.
+func decodeOrderedJSON(dec *json.Decoder) (Value, error) {
+	var tok, err = dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		var m = NewOrderedMap()
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			val, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			m.Set(key.(string), val)
+		}
+		_, err = dec.Token() // '}'
+		return m, err
+	case json.Delim('['):
+		var list = List{}
+		for dec.More() {
+			val, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, val)
+		}
+		_, err = dec.Token() // ']'
+		return list, err
+	}
+	return jsonValue(DefaultStructOptions, tok), nil
+}
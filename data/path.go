@@ -0,0 +1,80 @@
+package data
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Lookup returns the value at the given path within the given value, or
+// Undefined if any segment of the path is missing, e.g.
+//
+//	data.Lookup(obj, "order.items[2].price")
+//
+// The path is a sequence of keys, separated by dots, and indices in brackets,
+// like a data reference in a template without the leading $.  Keys that are
+// not identifiers may be given in quotes within brackets, as in
+// a['first-name'].  Maps and OrderedMaps are accessed by key and Lists by
+// index, so that a path of a number after a dot, as in a.0, also indexes a
+// List.  Lazy values are resolved along the way.
+//
+// Lookup returns Undefined, rather than failing, for a path that is missing,
+// that accesses a value that is not a collection (including Null), or that is
+// malformed.
+func Lookup(v Value, path string) Value {
+	var key string
+	var ok bool
+	for first := true; path != ""; first = false {
+		if key, path, ok = nextPathSegment(path, first); !ok {
+			return Undefined{}
+		}
+		switch obj := Resolve(v).(type) {
+		case List:
+			var index, err = strconv.Atoi(key)
+			if err != nil {
+				return Undefined{}
+			}
+			v = obj.Index(index)
+		default:
+			var m = entries(obj)
+			if m == nil {
+				return Undefined{}
+			}
+			v = m.Key(key)
+		}
+	}
+	return Resolve(v)
+}
+
+// nextPathSegment returns the key or index at the start of the given path,
+// and the rest of the path.  A key at the start of the path (first) is not
+// preceded by a dot.  It returns false if the path is malformed.
+func nextPathSegment(path string, first bool) (key, rest string, ok bool) {
+	if path[0] == '[' {
+		if len(path) > 1 && (path[1] == '\'' || path[1] == '"') {
+			var end = strings.IndexByte(path[2:], path[1]) + 2
+			if end < 2 || end+1 >= len(path) || path[end+1] != ']' {
+				return "", "", false
+			}
+			return path[2:end], path[end+2:], true
+		}
+		var end = strings.IndexByte(path, ']')
+		if end < 0 {
+			return "", "", false
+		}
+		return path[1:end], path[end+1:], true
+	}
+	if !first {
+		if path[0] != '.' {
+			return "", "", false
+		}
+		path = path[1:]
+	}
+	var end = strings.IndexAny(path, ".[")
+	if end < 0 {
+		end = len(path)
+	}
+	if end == 0 {
+		return "", "", false
+	}
+	return path[:end], path[end:], true
+}
@@ -0,0 +1,57 @@
+package data
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	var meta = NewOrderedMap()
+	meta.Set("first-name", String("Rob"))
+	var obj = Map{
+		"order": Map{
+			"items": List{
+				Map{"price": Int(1)},
+				Map{"price": Int(2)},
+				NewLazy(func() Value { return Map{"price": Int(3)} }),
+			},
+			"note": Null{},
+		},
+		"meta": meta,
+		"a.b":  String("dotted"),
+	}
+
+	var tests = []struct {
+		path     string
+		expected Value
+	}{
+		{"", obj},
+		{"order.items[2].price", Int(3)},
+		{"order.items.0.price", Int(1)},
+		{"order['items'][1][\"price\"]", Int(2)},
+		{"meta['first-name']", String("Rob")},
+		{"['a.b']", String("dotted")},
+		{"[\"a.b\"]", String("dotted")},
+
+		// missing segments
+		{"missing", Undefined{}},
+		{"order.missing.price", Undefined{}},
+		{"order.items[3]", Undefined{}},
+		{"order.items[-1]", Undefined{}},
+		{"order.items.x", Undefined{}},
+		{"order.note", Null{}},
+		{"order.note.text", Undefined{}},
+		{"order.items[0].price.value", Undefined{}},
+
+		// malformed paths
+		{".order", Undefined{}},
+		{"order..items", Undefined{}},
+		{"order.items[0", Undefined{}},
+		{"order.items[0]price", Undefined{}},
+		{"meta['first-name]", Undefined{}},
+		{"order.", Undefined{}},
+	}
+	for _, test := range tests {
+		var actual = Lookup(obj, test.path)
+		if !DeepEqual(actual, test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.path, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package data
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// protoWellKnownTypes converts the well-known types that are not converted as
+// messages, by the package path and name of their Go types.
+var protoWellKnownTypes map[string]func(StructOptions, reflect.Value) (Value, error)
+
+func init() {
+	const known = "google.golang.org/protobuf/types/known/"
+	protoWellKnownTypes = map[string]func(StructOptions, reflect.Value) (Value, error){
+		known + "timestamppb.Timestamp": StructOptions.protoTimestamp,
+		known + "durationpb.Duration":   StructOptions.protoDuration,
+		known + "structpb.Struct":       protoFieldNamed("Fields"),
+		known + "structpb.ListValue":    protoFieldNamed("Values"),
+		known + "structpb.Value":        protoFieldNamed("Kind"),
+		known + "structpb.NullValue":    StructOptions.protoNull,
+	}
+	for _, wrapper := range []string{"Double", "Float", "Int64", "UInt64", "Int32", "UInt32", "Bool", "String", "Bytes"} {
+		protoWellKnownTypes[known+"wrapperspb."+wrapper+"Value"] = protoFieldNamed("Value")
+	}
+}
+
+// protoField describes a field of a message that is converted to a map entry.
+type protoField struct {
+	index int    // index of the Go field
+	key   string // the name of the field in the .proto file, or "" for a oneof
+}
+
+// protoFieldsCache caches the fields of each message type converted, or nil
+// for struct types that are not messages.
+var protoFieldsCache sync.Map // reflect.Type => []protoField
+
+// protoFields returns the fields of the given struct type to convert, or nil
+// if it is not a generated message.
+func protoFields(typ reflect.Type) []protoField {
+	if fields, ok := protoFieldsCache.Load(typ); ok {
+		return fields.([]protoField)
+	}
+	var fields []protoField
+	for i := 0; i < typ.NumField(); i++ {
+		var field = typ.Field(i)
+		if _, ok := field.Tag.Lookup("protobuf_oneof"); ok {
+			fields = append(fields, protoField{i, ""})
+		} else if name := protoName(field.Tag); name != "" {
+			fields = append(fields, protoField{i, name})
+		}
+	}
+	protoFieldsCache.Store(typ, fields)
+	return fields
+}
+
+// protoName returns the name of the field in the .proto file, given by the
+// name option of its protobuf tag, or "" if it has none.
+func protoName(tag reflect.StructTag) string {
+	for _, opt := range strings.Split(tag.Get("protobuf"), ",") {
+		if strings.HasPrefix(opt, "name=") {
+			return opt[len("name="):]
+		}
+	}
+	return ""
+}
+
+// isProtoEnum returns true if the given type is a generated enum, which has
+// both a String and a Number method.
+func isProtoEnum(typ reflect.Type) bool {
+	if typ.Kind() != reflect.Int32 || !typ.Implements(stringerType) {
+		return false
+	}
+	var _, ok = typ.MethodByName("Number")
+	return ok
+}
+
+// protoMessage converts the given message to a map, or returns false if it is
+// not a message.
+func (c StructOptions) protoMessage(v reflect.Value) (Value, bool, error) {
+	var fields = protoFields(v.Type())
+	if fields == nil {
+		return nil, false, nil
+	}
+	if conv, ok := protoWellKnownTypes[v.Type().PkgPath()+"."+v.Type().Name()]; ok {
+		var val, err = conv(c, v)
+		return val, true, err
+	}
+
+	var m = make(map[string]Value, len(fields))
+	var ordered *OrderedMap
+	if c.OrderedMaps {
+		ordered = &OrderedMap{Map: m}
+	}
+	for _, field := range fields {
+		var key, fv = field.key, v.Field(field.index)
+		if key == "" {
+			// the set field of a oneof is that of the struct within the interface
+			if fv.IsNil() {
+				continue
+			}
+			var set = fv.Elem().Elem()
+			key, fv = protoName(set.Type().Field(0).Tag), set.Field(0)
+		}
+		var val, err = c.protoValue(fv)
+		if err != nil {
+			return nil, true, atPath(err, key)
+		}
+		if ordered != nil {
+			ordered.Set(key, val)
+		} else {
+			m[key] = val
+		}
+	}
+	if ordered != nil {
+		return ordered, true, nil
+	}
+	return Map(m), true, nil
+}
+
+// protoValue converts the value of a field of a message.
+func (c StructOptions) protoValue(v reflect.Value) (Value, error) {
+	switch {
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return String(base64.StdEncoding.EncodeToString(v.Bytes())), nil
+	case v.Kind() == reflect.Slice && v.IsNil():
+		return List{}, nil
+	case v.Kind() == reflect.Map && v.IsNil():
+		return Map{}, nil
+	}
+	return c.newValue(v.Interface())
+}
+
+// protoEnum converts the given enum to the String of its name.
+func (c StructOptions) protoEnum(v reflect.Value) (Value, error) {
+	if conv, ok := protoWellKnownTypes[v.Type().PkgPath()+"."+v.Type().Name()]; ok {
+		return conv(c, v)
+	}
+	return String(v.Interface().(fmt.Stringer).String()), nil
+}
+
+func (c StructOptions) protoTimestamp(v reflect.Value) (Value, error) {
+	var t = time.Unix(v.FieldByName("Seconds").Int(), v.FieldByName("Nanos").Int())
+	return c.formatTime(t.UTC()), nil
+}
+
+// protoDuration converts the given Duration to a String of its seconds, with
+// 0, 3, 6, or 9 fractional digits, as in the JSON mapping.
+func (c StructOptions) protoDuration(v reflect.Value) (Value, error) {
+	var secs, nanos = v.FieldByName("Seconds").Int(), v.FieldByName("Nanos").Int()
+	var sign string
+	if secs < 0 || nanos < 0 {
+		sign, secs, nanos = "-", -secs, -nanos
+	}
+	var str = sign + strconv.FormatInt(secs, 10)
+	if nanos != 0 {
+		var frac = fmt.Sprintf("%09d", nanos)
+		for strings.HasSuffix(frac, "000") {
+			frac = frac[:len(frac)-3]
+		}
+		str += "." + frac
+	}
+	return String(str + "s"), nil
+}
+
+// protoFieldNamed returns a conversion of a well-known type to the value of
+// its field with the given Go name.
+func protoFieldNamed(name string) func(StructOptions, reflect.Value) (Value, error) {
+	return func(c StructOptions, v reflect.Value) (Value, error) {
+		var fv = v.FieldByName(name)
+		if fv.Kind() == reflect.Interface {
+			// the set field of a oneof (structpb.Value's Kind)
+			if fv.IsNil() {
+				return Null{}, nil
+			}
+			fv = fv.Elem().Elem().Field(0)
+		}
+		return c.protoValue(fv)
+	}
+}
+
+func (c StructOptions) protoNull(reflect.Value) (Value, error) {
+	return Null{}, nil
+}
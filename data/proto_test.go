@@ -0,0 +1,155 @@
+package data
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// The types below are shaped like those generated by protoc-gen-go.
+
+type testStatus int32
+
+const (
+	testStatus_UNKNOWN testStatus = 0
+	testStatus_ACTIVE  testStatus = 1
+)
+
+var testStatus_name = map[int32]string{0: "UNKNOWN", 1: "ACTIVE"}
+
+func (x testStatus) String() string {
+	if name, ok := testStatus_name[int32(x)]; ok {
+		return name
+	}
+	return strconv.Itoa(int(x))
+}
+
+func (x testStatus) Number() int32 { return int32(x) }
+
+type testOrder struct {
+	state         struct{}
+	sizeCache     int32
+	unknownFields []byte
+
+	OrderId   int64               `protobuf:"varint,1,opt,name=order_id,json=orderId,proto3"`
+	Status    testStatus          `protobuf:"varint,2,opt,name=status,proto3,enum=test.Status"`
+	History   []testStatus        `protobuf:"varint,3,rep,packed,name=history,proto3,enum=test.Status"`
+	Items     []*testItem         `protobuf:"bytes,4,rep,name=items,proto3"`
+	Labels    map[string]string   `protobuf:"bytes,5,rep,name=labels,proto3"`
+	Signature []byte              `protobuf:"bytes,6,opt,name=signature,proto3"`
+	Customer  *testItem           `protobuf:"bytes,7,opt,name=customer,proto3"`
+	Placed    *testTimestamp      `protobuf:"bytes,8,opt,name=placed,proto3"`
+	Timeout   *testDuration       `protobuf:"bytes,9,opt,name=timeout,proto3"`
+	Payment   isTestOrder_Payment `protobuf_oneof:"payment"`
+}
+
+type isTestOrder_Payment interface{ isTestOrder_Payment() }
+
+type testOrder_Card struct {
+	Card string `protobuf:"bytes,10,opt,name=card,proto3,oneof"`
+}
+
+type testOrder_Invoice struct {
+	Invoice *testItem `protobuf:"bytes,11,opt,name=invoice,proto3,oneof"`
+}
+
+func (*testOrder_Card) isTestOrder_Payment()    {}
+func (*testOrder_Invoice) isTestOrder_Payment() {}
+
+type testItem struct {
+	state struct{}
+
+	DisplayName string `protobuf:"bytes,1,opt,name=display_name,json=displayName,proto3"`
+}
+
+type testTimestamp struct {
+	state struct{}
+
+	Seconds int64 `protobuf:"varint,1,opt,name=seconds,proto3"`
+	Nanos   int32 `protobuf:"varint,2,opt,name=nanos,proto3"`
+}
+
+type testDuration testTimestamp
+
+func TestProto(t *testing.T) {
+	// Recognize the test types as the well-known types they stand in for.
+	for typ, conv := range map[reflect.Type]func(StructOptions, reflect.Value) (Value, error){
+		reflect.TypeOf(testTimestamp{}): StructOptions.protoTimestamp,
+		reflect.TypeOf(testDuration{}):  StructOptions.protoDuration,
+	} {
+		var key = typ.PkgPath() + "." + typ.Name()
+		protoWellKnownTypes[key] = conv
+		defer delete(protoWellKnownTypes, key)
+	}
+
+	var tests = []struct {
+		input    *testOrder
+		expected Map
+	}{
+		{&testOrder{
+			OrderId:   42,
+			Status:    testStatus_ACTIVE,
+			History:   []testStatus{testStatus_UNKNOWN, testStatus_ACTIVE, 7},
+			Items:     []*testItem{{DisplayName: "Widget"}},
+			Labels:    map[string]string{"gift": "yes"},
+			Signature: []byte("sig"),
+			Placed:    &testTimestamp{Seconds: 1700000000, Nanos: 5},
+			Timeout:   &testDuration{Seconds: 1, Nanos: 500000000},
+			Payment:   &testOrder_Card{"visa"},
+		}, Map{
+			"order_id":  Int(42),
+			"status":    String("ACTIVE"),
+			"history":   List{String("UNKNOWN"), String("ACTIVE"), String("7")},
+			"items":     List{Map{"display_name": String("Widget")}},
+			"labels":    Map{"gift": String("yes")},
+			"signature": String("c2ln"),
+			"customer":  Null{},
+			"placed":    String(time.Unix(1700000000, 5).UTC().Format(time.RFC3339)),
+			"timeout":   String("1.500s"),
+			"card":      String("visa"),
+		}},
+
+		// Unset fields have default values, and unset oneofs are omitted.
+		{&testOrder{}, Map{
+			"order_id":  Int(0),
+			"status":    String("UNKNOWN"),
+			"history":   List{},
+			"items":     List{},
+			"labels":    Map{},
+			"signature": String(""),
+			"customer":  Null{},
+			"placed":    Null{},
+			"timeout":   Null{},
+		}},
+
+		{&testOrder{
+			Timeout: &testDuration{Seconds: -2, Nanos: -10000},
+			Payment: &testOrder_Invoice{&testItem{DisplayName: "Acme"}},
+		}, Map{
+			"order_id":  Int(0),
+			"status":    String("UNKNOWN"),
+			"history":   List{},
+			"items":     List{},
+			"labels":    Map{},
+			"signature": String(""),
+			"customer":  Null{},
+			"placed":    Null{},
+			"timeout":   String("-2.000010s"),
+			"invoice":   Map{"display_name": String("Acme")},
+		}},
+	}
+	for _, test := range tests {
+		var actual = New(test.input)
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("expected\n%v\ngot\n%v", test.expected, actual)
+		}
+	}
+
+	// Fields are in the order of the message with OrderedMaps.
+	var ordered = NewWith(StructOptions{OrderedMaps: true}, &testOrder{Payment: &testOrder_Card{"visa"}})
+	var keys = ordered.(*OrderedMap).Keys()
+	if keys[0] != "order_id" || keys[len(keys)-1] != "card" {
+		t.Errorf("expected the fields in order, got %v", keys)
+	}
+}
@@ -0,0 +1,94 @@
+package data
+
+import "encoding/json"
+
+// The sanitized content types hold content that is known to be safe to insert
+// into a particular context (its kind) without escaping, such as HTML snippets
+// produced by trusted server-side code.  They mirror the SanitizedContent
+// types of the official Soy implementation.  Autoescaping leaves sanitized
+// content of the matching kind as is, so that it is not escaped twice, while
+// values of other types (including String) are escaped as usual.
+//
+// Sanitized content bypasses escaping, so it must never be created from
+// untrusted input.  The content of a {param} block declared with a kind is
+// also sanitized content of that kind.
+type (
+	SanitizedHtml string
+	SanitizedJs   string
+	SanitizedUri  string
+	SanitizedCss  string
+)
+
+// Sanitized is implemented by the sanitized content types.
+type Sanitized interface {
+	Value
+
+	// ContentKind returns the kind of the content, as given by the kind
+	// attribute of a {param} block: "html", "js", "uri", or "css".
+	ContentKind() string
+}
+
+var (
+	_ Sanitized = SanitizedHtml("")
+	_ Sanitized = SanitizedJs("")
+	_ Sanitized = SanitizedUri("")
+	_ Sanitized = SanitizedCss("")
+)
+
+func (v SanitizedHtml) ContentKind() string { return "html" }
+func (v SanitizedJs) ContentKind() string   { return "js" }
+func (v SanitizedUri) ContentKind() string  { return "uri" }
+func (v SanitizedCss) ContentKind() string  { return "css" }
+
+func (v SanitizedHtml) Truthy() bool { return v != "" }
+func (v SanitizedJs) Truthy() bool   { return v != "" }
+func (v SanitizedUri) Truthy() bool  { return v != "" }
+func (v SanitizedCss) Truthy() bool  { return v != "" }
+
+func (v SanitizedHtml) String() string { return string(v) }
+func (v SanitizedJs) String() string   { return string(v) }
+func (v SanitizedUri) String() string  { return string(v) }
+func (v SanitizedCss) String() string  { return string(v) }
+
+// Sanitized content is equal to sanitized content of the same kind, and to a
+// String, with the same content, so that the content of a kinded {param} block
+// may be compared with a string literal.
+
+func (v SanitizedHtml) Equals(other Value) bool { return sanitizedEquals(v, other) }
+func (v SanitizedJs) Equals(other Value) bool   { return sanitizedEquals(v, other) }
+func (v SanitizedUri) Equals(other Value) bool  { return sanitizedEquals(v, other) }
+func (v SanitizedCss) Equals(other Value) bool  { return sanitizedEquals(v, other) }
+
+func sanitizedEquals(v Sanitized, other Value) bool {
+	switch o := other.(type) {
+	case String:
+		return v.String() == string(o)
+	case Sanitized:
+		return v.ContentKind() == o.ContentKind() && v.String() == o.String()
+	}
+	return false
+}
+
+// Sanitized content is marshaled as a string, and so loses its kind.
+
+func (v SanitizedHtml) MarshalJSON() ([]byte, error) { return json.Marshal(string(v)) }
+func (v SanitizedJs) MarshalJSON() ([]byte, error)   { return json.Marshal(string(v)) }
+func (v SanitizedUri) MarshalJSON() ([]byte, error)  { return json.Marshal(string(v)) }
+func (v SanitizedCss) MarshalJSON() ([]byte, error)  { return json.Marshal(string(v)) }
+
+// NewSanitized returns the given content as sanitized content of the given
+// kind, or as a String if the kind is not one of the sanitized content kinds
+// (e.g. "text").
+func NewSanitized(kind, content string) Value {
+	switch kind {
+	case "html":
+		return SanitizedHtml(content)
+	case "js":
+		return SanitizedJs(content)
+	case "uri":
+		return SanitizedUri(content)
+	case "css":
+		return SanitizedCss(content)
+	}
+	return String(content)
+}
@@ -0,0 +1,135 @@
+package data
+
+import (
+	"encoding/json"
+	"iter"
+	"reflect"
+)
+
+// Stream is a list whose items are produced on demand, so that large result
+// sets may be rendered without holding all of them in memory.  A stream may be
+// iterated only once, by {foreach}.
+//
+// Channels, iterator functions of the form func() (T, bool), and iterators of
+// the form func(yield func(T) bool) (e.g. iter.Seq[T]) are converted to
+// streams by New.
+type Stream struct {
+	next func() (Value, bool)
+	stop func() // releases the iterator, if non-nil
+}
+
+// NewStream returns a stream of the values returned by next, which returns
+// false once there are no more values.
+func NewStream(next func() (Value, bool)) *Stream {
+	return &Stream{next, nil}
+}
+
+// NewSeqStream returns a stream of the values yielded by the given iterator.
+// The iterator runs alongside the render that consumes the stream, until it
+// returns or the stream is stopped.
+func NewSeqStream(seq iter.Seq[Value]) *Stream {
+	var next, stop = iter.Pull(seq)
+	return &Stream{next, stop}
+}
+
+// Next returns the next value of the stream, or false if it is exhausted.
+func (v *Stream) Next() (Value, bool) {
+	if v.next == nil {
+		return nil, false
+	}
+	var val, ok = v.next()
+	if !ok {
+		v.Stop()
+	}
+	return val, ok
+}
+
+// Stop ends the stream, releasing its iterator if it was not yet exhausted.
+// Renders stop the streams that they iterate, including if they fail midway.
+func (v *Stream) Stop() {
+	if v.stop != nil {
+		v.stop()
+	}
+	v.next, v.stop = nil, nil
+}
+
+func (v *Stream) Truthy() bool   { return true }
+func (v *Stream) String() string { return "[...]" }
+
+func (v *Stream) Equals(other Value) bool {
+	o, ok := other.(*Stream)
+	return ok && v == o
+}
+
+// MarshalJSON consumes the stream, writing its values as a JSON array.
+func (v *Stream) MarshalJSON() ([]byte, error) {
+	var list = List{}
+	for val, ok := v.Next(); ok; val, ok = v.Next() {
+		list = append(list, val)
+	}
+	return json.Marshal(list)
+}
+
+// newChanStream returns a stream of the values received from the given channel.
+func newChanStream(convert StructOptions, ch reflect.Value) *Stream {
+	return NewStream(func() (Value, bool) {
+		var elem, ok = ch.Recv()
+		if !ok {
+			return nil, false
+		}
+		return NewWith(convert, elem.Interface()), true
+	})
+}
+
+// isIteratorFunc returns true if the given type is of the form func() (T, bool).
+func isIteratorFunc(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Func &&
+		typ.NumIn() == 0 &&
+		typ.NumOut() == 2 &&
+		typ.Out(1).Kind() == reflect.Bool
+}
+
+// newFuncStream returns a stream of the values returned by the given iterator
+// function.
+func newFuncStream(convert StructOptions, fn reflect.Value) *Stream {
+	if next, ok := fn.Interface().(func() (Value, bool)); ok {
+		return NewStream(next)
+	}
+	return NewStream(func() (Value, bool) {
+		var out = fn.Call(nil)
+		if !out[1].Bool() {
+			return nil, false
+		}
+		return NewWith(convert, out[0].Interface()), true
+	})
+}
+
+// seqValueType is the type of an iterator of values.
+var seqValueType = reflect.TypeOf(iter.Seq[Value](nil))
+
+// isSeqFunc returns true if the given type is of the form
+// func(yield func(T) bool).
+func isSeqFunc(typ reflect.Type) bool {
+	if typ.Kind() != reflect.Func || typ.NumIn() != 1 || typ.NumOut() != 0 {
+		return false
+	}
+	var yield = typ.In(0)
+	return yield.Kind() == reflect.Func &&
+		yield.NumIn() == 1 &&
+		yield.NumOut() == 1 &&
+		yield.Out(0).Kind() == reflect.Bool
+}
+
+// newSeqStream returns a stream of the values yielded by the given iterator.
+func newSeqStream(convert StructOptions, fn reflect.Value) *Stream {
+	if fn.Type().ConvertibleTo(seqValueType) {
+		return NewSeqStream(fn.Convert(seqValueType).Interface().(iter.Seq[Value]))
+	}
+	var yieldType = fn.Type().In(0)
+	return NewSeqStream(func(yield func(Value) bool) {
+		fn.Call([]reflect.Value{reflect.MakeFunc(yieldType, func(args []reflect.Value) []reflect.Value {
+			var more = yield(NewWith(convert, args[0].Interface()))
+			return []reflect.Value{reflect.ValueOf(more).Convert(yieldType.Out(0))}
+		})})
+	})
+}
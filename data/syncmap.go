@@ -0,0 +1,91 @@
+package data
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+)
+
+// SyncMap is a map that may be updated while concurrent renders read it, e.g.
+// feature flags or other data injected into every render and reloaded in the
+// background.  Sharing a Map in that way is a data race.
+//
+// Each update replaces the entries with a new, immutable Map, so that reads
+// are never blocked and see the entries as of a single point in time.
+// Templates read a SyncMap as that Map: it is resolved when accessed, like a
+// Lazy value (see Resolve), so that a {foreach} over its keys is not affected
+// by updates made during the loop.  Separate accesses may see different
+// entries, though, so a template that needs several consistent values should
+// read the map once with {let}.  Updates copy the entries, so a SyncMap is
+// intended for maps that are read far more often than they are updated.
+type SyncMap struct {
+	mu sync.Mutex // serializes updates
+	m  atomic.Pointer[Map]
+}
+
+// NewSyncMap returns a SyncMap with a copy of the entries of the given map.
+func NewSyncMap(m Map) *SyncMap {
+	var v = new(SyncMap)
+	v.Store(m)
+	return v
+}
+
+// Load returns the current entries of the map, which must not be modified.
+func (v *SyncMap) Load() Map {
+	if m := v.m.Load(); m != nil {
+		return *m
+	}
+	return Map{}
+}
+
+// Key retrieves a value under the named key, or Undefined if it doesn't exist.
+func (v *SyncMap) Key(k string) Value {
+	return v.Load().Key(k)
+}
+
+// Store replaces the entries of the map with a copy of those of the given map.
+func (v *SyncMap) Store(m Map) {
+	var copied = make(Map, len(m))
+	for k, val := range m {
+		copied[k] = val
+	}
+	v.mu.Lock()
+	v.m.Store(&copied)
+	v.mu.Unlock()
+}
+
+// Set sets the value of the given key.
+func (v *SyncMap) Set(key string, val Value) {
+	v.update(func(m Map) { m[key] = val })
+}
+
+// Delete removes the given key.
+func (v *SyncMap) Delete(key string) {
+	v.update(func(m Map) { delete(m, key) })
+}
+
+// update replaces the entries of the map with a copy modified by fn.
+func (v *SyncMap) update(fn func(Map)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var old = v.Load()
+	var m = make(Map, len(old)+1)
+	for k, val := range old {
+		m[k] = val
+	}
+	fn(m)
+	v.m.Store(&m)
+}
+
+func (v *SyncMap) Truthy() bool   { return true }
+func (v *SyncMap) String() string { return v.Load().String() }
+
+func (v *SyncMap) Equals(other Value) bool {
+	o, ok := other.(*SyncMap)
+	return ok && v == o
+}
+
+// MarshalJSON writes the current entries of the map as a JSON object.
+func (v *SyncMap) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.Load())
+}
@@ -0,0 +1,63 @@
+package data
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestSyncMap(t *testing.T) {
+	var initial = Map{"a": Int(1)}
+	var m = NewSyncMap(initial)
+	initial["b"] = Int(2) // the SyncMap has a copy
+
+	var snapshot = m.Load()
+	m.Set("c", Int(3))
+	m.Delete("a")
+	if !DeepEqual(snapshot, Map{"a": Int(1)}) {
+		t.Errorf("expected the snapshot to be unaffected by updates, got %v", snapshot)
+	}
+	if !DeepEqual(m.Load(), Map{"c": Int(3)}) {
+		t.Errorf("expected {c: 3}, got %v", m.Load())
+	}
+	if !m.Key("c").Equals(Int(3)) || m.Key("a") != (Undefined{}) {
+		t.Errorf("unexpected keys: %v, %v", m.Key("c"), m.Key("a"))
+	}
+	if !DeepEqual(Resolve(m), Map{"c": Int(3)}) {
+		t.Errorf("expected Resolve to give the entries, got %v", Resolve(m))
+	}
+	if !DeepEqual(Lookup(Map{"flags": m}, "flags.c"), Int(3)) {
+		t.Errorf("expected Lookup to read the entries")
+	}
+
+	var empty SyncMap
+	if empty.Load() == nil || empty.Key("a") != (Undefined{}) {
+		t.Errorf("expected the zero SyncMap to be empty")
+	}
+}
+
+func TestSyncMapConcurrent(t *testing.T) {
+	var m = NewSyncMap(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				m.Set(strconv.Itoa(i*100+j), Int(j))
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for k, v := range m.Load() {
+					_, _ = k, v.String()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if len(m.Load()) != 400 {
+		t.Errorf("expected 400 keys, got %d", len(m.Load()))
+	}
+}
@@ -2,6 +2,10 @@
 package data
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"iter"
 	"math"
 	"reflect"
 	"sort"
@@ -20,7 +24,8 @@ type Value interface {
 	// Equals returns true if the two values are equal.  Specifically, if:
 	// - They are comparable: they have the same Type, or they are Int and Float
 	// - (Primitives) They have the same value
-	// - (Lists, Maps) They are the same instance
+	// - (Lists, Maps) They are the same instance (see DeepEqual to compare
+	//   their contents)
 	// Uncomparable types and unequal values return false.
 	Equals(other Value) bool
 }
@@ -53,10 +58,164 @@ func (v Map) Key(k string) Value {
 	return result
 }
 
+// All returns an iterator over the indices and values of the list.
+func (v List) All() iter.Seq2[int, Value] {
+	return func(yield func(int, Value) bool) {
+		for i, val := range v {
+			if !yield(i, val) {
+				return
+			}
+		}
+	}
+}
+
+// All returns an iterator over the keys and values of the map, in no
+// particular order.
+func (v Map) All() iter.Seq2[string, Value] {
+	return func(yield func(string, Value) bool) {
+		for k, val := range v {
+			if !yield(k, val) {
+				return
+			}
+		}
+	}
+}
+
+// NewInt returns the given integer as a Value.  Small integers, such as
+// indices, counters, and lengths, share preallocated Values, so that results
+// of arithmetic on them need not be allocated.
+func NewInt(i int64) Value {
+	if minSmallInt <= i && i <= maxSmallInt {
+		return smallInts[i-minSmallInt]
+	}
+	return Int(i)
+}
+
+// NewBool returns the given bool as a Value, which is one of two shared
+// Values.
+func NewBool(b bool) Value {
+	if b {
+		return trueValue
+	}
+	return falseValue
+}
+
+// The range of integers that share preallocated Values.
+const (
+	minSmallInt = -128
+	maxSmallInt = 1024
+)
+
+var (
+	smallInts                   = newSmallInts()
+	trueValue, falseValue Value = Bool(true), Bool(false)
+)
+
+func newSmallInts() []Value {
+	var ints = make([]Value, maxSmallInt-minSmallInt+1)
+	for i := range ints {
+		ints[i] = Int(i + minSmallInt)
+	}
+	return ints
+}
+
 // Marshal ---------
 
+// The Value types marshal to and from JSON, so that a tree of values may be
+// round-tripped through encoding/json.  Undefined is marshaled as null, and so
+// is unmarshaled as Null within a List or Map.  Floats are always marshaled
+// with a decimal point or exponent, so that they are not unmarshaled as Ints,
+// except that NaN and infinite Floats are marshaled as null, as by javascript.
+
 func (v Undefined) MarshalJSON() ([]byte, error) { return []byte("null"), nil }
 func (v Null) MarshalJSON() ([]byte, error)      { return []byte("null"), nil }
+func (v Bool) MarshalJSON() ([]byte, error)      { return json.Marshal(bool(v)) }
+func (v Int) MarshalJSON() ([]byte, error)       { return json.Marshal(int64(v)) }
+func (v String) MarshalJSON() ([]byte, error)    { return json.Marshal(string(v)) }
+func (v List) MarshalJSON() ([]byte, error)      { return json.Marshal([]Value(v)) }
+func (v Map) MarshalJSON() ([]byte, error)       { return json.Marshal(map[string]Value(v)) }
+
+func (v Float) MarshalJSON() ([]byte, error) {
+	if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+		return []byte("null"), nil // as in javascript's JSON.stringify
+	}
+	var buf, err = json.Marshal(float64(v))
+	if err == nil && !bytes.ContainsAny(buf, ".eE") {
+		buf = append(buf, ".0"...)
+	}
+	return buf, err
+}
+
+func (v *Undefined) UnmarshalJSON(buf []byte) error { return unmarshalNull(buf, "Undefined") }
+func (v *Null) UnmarshalJSON(buf []byte) error      { return unmarshalNull(buf, "Null") }
+
+func (v *Bool) UnmarshalJSON(buf []byte) error {
+	return json.Unmarshal(buf, (*bool)(v))
+}
+
+func (v *String) UnmarshalJSON(buf []byte) error {
+	return json.Unmarshal(buf, (*string)(v))
+}
+
+func (v *Int) UnmarshalJSON(buf []byte) error {
+	return json.Unmarshal(buf, (*int64)(v))
+}
+
+func (v *Float) UnmarshalJSON(buf []byte) error {
+	return json.Unmarshal(buf, (*float64)(v))
+}
+
+func (v *List) UnmarshalJSON(buf []byte) error {
+	if string(buf) == "null" {
+		return nil // as encoding/json does for slices and maps
+	}
+	var val, err = decodeJSON(buf)
+	if err != nil {
+		return err
+	}
+	var list, ok = val.(List)
+	if !ok {
+		return fmt.Errorf("data: cannot unmarshal %s into List", buf)
+	}
+	*v = list
+	return nil
+}
+
+func (v *Map) UnmarshalJSON(buf []byte) error {
+	if string(buf) == "null" {
+		return nil // as encoding/json does for slices and maps
+	}
+	var val, err = decodeJSON(buf)
+	if err != nil {
+		return err
+	}
+	var m, ok = val.(Map)
+	if !ok {
+		return fmt.Errorf("data: cannot unmarshal %s into Map", buf)
+	}
+	*v = m
+	return nil
+}
+
+// unmarshalNull returns an error unless the given JSON is null.
+func unmarshalNull(buf []byte, typ string) error {
+	if string(bytes.TrimSpace(buf)) != "null" {
+		return fmt.Errorf("data: cannot unmarshal %s into %s", buf, typ)
+	}
+	return nil
+}
+
+// decodeJSON converts the given JSON to a soy data value, in the manner of
+// New(json.RawMessage(buf)), but returns an error for invalid JSON.
+func decodeJSON(buf []byte) (Value, error) {
+	var dec = json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var obj interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+	return jsonValue(DefaultStructOptions, obj), nil
+}
 
 // Truthy ----------
 
@@ -64,7 +223,7 @@ func (v Undefined) Truthy() bool { return false }
 func (v Null) Truthy() bool      { return false }
 func (v Bool) Truthy() bool      { return bool(v) }
 func (v Int) Truthy() bool       { return v != 0 }
-func (v Float) Truthy() bool     { return v != 0.0 && float64(v) != math.NaN() }
+func (v Float) Truthy() bool     { return v != 0.0 && !math.IsNaN(float64(v)) }
 func (v String) Truthy() bool    { return v != "" }
 func (v List) Truthy() bool      { return true }
 func (v Map) Truthy() bool       { return true }
@@ -75,9 +234,36 @@ func (v Undefined) String() string { panic("Attempted to coerce undefined value
 func (v Null) String() string      { return "null" }
 func (v Bool) String() string      { return strconv.FormatBool(bool(v)) }
 func (v Int) String() string       { return strconv.FormatInt(int64(v), 10) }
-func (v Float) String() string     { return strconv.FormatFloat(float64(v), 'g', -1, 64) }
+func (v Float) String() string     { return formatFloat(float64(v)) }
 func (v String) String() string    { return string(v) }
 
+// formatFloat formats the given number as javascript's Number.toString does, so
+// that the Go renderer prints numbers as the generated javascript does: in
+// plain decimal notation (e.g. 1000000 rather than 1e+06) unless smaller than
+// 1e-6 or at least 1e21, and NaN, Infinity, and -Infinity by name.  Negative
+// zero is printed as 0.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case f == 0:
+		return "0"
+	}
+	if abs := math.Abs(f); 1e-6 <= abs && abs < 1e21 {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	// javascript does not pad the exponent, e.g. 1e-7 rather than 1e-07
+	var str = strconv.FormatFloat(f, 'e', -1, 64)
+	var e = strings.IndexByte(str, 'e')
+	var exp = strings.TrimLeft(str[e+2:], "0")
+	return str[:e+2] + exp
+}
+
 func (v List) String() string {
 	var items = make([]string, len(v))
 	for i, item := range v {
@@ -123,8 +309,11 @@ func (v Bool) Equals(other Value) bool {
 }
 
 func (v String) Equals(other Value) bool {
-	if o, ok := other.(String); ok {
+	switch o := other.(type) {
+	case String:
 		return string(v) == string(o)
+	case Sanitized:
+		return string(v) == o.String()
 	}
 	return false
 }
@@ -162,3 +351,87 @@ func (v Float) Equals(other Value) bool {
 	}
 	return false
 }
+
+// DeepEqual returns true if the two values are equal, comparing Lists element
+// by element and Maps key by key, recursively, rather than by instance as
+// Equals does.  An OrderedMap is equal to a Map or OrderedMap with the same
+// entries, regardless of their order.  Lazy values are computed and compared
+// by their results.  Other values are compared with Equals.
+func DeepEqual(a, b Value) bool {
+	a, b = Resolve(a), Resolve(b)
+	switch a := a.(type) {
+	case List:
+		var b, ok = b.(List)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !DeepEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case Map, *OrderedMap:
+		var am, bm = entries(a), entries(b)
+		if bm == nil || len(am) != len(bm) {
+			return false
+		}
+		for k, av := range am {
+			var bv, ok = bm[k]
+			if !ok || !DeepEqual(av, bv) {
+				return false
+			}
+		}
+		return true
+	}
+	return a.Equals(b)
+}
+
+// Clone returns a deep copy of the given value, copying Lists, Maps, and
+// OrderedMaps recursively, so that the copy may be modified without affecting
+// the original.  Other values are immutable, and are returned as is, except
+// that Lazy values and Streams are shared with the original rather than being
+// computed or consumed.
+func Clone(v Value) Value {
+	switch v := v.(type) {
+	case List:
+		if v == nil {
+			return v
+		}
+		var list = make(List, len(v))
+		for i, elem := range v {
+			list[i] = Clone(elem)
+		}
+		return list
+	case Map:
+		if v == nil {
+			return v
+		}
+		var m = make(Map, len(v))
+		for k, elem := range v {
+			m[k] = Clone(elem)
+		}
+		return m
+	case *OrderedMap:
+		if v == nil {
+			return v
+		}
+		return &OrderedMap{Clone(v.Map).(Map), append([]string(nil), v.keys...)}
+	}
+	return v
+}
+
+// entries returns the entries of the given Map or OrderedMap, or nil if it is
+// neither.
+func entries(v Value) Map {
+	switch v := v.(type) {
+	case Map:
+		if v == nil {
+			return Map{}
+		}
+		return v
+	case *OrderedMap:
+		return entries(v.Map)
+	}
+	return nil
+}
@@ -2,7 +2,11 @@ package data
 
 import (
 	"encoding/json"
+	"iter"
+	"math"
+	"math/big"
 	"reflect"
+	"slices"
 	"testing"
 )
 
@@ -16,6 +20,8 @@ var (
 	_ Value = String("")
 	_ Value = List{}
 	_ Value = Map{}
+	_ Value = &OrderedMap{}
+	_ Value = BigInt{}
 )
 
 // Ensure custom marshalers are implemented
@@ -23,6 +29,21 @@ var (
 var (
 	_ json.Marshaler = Undefined{}
 	_ json.Marshaler = Null{}
+	_ json.Marshaler = Bool(false)
+	_ json.Marshaler = Int(0)
+	_ json.Marshaler = Float(0.0)
+	_ json.Marshaler = String("")
+	_ json.Marshaler = List{}
+	_ json.Marshaler = Map{}
+
+	_ json.Unmarshaler = (*Undefined)(nil)
+	_ json.Unmarshaler = (*Null)(nil)
+	_ json.Unmarshaler = (*Bool)(nil)
+	_ json.Unmarshaler = (*Int)(nil)
+	_ json.Unmarshaler = (*Float)(nil)
+	_ json.Unmarshaler = (*String)(nil)
+	_ json.Unmarshaler = (*List)(nil)
+	_ json.Unmarshaler = (*Map)(nil)
 )
 
 func TestKey(t *testing.T) {
@@ -61,6 +82,101 @@ func TestIndex(t *testing.T) {
 	}
 }
 
+func TestNewInt(t *testing.T) {
+	for _, i := range []int64{math.MinInt64, -129, -128, -1, 0, 1, 255, 256, 1024, 1025, math.MaxInt64} {
+		if actual := NewInt(i); actual != Int(i) {
+			t.Errorf("NewInt(%d) => %#v", i, actual)
+		}
+	}
+	for _, b := range []bool{true, false} {
+		if actual := NewBool(b); actual != Bool(b) {
+			t.Errorf("NewBool(%v) => %#v", b, actual)
+		}
+	}
+
+	// small values are not allocated
+	var sink Value
+	var allocs = testing.AllocsPerRun(100, func() {
+		for i := int64(minSmallInt); i <= maxSmallInt; i++ {
+			sink = NewInt(i)
+		}
+	})
+	if allocs != 0 || sink != Int(maxSmallInt) {
+		t.Errorf("NewInt allocated %v times", allocs)
+	}
+}
+
+func TestAll(t *testing.T) {
+	var list = List{String("a"), Int(1), Null{}}
+	var listVals List
+	for i, val := range list.All() {
+		if i == 2 {
+			break
+		}
+		listVals = append(listVals, val)
+	}
+	if !reflect.DeepEqual(listVals, list[:2]) {
+		t.Errorf("List.All: expected %v, got %v", list[:2], listVals)
+	}
+
+	var m = Map{"a": Int(1), "b": Int(2)}
+	var mapVals = make(Map)
+	for k, val := range m.All() {
+		mapVals[k] = val
+	}
+	if !reflect.DeepEqual(mapVals, m) {
+		t.Errorf("Map.All: expected %v, got %v", m, mapVals)
+	}
+
+	var ordered = NewOrderedMap()
+	for _, k := range []string{"z", "a", "m"} {
+		ordered.Set(k, String(k))
+	}
+	var keys []string
+	for k, val := range ordered.All() {
+		if val != String(k) {
+			t.Errorf("OrderedMap.All: expected %v for %q, got %v", String(k), k, val)
+		}
+		keys = append(keys, k)
+	}
+	if !reflect.DeepEqual(keys, []string{"z", "a", "m"}) {
+		t.Errorf("OrderedMap.All: expected keys in order, got %v", keys)
+	}
+}
+
+func TestFloat(t *testing.T) {
+	var tests = []struct {
+		f        float64
+		expected string
+	}{
+		{0, "0"},
+		{math.Copysign(0, -1), "0"},
+		{1, "1"},
+		{-2.5, "-2.5"},
+		{1e6, "1000000"},
+		{123456789012345680000, "123456789012345680000"},
+		{1e21, "1e+21"},
+		{-1.5e300, "-1.5e+300"},
+		{0.000001, "0.000001"},
+		{0.0000001, "1e-7"},
+		{1.25e-10, "1.25e-10"},
+		{5e-324, "5e-324"},
+		{0.30000000000000004, "0.30000000000000004"},
+		{math.NaN(), "NaN"},
+		{math.Inf(1), "Infinity"},
+		{math.Inf(-1), "-Infinity"},
+	}
+	for _, test := range tests {
+		if actual := Float(test.f).String(); actual != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.f, test.expected, actual)
+		}
+	}
+
+	if Float(math.NaN()).Truthy() || Float(0).Truthy() || !Float(math.Inf(-1)).Truthy() {
+		t.Error("expected NaN and 0 to be falsy, and infinity to be truthy")
+	}
+}
+
 func TestCustomMarhshaling(t *testing.T) {
 	tests := []struct {
 		input    interface{}
@@ -68,6 +184,11 @@ func TestCustomMarhshaling(t *testing.T) {
 	}{
 		{Null{}, []byte("null")},
 		{Undefined{}, []byte("null")},
+		{Float(2), []byte("2.0")},
+		{Float(2.5), []byte("2.5")},
+		{Float(1e21), []byte("1e+21")},
+		{List{Int(1), Float(1), Undefined{}}, []byte("[1,1.0,null]")},
+		{List{Float(math.NaN()), Float(math.Inf(-1))}, []byte("[null,null]")},
 	}
 
 	for _, test := range tests {
@@ -81,3 +202,323 @@ func TestCustomMarhshaling(t *testing.T) {
 		}
 	}
 }
+
+func TestJSONRoundTrip(t *testing.T) {
+	var tests = []Value{
+		Null{},
+		Bool(true),
+		Int(-3),
+		Float(2),
+		Float(0.25),
+		String("<a href=\"x\">"),
+		List{},
+		List{Int(1), Float(1), String("1"), Null{}},
+		Map{},
+		Map{
+			"int":    Int(1),
+			"float":  Float(1.5),
+			"list":   List{Bool(false), Map{"a": Null{}}},
+			"nested": Map{"b": List{}},
+		},
+	}
+	for _, test := range tests {
+		var buf, err = json.Marshal(test)
+		if err != nil {
+			t.Errorf("%v: %v", test, err)
+			continue
+		}
+		var actual = reflect.New(reflect.TypeOf(test))
+		if err = json.Unmarshal(buf, actual.Interface()); err != nil {
+			t.Errorf("%s: %v", buf, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual.Elem().Interface(), test) {
+			t.Errorf("%s => %#v, expected %#v", buf, actual.Elem().Interface(), test)
+		}
+	}
+
+	// Values within a struct
+	type snapshot struct {
+		Template string
+		Data     Map
+	}
+	var expected = snapshot{"ns.tmpl", Map{"x": List{Float(3)}}}
+	var buf, err = json.Marshal(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual snapshot
+	if err = json.Unmarshal(buf, &actual); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("%s => %#v, expected %#v", buf, actual, expected)
+	}
+}
+
+func TestJSONUnmarshalErrors(t *testing.T) {
+	var tests = []struct {
+		input  string
+		target interface{}
+	}{
+		{`1`, new(Null)},
+		{`"a"`, new(Undefined)},
+		{`1.5`, new(Int)},
+		{`"1"`, new(Int)},
+		{`1`, new(Bool)},
+		{`{}`, new(List)},
+		{`[]`, new(Map)},
+	}
+	for _, test := range tests {
+		if err := json.Unmarshal([]byte(test.input), test.target); err == nil {
+			t.Errorf("%s into %T: expected an error", test.input, test.target)
+		}
+	}
+}
+
+func TestOrderedMap(t *testing.T) {
+	var m = NewOrderedMap()
+	m.Set("c", Int(3))
+	m.Set("a", Int(1))
+	m.Set("b", Undefined{})
+	m.Set("c", Int(30))
+	if expected := []string{"c", "a", "b"}; !reflect.DeepEqual(m.Keys(), expected) {
+		t.Errorf("expected keys %v, got %v", expected, m.Keys())
+	}
+	if m.Key("c") != Int(30) || m.Key("z") != (Undefined{}) {
+		t.Errorf("unexpected values: %v, %v", m.Key("c"), m.Key("z"))
+	}
+	if expected := "{c: 30, a: 1, b: undefined}"; m.String() != expected {
+		t.Errorf("expected %q, got %q", expected, m.String())
+	}
+
+	m.Delete("a")
+	m.Delete("z")
+	m.Set("a", Int(1))
+	if expected := []string{"c", "b", "a"}; !reflect.DeepEqual(m.Keys(), expected) {
+		t.Errorf("expected keys %v, got %v", expected, m.Keys())
+	}
+	if !m.Equals(m) || m.Equals(NewOrderedMap()) || m.Equals(m.Map) {
+		t.Error("expected ordered maps to be equal only to themselves")
+	}
+
+	var input = `{"z":1,"y":{"b":[{"d":null,"c":1.5}],"a":"x"},"x":true}`
+	var actual OrderedMap
+	if err := json.Unmarshal([]byte(input), &actual); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"z", "y", "x"}; !reflect.DeepEqual(actual.Keys(), expected) {
+		t.Errorf("expected keys %v, got %v", expected, actual.Keys())
+	}
+	var nested = actual.Key("y").(*OrderedMap).Key("b").(List)[0].(*OrderedMap)
+	if expected := []string{"d", "c"}; !reflect.DeepEqual(nested.Keys(), expected) {
+		t.Errorf("expected nested keys %v, got %v", expected, nested.Keys())
+	}
+	var buf, err = json.Marshal(&actual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != input {
+		t.Errorf("expected %s, got %s", input, buf)
+	}
+
+	if err = json.Unmarshal([]byte(`[]`), &actual); err == nil {
+		t.Error("expected an error unmarshaling a list")
+	}
+}
+
+func TestDeepEqual(t *testing.T) {
+	var list = List{Int(1)}
+	var ordered = NewOrderedMap()
+	ordered.Set("b", List{Int(2)})
+	ordered.Set("a", Int(1))
+	var tests = []struct {
+		a, b     Value
+		expected bool
+	}{
+		{Int(1), Float(1), true},
+		{String("1"), Int(1), false},
+		{Null{}, Undefined{}, false},
+		{list, list, true},
+		{List{}, List(nil), true},
+		{List{Int(1), List{String("a")}}, List{Float(1), List{String("a")}}, true},
+		{List{Int(1)}, List{Int(1), Int(2)}, false},
+		{List{Int(1)}, Map{"0": Int(1)}, false},
+		{Map{}, Map(nil), true},
+		{Map{"a": Map{"b": Null{}}}, Map{"a": Map{"b": Null{}}}, true},
+		{Map{"a": Null{}}, Map{"b": Null{}}, false},
+		{Map{"a": Int(1)}, Map{"a": Int(1), "b": Int(2)}, false},
+		{ordered, Map{"a": Int(1), "b": List{Int(2)}}, true},
+		{Map{"a": Int(1), "b": List{Int(2)}}, ordered, true},
+		{ordered, &OrderedMap{}, false},
+		{&OrderedMap{}, Map{}, true},
+		{NewLazy(func() Value { return List{Int(1)} }), List{Int(1)}, true},
+		{Int(2), NewLazy(func() Value { return Int(2) }), true},
+	}
+	for _, test := range tests {
+		if actual := DeepEqual(test.a, test.b); actual != test.expected {
+			t.Errorf("DeepEqual(%v, %v): expected %v, got %v", test.a, test.b, test.expected, actual)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	var ordered = NewOrderedMap()
+	ordered.Set("b", List{Int(2)})
+	ordered.Set("a", Map{"c": String("c")})
+	var original = Map{
+		"list":    List{Int(1), Map{"x": Null{}}},
+		"ordered": ordered,
+		"nil":     List(nil),
+		"str":     String("s"),
+	}
+
+	var clone = Clone(original).(Map)
+	if !reflect.DeepEqual(clone, original) {
+		t.Fatalf("expected %v, got %v", original, clone)
+	}
+
+	// Modifying the clone does not affect the original.
+	clone["str"] = String("t")
+	clone["list"].(List)[1].(Map)["x"] = Int(1)
+	var clonedOrdered = clone["ordered"].(*OrderedMap)
+	clonedOrdered.Set("z", Int(0))
+	clonedOrdered.Map["a"].(Map)["c"] = String("d")
+	clonedOrdered.Map["b"].(List)[0] = Int(3)
+
+	var expected = Map{
+		"list":    List{Int(1), Map{"x": Null{}}},
+		"ordered": ordered,
+		"nil":     List(nil),
+		"str":     String("s"),
+	}
+	if !DeepEqual(original, expected) ||
+		!reflect.DeepEqual(ordered.Keys(), []string{"b", "a"}) ||
+		original["list"].(List)[1].(Map)["x"] != (Null{}) ||
+		ordered.Map["a"].(Map)["c"] != String("c") ||
+		ordered.Map["b"].(List)[0] != Int(2) {
+		t.Errorf("expected the original to be unmodified, got %v", original)
+	}
+}
+
+func TestLazy(t *testing.T) {
+	var calls int
+	var lazy = NewLazy(func() Value {
+		calls++
+		return NewLazy(func() Value { return Int(42) })
+	})
+	if calls != 0 {
+		t.Fatal("expected the value to not be computed until accessed")
+	}
+	if lazy.String() != "42" || !lazy.Truthy() || !lazy.Equals(Int(42)) {
+		t.Errorf("unexpected value: %v", lazy)
+	}
+	if Resolve(lazy) != Int(42) || calls != 1 {
+		t.Errorf("expected one call resolving to 42, got %v calls resolving to %#v", calls, Resolve(lazy))
+	}
+
+	if v := NewLazy(func() Value { return nil }).Value(); v != (Null{}) {
+		t.Errorf("expected a nil result to be Null, got %#v", v)
+	}
+
+	var m = New(map[string]interface{}{
+		"name": func() string { calls++; return "Rob" },
+		"next": func() (int, bool) { return 0, false },
+	}).(Map)
+	if _, ok := m["next"].(*Stream); !ok {
+		t.Errorf("expected an iterator function to be a Stream, got %T", m["next"])
+	}
+	if v, ok := m["name"].(*Lazy); !ok || v.Value() != String("Rob") || calls != 2 {
+		t.Errorf("expected a lazy Rob, got %#v", m["name"])
+	}
+	if buf, err := json.Marshal(m["name"]); err != nil || string(buf) != `"Rob"` {
+		t.Errorf("expected \"Rob\", got %s, %v", buf, err)
+	}
+}
+
+func TestSeqStream(t *testing.T) {
+	var stream, ok = New(slices.Values([]int{1, 2})).(*Stream)
+	if !ok {
+		t.Fatalf("expected an iterator to be a Stream, got %T", New(slices.Values([]int{1, 2})))
+	}
+	var list List
+	for val, ok := stream.Next(); ok; val, ok = stream.Next() {
+		list = append(list, val)
+	}
+	if !DeepEqual(list, List{Int(1), Int(2)}) {
+		t.Errorf("expected [1, 2], got %v", list)
+	}
+
+	// Streams of values are used as is, and release their iterator when stopped.
+	var stopped bool
+	stream = New(iter.Seq[Value](func(yield func(Value) bool) {
+		defer func() { stopped = true }()
+		for yield(String("a")) {
+		}
+	})).(*Stream)
+	if val, ok := stream.Next(); !ok || val != String("a") {
+		t.Errorf("expected a, got %v", val)
+	}
+	stream.Stop()
+	if _, ok := stream.Next(); ok || !stopped {
+		t.Errorf("expected the stream to be stopped")
+	}
+}
+
+func TestSanitized(t *testing.T) {
+	var html = NewSanitized("html", "<b>hi</b>")
+	if html != SanitizedHtml("<b>hi</b>") || html.(Sanitized).ContentKind() != "html" {
+		t.Errorf("expected sanitized html, got %#v", html)
+	}
+	if v := NewSanitized("text", "<b>"); v != String("<b>") {
+		t.Errorf("expected text to be a String, got %#v", v)
+	}
+	if !html.Equals(SanitizedHtml("<b>hi</b>")) || html.Equals(SanitizedCss("<b>hi</b>")) {
+		t.Error("expected sanitized content to equal only content of the same kind")
+	}
+	if !html.Equals(String("<b>hi</b>")) || !String("<b>hi</b>").Equals(html) ||
+		!DeepEqual(List{html}, List{String("<b>hi</b>")}) || html.Equals(String("hi")) {
+		t.Error("expected sanitized content to equal a String with the same content")
+	}
+	if SanitizedUri("").Truthy() || !SanitizedJs("0").Truthy() {
+		t.Error("expected sanitized content to be truthy if non-empty")
+	}
+	if buf, err := json.Marshal(List{html}); err != nil || string(buf) != `["\u003cb\u003ehi\u003c/b\u003e"]` {
+		t.Errorf("unexpected json: %s, %v", buf, err)
+	}
+	if New(SanitizedCss("a{}")) != SanitizedCss("a{}") {
+		t.Error("expected sanitized content to be converted as is")
+	}
+}
+
+func TestBigInt(t *testing.T) {
+	var x, _ = new(big.Int).SetString("123456789012345678901234567890", 10)
+	var v = New(x)
+	if _, ok := v.(BigInt); !ok || v.String() != "123456789012345678901234567890" {
+		t.Fatalf("expected a BigInt, got %#v", v)
+	}
+	x.SetInt64(1) // BigInts hold a copy
+	if v.String() != "123456789012345678901234567890" || !v.Truthy() {
+		t.Errorf("unexpected value: %v", v)
+	}
+	if New(*big.NewInt(-42)) != Int(-42) || New((*big.Int)(nil)) != (Null{}) {
+		t.Error("expected big.Ints in range to be Ints")
+	}
+	if buf, err := json.Marshal(v); err != nil || string(buf) != "123456789012345678901234567890" {
+		t.Errorf("unexpected json: %s, %v", buf, err)
+	}
+
+	var m Map
+	if err := json.Unmarshal([]byte(`{"id": 123456789012345678901234567890, "n": 1e30}`), &m); err != nil {
+		t.Fatal(err)
+	}
+	if !m["id"].Equals(v) || v.Equals(Int(1)) {
+		t.Errorf("expected %v to equal %v", m["id"], v)
+	}
+	if _, ok := m["n"].(Float); !ok {
+		t.Errorf("expected a Float, got %#v", m["n"])
+	}
+	if f := v.(BigInt).Float(); f != 1.2345678901234568e29 {
+		t.Errorf("unexpected float: %v", f)
+	}
+}
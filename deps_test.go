@@ -0,0 +1,59 @@
+package soy
+
+import (
+	"go/build"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const importPrefix = "github.com/robfig/soy"
+
+// TestDependencies verifies that servers that only render HTML do not link the
+// javascript generator, the message file formats, or the tools.  Each backend
+// is a separate package, which is linked only if it is imported.
+func TestDependencies(t *testing.T) {
+	var forbidden = []string{
+		"github.com/robfig/soy/soyjs",
+		"github.com/robfig/soy/soymsg/pomsg",
+		"github.com/robfig/soy/cmd",
+		"github.com/robfig/soy/soycatalog",
+		"github.com/robfig/soy/soylint",
+		"github.com/robfig/soy/refactor",
+		"github.com/robfig/soy/soytest",
+		"github.com/robfig/soy/soyweb",
+	}
+	for _, pkg := range []string{importPrefix, importPrefix + "/soyhtml"} {
+		var deps = make(map[string]bool)
+		if err := addDeps(deps, pkg); err != nil {
+			t.Fatal(err)
+		}
+		for dep := range deps {
+			for _, f := range forbidden {
+				if dep == f || strings.HasPrefix(dep, f+"/") {
+					t.Errorf("%s depends on %s", pkg, dep)
+				}
+			}
+		}
+	}
+}
+
+// addDeps adds the packages of this repository that the given package imports,
+// directly or indirectly, excluding tests.
+func addDeps(deps map[string]bool, pkg string) error {
+	var dir = filepath.FromSlash("." + strings.TrimPrefix(pkg, importPrefix))
+	var p, err = build.ImportDir(dir, 0)
+	if err != nil {
+		return err
+	}
+	for _, imp := range p.Imports {
+		if deps[imp] || imp != importPrefix && !strings.HasPrefix(imp, importPrefix+"/") {
+			continue
+		}
+		deps[imp] = true
+		if err := addDeps(deps, imp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
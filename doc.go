@@ -136,6 +136,136 @@ you can not call methods on it.
 See soyhtml.StructOptions for knobs to control how your structs get converted to
 data maps.
 
+Templates may also be deployed separately from the binary, as a zip or tar
+archive served over HTTP.  AddTemplateArchiveURL adds a pinned version of the
+templates, verified against its SHA-256 checksum, and Remote follows the latest
+version described by a manifest, polling for new ones:
+
+  var remote = soy.NewRemote("https://cdn.example.com/views/manifest.json",
+      func() *soy.Bundle { return soy.NewBundle(soy.WithConfig(soy.Prod)) })
+  remote.Refresh(ctx)         // fetch and compile the current version
+  go remote.Poll(ctx, time.Minute)
+
+  remote.Tofu().Render(resp, "acme.account.overview", obj)
+
+Evaluation order
+
+Both the Go renderer and the generated javascript evaluate expressions in the
+same order, so that functions with side effects (e.g. that count or log their
+calls) behave the same in each.  Operands and function arguments are evaluated
+left to right, each at most once, except that the following operators evaluate
+only the operands that they need:
+
+ * $a and f() calls f only if $a is truthy.
+ * $a or f() calls f only if $a is falsy.
+ * $a ?: f() calls f only if $a is null or undefined.
+ * $a ? f() : g() calls only one of f and g.
+
+Bitwise operators
+
+In addition to the official Soy operators, expressions may use the bitwise
+operators &, |, ^, << and >> on integers, e.g. to compute flag masks.  They
+bind as in javascript: shifts bind more tightly than comparisons, which bind
+more tightly than &, then ^, then |.
+
+  {$flags | (1 << $bit)}
+
+Integers are 64-bit two's complement, and >> is an arithmetic shift.  It is an
+error to apply them to non-integers, or to shift by a count outside [0, 63].
+In the generated javascript they are implemented by soyutils rather than by
+javascript's own 32-bit operators, so they give the same results, except that
+results beyond +/-2^53 are rounded like any other javascript number.
+
+Since | also introduces a print directive, a | followed by an identifier is
+read as a directive.  Wrap a function call or global in parentheses to use it
+as the right operand, as in {$a | (f())}.
+
+Comparisons
+
+The comparison operators <, <=, > and >= compare two strings by code point, in
+both the Go renderer and the generated javascript (whose own operators compare
+UTF-16 code units).  Otherwise, both operands must be numbers.  For a
+locale-aware collation, replace soyhtml.CompareStrings and, in javascript,
+soy.$$compareStrings with equivalent functions.
+
+Numbers
+
+Both the Go renderer and the generated javascript print numbers as
+javascript's Number.toString does: floats in plain decimal notation, without a
+trailing .0 (e.g. {1000000.0} prints 1000000), unless smaller than 1e-6 or at
+least 1e21 (e.g. 1e-7 and 1e+21), and NaN, Infinity, and -Infinity by name.
+Negative zero prints as 0.  NaN is falsy, like zero.  The |json directive
+writes NaN and infinities as null.
+
+Integers are 64-bit in Go, but javascript numbers represent integers exactly
+only up to +/-2^53, so larger integers print differently in each.
+
+Regular expressions
+
+In addition to the official Soy functions, templates may use regular
+expressions, given as strings:
+
+ * strMatches(str, pattern) returns true if str contains a match of pattern.
+   Anchor the pattern with ^ and $ to match the whole string.
+ * strReplaceAll(str, pattern, replacement) replaces every match of pattern in
+   str.  The replacement is literal, and may not refer to groups.
+
+The Go renderer uses RE2 syntax (package regexp) and the generated javascript
+uses RegExp, so that patterns must be restricted to the syntax that the two
+share to behave the same in each: literals, ., character classes such as [a-z]
+and [^0-9], \d, \w, \b, the anchors ^ and $, the quantifiers *, +, ?, {n,m}
+and their lazy forms (e.g. *?), alternation, and capturing (...) and
+non-capturing (?:...) groups.  Flags such as (?i), named groups, and Unicode
+classes (\pL) are not portable.  Note that \s also matches non-ASCII spaces in
+javascript, and that . matches each half of a character outside the Basic
+Multilingual Plane (e.g. an emoji) in javascript, but the whole character in
+Go.  An invalid pattern fails the render.
+
+Enums
+
+Enums registered with data.RegisterEnum, such as protocol buffer enums, may be
+displayed without mirroring their definitions in the template:
+
+  data.RegisterEnum("acme.Status", acmepb.Status_name)
+
+  {enumName('acme.Status', $order.status)}   // e.g. ACTIVE
+  {enumValue('acme.Status', 'ACTIVE')}       // e.g. 1
+
+Both return null for numbers or names that the enum does not define.  In the
+generated javascript, the enum is given as a table, so it must be named by a
+string literal and registered before the javascript is generated.
+
+Call budgets
+
+A call may be given a time budget, and a template to render in its place if
+the budget is exceeded, so that a slow part of a page (e.g. one that calls a
+function fetching recommendations) degrades rather than delaying the page:
+
+  {call .recommendations budget="50ms" fallback=".spinner"}
+    {param user: $user /}
+  {/call}
+
+The fallback receives the same data and params as the call.  The budget is
+given as a Go duration, and the fallback must be given with it.  An error
+raised by the call within its budget fails the render as usual.  The Go
+renderer abandons a call that exceeds its budget, though it runs to completion
+in the background, and ignores budgets if the Deterministic option is set.  An
+abandoned call is not interrupted, so a function that it calls that never
+returns leaks the goroutine running it; functions should have timeouts of
+their own.  Since the call and its fallback may run at the same time, the data
+of a budgeted call may not contain streams (e.g. channels), which are consumed
+as they are iterated.  The generated javascript ignores budgets.
+
+Packages
+
+Each backend is a separate package, so that a program links only those that it
+imports.  A server that renders HTML with this package and soyhtml does not
+link the javascript generator (soyjs), the message file formats (e.g.
+soymsg/pomsg), or the tools (cmd/soy, soylint, soycatalog, and the like), and
+needs no build tags to exclude them.  Adapters for other libraries, such as
+soyotel for OpenTelemetry, are separate modules, so that this module does not
+depend on those libraries.
+
 Project Status
 
 The goal is full compatibility and feature parity with the official Closure
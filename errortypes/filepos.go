@@ -46,9 +46,10 @@ var _ ErrFilePos = &errFilePos{}
 
 type errFilePos struct {
 	error
-	file string
-	line int
-	col  int
+	file  string
+	line  int
+	col   int
+	kinds []error
 }
 
 func (e *errFilePos) File() string {
@@ -62,3 +63,11 @@ func (e *errFilePos) Line() int {
 func (e *errFilePos) Col() int {
 	return e.col
 }
+
+func (e *errFilePos) Is(target error) bool {
+	return isKind(e.kinds, target)
+}
+
+func (e *errFilePos) Unwrap() error {
+	return e.error
+}
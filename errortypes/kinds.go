@@ -0,0 +1,62 @@
+package errortypes
+
+import "errors"
+
+// The kinds of errors reported by soy.  Errors returned by the soy packages
+// may be identified as one or more of these with errors.Is.
+var (
+	// ErrTemplateNotFound is reported when a template is rendered or called
+	// that does not exist.
+	ErrTemplateNotFound = errors.New("template not found")
+
+	// ErrParse is reported for soy that can not be parsed.
+	ErrParse = errors.New("parse error")
+
+	// ErrType is reported for templates that parse, but fail the checks made
+	// before rendering, e.g. referring to undeclared data.
+	ErrType = errors.New("type error")
+
+	// ErrRender is reported for any failure to render a template.
+	ErrRender = errors.New("render error")
+
+	// ErrMissingParam is reported when a required param is not passed to a
+	// template, or a value that must be defined is undefined.
+	ErrMissingParam = errors.New("missing param")
+)
+
+// Wrap returns an error that wraps err and is also identified, by errors.Is, as
+// each of the given kinds.  If err is an ErrFilePos, so is the result.
+func Wrap(err error, kinds ...error) error {
+	if err == nil {
+		return nil
+	}
+	if pos, ok := err.(*errFilePos); ok {
+		var wrapped = *pos
+		wrapped.kinds = append(append([]error(nil), pos.kinds...), kinds...)
+		return &wrapped
+	}
+	return &kindError{err, kinds}
+}
+
+// kindError is an error identified as one or more kinds.
+type kindError struct {
+	error
+	kinds []error
+}
+
+func (e *kindError) Is(target error) bool {
+	return isKind(e.kinds, target)
+}
+
+func (e *kindError) Unwrap() error {
+	return e.error
+}
+
+func isKind(kinds []error, target error) bool {
+	for _, kind := range kinds {
+		if kind == target {
+			return true
+		}
+	}
+	return false
+}
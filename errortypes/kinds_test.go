@@ -0,0 +1,66 @@
+package errortypes_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/robfig/soy/errortypes"
+)
+
+func TestWrap(t *testing.T) {
+	var tests = []struct {
+		name   string
+		in     error
+		is     []error
+		isNot  []error
+		hasPos bool
+	}{
+		{
+			name:  "errors.New",
+			in:    errortypes.Wrap(errors.New("an error"), errortypes.ErrParse),
+			is:    []error{errortypes.ErrParse},
+			isNot: []error{errortypes.ErrRender},
+		},
+		{
+			name:   "ErrFilePos",
+			in:     errortypes.Wrap(errortypes.NewErrFilePosf("file.soy", 1, 2, "message"), errortypes.ErrRender),
+			is:     []error{errortypes.ErrRender},
+			isNot:  []error{errortypes.ErrParse},
+			hasPos: true,
+		},
+		{
+			name: "multiple kinds",
+			in: errortypes.Wrap(
+				errortypes.Wrap(errors.New("an error"), errortypes.ErrMissingParam),
+				errortypes.ErrRender),
+			is: []error{errortypes.ErrRender, errortypes.ErrMissingParam},
+		},
+		{
+			name: "wrapped by fmt",
+			in: fmt.Errorf("context: %w",
+				errortypes.Wrap(errortypes.NewErrFilePosf("file.soy", 1, 2, "message"), errortypes.ErrTemplateNotFound)),
+			is:    []error{errortypes.ErrTemplateNotFound},
+			isNot: []error{errortypes.ErrType},
+		},
+	}
+	for _, test := range tests {
+		for _, kind := range test.is {
+			if !errors.Is(test.in, kind) {
+				t.Errorf("%s: expected error to be %v", test.name, kind)
+			}
+		}
+		for _, kind := range test.isNot {
+			if errors.Is(test.in, kind) {
+				t.Errorf("%s: expected error not to be %v", test.name, kind)
+			}
+		}
+		if errortypes.IsErrFilePos(test.in) != test.hasPos {
+			t.Errorf("%s: expected IsErrFilePos to be %v", test.name, test.hasPos)
+		}
+	}
+
+	if errortypes.Wrap(nil, errortypes.ErrParse) != nil {
+		t.Error("expected nil")
+	}
+}
@@ -10,10 +10,13 @@ import (
 	"math/rand"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/robertkrimen/otto"
+	"github.com/robfig/soy/ast"
 	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/soyhtml"
 	"github.com/robfig/soy/soyjs"
 )
 
@@ -405,6 +408,88 @@ func TestFeaturesJavascript(t *testing.T) {
 	}
 }
 
+// shortCircuitTests are the conformance tests of the evaluation order of
+// expressions, run against both soyhtml and soyjs.  tick(x) returns x,
+// recording it in ticks.
+var shortCircuitTests = []struct {
+	body, output, ticks string
+}{
+	{"{if tick(0) and tick(1)}y{else}n{/if}", "n", "0"},
+	{"{if tick(1) and tick(2)}y{else}n{/if}", "y", "1,2"},
+	{"{if tick(1) or tick(2)}y{else}n{/if}", "y", "1"},
+	{"{if tick(0) or tick(2)}y{else}n{/if}", "y", "0,2"},
+	{"{if tick(false) or (tick(0) and tick(1))}y{else}n{/if}", "n", "false,0"},
+	{"{if not tick(0) or tick(1)}y{else}n{/if}", "y", "0"},
+	{"{tick(1) ?: tick(2)}", "1", "1"},
+	{"{tick(null) ?: tick(2)}", "2", "null,2"},
+	{"{tick(0) ?: tick(2)}", "0", "0"},
+	{"{tick(1) ? tick(2) : tick(3)}", "2", "1,2"},
+	{"{tick(0) ? tick(2) : tick(3)}", "3", "0,3"},
+	{"{tick(1) + tick(2) * tick(3)}", "7", "1,2,3"},
+	{"{max(tick(1), tick(2))}", "2", "1,2"},
+	{"{round(tick(1.26), tick(1))}", "1.3", "1.26,1"},
+	{"{let $m: ['a': ['b': 1]] /}{$m[tick('a')]?.b}", "1", "a"},
+	{"{let $m: ['a': null] /}{$m[tick('a')]?.b ?: 'none'}", "none", "a"},
+	{"{let $m: ['a': ['b': ['c': 1]]] /}{$m?.a[tick('b')]?.c}", "1", "b"},
+}
+
+func TestShortCircuit(t *testing.T) {
+	var ticks []string
+	var tick = soyhtml.Func{func(v []data.Value) data.Value {
+		ticks = append(ticks, v[0].String())
+		return v[0]
+	}, []int{1}}
+	soyjs.Funcs["tick"] = soyjs.Func{"tick", func(js soyjs.JSWriter, args []ast.Node) {
+		js.Write("tick(", args[0], ")")
+	}, []int{1}}
+	defer delete(soyjs.Funcs, "tick")
+
+	var otto = initJs(t)
+	for _, test := range shortCircuitTests {
+		var registry, err = NewBundle(WithFuncs(map[string]soyhtml.Func{"tick": tick})).
+			AddTemplateString("test.soy", "{namespace test}\n{template .t}"+test.body+"{/template}").
+			Compile()
+		if err != nil {
+			t.Errorf("%s: %v", test.body, err)
+			continue
+		}
+
+		ticks = nil
+		var buf bytes.Buffer
+		var tofu = soyhtml.NewTofu(registry).WithFuncs(map[string]soyhtml.Func{"tick": tick})
+		if err = tofu.Render(&buf, "test.t", nil); err != nil {
+			t.Errorf("%s: %v", test.body, err)
+		} else if buf.String() != test.output || strings.Join(ticks, ",") != test.ticks {
+			t.Errorf("%s: expected %q with ticks %q, got %q with ticks %q",
+				test.body, test.output, test.ticks, buf.String(), strings.Join(ticks, ","))
+		}
+
+		buf.Reset()
+		if err = soyjs.Write(&buf, registry.SoyFiles[0], soyjs.Options{}); err != nil {
+			t.Errorf("%s: %v", test.body, err)
+			continue
+		}
+		var js = otto.Copy()
+		if _, err = js.Run("var ticks = []; function tick(x) { ticks.push(String(x)); return x; }"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = js.Run(buf.String()); err != nil {
+			t.Errorf("%s: %v\n%s", test.body, err, buf.String())
+			continue
+		}
+		actual, err := js.Run("test.t()")
+		if err != nil {
+			t.Errorf("%s: %v\n%s", test.body, err, buf.String())
+			continue
+		}
+		jsTicks, _ := js.Run("ticks.join(',')")
+		if actual.String() != test.output || jsTicks.String() != test.ticks {
+			t.Errorf("%s (js): expected %q with ticks %q, got %q with ticks %q\n%s",
+				test.body, test.output, test.ticks, actual.String(), jsTicks.String(), buf.String())
+		}
+	}
+}
+
 func initJs(t *testing.T) *otto.Otto {
 	var otto = otto.New()
 	soyutilsFile, err := os.Open("soyjs/lib/soyutils.js")
@@ -414,19 +499,16 @@ func initJs(t *testing.T) *otto.Otto {
 	// remove any non-otto compatible regular expressions
 	var soyutilsBuf bytes.Buffer
 	var scanner = bufio.NewScanner(soyutilsFile)
-	var i = 1
 	for scanner.Scan() {
-		switch i {
-		case 2565, 2579, 2586:
+		switch line := scanner.Text(); {
+		case strings.HasPrefix(line, "soy.esc.$$FILTER_FOR_FILTER_CSS_VALUE_ ="),
+			strings.HasPrefix(line, "soy.esc.$$FILTER_FOR_FILTER_HTML_ATTRIBUTES_ ="),
+			strings.HasPrefix(line, "soy.esc.$$FILTER_FOR_FILTER_HTML_ELEMENT_NAME_ ="):
 			// skip these regexes
-			// soy.esc.$$FILTER_FOR_FILTER_CSS_VALUE_
-			// soy.esc.$$FILTER_FOR_FILTER_HTML_ATTRIBUTES_
-			// soy.esc.$$FILTER_FOR_FILTER_HTML_ELEMENT_NAME_
 		default:
 			soyutilsBuf.Write(scanner.Bytes())
 			soyutilsBuf.Write([]byte("\n"))
 		}
-		i++
 	}
 	// load the soyutils library
 	_, err = otto.Run(soyutilsBuf.String())
@@ -0,0 +1,170 @@
+// Package htmltok splits HTML into tags and text, for the tools that inspect
+// the HTML of templates (soylint) and of their output (soydiff).
+//
+// Like a browser, it does not fail on malformed HTML, but it is not a full
+// HTML5 tokenizer: character references are not decoded, and the content of
+// raw text elements (script, style, and textarea) is returned as text.
+package htmltok
+
+import "strings"
+
+// Kind is the kind of a token.
+type Kind int
+
+const (
+	Text     Kind = iota // text, including a "<" that does not begin a tag
+	StartTag             // e.g. <a href="...">
+	EndTag               // e.g. </a>
+	Comment              // a comment, doctype, or processing instruction
+)
+
+// Attr is an attribute of a start tag.
+type Attr struct {
+	Name  string // lowercase
+	Value string // without quotes, or "" if there is no value
+}
+
+// Token is a tag, text, or comment in the HTML.
+type Token struct {
+	Kind        Kind
+	Offset      int    // byte offset of the token in the HTML
+	Data        string // the text, or the lowercase name of the tag
+	Attrs       []Attr // attributes of a start tag, in order
+	SelfClosing bool   // true for a start tag ending in "/>"
+}
+
+// rawTextElements contain text that is not parsed as HTML.
+var rawTextElements = map[string]bool{"script": true, "style": true, "textarea": true}
+
+// Tokenize splits the given HTML into tokens.  Adjacent text may be split
+// across several tokens.
+func Tokenize(src string) []Token {
+	var tokens []Token
+	var i = 0
+	for i < len(src) {
+		var lt = strings.IndexByte(src[i:], '<')
+		if lt == -1 {
+			lt = len(src) - i
+		}
+		if lt > 0 {
+			tokens = append(tokens, Token{Kind: Text, Offset: i, Data: src[i : i+lt]})
+			i += lt
+			continue
+		}
+
+		var rest = src[i+1:]
+		switch {
+		case strings.HasPrefix(rest, "!--"):
+			var n = 1 + skipPast(rest, "-->")
+			tokens = append(tokens, Token{Kind: Comment, Offset: i, Data: src[i : i+n]})
+			i += n
+		case strings.HasPrefix(rest, "!"), strings.HasPrefix(rest, "?"):
+			var n = 1 + skipPast(rest, ">")
+			tokens = append(tokens, Token{Kind: Comment, Offset: i, Data: src[i : i+n]})
+			i += n
+		case strings.HasPrefix(rest, "/"):
+			var name, n = scanName(rest[1:])
+			tokens = append(tokens, Token{Kind: EndTag, Offset: i, Data: name})
+			i += 2 + n + skipPast(rest[1+n:], ">")
+		case rest != "" && isLetter(rest[0]):
+			var tok, n = scanStartTag(rest)
+			tok.Offset = i
+			tokens = append(tokens, tok)
+			i += 1 + n
+			if rawTextElements[tok.Data] && !tok.SelfClosing {
+				var end = strings.Index(strings.ToLower(src[i:]), "</"+tok.Data)
+				if end == -1 {
+					end = len(src) - i
+				}
+				if end > 0 {
+					tokens = append(tokens, Token{Kind: Text, Offset: i, Data: src[i : i+end]})
+				}
+				i += end
+			}
+		default:
+			tokens = append(tokens, Token{Kind: Text, Offset: i, Data: "<"})
+			i++
+		}
+	}
+	return tokens
+}
+
+// scanStartTag scans the start tag following a "<", returning it and the
+// number of bytes read.
+func scanStartTag(src string) (Token, int) {
+	var tok = Token{Kind: StartTag}
+	var i int
+	tok.Data, i = scanName(src)
+	for i < len(src) {
+		switch {
+		case src[i] == '>':
+			return tok, i + 1
+		case strings.HasPrefix(src[i:], "/>"):
+			tok.SelfClosing = true
+			return tok, i + 2
+		case isSpace(src[i]) || src[i] == '/':
+			i++
+			continue
+		}
+
+		// An attribute name may start with any character (e.g. "=").
+		var start = i
+		i++
+		for i < len(src) && !isSpace(src[i]) && !strings.ContainsRune("/>=", rune(src[i])) {
+			i++
+		}
+		var attr = Attr{Name: strings.ToLower(src[start:i])}
+		for i < len(src) && isSpace(src[i]) {
+			i++
+		}
+		if i < len(src) && src[i] == '=' {
+			i++
+			for i < len(src) && isSpace(src[i]) {
+				i++
+			}
+			start = i
+			if i < len(src) && (src[i] == '"' || src[i] == '\'') {
+				var end = strings.IndexByte(src[i+1:], src[i])
+				if end == -1 {
+					end = len(src) - i - 1
+				}
+				attr.Value, i = src[i+1:i+1+end], min(i+end+2, len(src))
+			} else {
+				for i < len(src) && !isSpace(src[i]) && src[i] != '>' {
+					i++
+				}
+				attr.Value = src[start:i]
+			}
+		}
+		tok.Attrs = append(tok.Attrs, attr)
+	}
+	return tok, len(src)
+}
+
+// scanName scans a lowercase tag name, returning it and the number of bytes
+// read.
+func scanName(src string) (string, int) {
+	var i = 0
+	for i < len(src) && !isSpace(src[i]) && src[i] != '/' && src[i] != '>' {
+		i++
+	}
+	return strings.ToLower(src[:i]), i
+}
+
+// skipPast returns the number of bytes up to and including the first sep in
+// src, or the length of src if there is none.
+func skipPast(src, sep string) int {
+	var i = strings.Index(src, sep)
+	if i == -1 {
+		return len(src)
+	}
+	return i + len(sep)
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
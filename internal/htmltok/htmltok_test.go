@@ -0,0 +1,48 @@
+package htmltok
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	var tests = []struct {
+		html   string
+		tokens []Token
+	}{
+		{`a < b`, []Token{
+			{Kind: Text, Offset: 0, Data: "a "},
+			{Kind: Text, Offset: 2, Data: "<"},
+			{Kind: Text, Offset: 3, Data: " b"},
+		}},
+		{`<!DOCTYPE html><!-- <p> -->`, []Token{
+			{Kind: Comment, Offset: 0, Data: "<!DOCTYPE html>"},
+			{Kind: Comment, Offset: 15, Data: "<!-- <p> -->"},
+		}},
+		{`<A Href="/x" title='y' disabled id=z>hi</a >`, []Token{
+			{Kind: StartTag, Offset: 0, Data: "a", Attrs: []Attr{
+				{"href", "/x"}, {"title", "y"}, {"disabled", ""}, {"id", "z"},
+			}},
+			{Kind: Text, Offset: 37, Data: "hi"},
+			{Kind: EndTag, Offset: 39, Data: "a"},
+		}},
+		{`<br/><img src = "a.png" />`, []Token{
+			{Kind: StartTag, Offset: 0, Data: "br", SelfClosing: true},
+			{Kind: StartTag, Offset: 5, Data: "img", Attrs: []Attr{{"src", "a.png"}}, SelfClosing: true},
+		}},
+		{`<script>if (a < b) {}</SCRIPT>`, []Token{
+			{Kind: StartTag, Offset: 0, Data: "script"},
+			{Kind: Text, Offset: 8, Data: "if (a < b) {}"},
+			{Kind: EndTag, Offset: 21, Data: "script"},
+		}},
+		{`<a title="unterminated`, []Token{
+			{Kind: StartTag, Offset: 0, Data: "a", Attrs: []Attr{{"title", "unterminated"}}},
+		}},
+	}
+	for _, test := range tests {
+		var actual = Tokenize(test.html)
+		if !reflect.DeepEqual(actual, test.tokens) {
+			t.Errorf("%s:\nexpected %+v\n     got %+v", test.html, test.tokens, actual)
+		}
+	}
+}
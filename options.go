@@ -0,0 +1,64 @@
+package soy
+
+import (
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/soyhtml"
+	"github.com/robfig/soy/soymsg"
+)
+
+// Option configures a Bundle.  Options are passed to NewBundle, and are
+// equivalent to calling the corresponding Bundle methods.
+type Option func(*Bundle)
+
+// WithGlobals adds the given globals to the bundle, like AddGlobalsMap.
+func WithGlobals(globals data.Map) Option {
+	return func(b *Bundle) { b.AddGlobalsMap(globals) }
+}
+
+// WithConstantFuncs adds the given constant functions to the bundle, like
+// AddConstantFuncs.
+func WithConstantFuncs(funcs data.Map) Option {
+	return func(b *Bundle) { b.AddConstantFuncs(funcs) }
+}
+
+// WithDenylist disallows the use of the named functions and print directives,
+// like Deny.
+func WithDenylist(names ...string) Option {
+	return func(b *Bundle) { b.Deny(names...) }
+}
+
+// WithFuncs makes the given functions available to the templates in the
+// bundle, in addition to soyhtml.Funcs, when rendered with the Tofu returned
+// from CompileToTofu.
+func WithFuncs(funcs map[string]soyhtml.Func) Option {
+	return func(b *Bundle) {
+		if b.funcs == nil {
+			b.funcs = make(map[string]soyhtml.Func, len(funcs))
+		}
+		for name, fn := range funcs {
+			b.funcs[name] = fn
+		}
+	}
+}
+
+// WithMessages sets the message bundle used to render the templates in the
+// bundle with the Tofu returned from CompileToTofu.
+func WithMessages(msgs soymsg.Bundle) Option {
+	return func(b *Bundle) { b.msgs = msgs }
+}
+
+// WithWatch watches the bundle's template files for changes, like WatchFiles.
+func WithWatch(watch bool) Option {
+	return func(b *Bundle) { b.WatchFiles(watch) }
+}
+
+// WithConfig applies the given configuration to the bundle, like Configure.
+func WithConfig(config RenderConfig) Option {
+	return func(b *Bundle) { b.Configure(config) }
+}
+
+// WithArchiveLimits limits the size of template archives and of the files
+// within them, like ArchiveLimits.
+func WithArchiveLimits(maxSize, maxFileSize int64) Option {
+	return func(b *Bundle) { b.ArchiveLimits(maxSize, maxFileSize) }
+}
@@ -59,7 +59,7 @@ const (
 	itemString  // e.g. 'hello world'
 	itemComma   // , (used in function invocations, lists, maps, print directives)
 	itemColon   // : (used in maps, print directives, operators)
-	itemPipe    // | (used in print directives)
+	itemPipe    // | (used in print directives, and as bitwise or)
 
 	// Data ref access tokens
 	itemIdent            // identifier (e.g. function name)
@@ -79,6 +79,10 @@ const (
 	itemMod    // %
 	itemAdd    // +
 	itemSub    // - (binary)
+	itemShl    // <<
+	itemShr    // >>
+	itemBitAnd // &
+	itemBitXor // ^
 	itemEq     // ==
 	itemNotEq  // !=
 	itemGt     // >
@@ -128,6 +132,7 @@ const (
 	itemTemplate    // {template ...}
 	itemLog         // {log}
 	itemDebugger    // {debugger}
+	itemAssert      // {assert ...}
 	// Character commands.
 	itemSpecialChar
 	itemSpace          // {sp}
@@ -168,6 +173,7 @@ func (t itemType) isOp() bool {
 
 var builtinIdents = map[string]itemType{
 	"alias":     itemAlias,
+	"assert":    itemAssert,
 	"call":      itemCall,
 	"case":      itemCase,
 	"css":       itemCss,
@@ -227,6 +233,10 @@ var arithmeticItemsBySymbol = map[string]itemType{
 	"%":   itemMod,
 	"+":   itemAdd,
 	"-":   itemSub,
+	"<<":  itemShl,
+	">>":  itemShr,
+	"&":   itemBitAnd,
+	"^":   itemBitXor,
 	"==":  itemEq,
 	"!=":  itemNotEq,
 	">":   itemGt,
@@ -587,7 +597,8 @@ func lexInsideTag(l *lexer) stateFn {
 	case r >= '0' && r <= '9':
 		l.backup()
 		return lexNumber
-	case r == '*', r == '/', r == '%', r == '+', r == ':', r == '(', r == ')':
+	case r == '*', r == '/', r == '%', r == '+', r == ':', r == '(', r == ')',
+		r == '&', r == '^':
 		// the single-character symbols
 		l.emit(arithmeticItemsBySymbol[string(r)])
 	case r == '>', r == '!', r == '<', r == '=' && l.peek() == '=':
@@ -625,6 +636,7 @@ func lexNegative(l *lexer) stateFn {
 	var lastType = l.lastEmit.typ
 	if lastType == itemInvalid ||
 		lastType.isOp() ||
+		lastType == itemPipe ||
 		lastType == itemLeftDelim ||
 		lastType == itemCase ||
 		lastType == itemComma ||
@@ -222,6 +222,25 @@ var lexTests = []lexTest{
 		tEOF,
 	}},
 
+	{"bitwise", `{1<<2 | $a & -1 ^ 3>>1|id}`, []item{
+		tLeft,
+		{itemInteger, 0, "1"},
+		{itemShl, 0, "<<"},
+		{itemInteger, 0, "2"},
+		{itemPipe, 0, "|"},
+		{itemDollarIdent, 0, "$a"},
+		{itemBitAnd, 0, "&"},
+		{itemInteger, 0, "-1"},
+		{itemBitXor, 0, "^"},
+		{itemInteger, 0, "3"},
+		{itemShr, 0, ">>"},
+		{itemInteger, 0, "1"},
+		{itemPipe, 0, "|"},
+		{itemIdent, 0, "id"},
+		tRight,
+		tEOF,
+	}},
+
 	{"expression", `{"a"+"b" != "ab" and (2 >= 5.0 or (null ?: true))}`, []item{
 		tLeft,
 		{itemString, 0, `"a"`},
@@ -8,6 +8,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/robfig/soy/ast"
@@ -15,17 +16,36 @@ import (
 	"github.com/robfig/soy/errortypes"
 )
 
+// MaxNestingDepth is the maximum depth to which commands (e.g. {if} and
+// {foreach}) and expressions (e.g. parentheses, unary operators, ternaries,
+// function calls, and list and map literals) may be nested.  Parsing and
+// rendering are recursive, so the limit protects them against exhausting the
+// stack on (typically machine-generated) deeply nested templates.  It may be
+// raised if necessary.
+var MaxNestingDepth = 1000
+
+// StrictAttributes makes attributes of the {namespace} declaration other than
+// the known ones (autoescape, requirecss, and cssbase) an error.  By default,
+// any attribute is allowed and recorded in NamespaceNode.Attrs, so that files
+// may carry attributes used by other tools or by newer versions of Soy.
+var StrictAttributes = false
+
+// namespaceAttrs are the attributes of the {namespace} declaration that are
+// known to this package.
+var namespaceAttrs = []string{"autoescape", "requirecss", "cssbase"}
+
 // tree is the parsed representation of a single soy file.
 type tree struct {
 	name      string            // name provided for the input
 	root      *ast.ListNode     // top-level root of the tree
 	text      string            // the full input text
 	lex       *lexer            // lexer provides a sequence of tokens
-	token     [2]item           // two-token lookahead
+	token     [3]item           // three-token lookahead
 	peekCount int               // how many tokens have we backed up?
 	namespace string            // the current namespace, for fully-qualifying template.
 	aliases   map[string]string // map from alias to namespace e.g. {"c": "a.b.c"}
 	inmsg     bool              // true while parsing children of a message node.
+	depth     int               // the current nesting depth
 }
 
 // SoyFile parses the input into a SoyFileNode (the AST).
@@ -47,10 +67,25 @@ func SoyFile(name, text string) (node *ast.SoyFileNode, err error) {
 	}, nil
 }
 
+// enter increments the nesting depth, failing if it exceeds MaxNestingDepth.
+func (t *tree) enter() {
+	t.depth++
+	if t.depth > MaxNestingDepth {
+		t.errorf("nesting depth exceeds the maximum of %d (see parse.MaxNestingDepth)", MaxNestingDepth)
+	}
+}
+
+// leave decrements the nesting depth.
+func (t *tree) leave() {
+	t.depth--
+}
+
 // itemList:
 //	textOrTag*
 // Terminates when it comes across the given end tag.
 func (t *tree) itemList(until ...itemType) *ast.ListNode {
+	t.enter()
+	defer t.leave()
 	var list *ast.ListNode
 	for {
 		var token = t.next()
@@ -167,6 +202,8 @@ func (t *tree) beginTag() ast.Node {
 	case itemDebugger:
 		t.expect(itemRightDelim, "debugger")
 		return &ast.DebuggerNode{token.pos}
+	case itemAssert:
+		return t.parseAssert(token)
 	case itemLet:
 		return t.parseLet(token)
 	case itemAlias:
@@ -175,7 +212,18 @@ func (t *tree) beginTag() ast.Node {
 	case itemNil, itemSpace, itemTab, itemNewline, itemCarriageReturn, itemLeftBrace, itemRightBrace:
 		t.expect(itemRightDelim, "special char")
 		return &ast.RawTextNode{token.pos, []byte(specialChars[token.typ])}
-	case itemIdent, itemDollarIdent, itemNull, itemBool, itemFloat, itemInteger, itemString, itemNegate, itemNot, itemLeftBracket:
+	case itemIdent:
+		if token.val != "key" {
+			t.backup()
+			return t.parsePrint(token)
+		}
+		if t.isKeyCommand() {
+			return t.parseKey(token)
+		}
+		// back up over the ident and the token peeked after it.
+		t.backup2(token)
+		return t.parsePrint(token)
+	case itemDollarIdent, itemNull, itemBool, itemFloat, itemInteger, itemString, itemNegate, itemNot, itemLeftBracket, itemLeftParen:
 		// print is implicit, so the tag may also begin with any value type or unary op.
 		t.backup()
 		fallthrough
@@ -187,6 +235,41 @@ func (t *tree) beginTag() ast.Node {
 	return nil
 }
 
+// isKeyCommand returns true if the "key" ident just read begins a {key}
+// command, rather than referring to a global or function named "key".  "key"
+// is not a builtin ident, since it is also used as an attribute name.
+func (t *tree) isKeyCommand() bool {
+	switch t.peek().typ {
+	case itemDollarIdent, itemIdent, itemNull, itemBool, itemFloat, itemInteger, itemString, itemNot:
+		return true
+	}
+	return false
+}
+
+// "key" has just been read.
+func (t *tree) parseKey(token item) ast.Node {
+	var node = &ast.KeyNode{token.pos, t.parseExpr(0)}
+	t.expect(itemRightDelim, "key")
+	return node
+}
+
+// "assert" has just been read.
+func (t *tree) parseAssert(token item) ast.Node {
+	const ctx = "assert"
+	var expr = t.parseExpr(0)
+	t.expect(itemComma, ctx)
+	var msg = t.expect(itemString, ctx)
+	var message, err = strconv.Unquote(msg.val)
+	if msg.val[0] == '\'' {
+		message, err = unquoteString(msg.val)
+	}
+	if err != nil {
+		t.errorf("error unquoting %s: %s", msg.val, err)
+	}
+	t.expect(itemRightDelim, ctx)
+	return &ast.AssertNode{token.pos, expr, message}
+}
+
 // print has just been read (or inferred)
 func (t *tree) parsePrint(token item) ast.Node {
 	var expr = t.parseExpr(0)
@@ -294,7 +377,7 @@ func (t *tree) parseCall(token item) ast.Node {
 	default:
 		t.backup()
 	}
-	attrs := t.parseAttrs("name", "data")
+	attrs := t.parseAttrs("name", "data", "fragment", "budget", "fallback")
 
 	if templateName == "" {
 		templateName = attrs["name"]
@@ -302,15 +385,7 @@ func (t *tree) parseCall(token item) ast.Node {
 	if templateName == "" {
 		t.errorf("call: template name not found")
 	}
-
-	// If it's not a fully qualified template name, apply the namespace or aliases
-	if templateName[0] == '.' {
-		templateName = t.namespace + templateName
-	} else if dot := strings.Index(templateName, "."); dot != -1 {
-		if alias, ok := t.aliases[templateName[:dot]]; ok {
-			templateName = alias + templateName[dot:]
-		}
-	}
+	templateName = t.qualifyTemplateName(templateName)
 
 	var allData = false
 	var dataNode ast.Node = nil
@@ -322,21 +397,58 @@ func (t *tree) parseCall(token item) ast.Node {
 		}
 	}
 
+	var fragment = t.boolAttr(attrs, "fragment", false)
+	var budget, fallback = t.parseBudget(attrs)
 	switch tok := t.next(); tok.typ {
 	case itemRightDelimEnd:
-		return &ast.CallNode{token.pos, templateName, allData, dataNode, nil}
+		return &ast.CallNode{token.pos, templateName, allData, dataNode, nil, fragment, budget, fallback}
 	case itemRightDelim:
 		body := t.parseCallParams()
 		t.expect(itemLeftDelim, "call")
 		t.expect(itemCallEnd, "call")
 		t.expect(itemRightDelim, "call")
-		return &ast.CallNode{token.pos, templateName, allData, dataNode, body}
+		return &ast.CallNode{token.pos, templateName, allData, dataNode, body, fragment, budget, fallback}
 	default:
 		t.unexpected(tok, "error scanning {call}")
 	}
 	panic("unreachable")
 }
 
+// qualifyTemplateName applies the namespace or aliases to the given template
+// name, if it is not fully qualified.
+func (t *tree) qualifyTemplateName(name string) string {
+	if name[0] == '.' {
+		return t.namespace + name
+	}
+	if dot := strings.Index(name, "."); dot != -1 {
+		if alias, ok := t.aliases[name[:dot]]; ok {
+			return alias + name[dot:]
+		}
+	}
+	return name
+}
+
+// parseBudget returns the budget and fallback template of a call, given by
+// its budget (a duration, e.g. "50ms") and fallback attributes, which must be
+// given together.
+func (t *tree) parseBudget(attrs map[string]string) (time.Duration, string) {
+	var str, hasBudget = attrs["budget"]
+	var fallback, hasFallback = attrs["fallback"]
+	switch {
+	case !hasBudget && !hasFallback:
+		return 0, ""
+	case !hasBudget || !hasFallback:
+		t.errorf("call: budget and fallback must be given together")
+	case fallback == "":
+		t.errorf("call: fallback template name is empty")
+	}
+	var budget, err = time.ParseDuration(str)
+	if err != nil || budget <= 0 {
+		t.errorf("call: budget must be a positive duration, e.g. \"50ms\", got %q", str)
+	}
+	return budget, t.qualifyTemplateName(fallback)
+}
+
 // parseCallParams collects a list of call params, of which there are many
 // different forms:
 // {param a: 'expr'/}
@@ -387,7 +499,7 @@ func (t *tree) parseCallParams() []ast.Node {
 			key = firstIdent.val
 			value = t.itemList(itemParamEnd)
 			t.expect(itemRightDelim, "param")
-			params = append(params, &ast.CallParamContentNode{initial.pos, key, value})
+			params = append(params, &ast.CallParamContentNode{initial.pos, key, value, ""})
 			continue
 		case itemIdent:
 			key = firstIdent.val
@@ -410,7 +522,7 @@ func (t *tree) parseCallParams() []ast.Node {
 			t.expect(itemRightDelim, "param")
 			value = t.itemList(itemParamEnd)
 			t.expect(itemRightDelim, "param")
-			params = append(params, &ast.CallParamContentNode{initial.pos, key, value})
+			params = append(params, &ast.CallParamContentNode{initial.pos, key, value, attrs["kind"]})
 		} else {
 			value = t.parseQuotedExpr(valueStr)
 			t.expect(itemRightDelimEnd, "param")
@@ -551,12 +663,14 @@ func inStringSlice(item string, group []string) bool {
 	return false
 }
 
+// parseAttrs parses the attributes of a command, which must have one of the
+// given names.  If no names are given, any attribute is allowed.
 func (t *tree) parseAttrs(allowedNames ...string) map[string]string {
 	var result = make(map[string]string)
 	for {
 		switch tok := t.next(); tok.typ {
 		case itemIdent:
-			if !inStringSlice(tok.val, allowedNames) {
+			if len(allowedNames) > 0 && !inStringSlice(tok.val, allowedNames) {
 				t.unexpected(tok, fmt.Sprintf("attributes. allowed: %v", allowedNames))
 			}
 			t.expect(itemEquals, "attribute")
@@ -713,10 +827,16 @@ func (t *tree) parseNamespace(token item) ast.Node {
 			name += part.val
 		default:
 			t.backup()
-			var autoescape = t.parseAutoescape(t.parseAttrs("autoescape"))
+			var attrs map[string]string
+			if StrictAttributes {
+				attrs = t.parseAttrs(namespaceAttrs...)
+			} else {
+				attrs = t.parseAttrs()
+			}
+			var autoescape = t.parseAutoescape(attrs)
 			t.expect(itemRightDelim, ctx)
 			t.namespace = name
-			return &ast.NamespaceNode{token.pos, name, autoescape}
+			return &ast.NamespaceNode{token.pos, name, autoescape, attrs}
 		}
 	}
 }
@@ -735,8 +855,10 @@ func (t *tree) parseAutoescape(attrs map[string]string) ast.AutoescapeType {
 		return ast.AutoescapeOn
 	case "false":
 		return ast.AutoescapeOff
+	case "strict":
+		return ast.AutoescapeStrict
 	default:
-		t.errorf(`expected "true", "false", or "contextual" for autoescape, got %q`, val)
+		t.errorf(`expected "true", "false", "contextual", or "strict" for autoescape, got %q`, val)
 	}
 	panic("unreachable")
 }
@@ -754,6 +876,7 @@ func (t *tree) parseTemplate(token item) ast.Node {
 		t.itemList(itemTemplateEnd),
 		autoescape,
 		private,
+		attrs["kind"],
 	}
 	t.expect(itemRightDelim, ctx)
 	return tmpl
@@ -794,19 +917,24 @@ func (t *tree) parseQuotedExpr(str string) ast.Node {
 }
 
 var precedence = map[itemType]int{
-	itemNot:    6,
-	itemNegate: 6,
-	itemMul:    5,
-	itemDiv:    5,
-	itemMod:    5,
-	itemAdd:    4,
-	itemSub:    4,
-	itemEq:     3,
-	itemNotEq:  3,
-	itemGt:     3,
-	itemGte:    3,
-	itemLt:     3,
-	itemLte:    3,
+	itemNot:    10,
+	itemNegate: 10,
+	itemMul:    9,
+	itemDiv:    9,
+	itemMod:    9,
+	itemAdd:    8,
+	itemSub:    8,
+	itemShl:    7,
+	itemShr:    7,
+	itemEq:     6,
+	itemNotEq:  6,
+	itemGt:     6,
+	itemGte:    6,
+	itemLt:     6,
+	itemLte:    6,
+	itemBitAnd: 5,
+	itemBitXor: 4,
+	itemPipe:   3,
 	itemOr:     2,
 	itemAnd:    1,
 	itemElvis:  0,
@@ -822,6 +950,21 @@ func (t *tree) parseExpr(prec int) ast.Node {
 	var tok item
 	for {
 		tok = t.next()
+		if tok.typ == itemPipe {
+			// a pipe followed by an identifier begins a print directive,
+			// unless the identifier is a function call.  otherwise it is a
+			// bitwise or.
+			if next := t.next(); next.typ == itemIdent {
+				if t.next().typ != itemLeftParen {
+					t.backup3(tok, next)
+					return n
+				}
+				t.backup3(tok, next)
+				t.next()
+			} else {
+				t.backup()
+			}
+		}
 		q := precedence[tok.typ]
 		if !isBinaryOp(tok.typ) || q < prec {
 			break
@@ -842,10 +985,15 @@ func (t *tree) parseExpr(prec int) ast.Node {
 func (t *tree) parseExprFirstTerm() ast.Node {
 	switch tok := t.next(); {
 	case isUnaryOp(tok):
-		return newUnaryOpNode(tok, t.parseExpr(precedence[tok.typ]))
+		t.enter()
+		n := newUnaryOpNode(tok, t.parseExpr(precedence[tok.typ]))
+		t.leave()
+		return n
 	case tok.typ == itemLeftParen:
+		t.enter()
 		n := t.parseExpr(0)
 		t.expect(itemRightParen, "soy expression")
+		t.leave()
 		return n
 	case isValue(tok):
 		return t.newValueNode(tok)
@@ -883,8 +1031,10 @@ func (t *tree) parseDataRef(tok item) ast.Node {
 			nullsafe = 1
 			fallthrough
 		case itemLeftBracket:
+			t.enter()
 			accessNode = &ast.DataRefExprNode{tok.pos, nullsafe == 1, t.parseExpr(0)}
 			t.expect(itemRightBracket, "dataref")
+			t.leave()
 		default:
 			t.backup()
 			return ref
@@ -895,6 +1045,8 @@ func (t *tree) parseDataRef(tok item) ast.Node {
 
 // "[" has just been read
 func (t *tree) parseListOrMap(token item) ast.Node {
+	t.enter()
+	defer t.leave()
 	// check if it's empty
 	switch t.next().typ {
 	case itemColon:
@@ -971,6 +1123,8 @@ func (t *tree) parseMapLiteral(first item, expr ast.Node) ast.Node {
 // parseTernary parses the ternary operator within an expression.
 // itemTernIf has already been read, and the condition is provided.
 func (t *tree) parseTernary(cond ast.Node) ast.Node {
+	t.enter()
+	defer t.leave()
 	n1 := t.parseExpr(0)
 	t.expect(itemColon, "ternary")
 	n2 := t.parseExpr(0)
@@ -986,6 +1140,7 @@ func isBinaryOp(typ itemType) bool {
 	switch typ {
 	case itemMul, itemDiv, itemMod,
 		itemAdd, itemSub,
+		itemShl, itemShr, itemBitAnd, itemBitXor, itemPipe,
 		itemEq, itemNotEq, itemGt, itemGte, itemLt, itemLte,
 		itemOr, itemAnd, itemElvis:
 		return true
@@ -1031,6 +1186,16 @@ func newBinaryOpNode(t item, n1, n2 ast.Node) ast.Node {
 		return &ast.AddNode{op(bin, "+")}
 	case itemSub:
 		return &ast.SubNode{op(bin, "-")}
+	case itemShl:
+		return &ast.ShiftLeftNode{op(bin, "<<")}
+	case itemShr:
+		return &ast.ShiftRightNode{op(bin, ">>")}
+	case itemBitAnd:
+		return &ast.BitAndNode{op(bin, "&")}
+	case itemBitXor:
+		return &ast.BitXorNode{op(bin, "^")}
+	case itemPipe:
+		return &ast.BitOrNode{op(bin, "|")}
 	case itemEq:
 		return &ast.EqNode{op(bin, "==")}
 	case itemNotEq:
@@ -1117,6 +1282,8 @@ func (t *tree) newGlobalNode(tok, next item) ast.Node {
 }
 
 func (t *tree) newFunctionNode(tok item) ast.Node {
+	t.enter()
+	defer t.leave()
 	node := &ast.FunctionNode{tok.pos, tok.val, nil}
 	if t.peek().typ == itemRightParen {
 		t.next()
@@ -1169,6 +1336,14 @@ func (t *tree) backup2(t1 item) {
 	t.peekCount = 2
 }
 
+// backup3 backs the input stream up three tokens.
+// The zeroth token is already there.
+func (t *tree) backup3(t2, t1 item) { // Reverse order: we're pushing back.
+	t.token[1] = t1
+	t.token[2] = t2
+	t.peekCount = 3
+}
+
 // peek returns but does not consume the next token.
 func (t *tree) peek() item {
 	if t.peekCount > 0 {
@@ -1195,6 +1370,7 @@ func (t *tree) recover(errp *error) {
 	} else {
 		*errp = e.(error)
 	}
+	*errp = errortypes.Wrap(*errp, errortypes.ErrParse)
 }
 
 // expect consumes the next token and guarantees it has the required type.
@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/robfig/soy/ast"
 	"github.com/robfig/soy/errortypes"
@@ -36,7 +37,7 @@ func tFile(nodes ...ast.Node) ast.Node {
 }
 
 func tTemplate(name string, nodes ...ast.Node) ast.Node {
-	n := &ast.TemplateNode{0, name, nil, ast.AutoescapeOn, false}
+	n := &ast.TemplateNode{0, name, nil, ast.AutoescapeOn, false, ""}
 	n.Body = newList(0)
 	n.Body.Nodes = nodes
 	return n
@@ -60,7 +61,10 @@ func str(value string) *ast.StringNode {
 
 var parseTests = []parseTest{
 	{"empty", "", tFile()},
-	{"namespace", "{namespace soy.example}", tFile(&ast.NamespaceNode{0, "soy.example", 0})},
+	{"namespace", "{namespace soy.example}", tFile(&ast.NamespaceNode{0, "soy.example", 0, nil})},
+	{"namespace attrs", `{namespace soy.example autoescape="strict" requirecss="a.b" lint="off"}`, tFile(
+		&ast.NamespaceNode{0, "soy.example", ast.AutoescapeStrict,
+			map[string]string{"autoescape": "strict", "requirecss": "a.b", "lint": "off"}})},
 	{"empty template", "{template .name}{/template}", tFile(tTemplate(".name"))},
 	{"text template", "{template .name}\nHello world!\n{/template}",
 		tFile(tTemplate(".name", newText(0, "Hello world!")))},
@@ -162,6 +166,15 @@ var parseTests = []parseTest{
 	)},
 
 	{"debugger", "{debugger}", tFile(&ast.DebuggerNode{0})},
+	{"key", "{key $id}{key 'a' + $i}{key}", tFile(
+		&ast.KeyNode{0, &ast.DataRefNode{0, "id", nil}},
+		&ast.KeyNode{0, &ast.AddNode{bin(str("a"), &ast.DataRefNode{0, "i", nil})}},
+		&ast.PrintNode{0, &ast.GlobalNode{0, "key", nil}, nil},
+	)},
+	{"assert", `{assert $id > 0, "id must be positive"}{assert $id, 'a \'b\''}`, tFile(
+		&ast.AssertNode{0, &ast.GtNode{bin(&ast.DataRefNode{0, "id", nil}, &ast.IntNode{0, 0})}, "id must be positive"},
+		&ast.AssertNode{0, &ast.DataRefNode{0, "id", nil}, "a 'b'"},
+	)},
 	{"global", "{GLOBAL_STR}{app.GLOBAL}", tFile(
 		&ast.PrintNode{0, &ast.GlobalNode{0, "GLOBAL_STR", nil}, nil},
 		&ast.PrintNode{0, &ast.GlobalNode{0, "app.GLOBAL", nil}, nil},
@@ -209,6 +222,21 @@ var parseTests = []parseTest{
 		&ast.FloatNode{0, 0.5},
 	)}, nil})},
 
+	{"bitwise", `{1 | 2 & 3 ^ 4 << 1 + 1 == 8 |escapeHtml}`, tFile(&ast.PrintNode{0, &ast.BitOrNode{bin(
+		&ast.IntNode{0, 1},
+		&ast.BitXorNode{bin(
+			&ast.BitAndNode{bin(&ast.IntNode{0, 2}, &ast.IntNode{0, 3})},
+			&ast.EqNode{bin(
+				&ast.ShiftLeftNode{bin(
+					&ast.IntNode{0, 4},
+					&ast.AddNode{bin(&ast.IntNode{0, 1}, &ast.IntNode{0, 1})})},
+				&ast.IntNode{0, 8})})})}, []*ast.PrintDirectiveNode{{0, "escapeHtml", nil}}})},
+
+	{"bitwise or function", `{1 | max(2, 3) |escapeHtml}`, tFile(&ast.PrintNode{0, &ast.BitOrNode{bin(
+		&ast.IntNode{0, 1},
+		&ast.FunctionNode{0, "max", []ast.Node{&ast.IntNode{0, 2}, &ast.IntNode{0, 3}}})},
+		[]*ast.PrintDirectiveNode{{0, "escapeHtml", nil}}})},
+
 	{"function", `{hasData()}`, tFile(&ast.PrintNode{0, &ast.FunctionNode{0, "hasData", nil}, nil})},
 
 	{"empty list", `{[]}`, tFile(&ast.PrintNode{0, &ast.ListLiteralNode{0, nil}, nil})},
@@ -363,18 +391,18 @@ var parseTests = []parseTest{
   {param zoo: 0 /}
   {param doo kind="html"}doopoo{/param}
 {/call}`, tFile(
-		&ast.CallNode{0, ".booTemplate_", false, nil, nil},
-		&ast.CallNode{0, "foo.goo.mooTemplate", true, nil, nil},
+		&ast.CallNode{0, ".booTemplate_", false, nil, nil, false, 0, ""},
+		&ast.CallNode{0, "foo.goo.mooTemplate", true, nil, nil, false, 0, ""},
 		&ast.CallNode{0, ".zooTemplate", false, &ast.DataRefNode{0, "animals", nil}, []ast.Node{
 			&ast.CallParamValueNode{0, "yoo", &ast.FunctionNode{0, "round", []ast.Node{&ast.DataRefNode{0, "too", nil}}}},
-			&ast.CallParamContentNode{0, "woo", tList(newText(0, "poo"))},
-			&ast.CallParamContentNode{0, "doo", tList(newText(0, "doopoo"))}}},
-		&ast.CallNode{0, "a.long.template.booTemplate_", false, nil, nil},
+			&ast.CallParamContentNode{0, "woo", tList(newText(0, "poo")), ""},
+			&ast.CallParamContentNode{0, "doo", tList(newText(0, "doopoo")), "html"}}, false, 0, ""},
+		&ast.CallNode{0, "a.long.template.booTemplate_", false, nil, nil, false, 0, ""},
 		&ast.CallNode{0, ".zooTemplate", false, &ast.DataRefNode{0, "animals", nil}, []ast.Node{
 			&ast.CallParamValueNode{0, "yoo", &ast.FunctionNode{0, "round", []ast.Node{&ast.DataRefNode{0, "too", nil}}}},
-			&ast.CallParamContentNode{0, "woo", tList(newText(0, "poo"))},
+			&ast.CallParamContentNode{0, "woo", tList(newText(0, "poo")), ""},
 			&ast.CallParamValueNode{0, "zoo", &ast.IntNode{0, 0}},
-			&ast.CallParamContentNode{0, "doo", tList(newText(0, "doopoo"))}}},
+			&ast.CallParamContentNode{0, "doo", tList(newText(0, "doopoo")), "html"}}, false, 0, ""},
 	)},
 
 	{"let", `
@@ -402,7 +430,15 @@ var parseTests = []parseTest{
 	)},
 
 	{"alias", `{alias a.b.c}{call c.d/}`, tFile(
-		&ast.CallNode{0, "a.b.c.d", false, nil, nil},
+		&ast.CallNode{0, "a.b.c.d", false, nil, nil, false, 0, ""},
+	)},
+
+	{"call fragment", `{call .header fragment="true" /}`, tFile(
+		&ast.CallNode{0, ".header", false, nil, nil, true, 0, ""},
+	)},
+
+	{"call budget", `{alias a.b}{call .recs budget="50ms" fallback="b.spinner" /}`, tFile(
+		&ast.CallNode{0, ".recs", false, nil, nil, false, 50 * time.Millisecond, "a.b.spinner"},
 	)},
 
 	{"msg html", `
@@ -514,7 +550,9 @@ func eqTree(t *testing.T, expected, actual ast.Node) bool {
 	case *ast.ListNode:
 		return eqNodes(t, expected.(*ast.ListNode).Nodes, actual.(*ast.ListNode).Nodes)
 	case *ast.NamespaceNode:
-		return eqstr(t, "namespace", expected.(*ast.NamespaceNode).Name, actual.(*ast.NamespaceNode).Name)
+		return eqstr(t, "namespace", expected.(*ast.NamespaceNode).Name, actual.(*ast.NamespaceNode).Name) &&
+			eqint(t, "autoescape", int64(expected.(*ast.NamespaceNode).Autoescape), int64(actual.(*ast.NamespaceNode).Autoescape)) &&
+			eqstr(t, "namespace attrs", expected.(*ast.NamespaceNode).String(), actual.(*ast.NamespaceNode).String())
 	case *ast.TemplateNode:
 		if expected.(*ast.TemplateNode).Name != actual.(*ast.TemplateNode).Name {
 			return false
@@ -527,6 +565,11 @@ func eqTree(t *testing.T, expected, actual ast.Node) bool {
 			eqstr(t, "css", expected.(*ast.CssNode).Suffix, actual.(*ast.CssNode).Suffix)
 	case *ast.DebuggerNode:
 		return true
+	case *ast.KeyNode:
+		return eqTree(t, expected.(*ast.KeyNode).Key, actual.(*ast.KeyNode).Key)
+	case *ast.AssertNode:
+		return eqTree(t, expected.(*ast.AssertNode).Expr, actual.(*ast.AssertNode).Expr) &&
+			eqstr(t, "assert", expected.(*ast.AssertNode).Message, actual.(*ast.AssertNode).Message)
 	case *ast.LogNode:
 		return eqTree(t, expected.(*ast.LogNode).Body, actual.(*ast.LogNode).Body)
 	case *ast.LetValueNode:
@@ -583,7 +626,8 @@ func eqTree(t *testing.T, expected, actual ast.Node) bool {
 	case *ast.NegateNode:
 		return eqTree(t, expected.(*ast.NegateNode).Arg, actual.(*ast.NegateNode).Arg)
 	case *ast.MulNode, *ast.DivNode, *ast.ModNode, *ast.AddNode, *ast.SubNode, *ast.EqNode, *ast.NotEqNode,
-		*ast.GtNode, *ast.GteNode, *ast.LtNode, *ast.LteNode, *ast.OrNode, *ast.AndNode, *ast.ElvisNode:
+		*ast.GtNode, *ast.GteNode, *ast.LtNode, *ast.LteNode, *ast.OrNode, *ast.AndNode, *ast.ElvisNode,
+		*ast.ShiftLeftNode, *ast.ShiftRightNode, *ast.BitAndNode, *ast.BitOrNode, *ast.BitXorNode:
 		return eqBinOp(t, expected, actual)
 	case *ast.TernNode:
 		return eqTree(t, expected.(*ast.TernNode).Arg1, actual.(*ast.TernNode).Arg1) &&
@@ -618,6 +662,9 @@ func eqTree(t *testing.T, expected, actual ast.Node) bool {
 
 	case *ast.CallNode:
 		return eqstr(t, "call", expected.(*ast.CallNode).Name, actual.(*ast.CallNode).Name) &&
+			eqbool(t, "call fragment", expected.(*ast.CallNode).Fragment, actual.(*ast.CallNode).Fragment) &&
+			eqint(t, "call budget", int64(expected.(*ast.CallNode).Budget), int64(actual.(*ast.CallNode).Budget)) &&
+			eqstr(t, "call fallback", expected.(*ast.CallNode).Fallback, actual.(*ast.CallNode).Fallback) &&
 			eqTree(t, expected.(*ast.CallNode).Data, actual.(*ast.CallNode).Data) &&
 			eqNodes(t, expected.(*ast.CallNode).Params, actual.(*ast.CallNode).Params)
 	case *ast.CallParamValueNode:
@@ -625,6 +672,7 @@ func eqTree(t *testing.T, expected, actual ast.Node) bool {
 			eqTree(t, expected.(*ast.CallParamValueNode).Value, actual.(*ast.CallParamValueNode).Value)
 	case *ast.CallParamContentNode:
 		return eqstr(t, "param", expected.(*ast.CallParamContentNode).Key, actual.(*ast.CallParamContentNode).Key) &&
+			eqstr(t, "kind", expected.(*ast.CallParamContentNode).Kind, actual.(*ast.CallParamContentNode).Kind) &&
 			eqTree(t, expected.(*ast.CallParamContentNode).Content, actual.(*ast.CallParamContentNode).Content)
 
 	case *ast.IfNode:
@@ -747,6 +795,16 @@ func TestPlural(t *testing.T) {
 
 // Parser tests imported from the official Soy project
 
+func TestCallBudget(t *testing.T) {
+	works(t, `{call .a budget="1s" fallback=".b" /}`)
+	works(t, `{call .a budget="50ms" fallback="ns.b"}{param x: 1 /}{/call}`)
+	fails(t, `{call .a budget="50ms" /}`)
+	fails(t, `{call .a fallback=".b" /}`)
+	fails(t, `{call .a budget="50" fallback=".b" /}`)
+	fails(t, `{call .a budget="-1s" fallback=".b" /}`)
+	fails(t, `{call .a budget="1s" fallback="" /}`)
+}
+
 func TestRecognizeSoyTag(t *testing.T) {
 	works(t, "{sp}")
 	works(t, "{ sp }")
@@ -842,6 +900,7 @@ func TestRecognizeCommands(t *testing.T) {
 
 	works(t, "{log}Blah blah.{/log}")
 	works(t, "{debugger}")
+	works(t, "{key $foo}")
 	works(t, "{let $foo : 1 + 2/}\n")
 	works(t, "{let $foo : '\"'/}\n")
 	works(t, "{let $foo}Hello{/let}\n")
@@ -920,6 +979,47 @@ func TestErrorFilePos(t *testing.T) {
 		3, 2)
 }
 
+func TestMaxNestingDepth(t *testing.T) {
+	defer func(depth int) { MaxNestingDepth = depth }(MaxNestingDepth)
+	MaxNestingDepth = 10
+	var nested = func(n int, open, close string) string {
+		return strings.Repeat(open, n) + "1" + strings.Repeat(close, n)
+	}
+
+	// The soy file itself counts as the first level.
+	works(t, nested(9, "{if true}", "{/if}"))
+	works(t, "{print "+nested(9, "(", ")")+"}")
+	fails(t, nested(10, "{foreach $x in $xs}", "{/foreach}"))
+	fails(t, "{print "+nested(10, "(", ")")+"}")
+
+	// Each kind of nested expression counts towards the limit.  (The operand
+	// of the addition is needed for "-" to be read as a negation.)
+	var exprs = []struct{ open, close string }{
+		{"[", "]"},
+		{"['a': ", "]"},
+		{"not ", ""},
+		{"- ", ""},
+		{"true ? 1 : ", ""},
+		{"max(1, ", ")"},
+		{"$x[", "]"},
+	}
+	for _, expr := range exprs {
+		works(t, "{print 0 + "+nested(9, expr.open, expr.close)+"}")
+		fails(t, "{print 0 + "+nested(10, expr.open, expr.close)+"}")
+	}
+	failsWithErrFilePos(t, "{if true}\n"+nested(9, "{if true}", "{/if}")+"{/if}", 2, 82)
+
+	MaxNestingDepth = 1000
+	works(t, nested(999, "{if true}", "{/if}"))
+}
+
+func TestStrictAttributes(t *testing.T) {
+	defer func(strict bool) { StrictAttributes = strict }(StrictAttributes)
+	StrictAttributes = true
+	works(t, `{namespace a autoescape="strict" requirecss="b" cssbase="c"}`)
+	fails(t, `{namespace a lint="off"}`)
+}
+
 // regression: ensures that the lexer is drained (and thus its run goroutine cleaned up) on an aborted parse.
 func TestDrainsLexer(t *testing.T) {
 	var (
@@ -0,0 +1,34 @@
+package parsepasses
+
+import (
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/template"
+)
+
+// StripAsserts removes the {assert} commands from all templates in the
+// registry, so that production builds do not pay for checks meant for
+// development.  Bundles apply it, after checking the data references of the
+// templates, when configured to strip asserts.
+func StripAsserts(reg template.Registry) error {
+	for _, t := range reg.Templates {
+		stripAsserts(t.Node)
+	}
+	return nil
+}
+
+func stripAsserts(node ast.Node) {
+	if list, ok := node.(*ast.ListNode); ok {
+		var nodes = list.Nodes[:0]
+		for _, child := range list.Nodes {
+			if _, ok := child.(*ast.AssertNode); !ok {
+				nodes = append(nodes, child)
+			}
+		}
+		list.Nodes = nodes
+	}
+	if parent, ok := node.(ast.ParentNode); ok {
+		for _, child := range parent.Children() {
+			stripAsserts(child)
+		}
+	}
+}
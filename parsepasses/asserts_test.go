@@ -0,0 +1,26 @@
+package parsepasses
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripAsserts(t *testing.T) {
+	var reg = mustRegistry(t, `{namespace test}
+
+/** @param id */
+{template .main}
+  {assert $id > 0, "id must be positive"}
+  {if $id}
+    {assert $id < 10, "id must be small"}
+    {$id}
+  {/if}
+{/template}`)
+	if err := StripAsserts(reg); err != nil {
+		t.Fatal(err)
+	}
+	var actual = reg.Templates[0].Node.String()
+	if strings.Contains(actual, "assert") || !strings.Contains(actual, "{$id}") {
+		t.Errorf("expected the asserts to be removed, got %v", actual)
+	}
+}
@@ -0,0 +1,100 @@
+package parsepasses
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/template"
+)
+
+// CallGraph returns a map from the name of each template in the registry to
+// the sorted, de-duplicated names of the templates that it {call}s.
+func CallGraph(reg template.Registry) map[string][]string {
+	var graph = make(map[string][]string, len(reg.Templates))
+	for _, t := range reg.Templates {
+		graph[t.Node.Name] = Callees(t.Node)
+	}
+	return graph
+}
+
+// Callees returns the sorted, de-duplicated names of the templates called from
+// within the given node, including the fallbacks of budgeted calls.
+func Callees(node ast.Node) []string {
+	var seen = make(map[string]bool)
+	var names []string
+	var visit func(ast.Node)
+	visit = func(node ast.Node) {
+		if call, ok := node.(*ast.CallNode); ok {
+			for _, name := range []string{call.Name, call.Fallback} {
+				if name != "" && !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+		if parent, ok := node.(ast.ParentNode); ok {
+			for _, child := range parent.Children() {
+				visit(child)
+			}
+		}
+	}
+	visit(node)
+	sort.Strings(names)
+	return names
+}
+
+// UnreachableTemplates returns the sorted names of all templates in the
+// registry that can not be reached by following {call}s from any of the given
+// entry points.  Those templates are candidates for deletion.
+//
+// Templates that are rendered by a name computed at runtime can not be found
+// by examining the call graph.  Any template whose name matches one of the
+// allowlist patterns (using path.Match syntax, e.g. "ns.widgets.*") is treated
+// as an additional entry point.
+//
+// Deltemplates and {delcall} are not supported by the parser, so every
+// template in the registry is an ordinary template reached only by {call}.
+func UnreachableTemplates(reg template.Registry, entryPoints, allowlist []string) ([]string, error) {
+	var (
+		graph = CallGraph(reg)
+		live  = make(map[string]bool)
+		queue []string
+	)
+	for _, name := range entryPoints {
+		if _, ok := graph[name]; !ok {
+			return nil, fmt.Errorf("entry point %q not found", name)
+		}
+		queue = append(queue, name)
+	}
+	for _, pattern := range allowlist {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("allowlist pattern %q: %v", pattern, err)
+		}
+		for name := range graph {
+			if matched, _ := path.Match(pattern, name); matched {
+				queue = append(queue, name)
+			}
+		}
+	}
+
+	for len(queue) > 0 {
+		var name = queue[0]
+		queue = queue[1:]
+		if live[name] {
+			continue
+		}
+		live[name] = true
+		queue = append(queue, graph[name]...)
+	}
+
+	var dead []string
+	for name := range graph {
+		if !live[name] {
+			dead = append(dead, name)
+		}
+	}
+	sort.Strings(dead)
+	return dead, nil
+}
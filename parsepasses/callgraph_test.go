@@ -0,0 +1,79 @@
+package parsepasses
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/robfig/soy/parse"
+	"github.com/robfig/soy/template"
+)
+
+const callGraphTestSoy = `{namespace test}
+
+{template .main}
+  {call .header /}
+  {if true}{call .body}{param content}{call .widget /}{/param}{/call}{/if}
+{/template}
+
+{template .header}{call .logo budget="10ms" fallback=".logoText" /}{call .logo /}{/template}
+{template .logo}{/template}
+{template .logoText}{/template}
+{template .body}{/template}
+{template .widget}{/template}
+{template .orphan}{call .orphanChild /}{/template}
+{template .orphanChild}{/template}
+{template .dynamicFoo}{/template}
+{template .dynamicBar}{/template}
+`
+
+func TestUnreachableTemplates(t *testing.T) {
+	var tree, err = parse.SoyFile("", callGraphTestSoy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reg template.Registry
+	if err = reg.Add(tree); err != nil {
+		t.Fatal(err)
+	}
+
+	var graph = CallGraph(reg)
+	if expected := []string{"test.body", "test.header", "test.widget"}; !reflect.DeepEqual(graph["test.main"], expected) {
+		t.Errorf("callees of main: expected %v, got %v", expected, graph["test.main"])
+	}
+	if expected := []string{"test.logo", "test.logoText"}; !reflect.DeepEqual(graph["test.header"], expected) {
+		t.Errorf("callees of header: expected %v, got %v", expected, graph["test.header"])
+	}
+
+	var tests = []struct {
+		entryPoints []string
+		allowlist   []string
+		dead        []string
+	}{
+		{[]string{"test.main"}, nil,
+			[]string{"test.dynamicBar", "test.dynamicFoo", "test.orphan", "test.orphanChild"}},
+		{[]string{"test.main"}, []string{"test.dynamic*"},
+			[]string{"test.orphan", "test.orphanChild"}},
+		{[]string{"test.main", "test.orphan"}, []string{"test.dynamicFoo"},
+			[]string{"test.dynamicBar"}},
+		{[]string{"test.header"}, nil,
+			[]string{"test.body", "test.dynamicBar", "test.dynamicFoo", "test.main",
+				"test.orphan", "test.orphanChild", "test.widget"}},
+	}
+	for _, test := range tests {
+		var dead, err = UnreachableTemplates(reg, test.entryPoints, test.allowlist)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !reflect.DeepEqual(dead, test.dead) {
+			t.Errorf("%v %v: expected %v, got %v", test.entryPoints, test.allowlist, test.dead, dead)
+		}
+	}
+
+	if _, err = UnreachableTemplates(reg, []string{"test.missing"}, nil); err == nil {
+		t.Error("expected error for missing entry point")
+	}
+	if _, err = UnreachableTemplates(reg, nil, []string{"test.["}); err == nil {
+		t.Error("expected error for malformed allowlist pattern")
+	}
+}
@@ -0,0 +1,116 @@
+package parsepasses
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/template"
+)
+
+// FoldConstantFuncs replaces each call to one of the given zero-argument
+// functions in the registry with its value, so that the templates may use
+// values fixed at compile time (e.g. isDebug() or buildVersion()) as
+// efficiently as literals.  An error is returned if one of them is called with
+// arguments.
+func FoldConstantFuncs(reg template.Registry, funcs data.Map) error {
+	if len(funcs) == 0 {
+		return nil
+	}
+	for _, t := range reg.Templates {
+		if err := FoldNodeConstantFuncs(t.Node, funcs); err != nil {
+			return fmt.Errorf("template %v: %v", t.Node.Name, err)
+		}
+	}
+	return nil
+}
+
+// FoldNodeConstantFuncs replaces calls to the given functions within the given
+// node and all children nodes.  See FoldConstantFuncs.
+func FoldNodeConstantFuncs(node ast.Node, funcs data.Map) error {
+	return replaceNodes(reflect.ValueOf(node), func(node ast.Node) (ast.Node, error) {
+		var fn, ok = node.(*ast.FunctionNode)
+		if !ok {
+			return node, nil
+		}
+		val, ok := funcs[fn.Name]
+		if !ok {
+			return node, nil
+		}
+		if len(fn.Args) > 0 {
+			return nil, fmt.Errorf("function %q takes no arguments, got %d", fn.Name, len(fn.Args))
+		}
+		return &ast.ConstantNode{fn.Pos, fn.Name, val}, nil
+	})
+}
+
+var nodeType = reflect.TypeOf((*ast.Node)(nil)).Elem()
+
+// replaceNodes calls replace on every node reachable from the given value
+// through a field (or slice or map element) of type ast.Node, and stores the
+// result in its place.  Since nodes only expose their children as copies, the
+// fields are traversed by reflection.
+func replaceNodes(v reflect.Value, replace func(ast.Node) (ast.Node, error)) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return replaceNodes(v.Elem(), replace)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if err := replaceField(v.Field(i), replace); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// replaceField replaces the nodes within the given struct field.
+func replaceField(field reflect.Value, replace func(ast.Node) (ast.Node, error)) error {
+	switch {
+	case field.Type() == nodeType:
+		return replaceValue(field, replace)
+	case field.Kind() == reflect.Ptr && field.Type().Implements(nodeType):
+		return replaceNodes(field, replace)
+	case field.Kind() == reflect.Interface && field.Type().Implements(nodeType):
+		// e.g. an ast.ParentNode, which may not hold an arbitrary node.
+		if !field.IsNil() {
+			return replaceNodes(field.Elem(), replace)
+		}
+	case field.Kind() == reflect.Struct:
+		// e.g. an embedded ast.BinaryOpNode
+		return replaceNodes(field, replace)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Implements(nodeType):
+		for i := 0; i < field.Len(); i++ {
+			if err := replaceField(field.Index(i), replace); err != nil {
+				return err
+			}
+		}
+	case field.Kind() == reflect.Map && field.Type().Elem() == nodeType:
+		for _, key := range field.MapKeys() {
+			var elem = reflect.New(nodeType).Elem()
+			elem.Set(field.MapIndex(key))
+			if err := replaceValue(elem, replace); err != nil {
+				return err
+			}
+			field.SetMapIndex(key, elem)
+		}
+	}
+	return nil
+}
+
+// replaceValue replaces the node held in the given settable ast.Node value,
+// and then the nodes within it.
+func replaceValue(v reflect.Value, replace func(ast.Node) (ast.Node, error)) error {
+	if v.IsNil() {
+		return nil
+	}
+	var node, err = replace(v.Interface().(ast.Node))
+	if err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(&node).Elem())
+	return replaceNodes(reflect.ValueOf(node), replace)
+}
@@ -0,0 +1,68 @@
+package parsepasses
+
+import (
+	"testing"
+
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/parse"
+	"github.com/robfig/soy/template"
+)
+
+func TestFoldConstantFuncs(t *testing.T) {
+	var constants = data.Map{"isDebug": data.Bool(true), "buildVersion": data.String("1.2")}
+	var reg = mustRegistry(t, `{namespace test}
+
+{template .main}
+  {if isDebug()}debug{/if}
+  {buildVersion() + '-' + length([isDebug(), round(1)])}
+  {call .other}{param v: ['k': buildVersion()] /}{/call}
+  {msg desc=""}Version {buildVersion()}{/msg}
+{/template}
+
+{template .other}{/template}`)
+	if err := FoldConstantFuncs(reg, constants); err != nil {
+		t.Fatal(err)
+	}
+
+	var folded, funcs int
+	var visit func(ast.Node)
+	visit = func(node ast.Node) {
+		switch node := node.(type) {
+		case *ast.ConstantNode:
+			if !node.Value.Equals(constants[node.Name]) {
+				t.Errorf("%v: expected %v, got %v", node.Name, constants[node.Name], node.Value)
+			}
+			folded++
+		case *ast.FunctionNode:
+			funcs++
+		}
+		if parent, ok := node.(ast.ParentNode); ok {
+			for _, child := range parent.Children() {
+				visit(child)
+			}
+		}
+	}
+	visit(reg.Templates[0].Node)
+	if folded != 5 || funcs != 2 {
+		t.Errorf("expected 5 constants and 2 other functions, got %d and %d", folded, funcs)
+	}
+
+	reg = mustRegistry(t, `{namespace test}
+{template .main}{isDebug(1)}{/template}`)
+	if err := FoldConstantFuncs(reg, constants); err == nil {
+		t.Error("expected an error for a constant function called with arguments")
+	}
+}
+
+func mustRegistry(t *testing.T, soy string) template.Registry {
+	var tree, err = parse.SoyFile("", soy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reg template.Registry
+	if err = reg.Add(tree); err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
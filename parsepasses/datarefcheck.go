@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/errortypes"
 	"github.com/robfig/soy/template"
 )
 
@@ -17,14 +18,38 @@ import (
 //  6. any variable created by {let} is used somewhere
 //  7. {let} variable names are valid.  ('ij' is not allowed.)
 func CheckDataRefs(reg template.Registry) (err error) {
+	return checkDataRefs(reg, reg.Templates)
+}
+
+// CheckTemplateDataRefs performs the same validation as CheckDataRefs, but only
+// for the named templates.  It is used to re-check the templates affected by a
+// change without re-checking the entire registry.
+func CheckTemplateDataRefs(reg template.Registry, names []string) error {
+	var templates []template.Template
+	for _, name := range names {
+		var t, ok = reg.Template(name)
+		if !ok {
+			return errortypes.Wrap(fmt.Errorf("template %v not found", name), errortypes.ErrTemplateNotFound)
+		}
+		templates = append(templates, t)
+	}
+	return checkDataRefs(reg, templates)
+}
+
+func checkDataRefs(reg template.Registry, templates []template.Template) (err error) {
 	var currentTemplate string
 	defer func() {
 		if err2 := recover(); err2 != nil {
-			err = fmt.Errorf("template %v: %v", currentTemplate, err2)
+			if cause, ok := err2.(error); ok {
+				err = fmt.Errorf("template %v: %w", currentTemplate, cause)
+			} else {
+				err = fmt.Errorf("template %v: %v", currentTemplate, err2)
+			}
+			err = errortypes.Wrap(err, errortypes.ErrType)
 		}
 	}()
 
-	for _, t := range reg.Templates {
+	for _, t := range templates {
 		currentTemplate = t.Node.Name
 		tc := newTemplateChecker(reg, t.Doc.Params)
 		tc.checkTemplate(t.Node.Body)
@@ -85,7 +110,14 @@ func (tc *templateChecker) checkLet(varName string) {
 func (tc *templateChecker) checkCall(node *ast.CallNode) {
 	var callee, ok = tc.registry.Template(node.Name)
 	if !ok {
-		panic(fmt.Errorf("{call}: template %q not found", node.Name))
+		panic(errortypes.Wrap(fmt.Errorf("{call}: template %q not found", node.Name),
+			errortypes.ErrTemplateNotFound))
+	}
+	if node.Fallback != "" {
+		if _, ok := tc.registry.Template(node.Fallback); !ok {
+			panic(errortypes.Wrap(fmt.Errorf("{call}: fallback template %q not found", node.Fallback),
+				errortypes.ErrTemplateNotFound))
+		}
 	}
 
 	// collect callee's list of required/allowed params
@@ -135,8 +167,8 @@ func (tc *templateChecker) checkCall(node *ast.CallNode) {
 	}
 	for _, requiredCalleeParam := range requiredCalleeParamNames {
 		if !contains(callerParamNames, requiredCalleeParam) {
-			panic(fmt.Errorf("Required param %q is not passed by the call: %v",
-				requiredCalleeParam, node))
+			panic(errortypes.Wrap(fmt.Errorf("Required param %q is not passed by the call: %v",
+				requiredCalleeParam, node), errortypes.ErrMissingParam))
 		}
 	}
 }
@@ -278,6 +278,28 @@ func TestCalledTemplatesRequiredToExist(t *testing.T) {
 {call .NotExist data="$var"/}
 {/template}
 `, false},
+
+		{`
+/** no params */
+{template .FallbackDoesNotExist}
+{call .Exists budget="50ms" fallback=".NotExist"/}
+{/template}
+
+/** no params */
+{template .Exists}
+{/template}
+`, false},
+
+		{`
+/** no params */
+{template .FallbackExists}
+{call .Exists budget="50ms" fallback=".Exists"/}
+{/template}
+
+/** no params */
+{template .Exists}
+{/template}
+`, true},
 	})
 }
 
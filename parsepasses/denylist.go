@@ -0,0 +1,52 @@
+package parsepasses
+
+import (
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/errortypes"
+	"github.com/robfig/soy/template"
+)
+
+// CheckDenylist returns an error if any template in the registry uses one of
+// the given functions or print directives, e.g. to disallow nondeterministic
+// functions such as randomInt in templates whose output is cached.
+func CheckDenylist(reg template.Registry, denied []string) error {
+	if len(denied) == 0 {
+		return nil
+	}
+	var deny = make(map[string]bool, len(denied))
+	for _, name := range denied {
+		deny[name] = true
+	}
+	for _, t := range reg.Templates {
+		if err := checkDenylist(reg, t.Node.Name, t.Node, deny); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkDenylist(reg template.Registry, templateName string, node ast.Node, deny map[string]bool) error {
+	var kind, name string
+	switch node := node.(type) {
+	case *ast.FunctionNode:
+		kind, name = "function", node.Name
+	case *ast.PrintDirectiveNode:
+		kind, name = "print directive", node.Name
+	}
+	if deny[name] {
+		var (
+			file      = reg.Filename(templateName)
+			line, col = reg.LineNumber(templateName, node), reg.ColNumber(templateName, node)
+		)
+		return errortypes.NewErrFilePosf(file, line, col,
+			"template %v:%d:%d: %v: %s %q is not allowed", file, line, col, templateName, kind, name)
+	}
+	if parent, ok := node.(ast.ParentNode); ok {
+		for _, child := range parent.Children() {
+			if err := checkDenylist(reg, templateName, child, deny); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package parsepasses
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckDenylist(t *testing.T) {
+	var tests = []struct {
+		name string
+		soy  string
+		err  string // expected in the error, or "" if ok
+	}{
+		{"function", `{template .a}{randomInt(10)}{/template}`, `function "randomInt"`},
+		{"nested function", `{template .a}{if true}{round(randomInt(10))}{/if}{/template}`, `function "randomInt"`},
+		{"directive", `{template .a}{'a'|insertWordBreaks:2}{/template}`, `print directive "insertWordBreaks"`},
+		{"call param", `{template .a}{call .b}{param x: randomInt(2)/}{/call}{/template}
+{template .b}{/template}`, `function "randomInt"`},
+		{"allowed", `{template .a}{round(1.5)}{'a'|escapeUri}{/template}`, ""},
+	}
+	for _, test := range tests {
+		var reg = mustRegistry(t, "{namespace test}\n"+test.soy)
+		var err = CheckDenylist(reg, []string{"randomInt", "insertWordBreaks"})
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: expected an error for %s, got %v", test.name, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package parsepasses
+
+import (
+	"strings"
+
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/errortypes"
+	"github.com/robfig/soy/template"
+)
+
+// CheckRecursion returns an error if any template in the registry calls itself
+// unconditionally, directly or through other templates, since rendering it
+// would never terminate.  A call is unconditional if it is not within an
+// {if}, {switch}, {foreach}/{for}, or {plural}.
+func CheckRecursion(reg template.Registry) error {
+	var calls = make(map[string][]*ast.CallNode, len(reg.Templates))
+	for _, t := range reg.Templates {
+		calls[t.Node.Name] = unconditionalCalls(t.Node)
+	}
+
+	// Depth-first search for a cycle, from each template in turn.
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	var (
+		state = make(map[string]int)
+		path  []string
+		via   []*ast.CallNode
+	)
+	var visit func(name string) bool
+	visit = func(name string) bool {
+		state[name] = visiting
+		path = append(path, name)
+		for _, call := range calls[name] {
+			via = append(via, call)
+			switch state[call.Name] {
+			case visiting:
+				path = append(path, call.Name)
+				return true
+			case unvisited:
+				if visit(call.Name) {
+					return true
+				}
+			}
+			via = via[:len(via)-1]
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		return false
+	}
+	for _, t := range reg.Templates {
+		if state[t.Node.Name] != unvisited || !visit(t.Node.Name) {
+			continue
+		}
+
+		// Report the cycle starting from the template that closes it.
+		var start = 0
+		for path[start] != path[len(path)-1] {
+			start++
+		}
+		var (
+			caller, call = path[start], via[start]
+			file         = reg.Filename(caller)
+			line, col    = reg.LineNumber(caller, call), reg.ColNumber(caller, call)
+		)
+		return errortypes.NewErrFilePosf(file, line, col,
+			"template %v:%d:%d: %v calls itself unconditionally, so it would never terminate: %v",
+			file, line, col, caller, strings.Join(path[start:], " -> "))
+	}
+	return nil
+}
+
+// unconditionalCalls returns the {call}s within the given node that are
+// always executed when it is rendered.
+func unconditionalCalls(node ast.Node) []*ast.CallNode {
+	var calls []*ast.CallNode
+	var visit func(ast.Node)
+	visit = func(node ast.Node) {
+		switch node := node.(type) {
+		case *ast.IfNode, *ast.SwitchNode, *ast.ForNode, *ast.MsgPluralNode:
+			return
+		case *ast.CallNode:
+			calls = append(calls, node)
+		}
+		if parent, ok := node.(ast.ParentNode); ok {
+			for _, child := range parent.Children() {
+				visit(child)
+			}
+		}
+	}
+	visit(node)
+	return calls
+}
@@ -0,0 +1,42 @@
+package parsepasses
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/robfig/soy/errortypes"
+)
+
+func TestCheckRecursion(t *testing.T) {
+	var tests = []struct {
+		name  string
+		soy   string
+		cycle string // expected in the error, or "" if ok
+	}{
+		{"self", `{template .a}{call .a/}{/template}`, "test.a -> test.a"},
+		{"in param", `{template .a}{call .b}{param x}{call .a/}{/param}{/call}{/template}
+{template .b}{/template}`, "test.a -> test.a"},
+		{"mutual", `{template .a}<b>{call .b/}</b>{/template}
+{template .b}{call .c/}{/template}
+{template .c}{call .a/}{/template}`, "test.a -> test.b -> test.c -> test.a"},
+		{"if", `{template .a}{if true}{call .a/}{/if}{/template}`, ""},
+		{"foreach", `{template .a}{foreach $x in []}{call .a/}{/foreach}{/template}`, ""},
+		{"switch", `{template .a}{switch 1}{case 1}{call .a/}{/switch}{/template}`, ""},
+		{"mutual if", `{template .a}{call .b/}{/template}
+{template .b}{if false}{call .a/}{/if}{/template}`, ""},
+	}
+	for _, test := range tests {
+		var reg = mustRegistry(t, "{namespace test}\n"+test.soy)
+		var err = CheckRecursion(reg)
+		switch {
+		case test.cycle == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		case test.cycle != "" && err == nil:
+			t.Errorf("%s: expected an error", test.name)
+		case test.cycle != "" && !strings.HasSuffix(err.Error(), test.cycle):
+			t.Errorf("%s: expected cycle %q, got %v", test.name, test.cycle, err)
+		case err != nil && errortypes.ToErrFilePos(err).Line() != 2:
+			t.Errorf("%s: expected an error on line 2, got %v", test.name, err)
+		}
+	}
+}
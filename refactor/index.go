@@ -0,0 +1,206 @@
+package refactor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// templateDecl is the location of a template within a file.
+type templateDecl struct {
+	name      string   // fully-qualified name
+	doc       *segment // preceding SoyDoc, if any
+	open      segment  // the {template} tag
+	close     segment  // the {/template} tag
+	nameStart int      // offset of the template name as written
+	nameEnd   int
+	tags      []segment
+	callee    []*callSite // calls made within the template
+}
+
+// callSite is a {call} within a template.
+type callSite struct {
+	caller      string
+	callee      string // fully-qualified name of the called template
+	open        segment
+	close       *segment // the {/call} tag, or nil if self-closing
+	nameStart   int      // offset of the template name as written
+	nameEnd     int
+	allData     bool
+	data        string // the data attribute, if not "all"
+	params      []paramTag
+	selfClosing bool
+}
+
+// paramTag is a {param} within a call.
+type paramTag struct {
+	key              string
+	keyStart, keyEnd int // offsets of the key as written
+}
+
+// fileIndex records the declarations found in a file.
+type fileIndex struct {
+	namespace    string
+	namespaceTag segment   // the {namespace} tag
+	aliases      []segment // {alias} tags
+	aliasMap     map[string]string
+	templates    []*templateDecl
+}
+
+var (
+	nameRegexp     = regexp.MustCompile(`^\s+([\w.]+)`)
+	paramKeyRegexp = regexp.MustCompile(`^\s+(\w+)\s*(:|$|\s+\w+\s*=)`)
+)
+
+// index scans the file for its namespace, aliases, templates and calls.
+func (f *file) index() (*fileIndex, error) {
+	var (
+		idx   = &fileIndex{aliasMap: make(map[string]string)}
+		tmpl  *templateDecl
+		calls []*callSite // stack of open calls
+		doc   *segment
+	)
+	for i := range f.segments {
+		var seg = f.segments[i]
+		switch seg.kind {
+		case segSoyDoc:
+			doc = &f.segments[i]
+			continue
+		case segText:
+			if strings.TrimSpace(f.text(seg)) != "" {
+				doc = nil
+			}
+			continue
+		case segComment:
+			continue
+		}
+
+		var tag = f.text(seg)
+		var cmd, rest = tagCommand(tag)
+		var inner, selfClosing = tagInner(tag)
+		var restOffset = seg.start + strings.Index(tag, inner) + len(inner) - len(rest)
+		if tmpl != nil {
+			tmpl.tags = append(tmpl.tags, seg)
+		}
+		switch cmd {
+		case "namespace":
+			var m = nameRegexp.FindStringSubmatchIndex(rest)
+			if m == nil {
+				return nil, fmt.Errorf("%s: malformed namespace", f.name)
+			}
+			idx.namespace = rest[m[2]:m[3]]
+			idx.namespaceTag = seg
+		case "alias":
+			var name = strings.TrimSpace(rest)
+			idx.aliasMap[name[strings.LastIndex(name, ".")+1:]] = name
+			idx.aliases = append(idx.aliases, seg)
+		case "template":
+			tmpl = &templateDecl{doc: doc, open: seg}
+			if m := nameRegexp.FindStringSubmatchIndex(rest); m != nil &&
+				!strings.HasPrefix(strings.TrimSpace(rest[m[3]:]), "=") {
+				tmpl.name = rest[m[2]:m[3]]
+				tmpl.nameStart, tmpl.nameEnd = restOffset+m[2], restOffset+m[3]
+			}
+			if a, ok := tagAttrs(tag)["name"]; ok {
+				tmpl.name = a.value
+				tmpl.nameStart, tmpl.nameEnd = seg.start+a.start, seg.start+a.end
+			}
+			if strings.HasPrefix(tmpl.name, ".") {
+				tmpl.name = idx.namespace + tmpl.name
+			}
+		case "/template":
+			if tmpl == nil {
+				return nil, fmt.Errorf("%s: unexpected {/template}", f.name)
+			}
+			tmpl.close = seg
+			idx.templates = append(idx.templates, tmpl)
+			tmpl = nil
+		case "call":
+			var call = &callSite{open: seg, selfClosing: selfClosing}
+			if tmpl != nil {
+				call.caller = tmpl.name
+			}
+			if m := nameRegexp.FindStringSubmatchIndex(rest); m != nil &&
+				!strings.HasPrefix(strings.TrimSpace(rest[m[3]:]), "=") {
+				call.callee = rest[m[2]:m[3]]
+				call.nameStart, call.nameEnd = restOffset+m[2], restOffset+m[3]
+			}
+			var attrs = tagAttrs(tag)
+			if a, ok := attrs["name"]; ok {
+				call.callee = a.value
+				call.nameStart, call.nameEnd = seg.start+a.start, seg.start+a.end
+			}
+			if a, ok := attrs["data"]; ok {
+				if a.value == "all" {
+					call.allData = true
+				} else {
+					call.data = a.value
+				}
+			}
+			call.callee = idx.resolve(call.callee)
+			if tmpl != nil {
+				tmpl.callee = append(tmpl.callee, call)
+			}
+			if !selfClosing {
+				calls = append(calls, call)
+			}
+		case "/call":
+			if len(calls) == 0 {
+				return nil, fmt.Errorf("%s: unexpected {/call}", f.name)
+			}
+			calls[len(calls)-1].close = &f.segments[i]
+			calls = calls[:len(calls)-1]
+		case "param":
+			if len(calls) == 0 {
+				return nil, fmt.Errorf("%s: {param} outside of {call}", f.name)
+			}
+			var p paramTag
+			if a, ok := tagAttrs(tag)["key"]; ok {
+				p = paramTag{a.value, seg.start + a.start, seg.start + a.end}
+			} else if m := paramKeyRegexp.FindStringSubmatchIndex(rest); m != nil {
+				p = paramTag{rest[m[2]:m[3]], restOffset + m[2], restOffset + m[3]}
+			} else {
+				return nil, fmt.Errorf("%s: malformed param: %s", f.name, tag)
+			}
+			var call = calls[len(calls)-1]
+			call.params = append(call.params, p)
+		}
+		doc = nil
+	}
+	return idx, nil
+}
+
+// resolve returns the fully-qualified name of the given template name, as
+// written within the file.
+func (idx *fileIndex) resolve(name string) string {
+	if strings.HasPrefix(name, ".") {
+		return idx.namespace + name
+	}
+	if dot := strings.Index(name, "."); dot != -1 {
+		if alias, ok := idx.aliasMap[name[:dot]]; ok {
+			return alias + name[dot:]
+		}
+	}
+	return name
+}
+
+// template returns the declaration of the given template, if it is in this
+// file.
+func (idx *fileIndex) template(name string) *templateDecl {
+	for _, t := range idx.templates {
+		if t.name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// hasParam returns true if the call passes the given param explicitly.
+func (c *callSite) hasParam(key string) bool {
+	for _, p := range c.params {
+		if p.key == key {
+			return true
+		}
+	}
+	return false
+}
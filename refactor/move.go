@@ -0,0 +1,209 @@
+package refactor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/robfig/soy/template"
+)
+
+// MoveTemplate moves a template to a new fully-qualified name, which may be in
+// a different namespace and file.  The template (and its SoyDoc) is removed
+// from its current file and appended to destFile, which is created if it is
+// not already part of the registry.  Every {call} of the template across the
+// bundle is rewritten to use the new name, adding an {alias} for the new
+// namespace where the call site previously used an alias, and removing
+// {alias} directives that are no longer used.
+//
+// Calls made from within the moved template are rewritten as necessary so that
+// they continue to refer to the same templates from the new namespace.
+//
+// Deltemplates are not supported by the parser, so there are no {delcall}
+// sites to update.  The JavaScript generated by soyjs refers to templates only
+// by their fully-qualified names, so it is updated by regenerating it.
+//
+// The new contents of each changed file are returned, keyed by file name.
+func MoveTemplate(reg template.Registry, templateName, newName, destFile string) (map[string]string, error) {
+	if _, ok := reg.Template(templateName); !ok {
+		return nil, fmt.Errorf("template %q not found", templateName)
+	}
+	if _, ok := reg.Template(newName); ok {
+		return nil, fmt.Errorf("template %q already exists", newName)
+	}
+	var dot = strings.LastIndex(newName, ".")
+	if dot <= 0 || !isIdent(newName[dot+1:]) {
+		return nil, fmt.Errorf("invalid template name %q", newName)
+	}
+	var newNamespace = newName[:dot]
+
+	var files, indexes, err = indexFiles(reg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the source and destination files.
+	var (
+		src, dest *file
+		destIdx   *fileIndex
+		decl      *templateDecl
+	)
+	for i, f := range files {
+		if d := indexes[i].template(templateName); d != nil {
+			src, decl = f, d
+		}
+		if f.name == destFile {
+			dest, destIdx = f, indexes[i]
+		}
+	}
+	if decl == nil {
+		return nil, fmt.Errorf("template %q not found in source", templateName)
+	}
+	if dest != nil && destIdx.namespace != newNamespace {
+		return nil, fmt.Errorf("%s has namespace %q, not %q", destFile, destIdx.namespace, newNamespace)
+	}
+	if dest == nil {
+		dest = &file{name: destFile, src: "{namespace " + newNamespace + "}\n"}
+		destIdx = &fileIndex{namespace: newNamespace, aliasMap: make(map[string]string)}
+		files = append(files, dest)
+	}
+
+	// Extract the template, rewriting its name and the calls within it.
+	var (
+		start, end = moveSpan(src, decl)
+		moved      = &file{name: src.name, src: src.src[start:end]}
+		shortName  = newName[dot:]
+	)
+	moved.replace(decl.nameStart-start, decl.nameEnd-start, shortName)
+	for _, call := range decl.callee {
+		var callee = call.callee
+		if callee == templateName {
+			callee = newName
+		}
+		moved.replace(call.nameStart-start, call.nameEnd-start,
+			relativeName(callee, newNamespace, destIdx.aliasMap))
+	}
+	movedText, err := moved.result()
+	if err != nil {
+		return nil, err
+	}
+	src.replace(start, end, "")
+
+	// Rewrite the call sites in every file.
+	for i, idx := range indexes {
+		var (
+			f         = files[i]
+			aliasUses = make(map[string]int)
+			addAlias  = false
+		)
+		for _, t := range idx.templates {
+			for _, call := range t.callee {
+				var alias = usedAlias(idx, f.src[call.nameStart:call.nameEnd])
+				if alias != "" {
+					aliasUses[alias]++
+				}
+				if t == decl {
+					// The call moves with the template.
+					if alias != "" {
+						aliasUses[alias]--
+					}
+					continue
+				}
+				if call.callee != templateName {
+					continue
+				}
+
+				var aliases = idx.aliasMap
+				if alias != "" {
+					aliasUses[alias]--
+					var last = newNamespace[strings.LastIndex(newNamespace, ".")+1:]
+					if _, taken := idx.aliasMap[last]; !taken && idx.namespace != newNamespace {
+						aliases = map[string]string{last: newNamespace}
+						addAlias = true
+					}
+				}
+				f.replace(call.nameStart, call.nameEnd, relativeName(newName, idx.namespace, aliases))
+			}
+		}
+
+		// Remove aliases that are no longer used, and add the new one if needed.
+		for _, tag := range idx.aliases {
+			var _, name = tagCommand(f.text(tag))
+			name = strings.TrimSpace(name)
+			if uses, ok := aliasUses[name[strings.LastIndex(name, ".")+1:]]; ok && uses == 0 {
+				var start, end = lineSpan(f.src, tag.start, tag.end)
+				f.replace(start, end, "")
+			}
+		}
+		if addAlias {
+			var at = idx.namespaceTag.end
+			f.replace(at, at, "\n{alias "+newNamespace+"}")
+		}
+	}
+
+	// Append the template to the destination file.
+	var sep = "\n"
+	if !strings.HasSuffix(dest.src, "\n") {
+		sep = "\n\n"
+	}
+	dest.replace(len(dest.src), len(dest.src), sep+strings.TrimRight(movedText, "\n")+"\n")
+	return results(files)
+}
+
+// moveSpan returns the span of source to move for the given template: its
+// SoyDoc through the closing tag, extended to cover whole lines.
+func moveSpan(f *file, decl *templateDecl) (int, int) {
+	var start = decl.open.start
+	if decl.doc != nil {
+		start = decl.doc.start
+	}
+	var _, end = lineSpan(f.src, start, decl.close.end)
+	// Also consume one following blank line, so that templates remain
+	// separated by a single blank line.
+	if strings.HasPrefix(f.src[end:], "\n") {
+		end++
+	}
+	for start > 0 && f.src[start-1] != '\n' && isSpace(f.src[start-1]) {
+		start--
+	}
+	return start, end
+}
+
+// lineSpan extends the given span to include the trailing newline, if only
+// whitespace follows it on the line.
+func lineSpan(src string, start, end int) (int, int) {
+	var i = end
+	for i < len(src) && (src[i] == ' ' || src[i] == '\t' || src[i] == '\r') {
+		i++
+	}
+	if i < len(src) && src[i] == '\n' {
+		return start, i + 1
+	}
+	return start, end
+}
+
+// relativeName returns the shortest way to refer to the given template from a
+// file with the given namespace and aliases.
+func relativeName(name, namespace string, aliases map[string]string) string {
+	var dot = strings.LastIndex(name, ".")
+	if name[:dot] == namespace {
+		return name[dot:]
+	}
+	for alias, aliasNamespace := range aliases {
+		if name[:dot] == aliasNamespace {
+			return alias + name[dot:]
+		}
+	}
+	return name
+}
+
+// usedAlias returns the alias used by the written template name, if any.
+func usedAlias(idx *fileIndex, written string) string {
+	var dot = strings.Index(written, ".")
+	if dot <= 0 {
+		return ""
+	}
+	if _, ok := idx.aliasMap[written[:dot]]; ok {
+		return written[:dot]
+	}
+	return ""
+}
@@ -0,0 +1,101 @@
+package refactor
+
+import (
+	"testing"
+
+	"github.com/robfig/soy/parsepasses"
+)
+
+func TestMoveTemplate(t *testing.T) {
+	var input = map[string]string{
+		"widgets.soy": `{namespace ns.widgets}
+
+/**
+ * A button.
+ * @param label
+ */
+{template .button}
+  {call .icon /}{$label}
+{/template}
+
+/** An icon. */
+{template .icon}
+  <i></i>
+{/template}
+`,
+		"page.soy": `{namespace ns.page}
+{alias ns.widgets}
+
+/** The page. */
+{template .page}
+  {call widgets.button}{param label: 'Save'/}{/call}
+{/template}
+`,
+		"other.soy": `{namespace ns.other}
+
+/** Another. */
+{template .other}
+  {call ns.widgets.button}{param label: 'Other'/}{/call}
+{/template}
+`,
+	}
+
+	var reg = parseRegistry(t, input)
+	var output, err = MoveTemplate(reg, "ns.widgets.button", "ns.controls.button", "controls.soy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected = map[string]string{
+		"widgets.soy": `{namespace ns.widgets}
+
+/** An icon. */
+{template .icon}
+  <i></i>
+{/template}
+`,
+		"controls.soy": `{namespace ns.controls}
+
+/**
+ * A button.
+ * @param label
+ */
+{template .button}
+  {call ns.widgets.icon /}{$label}
+{/template}
+`,
+		"page.soy": `{namespace ns.page}
+{alias ns.controls}
+
+/** The page. */
+{template .page}
+  {call controls.button}{param label: 'Save'/}{/call}
+{/template}
+`,
+		"other.soy": `{namespace ns.other}
+
+/** Another. */
+{template .other}
+  {call ns.controls.button}{param label: 'Other'/}{/call}
+{/template}
+`,
+	}
+	for name, content := range expected {
+		if output[name] != content {
+			t.Errorf("%s: expected\n%s\ngot\n%s", name, content, output[name])
+		}
+	}
+	if len(output) != len(expected) {
+		t.Errorf("expected %d files changed, got %d", len(expected), len(output))
+	}
+
+	// The result must still compile and pass the data ref checks.
+	if err = parsepasses.CheckDataRefs(parseRegistry(t, output)); err != nil {
+		t.Error(err)
+	}
+
+	// Moving into an existing file with a different namespace is an error.
+	if _, err = MoveTemplate(reg, "ns.widgets.button", "ns.x.button", "page.soy"); err == nil {
+		t.Error("expected error moving into a file with a different namespace")
+	}
+}
@@ -0,0 +1,315 @@
+// Package refactor provides automated refactorings of Soy templates.
+//
+// Refactorings are computed from the parsed registry but applied as edits to
+// the original source text, so that formatting, comments, and SoyDoc outside
+// of the edited spans are preserved exactly.  Each refactoring returns the new
+// content of every file that it changed, keyed by file name, which the caller
+// may inspect or write back with WriteFiles.
+package refactor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// WriteFiles writes each of the given files (as returned by a refactoring) to
+// disk, preserving the existing file mode.
+func WriteFiles(files map[string]string) error {
+	for name, content := range files {
+		var mode os.FileMode = 0644
+		if fi, err := os.Stat(name); err == nil {
+			mode = fi.Mode()
+		}
+		if err := ioutil.WriteFile(name, []byte(content), mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// segmentKind identifies the type of a span of source text.
+type segmentKind int
+
+const (
+	segText    segmentKind = iota // raw text (including {literal} content)
+	segTag                        // a command or print tag, including delimiters
+	segSoyDoc                     // a /** SoyDoc */ comment
+	segComment                    // a // line or /* block */ comment
+)
+
+// segment is a span of source text.
+type segment struct {
+	kind       segmentKind
+	start, end int
+}
+
+// file is a source file being edited.
+type file struct {
+	name     string
+	src      string
+	segments []segment
+	edits    []edit
+}
+
+// edit replaces the source in [start, end) with text.
+type edit struct {
+	start, end int
+	text       string
+}
+
+func newFile(name, src string) (*file, error) {
+	var segments, err = scan(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return &file{name, src, segments, nil}, nil
+}
+
+// text returns the source text of the given segment.
+func (f *file) text(seg segment) string {
+	return f.src[seg.start:seg.end]
+}
+
+// replace records an edit of the source in [start, end).
+func (f *file) replace(start, end int, text string) {
+	f.edits = append(f.edits, edit{start, end, text})
+}
+
+// result returns the source with all edits applied.  Edits must not overlap,
+// except that multiple insertions at the same position are applied in the
+// order they were recorded.
+func (f *file) result() (string, error) {
+	var edits = make([]edit, len(f.edits))
+	copy(edits, f.edits)
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	var (
+		buf  bytes.Buffer
+		last = 0
+	)
+	for _, e := range edits {
+		if e.start < last {
+			return "", fmt.Errorf("%s: overlapping edits at offset %d", f.name, e.start)
+		}
+		buf.WriteString(f.src[last:e.start])
+		buf.WriteString(e.text)
+		last = e.end
+	}
+	buf.WriteString(f.src[last:])
+	return buf.String(), nil
+}
+
+// scan splits the source into segments, following the same rules as the
+// lexer for comments, {literal} blocks, and double-brace tags.
+func scan(src string) ([]segment, error) {
+	var (
+		segments  []segment
+		textStart = 0
+		i         = 0
+	)
+	var emitText = func(end int) {
+		if end > textStart {
+			segments = append(segments, segment{segText, textStart, end})
+		}
+	}
+	for i < len(src) {
+		switch {
+		case strings.HasPrefix(src[i:], "//") && (i == 0 || isSpace(src[i-1])):
+			emitText(i)
+			var end = strings.IndexByte(src[i:], '\n')
+			if end == -1 {
+				end = len(src) - i
+			}
+			segments = append(segments, segment{segComment, i, i + end})
+			i += end
+			textStart = i
+
+		case strings.HasPrefix(src[i:], "/*"):
+			emitText(i)
+			var end = strings.Index(src[i+2:], "*/")
+			if end == -1 {
+				return nil, fmt.Errorf("unclosed comment at offset %d", i)
+			}
+			var kind = segComment
+			if strings.HasPrefix(src[i:], "/**") {
+				kind = segSoyDoc
+			}
+			segments = append(segments, segment{kind, i, i + 2 + end + 2})
+			i += 2 + end + 2
+			textStart = i
+
+		case src[i] == '{':
+			emitText(i)
+			var end, err = scanTag(src, i)
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, segment{segTag, i, end})
+			i = end
+			textStart = i
+			if cmd, _ := tagCommand(src[segments[len(segments)-1].start:end]); cmd == "literal" {
+				var close = strings.Index(src[i:], "{/literal}")
+				if close == -1 {
+					return nil, fmt.Errorf("unclosed {literal} at offset %d", i)
+				}
+				i += close
+			}
+
+		default:
+			i++
+		}
+	}
+	emitText(len(src))
+	return segments, nil
+}
+
+// scanTag returns the offset just past the end of the tag beginning at start.
+// Strings within the tag may contain delimiters.
+func scanTag(src string, start int) (int, error) {
+	var (
+		double = strings.HasPrefix(src[start:], "{{")
+		quote  byte // the open quote character, if within a string
+		i      = start + 1
+	)
+	if double {
+		i++
+	}
+	for ; i < len(src); i++ {
+		var ch = src[i]
+		switch {
+		case quote != 0 && ch == '\\':
+			i++
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '}':
+			if !double {
+				return i + 1, nil
+			}
+			if strings.HasPrefix(src[i:], "}}") {
+				return i + 2, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unclosed tag at offset %d", start)
+}
+
+// tagInner returns the content of the tag between the delimiters, and whether
+// the tag is self-closing.
+func tagInner(tag string) (inner string, selfClosing bool) {
+	var open, close = 1, 1
+	if strings.HasPrefix(tag, "{{") {
+		open, close = 2, 2
+	}
+	inner = tag[open : len(tag)-close]
+	if strings.HasSuffix(inner, "/") {
+		return inner[:len(inner)-1], true
+	}
+	return inner, false
+}
+
+// tagCommand returns the command name of the given tag (e.g. "call", "/call")
+// and the remainder of the tag content.  Print tags have an empty command.
+func tagCommand(tag string) (cmd, rest string) {
+	var inner, _ = tagInner(tag)
+	inner = strings.TrimLeft(inner, " \t\r\n")
+	var n = 0
+	if n < len(inner) && inner[n] == '/' {
+		n++
+	}
+	for n < len(inner) && isIdentChar(inner[n]) {
+		n++
+	}
+	cmd = inner[:n]
+	if !commands[cmd] {
+		return "", inner
+	}
+	return cmd, inner[n:]
+}
+
+// commands is the set of command names that may begin a tag.
+var commands = make(map[string]bool)
+
+func init() {
+	for _, cmd := range []string{"namespace", "alias", "template", "call", "delcall",
+		"param", "let", "if", "elseif", "else", "switch", "case", "default",
+		"foreach", "for", "ifempty", "msg", "plural", "log", "debugger",
+		"literal", "css", "print", "deltemplate", "delpackage", "sp", "nil",
+		"lb", "rb"} {
+		commands[cmd] = true
+		commands["/"+cmd] = true
+	}
+}
+
+var attrRegexp = regexp.MustCompile(`(\w+)\s*=\s*("(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*')`)
+
+// attr is an attribute of a tag, with the offsets of its value (excluding the
+// quotes) relative to the start of the tag.
+type attr struct {
+	value      string
+	start, end int
+}
+
+// tagAttrs returns the attributes within the given tag.
+func tagAttrs(tag string) map[string]attr {
+	var attrs = make(map[string]attr)
+	for _, m := range attrRegexp.FindAllStringSubmatchIndex(tag, -1) {
+		var name = tag[m[2]:m[3]]
+		attrs[name] = attr{tag[m[4]+1 : m[5]-1], m[4] + 1, m[5] - 1}
+	}
+	return attrs
+}
+
+// varRefs returns the offsets within the tag of each reference to the given
+// variable (including the $).  References within single-quoted string
+// literals are ignored.
+func varRefs(tag, name string) []int {
+	var (
+		refs   []int
+		target = "$" + name
+	)
+	for i := 0; i < len(tag); i++ {
+		switch tag[i] {
+		case '\'':
+			for i++; i < len(tag) && tag[i] != '\''; i++ {
+				if tag[i] == '\\' {
+					i++
+				}
+			}
+		case '$':
+			if strings.HasPrefix(tag[i:], target) &&
+				(i+len(target) == len(tag) || !isIdentChar(tag[i+len(target)])) {
+				refs = append(refs, i)
+			}
+		}
+	}
+	return refs
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n'
+}
+
+func isIdentChar(ch byte) bool {
+	return ch == '_' || '0' <= ch && ch <= '9' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z'
+}
+
+// isIdent returns true if the given string is a valid identifier.
+func isIdent(s string) bool {
+	if s == "" || '0' <= s[0] && s[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isIdentChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
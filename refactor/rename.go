@@ -0,0 +1,232 @@
+package refactor
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/template"
+)
+
+// RenameParam renames a param of the given template.  The SoyDoc declaration,
+// every reference within the template, and the {param} passed by every call
+// site are updated.
+//
+// Calls that pass data="all" or data="$x" provide the param implicitly, by its
+// old name.  Those call sites are given an explicit {param} so that they
+// continue to pass the same value, e.g.
+//
+//	{call .foo data="all"/}
+//	=>
+//	{call .foo data="all"}{param newName: $oldName/}{/call}
+//
+// Likewise, data="all" calls made by the renamed template to templates that
+// still expect the old name are given {param oldName: $newName/}.
+//
+// The new contents of each changed file are returned, keyed by file name.
+func RenameParam(reg template.Registry, templateName, oldName, newName string) (map[string]string, error) {
+	var tmpl, ok = reg.Template(templateName)
+	if !ok {
+		return nil, fmt.Errorf("template %q not found", templateName)
+	}
+	if !isIdent(newName) || newName == "ij" {
+		return nil, fmt.Errorf("invalid param name %q", newName)
+	}
+	if !declaresParam(tmpl, oldName) {
+		return nil, fmt.Errorf("template %q has no param %q", templateName, oldName)
+	}
+	if declaresParam(tmpl, newName) {
+		return nil, fmt.Errorf("template %q already has a param %q", templateName, newName)
+	}
+	if local := findLocal(tmpl.Node, oldName, newName); local != "" {
+		return nil, fmt.Errorf("template %q has a local variable named %q", templateName, local)
+	}
+
+	var files, indexes, err = indexFiles(reg)
+	if err != nil {
+		return nil, err
+	}
+
+	var renamed bool
+	for i, f := range files {
+		var idx = indexes[i]
+
+		// Update the declaration and references within the template itself.
+		if decl := idx.template(templateName); decl != nil {
+			if err := renameDocParam(f, decl, oldName, newName); err != nil {
+				return nil, err
+			}
+			for _, tag := range decl.tags {
+				for _, ref := range varRefs(f.text(tag), oldName) {
+					f.replace(tag.start+ref, tag.start+ref+1+len(oldName), "$"+newName)
+				}
+			}
+			renamed = true
+		}
+
+		// Update the call sites.
+		for _, decl := range idx.templates {
+			for _, call := range decl.callee {
+				if call.callee == templateName {
+					renameCallParam(f, reg, call, templateName, oldName, newName)
+				} else if call.caller == templateName && call.allData && !call.hasParam(oldName) {
+					if callee, ok := reg.Template(call.callee); ok && declaresParam(callee, oldName) {
+						addParam(f, call, fmt.Sprintf("{param %s: $%s/}", oldName, newName))
+					}
+				}
+			}
+		}
+	}
+	if !renamed {
+		return nil, fmt.Errorf("template %q not found in source", templateName)
+	}
+	return results(files)
+}
+
+// renameCallParam updates a call to the renamed template.
+func renameCallParam(f *file, reg template.Registry, call *callSite, templateName, oldName, newName string) {
+	if call.hasParam(oldName) {
+		for _, p := range call.params {
+			if p.key == oldName {
+				f.replace(p.keyStart, p.keyEnd, newName)
+			}
+		}
+		return
+	}
+	switch {
+	case call.allData:
+		// The renamed template passes its own data along, which its callers
+		// now provide under the new name.
+		if call.caller == templateName {
+			return
+		}
+		if caller, ok := reg.Template(call.caller); ok && declaresParam(caller, oldName) {
+			addParam(f, call, fmt.Sprintf("{param %s: $%s/}", newName, oldName))
+		}
+	case call.data != "":
+		var data = call.data
+		if call.caller == templateName {
+			data = renameVars(data, oldName, newName)
+		}
+		addParam(f, call, fmt.Sprintf("{param %s: %s.%s/}", newName, data, oldName))
+	}
+}
+
+var docParamRegexp = regexp.MustCompile(`@param\??\s+(\w+)`)
+
+// renameDocParam renames the param declared in the template's SoyDoc.
+func renameDocParam(f *file, decl *templateDecl, oldName, newName string) error {
+	if decl.doc == nil {
+		return fmt.Errorf("template %q: soydoc not found", decl.name)
+	}
+	var doc = f.text(*decl.doc)
+	for _, m := range docParamRegexp.FindAllStringSubmatchIndex(doc, -1) {
+		if doc[m[2]:m[3]] == oldName {
+			f.replace(decl.doc.start+m[2], decl.doc.start+m[3], newName)
+			return nil
+		}
+	}
+	return fmt.Errorf("template %q: @param %s not found in soydoc", decl.name, oldName)
+}
+
+// addParam adds the given {param} tag to the call, converting a self-closing
+// call into one with a body if necessary.
+func addParam(f *file, call *callSite, param string) {
+	if !call.selfClosing {
+		f.replace(call.open.end, call.open.end, param)
+		return
+	}
+	var tag = f.text(call.open)
+	var closeDelim = "}"
+	if len(tag) > 1 && tag[1] == '{' {
+		closeDelim = "}}"
+	}
+	var end = len(tag) - len(closeDelim) - 1 // the position of the "/"
+	for end > 0 && isSpace(tag[end-1]) {
+		end--
+	}
+	f.replace(call.open.start+end, call.open.end, closeDelim+param+"{/call}")
+}
+
+// renameVars renames references to the given variable in an expression.
+func renameVars(expr, oldName, newName string) string {
+	var refs = varRefs(expr, oldName)
+	for i := len(refs) - 1; i >= 0; i-- {
+		expr = expr[:refs[i]] + "$" + newName + expr[refs[i]+1+len(oldName):]
+	}
+	return expr
+}
+
+// declaresParam returns true if the template declares the given param.
+func declaresParam(tmpl template.Template, name string) bool {
+	for _, param := range tmpl.Doc.Params {
+		if param.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// findLocal returns the first of the given names that is used for a {let},
+// {for}, or {foreach} variable within the node, or "" if none are.
+func findLocal(node ast.Node, names ...string) string {
+	var name string
+	switch node := node.(type) {
+	case *ast.LetValueNode:
+		name = node.Name
+	case *ast.LetContentNode:
+		name = node.Name
+	case *ast.ForNode:
+		name = node.Var
+	}
+	for _, candidate := range names {
+		if name == candidate {
+			return name
+		}
+	}
+	if parent, ok := node.(ast.ParentNode); ok {
+		for _, child := range parent.Children() {
+			if local := findLocal(child, names...); local != "" {
+				return local
+			}
+		}
+	}
+	return ""
+}
+
+// indexFiles scans and indexes the source of every file in the registry.
+func indexFiles(reg template.Registry) ([]*file, []*fileIndex, error) {
+	var (
+		files   []*file
+		indexes []*fileIndex
+	)
+	for _, soyfile := range reg.SoyFiles {
+		var f, err = newFile(soyfile.Name, soyfile.Text)
+		if err != nil {
+			return nil, nil, err
+		}
+		idx, err := f.index()
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, f)
+		indexes = append(indexes, idx)
+	}
+	return files, indexes, nil
+}
+
+// results returns the edited content of each file that has been changed.
+func results(files []*file) (map[string]string, error) {
+	var changed = make(map[string]string)
+	for _, f := range files {
+		if len(f.edits) == 0 {
+			continue
+		}
+		var content, err = f.result()
+		if err != nil {
+			return nil, err
+		}
+		changed[f.name] = content
+	}
+	return changed, nil
+}
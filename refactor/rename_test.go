@@ -0,0 +1,170 @@
+package refactor
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/robfig/soy/parse"
+	"github.com/robfig/soy/parsepasses"
+	"github.com/robfig/soy/template"
+)
+
+func parseRegistry(t *testing.T, files map[string]string) template.Registry {
+	var reg template.Registry
+	for _, name := range sortedKeys(files) {
+		var tree, err = parse.SoyFile(name, files[name])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = reg.Add(tree); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return reg
+}
+
+func TestRenameParam(t *testing.T) {
+	var input = map[string]string{
+		"widgets.soy": `{namespace ns.widgets}
+
+/**
+ * Renders a button.
+ * @param label the text to show  // and a comment
+ * @param? theme
+ * @param? labelSuffix
+ */
+{template .button}
+  // Not $label.
+  <button class="{$theme ?: 'plain'}">{$label}{$labelSuffix ?: ''}</button>
+  {if $theme}{call .icon data="all"/}{/if}
+{/template}
+
+/**
+ * @param label
+ * @param? theme
+ * @param? labelSuffix
+ */
+{template .icon}
+  {$label}{$theme}{$labelSuffix}
+{/template}
+`,
+		"page.soy": `{namespace ns.page}
+{alias ns.widgets}
+
+/**
+ * @param label
+ * @param button
+ */
+{template .page}
+  {call widgets.button}
+    {param label: 'Save' /}
+  {/call}
+  {call ns.widgets.button data="all" /}
+  {call widgets.button data="$button"}{param theme: 'dark'/}{/call}
+  {{call .other}}{param key="label" value="$label"/}{{/call}}
+  {call widgets.icon}{param label}Icon {$label}{/param}{/call}
+{/template}
+
+/** @param label */
+{template .other}{$label}{/template}
+`,
+	}
+
+	var reg = parseRegistry(t, input)
+	var output, err = RenameParam(reg, "ns.widgets.button", "label", "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected = map[string]string{
+		"widgets.soy": `{namespace ns.widgets}
+
+/**
+ * Renders a button.
+ * @param text the text to show  // and a comment
+ * @param? theme
+ * @param? labelSuffix
+ */
+{template .button}
+  // Not $label.
+  <button class="{$theme ?: 'plain'}">{$text}{$labelSuffix ?: ''}</button>
+  {if $theme}{call .icon data="all"}{param label: $text/}{/call}{/if}
+{/template}
+
+/**
+ * @param label
+ * @param? theme
+ * @param? labelSuffix
+ */
+{template .icon}
+  {$label}{$theme}{$labelSuffix}
+{/template}
+`,
+		"page.soy": `{namespace ns.page}
+{alias ns.widgets}
+
+/**
+ * @param label
+ * @param button
+ */
+{template .page}
+  {call widgets.button}
+    {param text: 'Save' /}
+  {/call}
+  {call ns.widgets.button data="all"}{param text: $label/}{/call}
+  {call widgets.button data="$button"}{param text: $button.label/}{param theme: 'dark'/}{/call}
+  {{call .other}}{param key="label" value="$label"/}{{/call}}
+  {call widgets.icon}{param label}Icon {$label}{/param}{/call}
+{/template}
+
+/** @param label */
+{template .other}{$label}{/template}
+`,
+	}
+	for name, content := range expected {
+		if output[name] != content {
+			t.Errorf("%s: expected\n%s\ngot\n%s", name, content, output[name])
+		}
+	}
+
+	// The result must still compile and pass the data ref checks.
+	if err = parsepasses.CheckDataRefs(parseRegistry(t, output)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRenameParamErrors(t *testing.T) {
+	var reg = parseRegistry(t, map[string]string{"a.soy": `{namespace a}
+
+/**
+ * @param x
+ * @param y
+ */
+{template .a}
+  {$x}{$y}
+  {foreach $z in [1]}{$z}{/foreach}
+{/template}
+`})
+	var tests = []struct{ tmpl, old, new string }{
+		{"a.missing", "x", "w"},
+		{"a.a", "missing", "w"},
+		{"a.a", "x", "y"},
+		{"a.a", "x", "z"},
+		{"a.a", "x", "ij"},
+		{"a.a", "x", "1x"},
+	}
+	for _, test := range tests {
+		if _, err := RenameParam(reg, test.tmpl, test.old, test.new); err == nil {
+			t.Errorf("RenameParam(%v, %v, %v): expected error", test.tmpl, test.old, test.new)
+		}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
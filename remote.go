@@ -0,0 +1,167 @@
+package soy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/robfig/soy/soyhtml"
+)
+
+// Manifest describes the current version of a template archive.  It is served
+// as JSON from the URL given to NewRemote, e.g.
+//
+//	{"version": "2024.05.01-3",
+//	 "url": "templates-2024.05.01-3.tar.gz",
+//	 "sha256": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"}
+//
+// The URL of the archive may be relative to that of the manifest.
+type Manifest struct {
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	SHA256  string `json:"sha256"`
+}
+
+// Remote renders the templates of an archive that is deployed separately from
+// the binary, fetching new versions as they are published.  Each version is
+// described by a Manifest, and the archive is verified against its checksum
+// before it is compiled.  A version that fails to be fetched or compiled is
+// not used, so that the templates of the last good version continue to be
+// rendered.
+//
+// The Tofu of the current version should be retrieved for each render:
+//
+//	var remote = soy.NewRemote("https://cdn.example.com/templates/manifest.json",
+//		func() *soy.Bundle { return soy.NewBundle(soy.WithConfig(soy.Prod)) })
+//	if _, err := remote.Refresh(ctx); err != nil {
+//		log.Fatal(err)
+//	}
+//	go remote.Poll(ctx, time.Minute)
+//	...
+//	remote.Tofu().Render(w, "page.home", data)
+type Remote struct {
+	manifestURL string
+	newBundle   func() *Bundle
+	client      *http.Client
+	mu          sync.Mutex // serializes refreshes
+	current     atomic.Pointer[remoteVersion]
+}
+
+// remoteVersion is a version of the templates, compiled.
+type remoteVersion struct {
+	version string
+	tofu    *soyhtml.Tofu
+}
+
+// NewRemote returns a Remote for the archives described by the manifest at the
+// given URL.  Each version is compiled by a bundle returned by newBundle, with
+// the archive's templates added, so that it may add options, globals, and the
+// like.  No version is fetched until Refresh is called.
+func NewRemote(manifestURL string, newBundle func() *Bundle) *Remote {
+	return &Remote{manifestURL: manifestURL, newBundle: newBundle, client: http.DefaultClient}
+}
+
+// WithClient sets the client used to fetch the manifest and archives, which is
+// http.DefaultClient by default.
+func (r *Remote) WithClient(client *http.Client) *Remote {
+	r.client = client
+	return r
+}
+
+// Tofu returns the compiled templates of the current version, or nil if no
+// version has been fetched.
+func (r *Remote) Tofu() *soyhtml.Tofu {
+	if v := r.current.Load(); v != nil {
+		return v.tofu
+	}
+	return nil
+}
+
+// Version returns the current version, or "" if no version has been fetched.
+func (r *Remote) Version() string {
+	if v := r.current.Load(); v != nil {
+		return v.version
+	}
+	return ""
+}
+
+// Refresh fetches the manifest and, if it describes a new version, fetches,
+// verifies, and compiles its archive, and makes it the current version.  It
+// returns whether the version was updated.
+func (r *Remote) Refresh(ctx context.Context) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var manifest, err = r.fetchManifest(ctx)
+	if err != nil {
+		return false, err
+	}
+	if manifest.Version == r.Version() {
+		return false, nil
+	}
+	var b = r.newBundle()
+	var maxSize, _ = b.archiveLimits()
+	archive, err := fetchArchive(ctx, r.client, manifest.URL, manifest.SHA256, maxSize)
+	if err != nil {
+		return false, err
+	}
+	tofu, err := b.AddTemplateArchive(manifest.URL, archive).CompileToTofu()
+	if err != nil {
+		return false, fmt.Errorf("template version %s: %w", manifest.Version, err)
+	}
+	r.current.Store(&remoteVersion{manifest.Version, tofu})
+	return true, nil
+}
+
+// Poll refreshes the templates at the given interval until the context is
+// done.  Failures are reported to the Logger, and retried at the next
+// interval.
+func (r *Remote) Poll(ctx context.Context, interval time.Duration) {
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var start = time.Now()
+		switch updated, err := r.Refresh(ctx); {
+		case err != nil && ctx.Err() == nil:
+			Logger.Println(err)
+		case updated:
+			Logger.Printf("updated templates to version %s in %v", r.Version(), time.Since(start))
+		}
+	}
+}
+
+// fetchManifest returns the manifest, with the URL of the archive resolved.
+func (r *Remote) fetchManifest(ctx context.Context) (Manifest, error) {
+	var manifest Manifest
+	var body, err = fetch(ctx, r.client, r.manifestURL, maxManifestSize)
+	if err != nil {
+		return manifest, err
+	}
+	if err = json.Unmarshal(body, &manifest); err != nil {
+		return manifest, fmt.Errorf("template manifest %s: %w", r.manifestURL, err)
+	}
+	if manifest.Version == "" || manifest.URL == "" || manifest.SHA256 == "" {
+		return manifest, fmt.Errorf("template manifest %s: version, url, and sha256 are required",
+			r.manifestURL)
+	}
+	base, err := url.Parse(r.manifestURL)
+	if err != nil {
+		return manifest, err
+	}
+	ref, err := url.Parse(manifest.URL)
+	if err != nil {
+		return manifest, fmt.Errorf("template manifest %s: %w", r.manifestURL, err)
+	}
+	manifest.URL = base.ResolveReference(ref).String()
+	return manifest, nil
+}
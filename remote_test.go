@@ -0,0 +1,99 @@
+package soy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testPublisher serves a manifest and the archives that it refers to.
+type testPublisher struct {
+	mu       sync.Mutex
+	manifest string
+	archives map[string][]byte
+}
+
+func (p *testPublisher) publish(version string, archive []byte, sum string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var name = "templates-" + version + ".zip"
+	p.archives["/archives/"+name] = archive
+	p.manifest = fmt.Sprintf(`{"version": %q, "url": "archives/%s", "sha256": %q}`, version, name, sum)
+}
+
+func (p *testPublisher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r.URL.Path == "/manifest.json" {
+		w.Write([]byte(p.manifest))
+	} else if archive, ok := p.archives[r.URL.Path]; ok {
+		w.Write(archive)
+	} else {
+		http.NotFound(w, r)
+	}
+}
+
+func TestRemote(t *testing.T) {
+	var publisher = &testPublisher{archives: make(map[string][]byte)}
+	var server = httptest.NewServer(publisher)
+	defer server.Close()
+
+	var remote = NewRemote(server.URL+"/manifest.json", func() *Bundle {
+		return NewBundle(WithConfig(Prod))
+	})
+	var ctx = context.Background()
+	var check = func(expectedVersion, expectedOutput string) {
+		t.Helper()
+		if remote.Version() != expectedVersion {
+			t.Errorf("expected version %q, got %q", expectedVersion, remote.Version())
+		}
+		var buf bytes.Buffer
+		if err := remote.Tofu().Render(&buf, "page.hello", map[string]string{"name": "Rob"}); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != expectedOutput {
+			t.Errorf("expected %q, got %q", expectedOutput, buf.String())
+		}
+	}
+	var refresh = func(expectUpdated bool) {
+		t.Helper()
+		if updated, err := remote.Refresh(ctx); err != nil || updated != expectUpdated {
+			t.Errorf("expected updated=%v, got %v, %v", expectUpdated, updated, err)
+		}
+	}
+
+	// Nothing is rendered until the first version is fetched.
+	if _, err := remote.Refresh(ctx); err == nil || remote.Tofu() != nil {
+		t.Errorf("expected no version before publishing, got %v", err)
+	}
+
+	var v1 = zipArchive(t, testArchiveFiles("Hello"))
+	publisher.publish("1", v1, checksum(v1))
+	refresh(true)
+	check("1", "Hello Rob")
+	refresh(false)
+	check("1", "Hello Rob")
+
+	var v2 = zipArchive(t, testArchiveFiles("Hi"))
+	publisher.publish("2", v2, checksum(v2))
+	refresh(true)
+	check("2", "Hi Rob")
+
+	// Versions that fail verification or compilation are not used.
+	var v3 = zipArchive(t, testArchiveFiles("Hey"))
+	publisher.publish("3", v3, checksum(v2))
+	if _, err := remote.Refresh(ctx); err == nil || !strings.Contains(err.Error(), "sha256") {
+		t.Errorf("expected a checksum error, got %v", err)
+	}
+	var v4 = zipArchive(t, testArchiveFiles("{if}"))
+	publisher.publish("4", v4, checksum(v4))
+	if _, err := remote.Refresh(ctx); err == nil || !strings.Contains(err.Error(), "template version 4") {
+		t.Errorf("expected a compile error, got %v", err)
+	}
+	check("2", "Hi Rob")
+}
@@ -0,0 +1,218 @@
+// Package soycatalog renders a catalog of templates with example data, like a
+// storybook for server templates: a page showing each template rendered with
+// each of its examples, for review by designers and developers.
+//
+// Examples are named data fixtures for a template.  By convention, they are
+// kept in an examples directory with a JSON file per template, named for the
+// template, that maps the name of each example to its data:
+//
+//	examples/widgets.button.json:
+//	{
+//	  "primary": {"label": "Save", "primary": true},
+//	  "disabled": {"label": "Save", "disabled": true}
+//	}
+package soycatalog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/soyhtml"
+)
+
+// Example is a named data set with which to render a template.
+type Example struct {
+	Template string // fully-qualified name of the template
+	Name     string
+	Data     data.Map
+}
+
+// LoadExamples reads the examples in the *.json files in the given directory,
+// following the convention described in the package documentation.  They are
+// returned sorted by template and name.
+func LoadExamples(dir string) ([]Example, error) {
+	var filenames, err = filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var examples []Example
+	for _, filename := range filenames {
+		var buf, err = ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		var tmpl = strings.TrimSuffix(filepath.Base(filename), ".json")
+		var byName map[string]data.Map
+		if err = json.Unmarshal(buf, &byName); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		for name, params := range byName {
+			examples = append(examples, Example{tmpl, name, params})
+		}
+	}
+	sortExamples(examples)
+	return examples, nil
+}
+
+func sortExamples(examples []Example) {
+	sort.Slice(examples, func(i, j int) bool {
+		if examples[i].Template != examples[j].Template {
+			return examples[i].Template < examples[j].Template
+		}
+		return examples[i].Name < examples[j].Name
+	})
+}
+
+// Catalog serves an index page that renders each template with each of its
+// examples, and renders single examples.
+type Catalog struct {
+	tofu     *soyhtml.Tofu
+	examples []Example
+}
+
+// New returns a catalog of the given examples, rendered by the given Tofu.
+func New(tofu *soyhtml.Tofu, examples []Example) *Catalog {
+	var sorted = append([]Example(nil), examples...)
+	sortExamples(sorted)
+	return &Catalog{tofu, sorted}
+}
+
+// Example returns the named example of the given template.
+func (c *Catalog) Example(tmpl, name string) (Example, bool) {
+	for _, ex := range c.examples {
+		if ex.Template == tmpl && ex.Name == name {
+			return ex, true
+		}
+	}
+	return Example{}, false
+}
+
+// Render renders the named example of the given template.
+func (c *Catalog) Render(tmpl, name string) (string, error) {
+	var ex, ok = c.Example(tmpl, name)
+	if !ok {
+		return "", fmt.Errorf("no example %q of template %s", name, tmpl)
+	}
+	var buf bytes.Buffer
+	if err := c.tofu.Render(&buf, ex.Template, ex.Data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Entry describes a single rendered example in the catalog, for tools that
+// drive a headless browser to take screenshots of each one (e.g. to compare
+// them in CI).
+type Entry struct {
+	Template string `json:"template"`
+	Example  string `json:"example"`
+	URL      string `json:"url"` // where the catalog serves the rendered example
+}
+
+// Entries returns an entry for each example, in the order of the index page.
+// Their URLs are relative to the catalog's root, resolved against base, which
+// should end with a slash (e.g. "http://localhost:9812/catalog/").
+func (c *Catalog) Entries(base string) []Entry {
+	var entries = make([]Entry, len(c.examples))
+	for i, ex := range c.examples {
+		entries[i] = Entry{ex.Template, ex.Name, base + "render?" + url.Values{
+			"template": {ex.Template},
+			"example":  {ex.Name},
+		}.Encode()}
+	}
+	return entries
+}
+
+// ServeHTTP serves the catalog: the index page at the root, which shows each
+// example in a frame, and relative to it:
+//
+//	render?template=NAME&example=NAME  the rendered example
+//	entries.json                       the Entries, with absolute URLs
+func (c *Catalog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch path.Base(r.URL.Path) {
+	case "entries.json":
+		var scheme = "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		var base = scheme + "://" + r.Host + strings.TrimSuffix(r.URL.Path, "entries.json")
+		w.Header().Set("Content-Type", "application/json")
+		var enc = json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(c.Entries(base))
+	case "render":
+		var query = r.URL.Query()
+		var out, err = c.Render(query.Get("template"), query.Get("example"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(out))
+	default:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		index.Execute(w, c.groups())
+	}
+}
+
+// group is the examples of a single template, as shown on the index page.
+type group struct {
+	Template string
+	Examples []Example
+}
+
+func (c *Catalog) groups() []group {
+	var groups []group
+	for _, ex := range c.examples {
+		if len(groups) == 0 || groups[len(groups)-1].Template != ex.Template {
+			groups = append(groups, group{Template: ex.Template})
+		}
+		var g = &groups[len(groups)-1]
+		g.Examples = append(g.Examples, ex)
+	}
+	return groups
+}
+
+var index = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Template catalog</title>
+<style>
+  body { font-family: sans-serif; margin: 2em; }
+  nav a { margin-right: 1em; }
+  section { margin-bottom: 3em; }
+  figure { margin: 1em 0; }
+  figcaption { font-size: small; color: #666; }
+  iframe { width: 100%; height: 20em; border: 1px solid #ccc; resize: vertical; }
+</style>
+</head>
+<body>
+<h1>Template catalog</h1>
+<nav>{{range .}}<a href="#{{.Template}}">{{.Template}}</a>{{end}}</nav>
+{{range .}}
+<section id="{{.Template}}">
+  <h2>{{.Template}}</h2>
+  {{range .Examples}}
+  <figure>
+    <figcaption>{{.Name}}</figcaption>
+    <iframe src="render?template={{.Template}}&amp;example={{.Name}}" loading="lazy"></iframe>
+  </figure>
+  {{end}}
+</section>
+{{else}}
+<p>There are no examples.</p>
+{{end}}
+</body>
+</html>
+`))
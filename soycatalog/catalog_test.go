@@ -0,0 +1,123 @@
+package soycatalog
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/soytest"
+)
+
+func TestLoadExamples(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "soycatalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for filename, content := range map[string]string{
+		"widgets.button.json": `{"primary": {"label": "Save", "primary": true}, "disabled": {"label": "x"}}`,
+		"page.home.json":      `{"empty": {}}`,
+		"README.md":           `not an example`,
+	} {
+		if err = ioutil.WriteFile(filepath.Join(dir, filename), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	examples, err := LoadExamples(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected = []Example{
+		{"page.home", "empty", data.Map{}},
+		{"widgets.button", "disabled", data.Map{"label": data.String("x")}},
+		{"widgets.button", "primary", data.Map{"label": data.String("Save"), "primary": data.Bool(true)}},
+	}
+	if !reflect.DeepEqual(examples, expected) {
+		t.Errorf("expected %v, got %v", expected, examples)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "bad.json"), []byte(`[]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadExamples(dir); err == nil || !strings.Contains(err.Error(), "bad.json") {
+		t.Errorf("expected an error for bad.json, got %v", err)
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	var tmpl = soytest.MustCompile(`
+/**
+ * @param label
+ * @param? primary
+ */
+{template .button}
+<button{if $primary} class="primary"{/if}>{$label}</button>
+{/template}`)
+	var catalog = New(tmpl.Tofu, []Example{
+		{tmpl.Name, "primary", data.Map{"label": data.String("Save"), "primary": data.Bool(true)}},
+		{tmpl.Name, "plain", data.Map{"label": data.String("Cancel")}},
+		{tmpl.Name, "broken", data.Map{}},
+	})
+
+	var tests = []struct {
+		url      string
+		code     int
+		contains []string
+	}{
+		{"/catalog/", http.StatusOK, []string{
+			`<h2>soytest.button</h2>`,
+			`<figcaption>broken</figcaption>`,
+			`src="render?template=soytest.button&amp;example=plain"`,
+		}},
+		{"/catalog/render?template=soytest.button&example=primary", http.StatusOK, []string{
+			`<button class="primary">Save</button>`,
+		}},
+		{"/catalog/render?template=soytest.button&example=missing", http.StatusNotFound, []string{
+			`no example "missing" of template soytest.button`,
+		}},
+	}
+	for _, test := range tests {
+		var w = httptest.NewRecorder()
+		catalog.ServeHTTP(w, httptest.NewRequest("GET", test.url, nil))
+		if w.Code != test.code {
+			t.Errorf("%s: expected %d, got %d", test.url, test.code, w.Code)
+		}
+		for _, s := range test.contains {
+			if !strings.Contains(w.Body.String(), s) {
+				t.Errorf("%s: expected %q in:\n%s", test.url, s, w.Body.String())
+			}
+		}
+	}
+
+	var entries = catalog.Entries("/catalog/")
+	var expected = []Entry{
+		{"soytest.button", "broken", "/catalog/render?example=broken&template=soytest.button"},
+		{"soytest.button", "plain", "/catalog/render?example=plain&template=soytest.button"},
+		{"soytest.button", "primary", "/catalog/render?example=primary&template=soytest.button"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %v, got %v", expected, entries)
+	}
+
+	var w = httptest.NewRecorder()
+	catalog.ServeHTTP(w, httptest.NewRequest("GET", "http://localhost:9812/catalog/entries.json", nil))
+	var served []Entry
+	if err := json.Unmarshal(w.Body.Bytes(), &served); err != nil {
+		t.Fatal(err)
+	}
+	if len(served) != 3 || served[0].URL != "http://localhost:9812"+expected[0].URL {
+		t.Errorf("unexpected entries: %v", served)
+	}
+
+	if _, err := catalog.Render(tmpl.Name, "broken"); err == nil {
+		t.Error("expected an error rendering the broken example")
+	}
+}
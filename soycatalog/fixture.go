@@ -0,0 +1,419 @@
+package soycatalog
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/template"
+)
+
+// Kind is the kind of value expected by a template for a param, or for a
+// field or element within one.
+type Kind int
+
+const (
+	Unknown Kind = iota
+	String
+	Bool
+	Number
+	List
+	Map
+)
+
+func (k Kind) String() string {
+	switch k {
+	case String:
+		return "string"
+	case Bool:
+		return "bool"
+	case Number:
+		return "number"
+	case List:
+		return "list"
+	case Map:
+		return "map"
+	}
+	return "unknown"
+}
+
+// maxDepth is the deepest that a shape is nested within a param, when taken
+// from the params of a called template.
+const maxDepth = 8
+
+// Shape describes the value expected for a param, as inferred from the way the
+// template uses it, since params do not declare their types.  For example,
+// {foreach $item in $items}{$item.price * 2}{/foreach} implies that $items is
+// a list of maps with a numeric price.
+type Shape struct {
+	Kind   Kind
+	Elem   *Shape            // shape of the elements of a List
+	Fields map[string]*Shape // shape of the fields of a Map, by key
+
+	// strong is true if the kind is implied by the use of the value (e.g. as a
+	// list or in arithmetic), rather than suggested (e.g. by printing it).
+	strong bool
+}
+
+// hint records that the value is used as the given kind.  A value that is
+// both tested and printed is taken to be a string.
+func (s *Shape) hint(kind Kind, strong bool) {
+	if s.Kind == Unknown || strong && !s.strong ||
+		!s.strong && s.Kind == Bool && kind == String {
+		s.Kind, s.strong = kind, strong
+	}
+}
+
+// merge records the uses of another value of the same shape, up to the given
+// depth, since the shapes of recursive templates may refer to themselves.
+func (s *Shape) merge(other *Shape, depth int) {
+	if depth == 0 {
+		return
+	}
+	if other.Kind != Unknown {
+		s.hint(other.Kind, other.strong)
+	}
+	if other.Elem != nil {
+		s.elem().merge(other.Elem, depth-1)
+	}
+	for key, field := range other.Fields {
+		s.field(key).merge(field, depth-1)
+	}
+}
+
+func (s *Shape) elem() *Shape {
+	s.hint(List, true)
+	if s.Elem == nil {
+		s.Elem = &Shape{}
+	}
+	return s.Elem
+}
+
+func (s *Shape) field(key string) *Shape {
+	s.hint(Map, true)
+	if s.Fields == nil {
+		s.Fields = make(map[string]*Shape)
+	}
+	if s.Fields[key] == nil {
+		s.Fields[key] = &Shape{}
+	}
+	return s.Fields[key]
+}
+
+// ParamShapes returns the inferred shape of each param of the named template.
+// Params passed on to other templates take on the shapes of their params.
+func ParamShapes(reg template.Registry, name string) (map[string]*Shape, error) {
+	var params, ok = inferrer{reg, make(map[string]map[string]*Shape)}.infer(name)
+	if !ok {
+		return nil, fmt.Errorf("template not found: %s", name)
+	}
+	return params, nil
+}
+
+// inferrer infers the shapes of params from their use.
+type inferrer struct {
+	reg    template.Registry
+	shapes map[string]map[string]*Shape // param shapes by template name
+}
+
+// infer returns the shapes of the params of the named template.  Shapes of
+// templates that call themselves, directly or not, reflect only the uses seen
+// before the recursive call.
+func (inf inferrer) infer(name string) (map[string]*Shape, bool) {
+	if params, ok := inf.shapes[name]; ok {
+		return params, true
+	}
+	var t, ok = inf.reg.Template(name)
+	if !ok {
+		return nil, false
+	}
+	var params = make(map[string]*Shape)
+	if t.Doc != nil {
+		for _, param := range t.Doc.Params {
+			params[param.Name] = &Shape{}
+		}
+	}
+	inf.shapes[name] = params
+	inf.walk(params, t.Node.Body, map[string]*Shape{})
+	return params, true
+}
+
+// walk infers the shapes of params from their uses within the given node,
+// where env holds the shapes of the local variables.
+func (inf inferrer) walk(params map[string]*Shape, node ast.Node, env map[string]*Shape) {
+	switch node := node.(type) {
+	case nil:
+		return
+	case *ast.ForNode:
+		var body = env
+		if list := inf.shape(params, node.List, env); list != nil {
+			body = make(map[string]*Shape, len(env)+1)
+			for k, v := range env {
+				body[k] = v
+			}
+			body[node.Var] = list.elem()
+		}
+		inf.walk(params, node.List, env)
+		inf.walk(params, node.Body, body)
+		inf.walk(params, node.IfEmpty, env)
+		return
+	case *ast.LetValueNode:
+		inf.walk(params, node.Expr, env)
+		if s := inf.shape(params, node.Expr, env); s != nil {
+			env[node.Name] = s
+		}
+		return
+	case *ast.PrintNode:
+		if s := inf.shape(params, node.Arg, env); s != nil {
+			s.hint(String, false)
+		}
+	case *ast.IfCondNode:
+		if s := inf.shape(params, node.Cond, env); s != nil {
+			s.hint(Bool, false)
+		}
+	case *ast.NotNode:
+		if s := inf.shape(params, node.Arg, env); s != nil {
+			s.hint(Bool, false)
+		}
+	case *ast.NegateNode:
+		inf.hint(params, node.Arg, env, Number)
+	case *ast.MulNode, *ast.DivNode, *ast.ModNode, *ast.SubNode,
+		*ast.GtNode, *ast.GteNode, *ast.LtNode, *ast.LteNode,
+		*ast.ShiftLeftNode, *ast.ShiftRightNode, *ast.BitAndNode, *ast.BitOrNode, *ast.BitXorNode:
+		for _, arg := range node.(ast.ParentNode).Children() {
+			inf.hint(params, arg, env, Number)
+		}
+	case *ast.CallNode:
+		inf.call(params, node, env)
+	case *ast.FunctionNode:
+		var kind Kind
+		switch node.Name {
+		case "length":
+			kind = List
+		case "keys":
+			kind = Map
+		case "round", "floor", "ceiling", "min", "max":
+			kind = Number
+		case "strContains":
+			kind = String
+		}
+		if kind != Unknown {
+			for _, arg := range node.Args {
+				inf.hint(params, arg, env, kind)
+			}
+		}
+	}
+	if parent, ok := node.(ast.ParentNode); ok {
+		for _, child := range parent.Children() {
+			inf.walk(params, child, env)
+		}
+	}
+}
+
+// call infers the shapes of the data passed by a call from the shapes of the
+// params of the called template.
+func (inf inferrer) call(params map[string]*Shape, node *ast.CallNode, env map[string]*Shape) {
+	var data = inf.shape(params, node.Data, env)
+	if data != nil {
+		data.hint(Map, true)
+	}
+	var callee, ok = inf.infer(node.Name)
+	if !ok {
+		return
+	}
+	var passed = make(map[string]bool)
+	for _, param := range node.Params {
+		if param, ok := param.(*ast.CallParamValueNode); ok {
+			if s := inf.shape(params, param.Value, env); s != nil && callee[param.Key] != nil {
+				s.merge(callee[param.Key], maxDepth)
+			}
+		}
+		switch param := param.(type) {
+		case *ast.CallParamValueNode:
+			passed[param.Key] = true
+		case *ast.CallParamContentNode:
+			passed[param.Key] = true
+		}
+	}
+	for name, s := range callee {
+		switch {
+		case passed[name]:
+		case data != nil:
+			data.field(name).merge(s, maxDepth)
+		case node.AllData && params[name] != nil:
+			params[name].merge(s, maxDepth)
+		}
+	}
+}
+
+// hint records that the value of the given expression is used as the given
+// kind, if it is a data reference.
+func (inf inferrer) hint(params map[string]*Shape, expr ast.Node, env map[string]*Shape, kind Kind) {
+	if s := inf.shape(params, expr, env); s != nil {
+		s.hint(kind, true)
+	}
+}
+
+// shape returns the shape of the value of the given expression, if it is a
+// reference to a param or local variable, or nil otherwise.
+func (inf inferrer) shape(params map[string]*Shape, expr ast.Node, env map[string]*Shape) *Shape {
+	var ref, ok = expr.(*ast.DataRefNode)
+	if !ok {
+		return nil
+	}
+	var s = env[ref.Key]
+	if s == nil {
+		s = params[ref.Key]
+	}
+	if s == nil {
+		return nil
+	}
+	for _, access := range ref.Access {
+		switch access := access.(type) {
+		case *ast.DataRefKeyNode:
+			s = s.field(access.Key)
+		case *ast.DataRefIndexNode:
+			s = s.elem()
+		case *ast.DataRefExprNode:
+			if key, ok := access.Arg.(*ast.StringNode); ok {
+				s = s.field(key.Value)
+			} else {
+				s = s.elem()
+			}
+		}
+	}
+	return s
+}
+
+// Faker returns a value for the param or field at the given path (e.g.
+// "user.email", or "items[].price" for the price of each item), with the given
+// shape.  It returns false to defer to the next faker, or to the default.
+type Faker func(path string, shape *Shape) (data.Value, bool)
+
+// Generator generates plausible data for templates from the inferred shapes of
+// their params, e.g. for examples in the catalog, or to render every template
+// in tests.
+type Generator struct {
+	reg    template.Registry
+	rand   *rand.Rand
+	fakers []Faker
+}
+
+// NewGenerator returns a generator for the templates in the registry, which
+// generates the same data for the same seed.
+func NewGenerator(reg template.Registry, seed int64) *Generator {
+	return &Generator{reg: reg, rand: rand.New(rand.NewSource(seed))}
+}
+
+// WithFaker adds a faker to the generator, which takes precedence over those
+// added before it and over the defaults.
+func (g *Generator) WithFaker(faker Faker) *Generator {
+	g.fakers = append([]Faker{faker}, g.fakers...)
+	return g
+}
+
+// Generate returns data for all of the params of the named template.
+func (g *Generator) Generate(name string) (data.Map, error) {
+	return g.generate(name, false)
+}
+
+// Examples returns n examples of generated data for each template in the
+// registry, named "generated-1" to "generated-n".  The first example of each
+// has all of the template's params, and each of the rest omits each optional
+// param with even odds.
+func (g *Generator) Examples(n int) ([]Example, error) {
+	var examples []Example
+	for _, t := range g.reg.Templates {
+		for i := 1; i <= n; i++ {
+			var params, err = g.generate(t.Node.Name, i > 1)
+			if err != nil {
+				return nil, err
+			}
+			examples = append(examples, Example{t.Node.Name, fmt.Sprintf("generated-%d", i), params})
+		}
+	}
+	sortExamples(examples)
+	return examples, nil
+}
+
+func (g *Generator) generate(name string, omitOptional bool) (data.Map, error) {
+	var shapes, err = ParamShapes(g.reg, name)
+	if err != nil {
+		return nil, err
+	}
+	var t, _ = g.reg.Template(name)
+	var params = make(data.Map)
+	if t.Doc == nil {
+		return params, nil
+	}
+	for _, param := range t.Doc.Params {
+		if param.Optional && omitOptional && g.rand.Intn(2) == 0 {
+			continue
+		}
+		params[param.Name] = g.value(param.Name, shapes[param.Name])
+	}
+	return params, nil
+}
+
+// value generates a value of the given shape for the given path.
+func (g *Generator) value(path string, s *Shape) data.Value {
+	for _, faker := range g.fakers {
+		if val, ok := faker(path, s); ok {
+			return val
+		}
+	}
+	switch s.Kind {
+	case List:
+		var list = make(data.List, 1+g.rand.Intn(3))
+		for i := range list {
+			list[i] = g.value(path+"[]", s.Elem)
+		}
+		return list
+	case Map:
+		var keys []string
+		for key := range s.Fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys) // for determinism
+		var m = make(data.Map, len(keys))
+		for _, key := range keys {
+			m[key] = g.value(path+"."+key, s.Fields[key])
+		}
+		return m
+	case Number:
+		return data.Int(g.rand.Intn(100))
+	case Bool:
+		return data.Bool(g.rand.Intn(2) == 0)
+	}
+	return data.String(g.fakeString(path))
+}
+
+var (
+	fakeNames = []string{"Alice", "Bob", "Carol", "Dave", "Erin", "Frank"}
+	fakeWords = []string{"lorem", "ipsum", "dolor", "sit", "amet", "consectetur", "adipiscing", "elit"}
+)
+
+// fakeString returns a string suited to the name of the param or field at
+// the given path.
+func (g *Generator) fakeString(path string) string {
+	var name = path[strings.LastIndexAny(path, ".]")+1:]
+	var lower = strings.ToLower(name)
+	switch {
+	case strings.Contains(lower, "email"):
+		return fmt.Sprintf("%s@example.com", strings.ToLower(fakeNames[g.rand.Intn(len(fakeNames))]))
+	case strings.Contains(lower, "url") || strings.Contains(lower, "href") || strings.Contains(lower, "link"):
+		return fmt.Sprintf("https://example.com/%s", fakeWords[g.rand.Intn(len(fakeWords))])
+	case strings.Contains(lower, "name"):
+		return fakeNames[g.rand.Intn(len(fakeNames))]
+	case strings.Contains(lower, "id"):
+		return fmt.Sprintf("%d", 1000+g.rand.Intn(9000))
+	}
+	var words = make([]string, 1+g.rand.Intn(4))
+	for i := range words {
+		words[i] = fakeWords[g.rand.Intn(len(fakeWords))]
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,160 @@
+package soycatalog
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/robfig/soy"
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/soyhtml"
+	"github.com/robfig/soy/template"
+)
+
+const fixtureSoy = `{namespace shop}
+
+/**
+ * @param user
+ * @param items
+ * @param? coupon
+ * @param? showTotal
+ */
+{template .cart}
+<h1>{$user.name} &lt;{$user.email}&gt;</h1>
+{if length($items) > 0}
+  <ul>
+  {foreach $item in $items}
+    {let $price: $item.price * $item.quantity /}
+    <li><a href="{$item.url}">{$item.title}</a> {$price}</li>
+  {/foreach}
+  </ul>
+{/if}
+{if $showTotal}{call .total data="$user" /}{/if}
+{if $coupon}{$coupon}{/if}
+{/template}
+
+/**
+ * @param name
+ * @param tags
+ */
+{template .total}
+{$name}{foreach $tag in $tags}{$tag.id}{/foreach}
+{/template}
+`
+
+func compileFixture(t *testing.T) *template.Registry {
+	var reg, err = soy.NewBundle().AddTemplateString("shop.soy", fixtureSoy).Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+// describe returns a compact description of the shape, for comparison.
+func describe(s *Shape) string {
+	switch s.Kind {
+	case List:
+		return "[" + describe(s.Elem) + "]"
+	case Map:
+		var fields []string
+		for key, field := range s.Fields {
+			fields = append(fields, key+":"+describe(field))
+		}
+		sort.Strings(fields)
+		return "{" + strings.Join(fields, " ") + "}"
+	}
+	return s.Kind.String()
+}
+
+func TestParamShapes(t *testing.T) {
+	var reg = compileFixture(t)
+	var tests = []struct {
+		template string
+		expected map[string]string
+	}{
+		{"shop.cart", map[string]string{
+			"user":      "{email:string name:string tags:[{id:string}]}",
+			"items":     "[{price:number quantity:number title:string url:string}]",
+			"coupon":    "string",
+			"showTotal": "bool",
+		}},
+		{"shop.total", map[string]string{
+			"name": "string",
+			"tags": "[{id:string}]",
+		}},
+	}
+	for _, test := range tests {
+		var shapes, err = ParamShapes(*reg, test.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var actual = make(map[string]string)
+		for name, shape := range shapes {
+			actual[name] = describe(shape)
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.template, test.expected, actual)
+		}
+	}
+
+	if _, err := ParamShapes(*reg, "shop.missing"); err == nil {
+		t.Error("expected an error for a missing template")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	var reg = compileFixture(t)
+	var gen = NewGenerator(*reg, 1).
+		WithFaker(func(path string, shape *Shape) (data.Value, bool) {
+			if path == "items[].title" {
+				return data.String("Widget"), true
+			}
+			return nil, false
+		})
+	var params, err = gen.Generate("shop.cart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(params) != 4 {
+		t.Errorf("expected all 4 params, got %v", params)
+	}
+	if email := params["user"].(data.Map)["email"].String(); !strings.HasSuffix(email, "@example.com") {
+		t.Errorf("expected an email, got %q", email)
+	}
+	for _, item := range params["items"].(data.List) {
+		var item = item.(data.Map)
+		if _, ok := item["price"].(data.Int); !ok {
+			t.Errorf("expected a numeric price, got %v", item["price"])
+		}
+		if title := item["title"].String(); title != "Widget" {
+			t.Errorf("expected the faked title, got %q", title)
+		}
+		if url := item["url"].String(); !strings.HasPrefix(url, "https://") {
+			t.Errorf("expected a url, got %q", url)
+		}
+	}
+
+	again, _ := NewGenerator(*reg, 1).WithFaker(gen.fakers[0]).Generate("shop.cart")
+	if !reflect.DeepEqual(params, again) {
+		t.Errorf("expected the same data for the same seed, got %v and %v", params, again)
+	}
+}
+
+// TestRenderGenerated renders every template with generated data.
+func TestRenderGenerated(t *testing.T) {
+	var reg = compileFixture(t)
+	var examples, err = NewGenerator(*reg, 1).Examples(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(examples) != 10 {
+		t.Fatalf("expected 5 examples of each template, got %d", len(examples))
+	}
+	var catalog = New(soyhtml.NewTofu(reg), examples)
+	for _, ex := range examples {
+		if _, err := catalog.Render(ex.Template, ex.Name); err != nil {
+			t.Errorf("%s %s: %v", ex.Template, ex.Name, err)
+		}
+	}
+}
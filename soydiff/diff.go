@@ -0,0 +1,205 @@
+// Package soydiff compares the HTML rendered by templates structurally, for
+// review tools and visual regression tests during template refactors.
+//
+// Unlike a text diff, it is not affected by changes to whitespace, attribute
+// order, quoting, or the case of names, and it reports each change at the
+// element where it occurs.
+package soydiff
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/soyhtml"
+)
+
+// ChangeKind is the kind of a structural change.
+type ChangeKind int
+
+const (
+	Inserted    ChangeKind = iota // a node was added
+	Removed                       // a node was removed
+	TextChanged                   // the content of a text node changed
+	AttrChanged                   // an attribute was added, removed, or changed
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Inserted:
+		return "inserted"
+	case Removed:
+		return "removed"
+	case TextChanged:
+		return "text changed"
+	case AttrChanged:
+		return "attribute changed"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// Change is a single difference between two HTML documents.
+type Change struct {
+	Kind ChangeKind
+	Path string // location of the element, e.g. "/html/body/div[2]/p[1]"
+	Attr string // name of the attribute, for AttrChanged
+
+	// Old and New are the HTML of the removed and inserted nodes, the text
+	// before and after a TextChanged, or the attribute values before and after
+	// an AttrChanged.  They are empty if not applicable.
+	Old, New string
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case Inserted:
+		return fmt.Sprintf("%s: inserted %s", c.Path, c.New)
+	case Removed:
+		return fmt.Sprintf("%s: removed %s", c.Path, c.Old)
+	case AttrChanged:
+		return fmt.Sprintf("%s: attribute %s changed from %q to %q", c.Path, c.Attr, c.Old, c.New)
+	}
+	return fmt.Sprintf("%s: text changed from %q to %q", c.Path, c.Old, c.New)
+}
+
+// Side is one of the two renders to compare.
+type Side struct {
+	Tofu     *soyhtml.Tofu
+	Template string
+	Data     data.Map
+}
+
+// Render renders each side and returns the structural differences between the
+// old and new output.  The sides may differ in bundle, template, or data.
+func Render(old, new Side) ([]Change, error) {
+	var oldBuf, newBuf bytes.Buffer
+	if err := old.Tofu.NewRenderer(old.Template).Execute(&oldBuf, old.Data); err != nil {
+		return nil, fmt.Errorf("rendering old: %w", err)
+	}
+	if err := new.Tofu.NewRenderer(new.Template).Execute(&newBuf, new.Data); err != nil {
+		return nil, fmt.Errorf("rendering new: %w", err)
+	}
+	return HTML(oldBuf.String(), newBuf.String()), nil
+}
+
+// HTML returns the structural differences between two HTML documents or
+// fragments.
+func HTML(old, new string) []Change {
+	var changes []Change
+	diffChildren(&changes, "", parseHTML(old), parseHTML(new))
+	return changes
+}
+
+// diffChildren compares the children of two matching nodes at the given path.
+func diffChildren(changes *[]Change, path string, old, new *node) {
+	var oldPaths, newPaths = childPaths(path, old), childPaths(path, new)
+	var i, j = 0, 0
+	for _, pair := range align(old.children, new.children) {
+		for ; i < pair[0]; i++ {
+			*changes = append(*changes, Change{Kind: Removed, Path: oldPaths[i], Old: old.children[i].String()})
+		}
+		for ; j < pair[1]; j++ {
+			*changes = append(*changes, Change{Kind: Inserted, Path: newPaths[j], New: new.children[j].String()})
+		}
+		if i < len(old.children) && j < len(new.children) {
+			diffNode(changes, newPaths[j], old.children[i], new.children[j])
+			i++
+			j++
+		}
+	}
+}
+
+// diffNode compares two nodes of the same kind at the given path.
+func diffNode(changes *[]Change, path string, old, new *node) {
+	if old.tag == "" {
+		if old.text != new.text {
+			*changes = append(*changes, Change{Kind: TextChanged, Path: path, Old: old.text, New: new.text})
+		}
+		return
+	}
+	var names = make(map[string]bool)
+	for name := range old.attrs {
+		names[name] = true
+	}
+	for name := range new.attrs {
+		names[name] = true
+	}
+	for _, name := range sortedKeys(names) {
+		var oldVal, inOld = old.attrs[name]
+		var newVal, inNew = new.attrs[name]
+		if oldVal != newVal || inOld != inNew {
+			*changes = append(*changes, Change{Kind: AttrChanged, Path: path, Attr: name, Old: oldVal, New: newVal})
+		}
+	}
+	diffChildren(changes, path, old, new)
+}
+
+// align matches the children of two nodes by kind (element name, or text),
+// using their longest common subsequence.  It returns the index pairs of the
+// matched children in order, followed by the pair of lengths.
+func align(old, new []*node) [][2]int {
+	// lcs[i][j] is the length of the LCS of old[i:] and new[j:].
+	var lcs = make([][]int, len(old)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			switch {
+			case old[i].tag == new[j].tag:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var pairs [][2]int
+	for i, j := 0, 0; i < len(old) && j < len(new); {
+		switch {
+		case old[i].tag == new[j].tag:
+			pairs = append(pairs, [2]int{i, j})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return append(pairs, [2]int{len(old), len(new)})
+}
+
+// childPaths returns the path of each child of the node at the given path.
+func childPaths(path string, parent *node) []string {
+	var paths = make([]string, len(parent.children))
+	var counts = make(map[string]int)
+	for i, child := range parent.children {
+		var name = child.tag
+		if name == "" {
+			name = "text()"
+		}
+		counts[name]++
+		paths[i] = fmt.Sprintf("%s/%s[%d]", path, name, counts[name])
+	}
+	return paths
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]string:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]bool:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,78 @@
+package soydiff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/soytest"
+)
+
+func TestHTML(t *testing.T) {
+	type test struct {
+		name     string
+		old, new string
+		changes  []string
+	}
+	var tests = []test{
+		{"identical", "<div>hello</div>", "<div>hello</div>", nil},
+		{"formatting", `<DIV class='a'  id=b>  hello
+			world </div>`, `<div id="b" class="a">hello world</div>`, nil},
+		{"comments", "<p>a<!-- x --></p>", "<p>a</p>", nil},
+		{"text", "<p>hello</p>", "<p>goodbye</p>",
+			[]string{`/p[1]/text()[1]: text changed from "hello" to "goodbye"`}},
+		{"attr changed", `<a href="/a">x</a>`, `<a href="/b">x</a>`,
+			[]string{`/a[1]: attribute href changed from "/a" to "/b"`}},
+		{"attr added", `<input>`, `<input disabled>`,
+			[]string{`/input[1]: attribute disabled changed from "" to ""`}},
+		{"inserted", "<ul><li>a</li><li>c</li></ul>", "<ul><li>a</li><li>b</li><li>c</li></ul>",
+			[]string{`/ul[1]/li[2]/text()[1]: text changed from "c" to "b"`,
+				`/ul[1]/li[3]: inserted <li>c</li>`}},
+		{"removed", "<div><p>a</p><hr><p>b</p></div>", "<div><p>a</p><p>b</p></div>",
+			[]string{`/div[1]/hr[1]: removed <hr>`}},
+		{"tag changed", "<div><b>x</b></div>", "<div><i>x</i></div>",
+			[]string{`/div[1]/b[1]: removed <b>x</b>`, `/div[1]/i[1]: inserted <i>x</i>`}},
+		{"void and self-closing", "<p>a<br>b</p>", "<p>a<br/>c</p>",
+			[]string{`/p[1]/text()[2]: text changed from "b" to "c"`}},
+		{"unclosed", "<div><p>a</div><p>b", "<div><p>a</p></div><p>b</p>", nil},
+		{"raw text", "<script>if (a<b) {}</script>", "<script>if (a<c) {}</script>",
+			[]string{`/script[1]/text()[1]: text changed from "if (a<b) {}" to "if (a<c) {}"`}},
+	}
+
+	for _, test := range tests {
+		var changes []string
+		for _, change := range HTML(test.old, test.new) {
+			changes = append(changes, change.String())
+		}
+		if !reflect.DeepEqual(changes, test.changes) {
+			t.Errorf("%s: expected %q, got %q", test.name, test.changes, changes)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	var tmpl = soytest.MustCompile(`
+/** @param names */
+{template .list}
+<ul>{foreach $name in $names}<li>{$name}</li>{/foreach}</ul>
+{/template}`)
+	var side = func(names ...interface{}) Side {
+		return Side{tmpl.Tofu, tmpl.Name, data.Map{"names": data.New(names)}}
+	}
+
+	var changes, err = Render(side("a", "b"), side("a", "c", "d"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected = []Change{
+		{TextChanged, "/ul[1]/li[2]/text()[1]", "", "b", "c"},
+		{Inserted, "/ul[1]/li[3]", "", "", "<li>d</li>"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected %v, got %v", expected, changes)
+	}
+
+	if _, err = Render(side(), Side{tmpl.Tofu, "soytest.missing", nil}); err == nil {
+		t.Error("expected an error rendering a missing template")
+	}
+}
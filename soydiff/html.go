@@ -0,0 +1,95 @@
+package soydiff
+
+import (
+	"strings"
+
+	"github.com/robfig/soy/internal/htmltok"
+)
+
+// node is an element or text node of a parsed HTML document.
+type node struct {
+	tag      string // element name, or "" for text
+	attrs    map[string]string
+	text     string // text content, with whitespace collapsed
+	children []*node
+}
+
+// voidElements have no end tag, and so no children.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+// parseHTML parses the given HTML into a tree, rooted at a node with no tag.
+// Like a browser, it does not fail on malformed HTML: unclosed elements are
+// closed by the end tag of an enclosing element, and stray end tags are
+// ignored.  Comments and doctypes are dropped, and whitespace-only text is
+// ignored.
+func parseHTML(src string) *node {
+	var root = &node{}
+	var stack = []*node{root}
+	var top = func() *node { return stack[len(stack)-1] }
+	for _, tok := range htmltok.Tokenize(src) {
+		switch tok.Kind {
+		case htmltok.Text:
+			addText(top(), tok.Data)
+		case htmltok.EndTag:
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].tag == tok.Data {
+					stack = stack[:i]
+					break
+				}
+			}
+		case htmltok.StartTag:
+			var elem = &node{tag: tok.Data, attrs: make(map[string]string)}
+			for _, attr := range tok.Attrs {
+				elem.attrs[attr.Name] = attr.Value
+			}
+			top().children = append(top().children, elem)
+			if !tok.SelfClosing && !voidElements[elem.tag] {
+				stack = append(stack, elem)
+			}
+		}
+	}
+	return root
+}
+
+// addText appends the given text to the parent's children, joining it with a
+// preceding text node.
+func addText(parent *node, text string) {
+	if text = strings.Join(strings.Fields(text), " "); text == "" {
+		return
+	}
+	if n := len(parent.children); n > 0 && parent.children[n-1].tag == "" {
+		parent.children[n-1].text += " " + text
+		return
+	}
+	parent.children = append(parent.children, &node{text: text})
+}
+
+// String returns the HTML for the node, normalized.
+func (n *node) String() string {
+	var buf strings.Builder
+	n.write(&buf)
+	return buf.String()
+}
+
+func (n *node) write(buf *strings.Builder) {
+	if n.tag == "" {
+		buf.WriteString(n.text)
+		return
+	}
+	buf.WriteString("<" + n.tag)
+	for _, name := range sortedKeys(n.attrs) {
+		buf.WriteString(" " + name + `="` + n.attrs[name] + `"`)
+	}
+	buf.WriteString(">")
+	if voidElements[n.tag] {
+		return
+	}
+	for _, child := range n.children {
+		child.write(buf)
+	}
+	buf.WriteString("</" + n.tag + ">")
+}
@@ -0,0 +1,266 @@
+package soyhtml
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/robfig/soy/ast"
+	soyt "github.com/robfig/soy/template"
+)
+
+// AccessRecorder collects the data paths that templates read while rendering.
+// It is intended to be attached to renderers in production for a sample of
+// requests, so that the report may be used to trim data that handlers fetch
+// but templates never use, and to find declared params that are dead.
+//
+// An AccessRecorder is safe for concurrent use by multiple renderers.
+type AccessRecorder struct {
+	sampleRate int
+
+	mu        sync.Mutex
+	seen      int
+	templates map[string]*templateAccess
+}
+
+// templateAccess accumulates the reads of a single template.
+type templateAccess struct {
+	renders int
+	params  []string
+	paths   map[string]int
+}
+
+// TemplateAccess summarizes the data read by a single template across the
+// sampled renders.
+type TemplateAccess struct {
+	Template string         // fully-qualified template name
+	Renders  int            // number of sampled renders that executed the template
+	Paths    map[string]int // data path => number of sampled renders that read it
+	Unread   []string       // declared params that were never read
+}
+
+// NewAccessRecorder returns a recorder that samples one out of every
+// sampleRate renders.  A sampleRate of 1 or less records every render.
+func NewAccessRecorder(sampleRate int) *AccessRecorder {
+	return &AccessRecorder{
+		sampleRate: sampleRate,
+		templates:  make(map[string]*templateAccess),
+	}
+}
+
+// sample returns true if the next render should be recorded.
+func (r *AccessRecorder) sample() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seen++
+	return r.sampleRate <= 1 || r.seen%r.sampleRate == 0
+}
+
+// merge adds the reads from a single render to the totals.
+func (r *AccessRecorder) merge(log *accessLog) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, reads := range log.reads {
+		var ta, ok = r.templates[name]
+		if !ok {
+			ta = &templateAccess{params: log.params[name], paths: make(map[string]int)}
+			r.templates[name] = ta
+		}
+		ta.renders++
+		for path := range reads {
+			ta.paths[path]++
+		}
+	}
+}
+
+// Report returns a summary of the data accessed by each template that was
+// executed during a sampled render, ordered by template name.
+func (r *AccessRecorder) Report() []TemplateAccess {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var report []TemplateAccess
+	for name, ta := range r.templates {
+		var paths = make(map[string]int, len(ta.paths))
+		for path, n := range ta.paths {
+			paths[path] = n
+		}
+		var unread []string
+		for _, param := range ta.params {
+			if !readsParam(paths, param) {
+				unread = append(unread, param)
+			}
+		}
+		report = append(report, TemplateAccess{name, ta.renders, paths, unread})
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Template < report[j].Template })
+	return report
+}
+
+// WriteReport writes the report in a human-readable form to the given writer.
+func (r *AccessRecorder) WriteReport(wr io.Writer) error {
+	for _, ta := range r.Report() {
+		if _, err := fmt.Fprintf(wr, "%s (%d renders)\n", ta.Template, ta.Renders); err != nil {
+			return err
+		}
+		var paths []string
+		for path := range ta.Paths {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			if _, err := fmt.Fprintf(wr, "\t%s\t%d\n", path, ta.Paths[path]); err != nil {
+				return err
+			}
+		}
+		for _, param := range ta.Unread {
+			if _, err := fmt.Fprintf(wr, "\tunread: $%s\n", param); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readsParam returns true if any of the given paths reads from the param.
+func readsParam(paths map[string]int, param string) bool {
+	var root = "$" + param
+	for path := range paths {
+		if path == root ||
+			strings.HasPrefix(path, root+".") ||
+			strings.HasPrefix(path, root+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// accessLog records the data paths read during a single render.
+type accessLog struct {
+	reads  map[string]map[string]struct{} // template name => set of paths
+	params map[string][]string            // template name => declared params
+}
+
+func newAccessLog() *accessLog {
+	return &accessLog{
+		reads:  make(map[string]map[string]struct{}),
+		params: make(map[string][]string),
+	}
+}
+
+// enter records that the given template was executed.
+func (l *accessLog) enter(tmpl string, doc *ast.SoyDocNode) {
+	if _, ok := l.reads[tmpl]; ok {
+		return
+	}
+	l.reads[tmpl] = make(map[string]struct{})
+	var params []string
+	for _, param := range doc.Params {
+		params = append(params, param.Name)
+	}
+	l.params[tmpl] = params
+}
+
+// read records that the given template read the given path.
+func (l *accessLog) read(tmpl, path string) {
+	l.reads[tmpl][path] = struct{}{}
+}
+
+// recordRead records the path read by the given data ref, if access is being
+// recorded.  Local variables that are bound to another data path (e.g. the
+// loop variable in a foreach) are reported as that path, while other local
+// variables are not reported at all.
+func (s *state) recordRead(node *ast.DataRefNode) {
+	if s.access == nil {
+		return
+	}
+	var root = "$" + node.Key
+	if local, ok := s.locals[node.Key]; ok {
+		if local == "" {
+			return
+		}
+		root = local
+	}
+	s.access.read(s.tmpl.Node.Name, root+accessPath(node.Access))
+}
+
+// bindLocal records the data path that the given local variable refers to, if
+// access is being recorded.  The suffix is appended to the path of the
+// expression (e.g. "[*]" for a loop variable).  It returns the previous
+// binding.
+func (s *state) bindLocal(name string, expr ast.Node, suffix string) (prev string, wasBound bool) {
+	if s.access == nil {
+		return "", false
+	}
+	if s.locals == nil {
+		s.locals = make(map[string]string)
+	}
+	prev, wasBound = s.locals[name]
+	var path string
+	if ref, ok := expr.(*ast.DataRefNode); ok && ref.Key != "ij" {
+		path = "$" + ref.Key
+		if local, ok := s.locals[ref.Key]; ok {
+			path = local
+		}
+		if path != "" {
+			path += accessPath(ref.Access) + suffix
+		}
+	}
+	s.locals[name] = path
+	return prev, wasBound
+}
+
+// unbindLocal restores a binding saved by bindLocal.
+func (s *state) unbindLocal(name, prev string, wasBound bool) {
+	if s.access == nil {
+		return
+	}
+	if wasBound {
+		s.locals[name] = prev
+	} else {
+		delete(s.locals, name)
+	}
+}
+
+// accessPath returns the normalized path for the given accesses.  Keys and
+// literal indices are kept, while computed accesses are reported as [*].
+func accessPath(access []ast.Node) string {
+	var buf bytes.Buffer
+	for _, node := range access {
+		switch node := node.(type) {
+		case *ast.DataRefKeyNode:
+			buf.WriteString("." + node.Key)
+		case *ast.DataRefIndexNode:
+			buf.WriteString("." + strconv.Itoa(node.Index))
+		default:
+			buf.WriteString("[*]")
+		}
+	}
+	return buf.String()
+}
+
+// recordAllData records the params passed implicitly by a data="all" call.
+// Each param declared by the callee that is not passed explicitly is treated
+// as having been read by the caller.
+func (s *state) recordAllData(node *ast.CallNode, callee soyt.Template) {
+	if s.access == nil {
+		return
+	}
+	var explicit = make(map[string]bool)
+	for _, param := range node.Params {
+		switch param := param.(type) {
+		case *ast.CallParamValueNode:
+			explicit[param.Key] = true
+		case *ast.CallParamContentNode:
+			explicit[param.Key] = true
+		}
+	}
+	for _, param := range callee.Doc.Params {
+		if !explicit[param.Name] {
+			s.recordRead(&ast.DataRefNode{Key: param.Name})
+		}
+	}
+}
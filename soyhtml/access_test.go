@@ -0,0 +1,90 @@
+package soyhtml
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/parse"
+	"github.com/robfig/soy/template"
+)
+
+const accessTestSoy = `{namespace test}
+
+/**
+ * @param user
+ * @param items
+ * @param legacy
+ */
+{template .page}
+  {$user.name}
+  {foreach $item in $items}
+    {$item.title}
+    {let $tag: $item.tags.0 /}
+    {$tag}
+  {/foreach}
+  {let $count: length($items) /}
+  {$count}
+  {call .footer data="all" /}
+{/template}
+
+/**
+ * @param user
+ */
+{template .footer}
+  {$user.email}{$ij.year}
+{/template}
+`
+
+func TestAccessRecorder(t *testing.T) {
+	var tree, err = parse.SoyFile("access.soy", accessTestSoy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var registry = template.Registry{}
+	if err = registry.Add(tree); err != nil {
+		t.Fatal(err)
+	}
+
+	var rec = NewAccessRecorder(2)
+	var obj = data.New(map[string]interface{}{
+		"user": map[string]interface{}{"name": "Rob", "email": "rob@example.com"},
+		"items": []interface{}{
+			map[string]interface{}{"title": "a", "tags": []interface{}{"x"}},
+		},
+	}).(data.Map)
+	for i := 0; i < 4; i++ {
+		err = NewTofu(&registry).NewRenderer("test.page").
+			Inject(data.Map{"year": data.Int(2014)}).
+			RecordAccess(rec).
+			Execute(ioutil.Discard, obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var expected = []TemplateAccess{
+		{"test.footer", 2, map[string]int{"$user.email": 2, "$ij.year": 2}, nil},
+		{"test.page", 2, map[string]int{
+			"$user.name":       2,
+			"$items":           2,
+			"$items[*].title":  2,
+			"$items[*].tags.0": 2,
+			"$user":            2,
+		}, []string{"legacy"}},
+	}
+	var actual = rec.Report()
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected:\n%v\ngot:\n%v", expected, actual)
+	}
+
+	var buf bytes.Buffer
+	if err = rec.WriteReport(&buf); err != nil {
+		t.Error(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("unread: $legacy")) {
+		t.Errorf("report missing unread param:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,144 @@
+package soyhtml
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/data"
+	soyt "github.com/robfig/soy/template"
+)
+
+// checkBudgetedData fails the render if the data of the given budgeted call,
+// or the injected data, contains a Stream.  A stream is consumed as it is
+// iterated and is not safe for concurrent use, so it may not be shared by a
+// call that may be abandoned while running, and by its fallback.  The data is
+// checked even if budgets are ignored, so that renders fail alike with and
+// without the Deterministic option.
+//
+// Of the data, only the params passed by the call and those declared by the
+// called template are checked, rather than all of the data passed with
+// data="all", which the called template does not read.
+func (s *state) checkBudgetedData(node *ast.CallNode, calledTmpl soyt.Template, vars data.Map) {
+	var keys []string
+	for _, param := range node.Params {
+		if param, ok := param.(*ast.CallParamValueNode); ok {
+			keys = append(keys, param.Key)
+		}
+	}
+	if calledTmpl.Doc != nil {
+		for _, param := range calledTmpl.Doc.Params {
+			keys = append(keys, param.Name)
+		}
+	}
+	for _, key := range keys {
+		if val, ok := vars[key]; ok && hasStream(val) {
+			s.errorf("budgeted call to %s: %s is or contains a stream, which may not be "+
+				"passed to a call with a budget", node.Name, key)
+		}
+	}
+	if hasStream(s.ij) {
+		s.errorf("budgeted call to %s: $ij is or contains a stream, which may not be "+
+			"used by a call with a budget", node.Name)
+	}
+}
+
+// hasStream returns true if the given value is or contains a Stream.  Lazy
+// values are not computed to check them, while the current entries of a
+// SyncMap are.
+func hasStream(val data.Value) bool {
+	switch val := val.(type) {
+	case *data.Stream:
+		return true
+	case *data.SyncMap:
+		return hasStream(val.Load())
+	case data.List:
+		for _, item := range val {
+			if hasStream(item) {
+				return true
+			}
+		}
+	case data.Map:
+		for _, item := range val {
+			if hasStream(item) {
+				return true
+			}
+		}
+	case *data.OrderedMap:
+		return hasStream(val.Map)
+	}
+	return false
+}
+
+// walkBudgeted executes the template called by the given budgeted call with
+// the given data, writing its output if it finishes within the call's budget.
+// It returns false, having written nothing, if the budget is exceeded, so that
+// the caller may render the fallback template in its place.  An error raised
+// by the template within the budget fails the render as usual.
+//
+// The template executes in a goroutine with a state of its own, which does not
+// record data access, profiles, source maps, or preloads, and does not share
+// the memoized results or fragments of the render, since the goroutine runs
+// to completion even once abandoned.  Its output is then discarded.  An
+// abandoned goroutine is not interrupted, so a function that never returns
+// (e.g. one blocked on a request without a timeout) leaks it.
+func (s *state) walkBudgeted(node *ast.CallNode, calledTmpl soyt.Template, vars data.Map) bool {
+	var callData = newScope(vars)
+	callData.enter(nil)
+	var callee = &state{
+		tmpl:       calledTmpl,
+		registry:   s.registry,
+		namespace:  calledTmpl.Namespace.Name,
+		autoescape: calledTmpl.Namespace.Autoescape,
+		context:    callData,
+		ij:         s.ij,
+		msgs:       s.msgs,
+		lenient:    s.lenient,
+		funcs:      s.funcs,
+		sortKeys:   s.sortKeys,
+		now:        s.now,
+		includes:   s.includes,
+		ctx:        s.ctx,
+		tracer:     s.tracer,
+	}
+	var buf bytes.Buffer
+	callee.wr = &buf
+	var end = s.startCall(callee, node.Name)
+
+	var done = make(chan error, 1) // buffered, so that an abandoned call exits
+	go func() {
+		var err error
+		defer func() { done <- err }()
+		defer func() {
+			if e := recover(); e != nil {
+				var isNew bool
+				if err, isNew = callee.recoverError(e); !isNew {
+					err = fmt.Errorf("%s: %w", callee.callAnnotation(), err)
+				}
+			}
+		}()
+		if end != nil {
+			defer end()
+		}
+		callee.walk(calledTmpl.Node)
+	}()
+
+	var timer = time.NewTimer(node.Budget)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			s.addCaller(err)
+			panic(err)
+		}
+		var start = s.outputOffset()
+		if _, err := s.wr.Write(buf.Bytes()); err != nil {
+			s.errorf("%s", err)
+		}
+		s.mapOutput(node, start)
+		return true
+	case <-timer.C:
+		return false
+	}
+}
@@ -0,0 +1,134 @@
+package soyhtml
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/robfig/soy/data"
+)
+
+const budgetTestSoy = `{namespace test}
+/** @param mode */
+{template .page}
+  <div>{call .recs budget="20ms" fallback=".spinner"}{param mode: $mode /}{param n: 3 /}{/call}</div>
+{/template}
+
+/** @param mode @param n */
+{template .recs}
+  {if $mode == 'slow'}{wait()}{elseif $mode == 'fail'}{fail()}{/if}
+  recs {$n}
+{/template}
+
+/** @param n */
+{template .spinner}loading {$n}{/template}
+`
+
+func TestCallBudget(t *testing.T) {
+	var release = make(chan struct{})
+	defer close(release)
+	var errFailed = errors.New("failed")
+	var funcs = map[string]Func{
+		"wait": {func([]data.Value) data.Value { <-release; return data.Null{} }, []int{0}},
+		"fail": ErrFunc(func([]data.Value) (data.Value, error) { return nil, errFailed }, 0),
+	}
+
+	var tests = []struct {
+		mode          string
+		deterministic bool
+		expected      string
+	}{
+		{"fast", false, "<div>recs 3</div>"},
+		{"slow", false, "<div>loading 3</div>"},
+		{"fast", true, "<div>recs 3</div>"},
+	}
+	for _, test := range tests {
+		var tofu = newTestTofu(t, budgetTestSoy).
+			WithFuncs(funcs).
+			WithOptions(Options{Deterministic: test.deterministic})
+		var buf bytes.Buffer
+		if err := tofu.Render(&buf, "test.page", data.Map{"mode": data.String(test.mode)}); err != nil {
+			t.Errorf("%s: %v", test.mode, err)
+			continue
+		}
+		if buf.String() != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.mode, test.expected, buf.String())
+		}
+	}
+
+	// An error within the budget fails the render as it would without one.
+	var errs [2]error
+	for i, deterministic := range []bool{false, true} {
+		errs[i] = newTestTofu(t, budgetTestSoy).
+			WithFuncs(funcs).
+			WithOptions(Options{Deterministic: deterministic}).
+			Render(new(bytes.Buffer), "test.page", data.Map{"mode": data.String("fail")})
+	}
+	if !errors.Is(errs[0], errFailed) {
+		t.Fatalf("expected the render to fail, got %v", errs[0])
+	}
+	if errs[0].Error() != errs[1].Error() {
+		t.Errorf("expected the error %q, got %q", errs[1], errs[0])
+	}
+
+	// Streams may not be passed to a budgeted call, with or without budgets.
+	const streamSoy = `{namespace test}
+/** @param items */
+{template .page}
+  {call .list budget="20ms" fallback=".list" data="all" /}
+{/template}
+
+/** @param items */
+{template .list}{foreach $item in $items}{$item}{/foreach}{/template}
+`
+	for _, deterministic := range []bool{false, true} {
+		var items = data.NewStream(func() (data.Value, bool) { return nil, false })
+		var err = newTestTofu(t, streamSoy).
+			WithOptions(Options{Deterministic: deterministic}).
+			Render(new(bytes.Buffer), "test.page", data.Map{"items": data.Map{"all": items}})
+		if err == nil || !strings.Contains(err.Error(), "items is or contains a stream") {
+			t.Errorf("deterministic=%v: expected a stream error, got %v", deterministic, err)
+		}
+	}
+
+	// Only the params of the called template are checked, including the
+	// entries of a SyncMap, as is the injected data.
+	const paramsSoy = `{namespace test}
+/**
+ * @param items
+ * @param other
+ */
+{template .page}
+  {call .list budget="20ms" fallback=".list" data="all" /}
+  {foreach $item in $other}{$item}{/foreach}
+{/template}
+
+/** @param items */
+{template .list}{foreach $item in $items}{$item}{/foreach}{/template}
+`
+	var newStream = func() *data.Stream {
+		return data.NewStream(func() (data.Value, bool) { return data.String("x"), false })
+	}
+	var streamTests = []struct {
+		data, ij data.Map
+		err      string
+	}{
+		{data.Map{"items": data.List{}, "other": newStream()}, nil, ""},
+		{data.Map{"items": data.NewSyncMap(data.Map{"a": newStream()}), "other": data.List{}}, nil,
+			"items is or contains a stream"},
+		{data.Map{"items": data.List{}, "other": data.List{}}, data.Map{"s": newStream()},
+			"$ij is or contains a stream"},
+	}
+	for _, test := range streamTests {
+		var err = newTestTofu(t, paramsSoy).NewRenderer("test.page").
+			Inject(test.ij).
+			Execute(new(bytes.Buffer), test.data)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%v: %v", test.data, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%v: expected an error containing %q, got %v", test.data, test.err, err)
+		}
+	}
+}
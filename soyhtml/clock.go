@@ -0,0 +1,93 @@
+package soyhtml
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/soy/data"
+)
+
+// Clock provides the current time to the now() and formatRelativeTime()
+// functions.  It is read once at the start of each render, so that the time
+// is consistent throughout.
+type Clock interface {
+	Now() time.Time
+}
+
+// FixedClock is a Clock that always returns the same time, for tests.
+type FixedClock time.Time
+
+func (c FixedClock) Now() time.Time { return time.Time(c) }
+
+// deterministicTime is the time used by deterministic renders that are not
+// given a clock.
+var deterministicTime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// WithClock sets the clock used by the time functions.  By default, the
+// system clock is used, or a fixed time if the Deterministic option is set.
+func (r *Renderer) WithClock(clock Clock) *Renderer {
+	r.clock = clock
+	return r
+}
+
+// clockFunc is a builtin function that depends on the time of the render.
+// Functions provided by the user with the same name take precedence.
+type clockFunc struct {
+	Apply           func(now time.Time, args []data.Value) data.Value
+	ValidArgLengths []int
+}
+
+var clockFuncs = map[string]clockFunc{
+	"now":                {funcNow, []int{0}},
+	"formatRelativeTime": {funcFormatRelativeTime, []int{1}},
+}
+
+// funcNow returns the time of the render, in milliseconds since the epoch (as
+// returned by javascript's Date.now()).
+func funcNow(now time.Time, _ []data.Value) data.Value {
+	return data.Int(now.UnixNano() / int64(time.Millisecond))
+}
+
+// funcFormatRelativeTime describes the given time, in milliseconds since the
+// epoch, relative to the time of the render, e.g. "5 minutes ago" or
+// "in 2 days".  It must match soy.$$formatRelativeTime.
+func funcFormatRelativeTime(now time.Time, args []data.Value) data.Value {
+	var ms int64
+	switch arg := args[0].(type) {
+	case data.Int:
+		ms = int64(arg)
+	case data.Float:
+		ms = int64(arg)
+	default:
+		panic(fmt.Errorf("expected a timestamp in milliseconds, got %T", args[0]))
+	}
+	var seconds = ms/1000 - now.Unix()
+	var future = seconds > 0
+	if !future {
+		seconds = -seconds
+	}
+
+	var n int64
+	var unit string
+	switch {
+	case seconds < 60:
+		return data.String("just now")
+	case seconds < 60*60:
+		n, unit = seconds/60, "minute"
+	case seconds < 24*60*60:
+		n, unit = seconds/(60*60), "hour"
+	case seconds < 30*24*60*60:
+		n, unit = seconds/(24*60*60), "day"
+	case seconds < 365*24*60*60:
+		n, unit = seconds/(30*24*60*60), "month"
+	default:
+		n, unit = seconds/(365*24*60*60), "year"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	if future {
+		return data.String(fmt.Sprintf("in %d %s", n, unit))
+	}
+	return data.String(fmt.Sprintf("%d %s ago", n, unit))
+}
@@ -0,0 +1,54 @@
+package soyhtml
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/robfig/soy/data"
+)
+
+func TestFormatRelativeTime(t *testing.T) {
+	var now = time.Date(2020, time.June, 15, 12, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		offset   time.Duration
+		expected string
+	}{
+		{0, "just now"},
+		{-59 * time.Second, "just now"},
+		{-time.Minute, "1 minute ago"},
+		{-90 * time.Minute, "1 hour ago"},
+		{5 * time.Hour, "in 5 hours"},
+		{-36 * time.Hour, "1 day ago"},
+		{45 * 24 * time.Hour, "in 1 month"},
+		{-800 * 24 * time.Hour, "2 years ago"},
+	}
+	for _, test := range tests {
+		var ms = now.Add(test.offset).UnixNano() / int64(time.Millisecond)
+		var actual = funcFormatRelativeTime(now, []data.Value{data.Int(ms)})
+		if actual != data.String(test.expected) {
+			t.Errorf("%v: expected %q, got %q", test.offset, test.expected, actual)
+		}
+	}
+}
+
+func TestClock(t *testing.T) {
+	var tofu = newTestTofu(t, `{namespace test}
+/** @param posted */
+{template .post}
+  {now()} posted {formatRelativeTime($posted)}
+{/template}`)
+	var now = time.Date(2020, time.June, 15, 12, 0, 0, 0, time.UTC)
+	var posted = now.Add(-2*time.Hour).UnixNano() / int64(time.Millisecond)
+
+	var buf bytes.Buffer
+	var err = tofu.NewRenderer("test.post").
+		WithClock(FixedClock(now)).
+		Execute(&buf, data.Map{"posted": data.Int(posted)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "1592222400000 posted 2 hours ago"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
@@ -0,0 +1,31 @@
+package soyhtml
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/robfig/soy/data"
+)
+
+// deterministicSeed seeds the random functions in deterministic renders.
+const deterministicSeed = 1
+
+// deterministicFuncs returns the given functions plus replacements for the
+// builtin functions whose results would otherwise vary between renders, for
+// use by a single deterministic render.  Functions provided to the Tofu are
+// not replaced.
+func deterministicFuncs(funcs map[string]Func) map[string]Func {
+	var rnd = rand.New(rand.NewSource(deterministicSeed))
+	var result = map[string]Func{
+		"randomInt": {func(v []data.Value) data.Value {
+			return data.Int(rnd.Int63n(int64(v[0].(data.Int))))
+		}, []int{1}},
+		"keys": {func(v []data.Value) data.Value {
+			return mapKeys(v[0], sort.Strings)
+		}, []int{1}},
+	}
+	for name, fn := range funcs {
+		result[name] = fn
+	}
+	return result
+}
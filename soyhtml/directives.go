@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/url"
 	"regexp"
+	"strings"
 	"text/template"
 	"unicode/utf8"
 
@@ -33,6 +34,8 @@ var PrintDirectives = map[string]PrintDirective{
 	"bidiSpanWrap":      {nil, []int{0}, false}, // unimplemented
 	"bidiUnicodeWrap":   {nil, []int{0}, false}, // unimplemented
 	"json":              {directiveJson, []int{0}, true},
+
+	"filterHtmlAttributes": {directiveFilterHtmlAttributes, []int{0}, true},
 }
 
 // ObligatoryPrintDirectives are always called
@@ -120,7 +123,11 @@ func directiveNoAutoescape(value data.Value, _ []data.Value) data.Value {
 	return value
 }
 
+// directiveEscapeHtml escapes the value, unless it is already sanitized HTML.
 func directiveEscapeHtml(value data.Value, _ []data.Value) data.Value {
+	if _, ok := value.(data.SanitizedHtml); ok {
+		return value
+	}
 	return data.String(template.HTMLEscapeString(value.String()))
 }
 
@@ -132,6 +139,41 @@ func directiveEscapeJsString(value data.Value, _ []data.Value) data.Value {
 	return data.String(template.JSEscapeString(value.String()))
 }
 
+// attributes is the value of a {param kind="attributes"} block: a set of
+// attribute name/value pairs, such as `class="foo" id="bar"`.  Values printed
+// within the block are escaped as usual, so the content is trusted to be safe
+// to insert into an open tag.
+type attributes string
+
+func (v attributes) Truthy() bool             { return v != "" }
+func (v attributes) String() string           { return string(v) }
+func (v attributes) Equals(o data.Value) bool { return v == o }
+
+// filterHtmlAttributesPattern matches the attribute names that may be
+// inserted dynamically, excluding those that may execute script or load
+// resources.  It matches the pattern used by soyutils.js.
+var filterHtmlAttributesPattern = regexp.MustCompile(
+	`(?i)^(?:style|on|action|archive|background|cite|classid|codebase|data|dsync|href|longdesc|src|usemap)|[^a-z0-9_$:-]`)
+
+// directiveFilterHtmlAttributes prints a set of attributes into an open tag.
+// Attribute sets built by {param kind="attributes"} are printed as-is, with a
+// trailing space if necessary to separate them from any following attribute.
+// Other values must be a single, safe attribute name.
+func directiveFilterHtmlAttributes(value data.Value, _ []data.Value) data.Value {
+	if attrs, ok := value.(attributes); ok {
+		var str = string(attrs)
+		if str != "" && !strings.ContainsAny(str[len(str)-1:], "\"' \t\n\r") {
+			str += " "
+		}
+		return data.String(str)
+	}
+	var str = value.String()
+	if filterHtmlAttributesPattern.MatchString(str) {
+		return data.String("zSoyz")
+	}
+	return data.String(str)
+}
+
 func directiveJson(value data.Value, _ []data.Value) data.Value {
 	j, err := json.Marshal(value)
 	if err != nil {
@@ -13,7 +13,13 @@ import (
 //
 // This is useful for evaluating Globals, or anything returned from parse.Expr.
 func EvalExpr(node ast.Node) (val data.Value, err error) {
-	state := &state{wr: ioutil.Discard}
+	return EvalExprData(node, nil)
+}
+
+// EvalExprData evaluates the given expression node, like EvalExpr, with the
+// given data available as variables (e.g. $name).
+func EvalExprData(node ast.Node, vars data.Map) (val data.Value, err error) {
+	state := &state{wr: ioutil.Discard, context: newScope(vars)}
 	defer state.errRecover(&err)
 	state.walk(node)
 	return state.val, nil
@@ -34,3 +34,38 @@ func TestEvalExpr(t *testing.T) {
 		}
 	}
 }
+
+func TestEvalExprData(t *testing.T) {
+	var vars = data.Map{
+		"a": data.Int(2),
+		"m": data.Map{"k": data.String("v")},
+		"n": data.Null{},
+	}
+	var tests = []struct {
+		input    string
+		expected data.Value
+		ok       bool
+	}{
+		{"$a * 3 + 1", data.Int(7), true},
+		{"$m.k", data.String("v"), true},
+		{"$n?.k", data.Null{}, true},
+		{"$n ?: 'default'", data.String("default"), true},
+		{"$missing ?: 1", data.Int(1), true},
+		{"$n.k", nil, false},
+	}
+	for _, test := range tests {
+		var node, err = parse.Expr(test.input)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		actual, err := EvalExprData(node, vars)
+		if (err == nil) != test.ok {
+			t.Errorf("%v: expected ok=%v, got %v", test.input, test.ok, err)
+			continue
+		}
+		if test.ok && !actual.Equals(test.expected) {
+			t.Errorf("EvalExprData(%v) => %v, expected %v", test.input, actual, test.expected)
+		}
+	}
+}
@@ -2,11 +2,13 @@ package soyhtml
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"runtime"
-	"runtime/debug"
+	"strings"
+	"time"
 
 	"github.com/robfig/soy/ast"
 	"github.com/robfig/soy/data"
@@ -30,6 +32,23 @@ type state struct {
 	autoescape ast.AutoescapeType // escaping mode
 	ij         data.Map           // injected data available to all templates.
 	msgs       soymsg.Bundle      // replacement text for {msg} tags
+	access     *accessLog         // data paths read, if recording access
+	profile    *profileLog        // executions of nodes, if profiling
+	locals     map[string]string  // local variable => data path, if recording access
+	lenient    bool               // print undefined values as the empty string
+	funcs      map[string]Func    // functions in addition to Funcs
+	sortKeys   func([]string)     // sorts map keys, overriding SortMapKeys
+	now        time.Time          // the time of the render
+	fragments  *fragments         // calls to render as fragments, if non-nil
+	includes   *includes          // how to render fragment="true" calls
+	memo       *memo              // results of memoized functions, if any
+	sourceMap  *sourceMapper      // records the source map, if non-nil
+	arena      *frameArena        // reuses the maps of frames, if non-nil
+	preloads   *Preloads          // collects the assets used, if non-nil
+	ctx        context.Context    // the context of the template, if tracing
+	tracer     Tracer             // observes template calls, if non-nil
+
+	ignoreBudgets bool // render budgeted calls without a deadline
 }
 
 // at marks the state to be on node n, for error reporting.
@@ -43,7 +62,18 @@ func (s *state) errorf(format string, args ...interface{}) {
 	panic(s.errFromNode(format, args...))
 }
 
+// errorKindf is like errorf, but also identifies the error as the given kind
+// (one of the errortypes kinds).
+func (s *state) errorKindf(kind error, format string, args ...interface{}) {
+	format = fmt.Sprintf("%s: %s", s.callAnnotation(), format)
+	panic(errortypes.Wrap(s.errFromNode(format, args...), kind))
+}
+
 func (s *state) errFromNode(format string, args ...interface{}) error {
+	if s.tmpl.Node == nil {
+		// evaluating a standalone expression, which has no position.
+		return fmt.Errorf(format, args...)
+	}
 	return errortypes.NewErrFilePosf(
 		s.registry.Filename(s.tmpl.Node.Name),
 		s.registry.LineNumber(s.tmpl.Node.Name, s.node),
@@ -54,6 +84,9 @@ func (s *state) errFromNode(format string, args ...interface{}) error {
 }
 
 func (s *state) callAnnotation() string {
+	if s.tmpl.Node == nil {
+		return "expression"
+	}
 	return fmt.Sprintf("template %s:%d", s.tmpl.Node.Name,
 		s.registry.LineNumber(s.tmpl.Node.Name, s.node))
 }
@@ -62,12 +95,11 @@ func (s *state) callAnnotation() string {
 // level of Parse.
 func (s *state) errRecover(errp *error) {
 	if e := recover(); e != nil {
-		switch e := e.(type) {
-		case runtime.Error:
-			*errp = s.errFromNode("%s: %v\n%v", s.callAnnotation(), e, string(debug.Stack()))
-		default:
-			*errp = s.errFromNode("%s: %v", s.callAnnotation(), e)
+		var err, isNew = s.recoverError(e)
+		if !isNew {
+			err = s.errFromNode("%s: %w", s.callAnnotation(), err)
 		}
+		*errp = err
 	}
 }
 
@@ -85,6 +117,9 @@ func (s *state) walk(node ast.Node) {
 		if node.Autoescape != ast.AutoescapeUnspecified {
 			s.autoescape = node.Autoescape
 		}
+		if s.access != nil {
+			s.access.enter(node.Name, s.tmpl.Doc)
+		}
 		s.walk(node.Body)
 	case *ast.ListNode:
 		for _, node := range node.Nodes {
@@ -93,27 +128,40 @@ func (s *state) walk(node ast.Node) {
 
 		// Output nodes ----------
 	case *ast.PrintNode:
+		var start, began = s.outputOffset(), s.profile.begin()
 		s.evalPrint(node)
+		s.profile.end(s.tmpl, node, began)
+		s.mapOutput(node, start)
 	case *ast.RawTextNode:
+		var start = s.outputOffset()
 		if _, err := s.wr.Write(node.Text); err != nil {
 			s.errorf("%s", err)
 		}
+		s.mapOutput(node, start)
 	case *ast.MsgNode:
 		s.evalMsg(node)
 	case *ast.MsgHtmlTagNode:
+		var start = s.outputOffset()
 		if _, err := s.wr.Write(node.Text); err != nil {
 			s.errorf("%s", err)
 		}
+		s.mapOutput(node, start)
 	case *ast.CssNode:
 		var prefix = ""
 		if node.Expr != nil {
 			prefix = s.eval(node.Expr).String() + "-"
 		}
+		var start = s.outputOffset()
 		if _, err := io.WriteString(s.wr, prefix+node.Suffix); err != nil {
 			s.errorf("%s", err)
 		}
-	case *ast.DebuggerNode:
+		s.mapOutput(node, start)
+	case *ast.DebuggerNode, *ast.KeyNode:
 		// nothing to do
+	case *ast.AssertNode:
+		if !s.eval(node.Expr).Truthy() {
+			s.errorf("assertion failed: %s", node.Message)
+		}
 	case *ast.LogNode:
 		// Render the node to capture any additional errors
 		rendered := s.renderBlock(node.Body)
@@ -130,7 +178,19 @@ func (s *state) walk(node ast.Node) {
 			}
 		}
 	case *ast.ForNode:
-		var list, ok = s.eval(node.List).(data.List)
+		var val = s.eval(node.List)
+		switch v := val.(type) {
+		case *data.Stream:
+			s.walkStream(node, v)
+			return
+		case data.Map, *data.OrderedMap:
+			// Iterate the keys of a map.
+			val = mapKeys(v, s.sortKeys)
+		case data.Null:
+			// Null, e.g. from a nil slice, is treated as an empty list.
+			val = data.List{}
+		}
+		var list, ok = val.(data.List)
 		if !ok {
 			s.errorf("In for loop %q, %q does not resolve to a list.",
 				node.String(), node.List.String())
@@ -141,19 +201,22 @@ func (s *state) walk(node ast.Node) {
 			}
 			break
 		}
-		s.context.push()
+		s.context.push(s.arena)
+		var prev, wasBound = s.bindLocal(node.Var, node.List, "[*]")
+		var indexKey, lastIndexKey = node.Var + "__index", node.Var + "__lastIndex"
 		for i, item := range list {
 			s.context.set(node.Var, item)
-			s.context.set(node.Var+"__index", data.Int(i))
-			s.context.set(node.Var+"__lastIndex", data.Int(len(list)-1))
+			s.context.set(indexKey, data.NewInt(int64(i)))
+			s.context.set(lastIndexKey, data.NewInt(int64(len(list)-1)))
 			s.walk(node.Body)
 		}
-		s.context.pop()
+		s.unbindLocal(node.Var, prev, wasBound)
+		s.context.pop(s.arena)
 	case *ast.SwitchNode:
 		var switchValue = s.eval(node.Value)
 		for _, caseNode := range node.Cases {
 			for _, caseValueNode := range caseNode.Values {
-				if switchValue.Equals(s.eval(caseValueNode)) {
+				if data.DeepEqual(switchValue, s.eval(caseValueNode)) {
 					s.walk(caseNode.Body)
 					return
 				}
@@ -164,11 +227,15 @@ func (s *state) walk(node ast.Node) {
 			}
 		}
 	case *ast.CallNode:
+		var began = s.profile.begin()
 		s.evalCall(node)
+		s.profile.end(s.tmpl, node, began)
 	case *ast.LetValueNode:
 		s.context.set(node.Name, s.eval(node.Expr))
+		s.bindLocal(node.Name, node.Expr, "")
 	case *ast.LetContentNode:
 		s.context.set(node.Name, data.String(s.renderBlock(node.Body)))
+		s.bindLocal(node.Name, nil, "")
 
 		// Values ----------
 	case *ast.NullNode:
@@ -176,13 +243,15 @@ func (s *state) walk(node ast.Node) {
 	case *ast.StringNode:
 		s.val = data.String(node.Value)
 	case *ast.IntNode:
-		s.val = data.Int(node.Value)
+		s.val = data.NewInt(node.Value)
 	case *ast.FloatNode:
 		s.val = data.Float(node.Value)
 	case *ast.BoolNode:
-		s.val = data.Bool(node.True)
+		s.val = data.NewBool(node.True)
 	case *ast.GlobalNode:
 		s.val = node.Value
+	case *ast.ConstantNode:
+		s.val = node.Value
 	case *ast.ListLiteralNode:
 		var items = make(data.List, len(node.Items))
 		for i, item := range node.Items {
@@ -204,7 +273,7 @@ func (s *state) walk(node ast.Node) {
 	case *ast.NegateNode:
 		switch arg := s.evaldef(node.Arg).(type) {
 		case data.Int:
-			s.val = data.Int(-arg)
+			s.val = data.NewInt(int64(-arg))
 		case data.Float:
 			s.val = data.Float(-arg)
 		default:
@@ -214,7 +283,7 @@ func (s *state) walk(node ast.Node) {
 		var arg1, arg2 = s.eval2def(node.Arg1, node.Arg2)
 		switch {
 		case isInt(arg1) && isInt(arg2):
-			s.val = data.Int(arg1.(data.Int) + arg2.(data.Int))
+			s.val = data.NewInt(int64(arg1.(data.Int) + arg2.(data.Int)))
 		case isString(arg1) || isString(arg2):
 			s.val = data.String(arg1.String() + arg2.String())
 		default:
@@ -224,7 +293,7 @@ func (s *state) walk(node ast.Node) {
 		var arg1, arg2 = s.eval2def(node.Arg1, node.Arg2)
 		switch {
 		case isInt(arg1) && isInt(arg2):
-			s.val = data.Int(arg1.(data.Int) - arg2.(data.Int))
+			s.val = data.NewInt(int64(arg1.(data.Int) - arg2.(data.Int)))
 		default:
 			s.val = data.Float(toFloat(arg1) - toFloat(arg2))
 		}
@@ -235,35 +304,56 @@ func (s *state) walk(node ast.Node) {
 		var arg1, arg2 = s.eval2def(node.Arg1, node.Arg2)
 		switch {
 		case isInt(arg1) && isInt(arg2):
-			s.val = data.Int(arg1.(data.Int) * arg2.(data.Int))
+			s.val = data.NewInt(int64(arg1.(data.Int) * arg2.(data.Int)))
 		default:
 			s.val = data.Float(toFloat(arg1) * toFloat(arg2))
 		}
 	case *ast.ModNode:
 		var arg1, arg2 = s.eval2def(node.Arg1, node.Arg2)
-		s.val = data.Int(arg1.(data.Int) % arg2.(data.Int))
+		s.val = data.NewInt(int64(arg1.(data.Int) % arg2.(data.Int)))
+
+		// Bitwise operators ----------
+	case *ast.ShiftLeftNode:
+		var arg1, arg2 = s.evalInts(&node.BinaryOpNode)
+		s.val = data.NewInt(int64(arg1 << s.shiftCount(arg2)))
+	case *ast.ShiftRightNode:
+		var arg1, arg2 = s.evalInts(&node.BinaryOpNode)
+		s.val = data.NewInt(int64(arg1 >> s.shiftCount(arg2)))
+	case *ast.BitAndNode:
+		var arg1, arg2 = s.evalInts(&node.BinaryOpNode)
+		s.val = data.NewInt(int64(arg1 & arg2))
+	case *ast.BitOrNode:
+		var arg1, arg2 = s.evalInts(&node.BinaryOpNode)
+		s.val = data.NewInt(int64(arg1 | arg2))
+	case *ast.BitXorNode:
+		var arg1, arg2 = s.evalInts(&node.BinaryOpNode)
+		s.val = data.NewInt(int64(arg1 ^ arg2))
 
 		// Arithmetic comparisons ----------
 	case *ast.EqNode:
-		s.val = data.Bool(s.eval(node.Arg1).Equals(s.eval(node.Arg2)))
+		s.val = data.NewBool(data.DeepEqual(s.eval(node.Arg1), s.eval(node.Arg2)))
 	case *ast.NotEqNode:
-		s.val = data.Bool(!s.eval(node.Arg1).Equals(s.eval(node.Arg2)))
+		s.val = data.NewBool(!data.DeepEqual(s.eval(node.Arg1), s.eval(node.Arg2)))
 	case *ast.LtNode:
-		s.val = data.Bool(toFloat(s.evaldef(node.Arg1)) < toFloat(s.evaldef(node.Arg2)))
+		var arg1, arg2 = s.eval2def(node.Arg1, node.Arg2)
+		s.val = data.NewBool(less(arg1, arg2, false))
 	case *ast.LteNode:
-		s.val = data.Bool(toFloat(s.evaldef(node.Arg1)) <= toFloat(s.evaldef(node.Arg2)))
+		var arg1, arg2 = s.eval2def(node.Arg1, node.Arg2)
+		s.val = data.NewBool(less(arg1, arg2, true))
 	case *ast.GtNode:
-		s.val = data.Bool(toFloat(s.evaldef(node.Arg1)) > toFloat(s.evaldef(node.Arg2)))
+		var arg1, arg2 = s.eval2def(node.Arg1, node.Arg2)
+		s.val = data.NewBool(less(arg2, arg1, false))
 	case *ast.GteNode:
-		s.val = data.Bool(toFloat(s.evaldef(node.Arg1)) >= toFloat(s.evaldef(node.Arg2)))
+		var arg1, arg2 = s.eval2def(node.Arg1, node.Arg2)
+		s.val = data.NewBool(less(arg2, arg1, true))
 
 		// Boolean operators ----------
 	case *ast.NotNode:
-		s.val = data.Bool(!s.eval(node.Arg).Truthy())
+		s.val = data.NewBool(!s.eval(node.Arg).Truthy())
 	case *ast.AndNode:
-		s.val = data.Bool(s.eval(node.Arg1).Truthy() && s.eval(node.Arg2).Truthy())
+		s.val = data.NewBool(s.eval(node.Arg1).Truthy() && s.eval(node.Arg2).Truthy())
 	case *ast.OrNode:
-		s.val = data.Bool(s.eval(node.Arg1).Truthy() || s.eval(node.Arg2).Truthy())
+		s.val = data.NewBool(s.eval(node.Arg1).Truthy() || s.eval(node.Arg2).Truthy())
 	case *ast.ElvisNode:
 		var arg1 = s.eval(node.Arg1)
 		if arg1 != (data.Null{}) && arg1 != (data.Undefined{}) {
@@ -284,14 +374,56 @@ func (s *state) walk(node ast.Node) {
 	}
 }
 
+// evalInts evaluates the operands of a bitwise operator, which must both be
+// integers.
+func (s *state) evalInts(node *ast.BinaryOpNode) (data.Int, data.Int) {
+	var arg1, arg2 = s.eval2def(node.Arg1, node.Arg2)
+	if !isInt(arg1) || !isInt(arg2) {
+		s.errorf("operands of %s must be integers, got %T and %T", node.Name, arg1, arg2)
+	}
+	return arg1.(data.Int), arg2.(data.Int)
+}
+
+// shiftCount returns the given shift count, which must be in [0, 63].
+func (s *state) shiftCount(n data.Int) uint {
+	if n < 0 || n > 63 {
+		s.errorf("shift count out of range: %d", n)
+	}
+	return uint(n)
+}
+
 func isInt(v data.Value) bool {
 	_, ok := v.(data.Int)
 	return ok
 }
 
+// isString returns true if the value is a String or sanitized content, which
+// is treated as a string by operators and functions.
 func isString(v data.Value) bool {
-	_, ok := v.(data.String)
-	return ok
+	switch v.(type) {
+	case data.String, data.Sanitized:
+		return true
+	}
+	return false
+}
+
+// CompareStrings orders strings for the comparison operators (<, <=, >, >=),
+// returning a negative number, zero, or a positive number if a sorts before,
+// the same as, or after b.  By default, strings are compared by code point,
+// as they are by soyutils.js.  It may be replaced by a locale-aware collation
+// (e.g. using golang.org/x/text/collate), which must be safe for concurrent
+// use; soy.$$compareStrings should then be replaced to match in javascript.
+var CompareStrings = strings.Compare
+
+// less returns true if v1 < v2, or v1 <= v2 if orEqual.  Two strings are
+// compared with CompareStrings; otherwise, both values must be numbers.
+func less(v1, v2 data.Value, orEqual bool) bool {
+	if isString(v1) && isString(v2) {
+		var cmp = CompareStrings(v1.String(), v2.String())
+		return cmp < 0 || orEqual && cmp == 0
+	}
+	var f1, f2 = toFloat(v1), toFloat(v2)
+	return f1 < f2 || orEqual && f1 == f2
 }
 
 func toFloat(v data.Value) float64 {
@@ -300,6 +432,8 @@ func toFloat(v data.Value) float64 {
 		return float64(v)
 	case data.Float:
 		return float64(v)
+	case data.BigInt:
+		return float64(v.Float())
 	case data.Undefined:
 		panic("not a number: undefined")
 	default:
@@ -310,7 +444,10 @@ func toFloat(v data.Value) float64 {
 func (s *state) evalPrint(node *ast.PrintNode) {
 	s.walk(node.Arg)
 	if _, ok := s.val.(data.Undefined); ok {
-		s.errorf("In 'print' tag, expression %q evaluates to undefined.", node.Arg.String())
+		if s.lenient {
+			return
+		}
+		s.errorKindf(errortypes.ErrMissingParam, "In 'print' tag, expression %q evaluates to undefined.", node.Arg.String())
 	}
 	var escapeHtml = s.autoescape != ast.AutoescapeOff
 	var result = s.val
@@ -340,10 +477,9 @@ func (s *state) evalPrint(node *ast.PrintNode) {
 		func() {
 			defer func() {
 				if err := recover(); err != nil {
-					s.errorf("panic in %v: %v\nexecuted: %v(%q, %v)\n%v",
+					s.panicf(err, "panic in %v: %v\nexecuted: %v(%q, %v)",
 						directiveNode, err,
-						directiveNode.Name, result, args,
-						string(debug.Stack()))
+						directiveNode.Name, result, args)
 				}
 			}()
 			result = directive.Apply(result, args)
@@ -353,6 +489,9 @@ func (s *state) evalPrint(node *ast.PrintNode) {
 		}
 	}
 
+	if _, ok := result.(data.SanitizedHtml); ok {
+		escapeHtml = false
+	}
 	var resultStr = result.String()
 	if escapeHtml {
 		htmlEscapeString(s.wr, resultStr)
@@ -386,9 +525,11 @@ func (s *state) evalMsgParts(msgNode *ast.MsgNode, parts []soymsg.Part) {
 		switch part := part.(type) {
 
 		case soymsg.RawTextPart:
+			var start = s.outputOffset()
 			if _, err := io.WriteString(s.wr, part.Text); err != nil {
 				s.errorf("%s", err)
 			}
+			s.mapOutput(msgNode, start)
 
 		case soymsg.PlaceholderPart:
 			// Find the node corresponding to the placeholder, and walk it.
@@ -464,26 +605,32 @@ func (s *state) walkMsgBody(node ast.ParentNode) {
 
 func (s *state) evalCall(node *ast.CallNode) {
 	// get template node we're calling
-	var calledTmpl, ok = s.registry.Template(node.Name)
-	if !ok {
-		s.errorf("failed to find template: %s", node.Name)
-	}
+	var calledTmpl = s.lookupTemplate(node.Name)
 
 	// sort out the data to pass
 	var callData scope
+	var pushed int // index of the first frame pushed for the call
 	if node.AllData {
 		callData = s.context.alldata()
-		callData.push()
+		pushed = len(callData)
+		callData.push(s.arena)
+		s.recordAllData(node, calledTmpl)
 	} else if node.Data != nil {
-		result, ok := s.eval(node.Data).(data.Map)
-		if !ok {
+		var result data.Map
+		switch val := s.eval(node.Data).(type) {
+		case data.Map:
+			result = val
+		case *data.OrderedMap:
+			result = val.Map
+		default:
 			s.errorf("In 'call' command %q, the data reference %q does not resolve to a map.",
 				node.String(), node.Data.String())
 		}
 		callData = newScope(result)
-		callData.push()
+		pushed = 1
+		callData.push(s.arena)
 	} else {
-		callData = newScope(make(data.Map))
+		callData = newScope(s.arena.get())
 	}
 
 	// resolve the params
@@ -492,13 +639,41 @@ func (s *state) evalCall(node *ast.CallNode) {
 		case *ast.CallParamValueNode:
 			callData.set(param.Key, s.eval(param.Value))
 		case *ast.CallParamContentNode:
-			callData.set(param.Key, data.String(s.renderBlock(param.Content)))
+			var content = s.renderBlock(param.Content)
+			if param.Kind == "attributes" {
+				callData.set(param.Key, attributes(content))
+			} else {
+				callData.set(param.Key, data.NewSanitized(param.Kind, string(content)))
+			}
 		default:
 			s.errorf("unexpected call param type: %T", param)
 		}
 	}
 
-	callData.enter()
+	if s.includes.isInclude(node.Fragment) {
+		var start = s.outputOffset()
+		s.writeInclude(node.Name, callData.flatten())
+		s.mapOutput(node, start)
+		return
+	}
+
+	var name = node.Name
+	if node.Budget > 0 {
+		var vars = callData.flatten()
+		s.checkBudgetedData(node, calledTmpl, vars)
+		if !s.ignoreBudgets {
+			callData.release(s.arena, pushed)
+			if s.walkBudgeted(node, calledTmpl, vars) {
+				return
+			}
+			name = node.Fallback
+			calledTmpl = s.lookupTemplate(name)
+			callData = newScope(vars)
+			pushed = 1
+		}
+	}
+
+	callData.enter(s.arena)
 	state := &state{
 		tmpl:       calledTmpl,
 		registry:   s.registry,
@@ -508,15 +683,80 @@ func (s *state) evalCall(node *ast.CallNode) {
 		context:    callData,
 		ij:         s.ij,
 		msgs:       s.msgs,
+		access:     s.access,
+		profile:    s.profile,
+		lenient:    s.lenient,
+		funcs:      s.funcs,
+		sortKeys:   s.sortKeys,
+		now:        s.now,
+		fragments:  s.fragments,
+		includes:   s.includes,
+		memo:       s.memo,
+		sourceMap:  s.sourceMap,
+		arena:      s.arena,
+		preloads:   s.preloads,
+		ctx:        s.ctx,
+		tracer:     s.tracer,
+
+		ignoreBudgets: s.ignoreBudgets,
 	}
 
+	if end := s.startCall(state, name); end != nil {
+		defer end()
+	}
 	defer func() {
 		if e := recover(); e != nil {
-			panic(fmt.Errorf("%s: %v", state.callAnnotation(), e))
+			var err, isNew = state.recoverError(e)
+			if !isNew {
+				err = fmt.Errorf("%s: %w", state.callAnnotation(), err)
+			}
+			s.addCaller(err)
+			panic(err)
 		}
 	}()
 
+	if !s.fragments.isFragment(name) {
+		state.walk(calledTmpl.Node)
+		state.context.release(s.arena, pushed)
+		return
+	}
+	var buf bytes.Buffer
+	state.wr = &buf
 	state.walk(calledTmpl.Node)
+	state.context.release(s.arena, pushed)
+	var start = s.outputOffset()
+	s.writeFragment(name, buf.Bytes())
+	s.mapOutput(node, start)
+}
+
+// walkStream executes a {foreach} over a stream, consuming one item ahead so
+// that isLast() may be determined.
+func (s *state) walkStream(node *ast.ForNode, stream *data.Stream) {
+	defer stream.Stop()
+	var item, ok = stream.Next()
+	if !ok {
+		if node.IfEmpty != nil {
+			s.walk(node.IfEmpty)
+		}
+		return
+	}
+	s.context.push(s.arena)
+	var prev, wasBound = s.bindLocal(node.Var, node.List, "[*]")
+	var indexKey, lastIndexKey = node.Var + "__index", node.Var + "__lastIndex"
+	for i := 0; ok; i++ {
+		var next, more = stream.Next()
+		var lastIndex = i + 1
+		if !more {
+			lastIndex = i
+		}
+		s.context.set(node.Var, item)
+		s.context.set(indexKey, data.NewInt(int64(i)))
+		s.context.set(lastIndexKey, data.NewInt(int64(lastIndex)))
+		s.walk(node.Body)
+		item, ok = next, more
+	}
+	s.unbindLocal(node.Var, prev, wasBound)
+	s.context.pop(s.arena)
 }
 
 // renderBlock is a helper that renders the given node to a temporary output
@@ -539,11 +779,57 @@ func checkNumArgs(allowedNumArgs []int, numArgs int) bool {
 	return false
 }
 
+// lookupTemplate returns the named template, failing the render if it is not
+// found or if it is in a lazily registered file that fails to load.
+func (s *state) lookupTemplate(name string) soyt.Template {
+	var tmpl, err = s.registry.Lookup(name)
+	switch {
+	case isNotFound(err):
+		s.errorKindf(errortypes.ErrTemplateNotFound, "failed to find template: %s", name)
+	case errors.Is(err, errortypes.ErrType):
+		s.errorKindf(errortypes.ErrType, "failed to load template %s: %v", name, err)
+	case err != nil:
+		s.errorKindf(errortypes.ErrParse, "failed to load template %s: %v", name, err)
+	}
+	return tmpl
+}
+
+// lookupFunc returns the named function, preferring those provided to the
+// Tofu over the package-level Funcs, and those over the clock, locale, and
+// assetUrl functions.
+func (s *state) lookupFunc(name string) (Func, bool) {
+	if fn, ok := s.funcs[name]; ok {
+		return fn, true
+	}
+	if fn, ok := Funcs[name]; ok {
+		return fn, true
+	}
+	if fn, ok := clockFuncs[name]; ok {
+		var now = s.now
+		return Func{func(args []data.Value) data.Value {
+			return fn.Apply(now, args)
+		}, fn.ValidArgLengths}, true
+	}
+	if fn, ok := localeFuncs[name]; ok {
+		var msgs = s.msgs
+		return Func{func(args []data.Value) data.Value {
+			return fn.Apply(msgs, args)
+		}, fn.ValidArgLengths}, true
+	}
+	if name == "assetUrl" {
+		var preloads = s.preloads
+		return Func{func(args []data.Value) data.Value {
+			return funcAssetUrl(preloads, args)
+		}, []int{1, 2}}, true
+	}
+	return Func{}, false
+}
+
 func (s *state) evalFunc(node *ast.FunctionNode) data.Value {
 	if fn, ok := loopFuncs[node.Name]; ok {
 		return fn(s, node.Args[0].(*ast.DataRefNode).Key)
 	}
-	if fn, ok := Funcs[node.Name]; ok {
+	if fn, ok := s.lookupFunc(node.Name); ok {
 		if !checkNumArgs(fn.ValidArgLengths, len(node.Args)) {
 			s.errorf("Function %q called with %v args, expected: %v",
 				node.Name, len(node.Args), fn.ValidArgLengths)
@@ -553,22 +839,37 @@ func (s *state) evalFunc(node *ast.FunctionNode) data.Value {
 		for i, arg := range node.Args {
 			args[i] = s.eval(arg)
 		}
-		defer func() {
-			if err := recover(); err != nil {
-				s.errorf("panic in %s(%v): %v\n%v", node.Name, args, err, string(debug.Stack()))
-			}
-		}()
-		r := fn.Apply(args)
-		if r == nil {
-			return data.Null{}
+		if s.memo.isMemoized(node.Name) {
+			return s.memo.call(node.Name, args, func() data.Value {
+				return s.applyFunc(node, fn, args)
+			})
 		}
-		return r
+		return s.applyFunc(node, fn, args)
 	}
 	s.errorf("unrecognized function name: %s", node.Name)
 	panic("unreachable")
 }
 
+// applyFunc calls the function at the given node with the given args.
+func (s *state) applyFunc(node *ast.FunctionNode, fn Func, args []data.Value) data.Value {
+	defer func() {
+		if err := recover(); err != nil {
+			if ferr, ok := err.(funcError); ok {
+				s.panicf(ferr.err, "%s(%v): %w", node.Name, args, ferr.err)
+			}
+			s.panicf(err, "panic in %s(%v): %v", node.Name, args, err)
+		}
+	}()
+	r := fn.Apply(args)
+	if r == nil {
+		return data.Null{}
+	}
+	return r
+}
+
 func (s *state) evalDataRef(node *ast.DataRefNode) data.Value {
+	s.recordRead(node)
+
 	// get the initial value
 	var ref data.Value
 	if node.Key == "ij" {
@@ -577,7 +878,7 @@ func (s *state) evalDataRef(node *ast.DataRefNode) data.Value {
 		}
 		ref = s.ij
 	} else {
-		ref = s.context.lookup(node.Key)
+		ref = data.Resolve(s.context.lookup(node.Key))
 	}
 	if len(node.Access) == 0 {
 		return ref
@@ -619,13 +920,13 @@ func (s *state) evalDataRef(node *ast.DataRefNode) data.Value {
 				s.errorf("%q is a list, but was accessed with a non-integer index",
 					(&ast.DataRefNode{node.Pos, node.Key, node.Access[:i]}).String())
 			}
-			ref = obj.Index(index)
-		case data.Map:
+			ref = data.Resolve(obj.Index(index))
+		case data.Map, *data.OrderedMap:
 			if key == "" {
 				s.errorf("%q is a map, and requires a string key to access",
 					(&ast.DataRefNode{node.Pos, node.Key, node.Access[:i]}).String())
 			}
-			ref = obj.Key(key)
+			ref = data.Resolve(mustMap(obj).Key(key))
 		default:
 			s.errorf("While evaluating \"%v\", encountered non-collection"+
 				" just before accessing \"%v\".", node, accessNode)
@@ -3,8 +3,11 @@ package soyhtml
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"log"
+	"math/big"
 	"reflect"
+	"slices"
 	"strings"
 	"testing"
 
@@ -86,7 +89,14 @@ func TestExpressions(t *testing.T) {
 		exprtest("bools5", "{null == $foo}", "false"),
 		exprtest("bools6", "{null == null}", "true"),
 		exprtest("bools7", "{$foo == $foo}", "true"),
+		exprtest("deep equality", "{[1, ['a': [2.0]]] == [1, ['a': [2]]]} {[1] != [1, 2]} {['a': 1] == ['b': 1]}", "true true false"),
 		exprtest("comparisons", `{0.5<=1 ? null?:'hello' : (1!=1)}`, "hello"),
+		exprtest("string comparison", "{'a' < 'b'} {'b' <= 'a'} {'abc' > 'ab'} {'B' < 'a'} {'a' >= 'a'}", "true false true true true"),
+		exprtest("string comparison by code point", "{'\uff61' < '\U0001F600'} {'\U0001F600' > '\uffff'}", "true true"),
+		exprtest("string comparison mixed", `{'a' < 1}`, "").fails(),
+		exprtest("strMatches", `{strMatches('order-123', '^order-\\d+$')} {strMatches('Order-1', '^order')}`, "true false"),
+		exprtest("strReplaceAll", `{strReplaceAll('a1b22c', '[0-9]+', '#')} {strReplaceAll('a.b', '\\.', '$1')}`, "a#b#c a$1b"),
+		exprtest("strMatches invalid pattern", `{strMatches('a', '(')}`, "").fails(),
 		exprtest("stringconcat", `{'hello' + 'world'}`, "helloworld"),
 		exprtest("mixedconcat", `{5 + 'world'}`, "5world"),
 		exprtest("elvis", `{null?:'hello'}`, "hello"),   // elvis does isNonnull check on first arg
@@ -95,6 +105,15 @@ func TestExpressions(t *testing.T) {
 		exprtest("elvis4", `{false?:'hello'}`, "false"), // false is non-null
 		exprtest("negate", `{-(1+1)}`, "-2"),
 		exprtest("negate float", `{-(1+1.5)}`, "-2.5"),
+		exprtest("bitwise", `{6 & 3} {6 | 3} {6 ^ 3} {1 << 4} {-16 >> 2} {0 | -1}`, "2 7 5 16 -4 -1"),
+		exprtest("bitwise precedence", `{1 | 6 & 3 ^ 1} {1 + 1 << 2} {(6 | 1)|escapeHtml}`, "3 8 7"),
+		exprtest("bitwise 64 bits", `{1 << 40} {(1 << 62) >> 61} {-1 >> 63} {1 << 63}`, "1099511627776 2 -1 -9223372036854775808"),
+		exprtest("bitwise non integer", `{1.5 & 1}`, "").fails(),
+		exprtest("bitwise or function", `{1 | max(2, 4)} {round(1.5) | 4|escapeHtml}`, "5 6"),
+		exprtest("shift count", `{1 << 64}`, "").fails(),
+		exprtest("negative shift count", `{1 >> -1}`, "").fails(),
+		exprtest("relative time", "{formatRelativeTime(now() - 3 * 60 * 60 * 1000)}", "3 hours ago"),
+		exprtest("locale", "{currentLocale()}:{currentDir()}", ":ltr"),
 
 		// short-circuiting
 		exprtest("shortcircuit precondition undef key fails", "{$undef.key}", "").fails(),
@@ -103,6 +122,47 @@ func TestExpressions(t *testing.T) {
 	})
 }
 
+func TestCompareStrings(t *testing.T) {
+	defer func(compare func(a, b string) int) { CompareStrings = compare }(CompareStrings)
+	CompareStrings = func(a, b string) int {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	}
+	runExecTests(t, []execTest{
+		exprtest("collation", "{'B' < 'a'} {'b' > 'A'} {'a' <= 'A'}", "false true true"),
+	})
+}
+
+func TestEnums(t *testing.T) {
+	data.RegisterEnum("test.Status", map[int32]string{0: "UNKNOWN", 1: "ACTIVE", 2: "DELETED"})
+	runExecTests(t, []execTest{
+		exprtest("enumName", "{enumName('test.Status', 1)} {enumName('test.Status', 3) ?: 'new'}", "ACTIVE new"),
+		exprtest("enumValue", "{enumValue('test.Status', 'DELETED')} {enumValue('test.Status', 'x') ?: -1}", "2 -1"),
+		exprtestwdata("enum data", "{enumName('test.Status', $status)}", "DELETED", d{"status": 2}),
+		exprtestwdata("enum name data", "{enumName('test.Status', $status)} {enumName('test.Status', 'NEW') ?: 'new'}",
+			"ACTIVE new", d{"status": "ACTIVE"}),
+		exprtest("enum other data", "{enumName('test.Status', 1.5) ?: 'none'} {enumName('test.Status', true) ?: 'none'}",
+			"none none"),
+		exprtest("enum not registered", "{enumName('test.Missing', 1)}", "").fails(),
+	})
+}
+
+func TestFloatPrinting(t *testing.T) {
+	runExecTests(t, []execTest{
+		exprtest("integral floats", "{1.0} {1000000.0} {1000000.0 * 1000000.0 * 1000000000.0}", "1 1000000 1e+21"),
+		exprtest("small floats", "{0.5} {0.000001} {0.0000001} {0.00000015}", "0.5 0.000001 1e-7 1.5e-7"),
+		exprtest("negative zero", "{-0.0} {-1.0 * 0.0}", "0 0"),
+		exprtest("nan and infinity", "{0 / 0} {1 / 0} {-1 / 0}", "NaN Infinity -Infinity"),
+		exprtest("nan is falsy", "{if 0 / 0}y{else}n{/if} {0 / 0 ?: 'x'} {not (0 / 0)}", "n NaN true"),
+	})
+}
+
+func TestAssetUrl(t *testing.T) {
+	runExecTests(t, []execTest{
+		exprtest("assetUrl", "{assetUrl('/site.css')} {assetUrl('/logo', 'image')} {assetUrl(1)}", "/site.css /logo 1"),
+		exprtest("assetUrl args", "{assetUrl()}", "").fails(),
+	})
+}
+
 func TestIf(t *testing.T) {
 	runExecTests(t, multidatatest("if", `
 {if $zoo}{$zoo}{/if}
@@ -160,13 +220,31 @@ func TestForeach(t *testing.T) {
 			"goose": []interface{}{d{"numKids": 1}, d{"numKids": 2}},
 			"foo":   d{"booze": []interface{}{}},
 		}, "1 goslings.\n2 goslings.\nSorry, no booze."},
+		{d{
+			"goose": nil, // null is treated as an empty list
+			"foo":   d{"booze": []d(nil)},
+		}, "Sorry, no booze."},
+
+		// streams
+		{d{
+			"goose": []interface{}{},
+			"foo":   d{"booze": chanOf(d{"name": "a"}, d{"name": "b"})},
+		}, "->\n0: Scary drink a!\n1: Scary drink b!"},
+		{d{
+			"goose": iteratorOf(d{"numKids": 1}),
+			"foo":   d{"booze": iteratorOf()},
+		}, "1 goslings.\nSorry, no booze."},
+		{d{
+			"goose": slices.Values([]d{{"numKids": 1}}),
+			"foo":   d{"booze": slices.Values([]d{{"name": "a"}})},
+		}, "1 goslings.\n->\n0: Scary drink a!"},
 	}, []errortest{
 		{nil},                           // non-null-safe eval of $foo.booze fails
 		{d{"foo": nil}},                 // ditto
 		{d{"foo": d{}}},                 // $foo.booze must be a list
 		{d{"foo": d{"booze": "str"}}},   // $foo.booze must be list
 		{d{"foo": d{"booze": 5}}},       // $foo.booze must be list
-		{d{"foo": d{"booze": d{}}}},     // $foo.booze must be list
+		{d{"foo": d{"booze": d{}}}},     // $goose must be list
 		{d{"foo": d{"booze": true}}},    // $foo.booze must be list
 		{d{"foo": d{"booze": []d{{}}}}}, // $boo.name fails
 	}))
@@ -177,6 +255,105 @@ func TestForeach(t *testing.T) {
 {/foreach}`, []datatest{
 		{d{"map": d{"a": nil}}, "a"},
 	}, nil))
+
+	runExecTests(t, multidatatest("foreachmap", `
+{foreach $key in $map}
+  {if isFirst($key)}[{/if}
+  {index($key)}.{$key}: {$map[$key]}
+  {if isLast($key)}]{else}, {/if}
+{ifempty}
+  empty
+{/foreach}
+{sp}{foreach $key in keys($map)}{$key}{/foreach}`, []datatest{
+		{d{"map": d{"c": 3, "a": 1, "b": 2}}, "[0.a: 1, 1.b: 2, 2.c: 3] abc"},
+		{d{"map": d{"a": 1}}, "[0.a: 1] a"},
+		{d{"map": d{}}, "empty "},
+		{d{"map": orderedOf("c", 3, "a", 1, "b", 2)}, "[0.c: 3, 1.a: 1, 2.b: 2] cab"},
+		{d{"map": orderedOf()}, "empty "},
+	}, nil))
+
+	runExecTests(t, multidatatest("orderedmap", `
+{foreach $key in keys(augmentMap($map, ['a': 0, 'z': 26]))}{$key}{/foreach}
+{sp}{$map.c}{$map['b']}`, []datatest{
+		{d{"map": orderedOf("c", 3, "a", 1, "b", 2)}, "cabz 32"},
+		{d{"map": d{"c": 3, "a": 1, "b": 2}}, "abcz 32"},
+	}, nil))
+}
+
+// orderedOf returns an ordered map of the given keys and values.
+func orderedOf(kvs ...interface{}) *data.OrderedMap {
+	var m = data.NewOrderedMap()
+	for i := 0; i < len(kvs); i += 2 {
+		m.Set(kvs[i].(string), data.New(kvs[i+1]))
+	}
+	return m
+}
+
+// chanOf returns a closed channel containing the given items.
+func chanOf(items ...interface{}) chan interface{} {
+	var ch = make(chan interface{}, len(items))
+	for _, item := range items {
+		ch <- item
+	}
+	close(ch)
+	return ch
+}
+
+// iteratorOf returns an iterator function yielding the given items.
+func iteratorOf(items ...interface{}) func() (interface{}, bool) {
+	return func() (interface{}, bool) {
+		if len(items) == 0 {
+			return nil, false
+		}
+		var item = items[0]
+		items = items[1:]
+		return item, true
+	}
+}
+
+func TestForeachSlice(t *testing.T) {
+	runExecTests(t, multidatatest("foreachslice", `
+{foreach $item in slice($items, 1, 3)}
+  {if not isFirst($item)}, {/if}{$item}
+{ifempty}
+  none
+{/foreach}`, []datatest{
+		{d{"items": []int{1, 2, 3, 4}}, "2, 3"},
+		{d{"items": []int{1}}, "none"},
+		{d{"items": []int(nil)}, "none"},
+		{d{"items": nil}, "none"},
+		{d{"items": chanOf(1, 2, 3, 4)}, "2, 3"},
+		{d{"items": chanOf(1)}, "none"},
+		{d{"items": slices.Values([]int{1, 2, 3, 4})}, "2, 3"},
+	}, []errortest{
+		{d{"items": "str"}},
+	}))
+}
+
+func TestForeachStopsStreams(t *testing.T) {
+	var tofu = newTestTofu(t, `{namespace test}
+/** @param items */
+{template .items}{foreach $item in $items}{$item.name}{/foreach}{/template}`)
+	var stopped bool
+	var items = func(yield func(interface{}) bool) {
+		defer func() { stopped = true }()
+		for i := 0; ; i++ {
+			var item interface{} = d{"name": "a"}
+			if i == 3 {
+				item = "not a map" // fails the render
+			}
+			if !yield(item) {
+				return
+			}
+		}
+	}
+	var err = tofu.Render(io.Discard, "test.items", d{"items": items})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !stopped {
+		t.Error("expected the iterator to be stopped")
+	}
 }
 
 func TestFor(t *testing.T) {
@@ -189,9 +366,10 @@ func TestFor(t *testing.T) {
 		{d{"items": []interface{}{}}, ""},
 		{d{"items": []interface{}{"car"}}, "1: car\n"},
 		{d{"items": []interface{}{"car", "boat"}}, "1: car\n2: boat\n"},
+		{d{"items": nil}, ""},           // null is treated as an empty list
+		{d{"items": []string(nil)}, ""}, // as is a nil slice
 	}, []errortest{
 		{d{}},             // undefined is not a valid slice
-		{d{"items": nil}}, // null is not a valid slice
 		{d{"items": "a"}}, // string is not a valid slice
 	}))
 }
@@ -271,6 +449,88 @@ func TestCall(t *testing.T) {
 	})
 }
 
+func TestSanitizedContent(t *testing.T) {
+	var input = `{namespace test}
+
+/** @param html @param str @param js */
+{template .main}
+{$html} {$str} {$html|escapeHtml} {$js} {$html|noAutoescape}{sp}
+{call .wrap}{param body kind="html"}<i>{$str}</i>{/param}{/call}
+{/template}
+
+/** @param body */
+{template .wrap}<p>{$body}</p>{/template}`
+	runExecTests(t, []execTest{
+		{"sanitized", "test.main", input,
+			`<b>hi</b> &lt;b&gt; <b>hi</b> a &lt; b <b>hi</b> <p><i>&lt;b&gt;</i></p>`,
+			d{
+				"html": data.SanitizedHtml("<b>hi</b>"),
+				"str":  "<b>",
+				"js":   data.SanitizedJs("a < b"),
+			}, true},
+	})
+}
+
+// The content of a kinded {param} block is sanitized content, which may be
+// compared with strings and passed to string functions.
+func TestSanitizedParamsAsStrings(t *testing.T) {
+	var input = `{namespace test}
+
+{template .main}
+{call .check}{param p kind="html"}<b>x</b>{/param}{/call}
+{/template}
+
+/** @param p */
+{template .check}
+{if $p == '<b>x</b>'}eq{else}ne{/if}{sp}
+{if '<b>x</b>' == $p}eq{else}ne{/if}{sp}
+{if $p != '<b>y</b>'}ne{/if}{sp}
+{if $p < '<c>'}lt{/if}{sp}
+{strContains($p, 'x')} {strMatches($p, '^<b>')} {strReplaceAll($p, 'b>', 'i>')}{sp}
+{if $p + '!' == '<b>x</b>!'}cat{/if}
+{/template}`
+	runExecTests(t, []execTest{
+		{"sanitizedasstring", "test.main", input,
+			`eq eq ne lt true true &lt;i&gt;x&lt;/i&gt; cat`, nil, true},
+	})
+}
+
+func TestCallAttributes(t *testing.T) {
+	var input = `{namespace test}
+
+/** @param label */
+{template .main}
+{call .button}
+  {param attrs kind="attributes"}title="{$label}" disabled{/param}
+  {param label: $label/}
+{/call}
+{call .button}
+  {param attrs kind="attributes"}class="primary"{/param}
+  {param label: $label/}
+{/call}
+{/template}
+
+/**
+ * @param attrs Attributes forwarded to the button.
+ * @param label
+ */
+{template .button}
+<button {$attrs|filterHtmlAttributes}type="button">{$label}</button>
+{/template}`
+	runExecTests(t, []execTest{
+		{"attributes", "test.main", input,
+			`<button title="&#34;&gt;&lt;b&gt;" disabled type="button">&#34;&gt;&lt;b&gt;</button>` +
+				`<button class="primary"type="button">&#34;&gt;&lt;b&gt;</button>`,
+			d{"label": `"><b>`}, true},
+		exprtestwdata("filterHtmlAttributes name", "<input {$name|filterHtmlAttributes}>",
+			"<input checked>", d{"name": "checked"}),
+		exprtestwdata("filterHtmlAttributes unsafe name", "<input {$name|filterHtmlAttributes}>",
+			"<input zSoyz>", d{"name": "onclick"}),
+		exprtestwdata("filterHtmlAttributes unsafe string", "<input {$name|filterHtmlAttributes}>",
+			"<input zSoyz>", d{"name": `x="y"`}),
+	})
+}
+
 func TestDataRefs(t *testing.T) {
 	runExecTests(t, []execTest{
 		// single key
@@ -384,6 +644,17 @@ func TestNilLogger(t *testing.T) {
 func TestDebugger(t *testing.T) {
 	runExecTests(t, []execTest{
 		exprtest("debugger", `{debugger}`, ``),
+		exprtestwdata("key", `<li>{key $id}{$id}</li>`, `<li>1</li>`, d{"id": 1}),
+	})
+}
+
+func TestAssert(t *testing.T) {
+	var failed = exprtestwdata("assert failed", `{assert $id > 0, "id must be positive"}{$id}`, ``, d{"id": 0})
+	failed.ok = false
+	runExecTests(t, []execTest{
+		exprtestwdata("assert", `{assert $id > 0, "id must be positive"}{$id}`, `1`, d{"id": 1}),
+		exprtestwdata("assert single quotes", `{assert $id, 'id is required'}{$id}`, `1`, d{"id": 1}),
+		failed,
 	})
 }
 
@@ -584,6 +855,35 @@ func TestHelloWorld(t *testing.T) {
 	})
 }
 
+// TestMarkupDeclarations renders an HTML email with a doctype and conditional
+// comments.
+func TestMarkupDeclarations(t *testing.T) {
+	// Doctypes and (conditional) comments are raw text, so they are passed
+	// through unchanged, while values printed within them are still escaped.
+	runExecTests(t, []execTest{
+		{"doctype and conditional comments", "test.email", `{namespace test}
+
+/** @param title */
+{template .email}
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN"
+    "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">
+<html>
+<!--[if gte mso 9]><xml><o:OfficeDocumentSettings/></xml><![endif]-->
+<!--[if IE]><p class="ie">{$title}</p><![endif]-->
+<!--[if !mso]><!--><b>{$title}</b><!--<![endif]-->
+<!-- a comment -->
+</html>
+{/template}`,
+			`<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" ` +
+				`"http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd"><html>` +
+				`<!--[if gte mso 9]><xml><o:OfficeDocumentSettings/></xml><![endif]-->` +
+				`<!--[if IE]><p class="ie">Q&amp;A</p><![endif]-->` +
+				`<!--[if !mso]><!--><b>Q&amp;A</b><!--<![endif]-->` +
+				`<!-- a comment --></html>`,
+			d{"title": "Q&A"}, true},
+	})
+}
+
 func TestStructData(t *testing.T) {
 	runExecTests(t, []execTest{
 		{"1 name", "examples.simple.helloName", helloWorldTemplate,
@@ -603,6 +903,48 @@ func TestStructData(t *testing.T) {
 	})
 }
 
+func TestBigIntData(t *testing.T) {
+	var id, _ = new(big.Int).SetString("340282366920938463463374607431768211455", 10)
+	runExecTests(t, []execTest{
+		exprtestwdata("big int", "{$id} {'#' + $id} {$id == $id} {$id > 1} {$small + 1}",
+			"340282366920938463463374607431768211455 #340282366920938463463374607431768211455 true true 43",
+			d{"id": id, "small": big.NewInt(42)}),
+	})
+}
+
+func TestLazyData(t *testing.T) {
+	var computed []string
+	var lazy = func(name string, val interface{}) *data.Lazy {
+		return data.NewLazy(func() data.Value {
+			computed = append(computed, name)
+			return data.New(val)
+		})
+	}
+	var tofu = newTestTofu(t, `{namespace test}
+/** @param user @param? orders @param flags */
+{template .t}
+  {$user.name}{if $flags[0] == 3} {$flags[0] + 1}{/if}
+  {call .c data="$user" /}
+{/template}
+/** @param name */
+{template .c}{sp}{$name}{/template}`)
+	var buf bytes.Buffer
+	var err = tofu.Render(&buf, "test.t", data.Map{
+		"user":   lazy("user", d{"name": lazy("name", "Rob")}),
+		"orders": lazy("orders", []int{1, 2}),
+		"flags":  data.List{lazy("flag", 3)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Rob 4 Rob"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+	if actual := strings.Join(computed, ","); actual != "user,name,flag" {
+		t.Errorf("expected each used value to be computed once, got %v", actual)
+	}
+}
+
 func TestLet(t *testing.T) {
 	runExecTests(t, []execTest{
 		exprtestwdata("let", `
@@ -1260,7 +1602,7 @@ func runNsExecTests(t *testing.T, tests []nsExecTest) {
 		b.Reset()
 		var datamap data.Map
 		if test.data != nil {
-			datamap = data.New(test.data).(data.Map)
+			datamap, _ = data.New(test.data).(data.Map) // or Null, if a nil map
 		}
 		tofu := NewTofu(&registry).NewRenderer(test.templateName).
 			Inject(ij)
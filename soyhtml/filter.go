@@ -0,0 +1,59 @@
+package soyhtml
+
+import "io"
+
+// Filter transforms the output of a render as it is written, e.g. to minify
+// it or to add a nonce to inline scripts.
+type Filter struct {
+	// Kinds lists the content kinds of the templates to filter, as given by
+	// their "kind" attribute.  Templates with no kind are "html".  If Kinds
+	// is empty, the output of every template is filtered.
+	Kinds []string
+
+	// New returns a writer that filters the output written to it and writes
+	// the result to w.  The writer is closed once rendering is complete, at
+	// which point it must write any output that it has buffered to w.  It
+	// must not close w.
+	New func(w io.Writer) io.WriteCloser
+}
+
+// appliesTo returns true if the filter should be applied to a template of the
+// given kind.
+func (f Filter) appliesTo(kind string) bool {
+	if len(f.Kinds) == 0 {
+		return true
+	}
+	for _, k := range f.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// WithFilters adds filters to apply to the output, in order: the output of
+// the template is written to the first filter, whose output is written to the
+// second, and so on.
+func (r *Renderer) WithFilters(filters ...Filter) *Renderer {
+	r.filters = append(r.filters, filters...)
+	return r
+}
+
+// filter returns a writer that applies the filters for the given content kind
+// to the output written to it, and the writers to close (in order) when
+// rendering is complete.
+func (r *Renderer) filter(wr io.Writer, kind string) (io.Writer, []io.WriteCloser) {
+	if kind == "" {
+		kind = "html"
+	}
+	var closers []io.WriteCloser
+	for i := len(r.filters) - 1; i >= 0; i-- {
+		if !r.filters[i].appliesTo(kind) {
+			continue
+		}
+		var fw = r.filters[i].New(wr)
+		closers = append([]io.WriteCloser{fw}, closers...)
+		wr = fw
+	}
+	return wr, closers
+}
@@ -0,0 +1,56 @@
+package soyhtml
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// upperFilter buffers its output until closed, then writes it in upper case.
+type upperFilter struct {
+	bytes.Buffer
+	w io.Writer
+}
+
+func (f *upperFilter) Close() error {
+	_, err := io.WriteString(f.w, strings.ToUpper(f.String()))
+	return err
+}
+
+// suffixFilter passes output through, adding a suffix when closed.
+type suffixFilter struct {
+	io.Writer
+	suffix string
+}
+
+func (f suffixFilter) Close() error {
+	_, err := io.WriteString(f.Writer, f.suffix)
+	return err
+}
+
+func TestFilters(t *testing.T) {
+	var tofu = newTestTofu(t, `{namespace test}
+{template .page}<p>hello</p>{/template}
+{template .text kind="text"}hello{/template}`)
+	var filters = []Filter{
+		{nil, func(w io.Writer) io.WriteCloser { return &upperFilter{w: w} }},
+		{[]string{"html"}, func(w io.Writer) io.WriteCloser { return suffixFilter{w, "<!-- html -->"} }},
+		{[]string{"text"}, func(w io.Writer) io.WriteCloser { return suffixFilter{w, "!"} }},
+	}
+
+	var tests = []struct{ name, expected string }{
+		{"test.page", "<P>HELLO</P><!-- html -->"},
+		{"test.text", "HELLO!"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		var err = tofu.NewRenderer(test.name).WithFilters(filters...).Execute(&buf, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		if buf.String() != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, buf.String())
+		}
+	}
+}
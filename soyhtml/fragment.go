@@ -0,0 +1,72 @@
+package soyhtml
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Fragment is the rendered output of a single {call}, identified by the hash
+// of its content.
+type Fragment struct {
+	Template string // fully-qualified name of the called template
+	Hash     string // hex-encoded SHA-256 of the content
+	Content  []byte
+}
+
+// FragmentStore receives the fragments published during rendering, e.g. to
+// save them to an external key-value store from which an edge cache assembles
+// pages.  It must be safe for concurrent use if the renderers that use it are.
+type FragmentStore interface {
+	PutFragment(Fragment) error
+}
+
+// FragmentHash returns the content hash by which a fragment is identified.
+func FragmentHash(content []byte) string {
+	var sum = sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// fragments holds the fragment configuration of a render.
+type fragments struct {
+	store     FragmentStore
+	templates map[string]bool
+}
+
+// WithFragments renders calls to the given templates as fragments: each one is
+// published to the store along with its content hash, and its output is
+// wrapped in comments marking the fragment boundaries, like so:
+//
+//	<!--soy:fragment ns.tmpl 9f86d0...-->output<!--/soy:fragment 9f86d0...-->
+//
+// The markers allow a downstream cache to replace each fragment with an edge
+// side include of the stored content.
+func (r *Renderer) WithFragments(store FragmentStore, templates ...string) *Renderer {
+	r.fragments = &fragments{store, make(map[string]bool, len(templates))}
+	for _, name := range templates {
+		r.fragments.templates[name] = true
+	}
+	return r
+}
+
+// isFragment returns true if calls to the named template render as fragments.
+func (f *fragments) isFragment(name string) bool {
+	return f != nil && f.templates[name]
+}
+
+// writeFragment publishes the rendered output of a call to the named template
+// and writes it to the output, between fragment markers.
+func (s *state) writeFragment(name string, content []byte) {
+	var frag = Fragment{name, FragmentHash(content), content}
+	if err := s.fragments.store.PutFragment(frag); err != nil {
+		s.errorf("failed to publish fragment %s: %v", name, err)
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<!--soy:fragment %s %s-->", name, frag.Hash)
+	buf.Write(content)
+	fmt.Fprintf(&buf, "<!--/soy:fragment %s-->", frag.Hash)
+	if _, err := s.wr.Write(buf.Bytes()); err != nil {
+		s.errorf("%s", err)
+	}
+}
@@ -0,0 +1,56 @@
+package soyhtml
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type fragmentMap map[string]Fragment
+
+func (m fragmentMap) PutFragment(f Fragment) error {
+	m[f.Hash] = f
+	return nil
+}
+
+type failingStore struct{}
+
+func (failingStore) PutFragment(Fragment) error { return errors.New("unavailable") }
+
+func TestFragments(t *testing.T) {
+	var tofu = newTestTofu(t, `{namespace test}
+{template .page}
+  <div>{call .header /}{call .item}{param n: 1 /}{/call}{call .item}{param n: 1 /}{/call}</div>
+{/template}
+
+{template .header}<h1>Hello</h1>{/template}
+
+/** @param n */
+{template .item}<p>{$n}</p>{/template}`)
+
+	var store = make(fragmentMap)
+	var buf bytes.Buffer
+	var err = tofu.NewRenderer("test.page").
+		WithFragments(store, "test.item").
+		Execute(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hash = FragmentHash([]byte("<p>1</p>"))
+	var frag = "<!--soy:fragment test.item " + hash + "--><p>1</p><!--/soy:fragment " + hash + "-->"
+	if expected := "<div><h1>Hello</h1>" + frag + frag + "</div>"; buf.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+	if len(store) != 1 || store[hash].Template != "test.item" || string(store[hash].Content) != "<p>1</p>" {
+		t.Errorf("unexpected fragments: %v", store)
+	}
+
+	err = tofu.NewRenderer("test.page").
+		WithFragments(failingStore{}, "test.header").
+		Execute(&buf, nil)
+	if err == nil || !strings.Contains(err.Error(), "unavailable") {
+		t.Errorf("expected the store's error, got %v", err)
+	}
+}
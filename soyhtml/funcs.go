@@ -1,15 +1,23 @@
 package soyhtml
 
 import (
+	"fmt"
 	"math"
 	"math/rand"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/robfig/soy/data"
 )
 
 type loopFunc func(s *state, key string) data.Value
 
+// loopFuncs provide the position of a {foreach} loop variable.  When iterating
+// a map, the loop variable takes each of its keys, in the order given by
+// SortMapKeys, and these report the position of the key in that order.
 var loopFuncs = map[string]loopFunc{
 	"index":   funcIndex,
 	"isFirst": funcIsFirst,
@@ -21,11 +29,11 @@ func funcIndex(s *state, key string) data.Value {
 }
 
 func funcIsFirst(s *state, key string) data.Value {
-	return data.Bool(s.context.lookup(key+"__index").(data.Int) == 0)
+	return data.NewBool(s.context.lookup(key+"__index").(data.Int) == 0)
 }
 
 func funcIsLast(s *state, key string) data.Value {
-	return data.Bool(
+	return data.NewBool(
 		s.context.lookup(key+"__index").(data.Int) == s.context.lookup(key+"__lastIndex").(data.Int))
 }
 
@@ -35,43 +43,129 @@ type Func struct {
 	ValidArgLengths []int
 }
 
+// ErrFunc returns a Func for a function that may fail.  An error returned by
+// apply fails the render with a *RenderError at the position of the call,
+// rather than requiring the function to panic or return undefined.  The
+// RenderError wraps the error, so it may be identified with errors.Is and
+// errors.As.
+func ErrFunc(apply func([]data.Value) (data.Value, error), validArgLengths ...int) Func {
+	return Func{func(args []data.Value) data.Value {
+		var val, err = apply(args)
+		if err != nil {
+			panic(funcError{err})
+		}
+		return val
+	}, validArgLengths}
+}
+
+// funcError is raised by the functions returned by ErrFunc to report an error.
+type funcError struct{ err error }
+
 // Funcs contains the builtin soy functions.
 // Callers may add their own functions to this map as well.
 var Funcs = map[string]Func{
-	"isNonnull":   {funcIsNonnull, []int{1}},
-	"length":      {funcLength, []int{1}},
-	"keys":        {funcKeys, []int{1}},
-	"augmentMap":  {funcAugmentMap, []int{2}},
-	"round":       {funcRound, []int{1, 2}},
-	"floor":       {funcFloor, []int{1}},
-	"ceiling":     {funcCeiling, []int{1}},
-	"min":         {funcMin, []int{2}},
-	"max":         {funcMax, []int{2}},
-	"randomInt":   {funcRandomInt, []int{1}},
-	"strContains": {funcStrContains, []int{2}},
-	"range":       {funcRange, []int{1, 2, 3}},
-	"hasData":     {funcHasData, []int{0}},
+	"isNonnull":     {funcIsNonnull, []int{1}},
+	"length":        {funcLength, []int{1}},
+	"keys":          {funcKeys, []int{1}},
+	"augmentMap":    {funcAugmentMap, []int{2}},
+	"round":         {funcRound, []int{1, 2}},
+	"floor":         {funcFloor, []int{1}},
+	"ceiling":       {funcCeiling, []int{1}},
+	"min":           {funcMin, []int{2}},
+	"max":           {funcMax, []int{2}},
+	"randomInt":     {funcRandomInt, []int{1}},
+	"strContains":   {funcStrContains, []int{2}},
+	"strMatches":    {funcStrMatches, []int{2}},
+	"strReplaceAll": {funcStrReplaceAll, []int{3}},
+	"range":         {funcRange, []int{1, 2, 3}},
+	"hasData":       {funcHasData, []int{0}},
+	"slice":         {funcSlice, []int{2, 3}},
+	"enumName":      {funcEnumName, []int{2}},
+	"enumValue":     {funcEnumValue, []int{2}},
 }
 
 func funcIsNonnull(v []data.Value) data.Value {
-	return data.Bool(!(v[0] == data.Null{} || v[0] == data.Undefined{}))
+	return data.NewBool(!(v[0] == data.Null{} || v[0] == data.Undefined{}))
 }
 
 func funcLength(v []data.Value) data.Value {
-	return data.Int(len(v[0].(data.List)))
+	if _, ok := v[0].(data.Null); ok {
+		return data.NewInt(0)
+	}
+	return data.NewInt(int64(len(v[0].(data.List))))
 }
 
+// SortMapKeys sorts the keys of a map, determining the order of the list
+// returned by keys() and so the order in which a {foreach} iterates a map.  By
+// default, keys are sorted lexically, as they are by soyutils.js.  If nil, the
+// keys are left in Go's (random) map iteration order.  The keys of a
+// *data.OrderedMap are not sorted, but left in the order in which they were
+// added.
+var SortMapKeys = sort.Strings
+
 func funcKeys(v []data.Value) data.Value {
-	var keys data.List
-	for k, _ := range v[0].(data.Map) {
-		keys = append(keys, data.String(k))
+	return mapKeys(v[0], nil)
+}
+
+// mapKeys returns the keys of the map, in order if it is a *data.OrderedMap,
+// or else ordered by the given function if non-nil, or else by SortMapKeys.
+// Null is treated as an empty map.
+func mapKeys(v data.Value, sortKeys func([]string)) data.List {
+	if m, ok := v.(*data.OrderedMap); ok {
+		return stringList(m.Keys())
+	}
+	var m = mustMap(v)
+	var keys = make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	if sortKeys == nil {
+		sortKeys = SortMapKeys
+	}
+	if sortKeys != nil {
+		sortKeys(keys)
+	}
+	return stringList(keys)
+}
+
+// stringList returns a list of the given strings.
+func stringList(strs []string) data.List {
+	var list = make(data.List, len(strs))
+	for i, str := range strs {
+		list[i] = data.String(str)
+	}
+	return list
+}
+
+// mustMap returns the entries of the given map, which must be a data.Map, a
+// *data.OrderedMap, or Null, which is treated as an empty map.
+func mustMap(v data.Value) data.Map {
+	switch m := v.(type) {
+	case *data.OrderedMap:
+		return m.Map
+	case data.Null:
+		return nil
 	}
-	return keys
+	return v.(data.Map)
 }
 
+// funcAugmentMap returns a map with the entries of both maps, preferring those
+// of the second.  If the first is ordered, so is the result, with the keys of
+// the second following its own.
 func funcAugmentMap(v []data.Value) data.Value {
-	var m1 = v[0].(data.Map)
-	var m2 = v[1].(data.Map)
+	if m1, ok := v[0].(*data.OrderedMap); ok {
+		var m2 = mustMap(v[1])
+		var result = data.NewOrderedMap()
+		for _, k := range m1.Keys() {
+			result.Set(k, m1.Map[k])
+		}
+		for _, k := range mapKeys(v[1], nil) {
+			result.Set(k.String(), m2[k.String()])
+		}
+		return result
+	}
+	var m1 = mustMap(v[0])
+	var m2 = mustMap(v[1])
 	var result = make(data.Map, len(m1)+len(m2)+4)
 	for k, v := range m1 {
 		result[k] = v
@@ -89,7 +183,7 @@ func funcRound(v []data.Value) data.Value {
 	}
 	var result = round(toFloat(v[0]), digitsAfterPt)
 	if digitsAfterPt <= 0 {
-		return data.Int(result)
+		return data.NewInt(int64(result))
 	}
 	return data.Float(result)
 }
@@ -109,14 +203,14 @@ func funcFloor(v []data.Value) data.Value {
 	if isInt(v[0]) {
 		return v[0]
 	}
-	return data.Int(math.Floor(toFloat(v[0])))
+	return data.NewInt(int64(math.Floor(toFloat(v[0]))))
 }
 
 func funcCeiling(v []data.Value) data.Value {
 	if isInt(v[0]) {
 		return v[0]
 	}
-	return data.Int(math.Ceil(toFloat(v[0])))
+	return data.NewInt(int64(math.Ceil(toFloat(v[0]))))
 }
 
 func funcMin(v []data.Value) data.Value {
@@ -140,11 +234,88 @@ func funcMax(v []data.Value) data.Value {
 }
 
 func funcRandomInt(v []data.Value) data.Value {
-	return data.Int(rand.Int63n(int64(v[0].(data.Int))))
+	return data.NewInt(rand.Int63n(int64(v[0].(data.Int))))
 }
 
 func funcStrContains(v []data.Value) data.Value {
-	return data.Bool(strings.Contains(string(v[0].(data.String)), string(v[1].(data.String))))
+	return data.NewBool(strings.Contains(v[0].String(), v[1].String()))
+}
+
+// maxCachedRegexps limits the number of compiled patterns that are cached, in
+// case patterns are given by data rather than by the template.
+const maxCachedRegexps = 1000
+
+var (
+	regexpCache      sync.Map // pattern => *regexp.Regexp
+	regexpCacheCount int32
+)
+
+// compileRegexp returns the compiled regular expression, failing the render
+// if the pattern is invalid.
+func compileRegexp(pattern string) *regexp.Regexp {
+	if re, ok := regexpCache.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	var re, err = regexp.Compile(pattern)
+	if err != nil {
+		panic(funcError{err})
+	}
+	if atomic.AddInt32(&regexpCacheCount, 1) <= maxCachedRegexps {
+		regexpCache.Store(pattern, re)
+	}
+	return re
+}
+
+// funcStrMatches returns true if the string contains a match of the regular
+// expression, which uses RE2 syntax.
+func funcStrMatches(v []data.Value) data.Value {
+	return data.NewBool(compileRegexp(v[1].String()).MatchString(v[0].String()))
+}
+
+// funcStrReplaceAll replaces all matches of the regular expression in the
+// string with the replacement, which is literal: it may not refer to groups.
+func funcStrReplaceAll(v []data.Value) data.Value {
+	var re = compileRegexp(v[1].String())
+	return data.String(re.ReplaceAllLiteralString(v[0].String(), v[2].String()))
+}
+
+// mustEnum returns the registered enum with the given name, failing the render
+// if there is none.
+func mustEnum(name data.Value) *data.Enum {
+	var enum, ok = data.LookupEnum(name.String())
+	if !ok {
+		panic(funcError{fmt.Errorf("enum %q is not registered", name)})
+	}
+	return enum
+}
+
+// funcEnumName returns the name of the given number in the enum, or null if
+// the number is not defined (e.g. by a newer version of the enum).  Given a
+// name, e.g. of an enum field converted to a string, it returns the name if the
+// enum defines it.  Any other value results in null.
+func funcEnumName(v []data.Value) data.Value {
+	var enum = mustEnum(v[0])
+	switch key := v[1].(type) {
+	case data.Int:
+		if name, ok := enum.Names[int32(key)]; ok && data.Int(int32(key)) == key {
+			return data.String(name)
+		}
+	case data.String:
+		if _, ok := enum.Values[string(key)]; ok {
+			return key
+		}
+	}
+	return data.Null{}
+}
+
+// funcEnumValue returns the number of the given name in the enum, or null if
+// the name is not defined.
+func funcEnumValue(v []data.Value) data.Value {
+	var enum = mustEnum(v[0])
+	if num, ok := enum.Values[v[1].String()]; ok {
+		return data.NewInt(int64(num))
+	}
+	return data.Null{}
 }
 
 func funcRange(v []data.Value) data.Value {
@@ -167,7 +338,7 @@ func funcRange(v []data.Value) data.Value {
 	var indices data.List
 	var i = 0
 	for index := init; index < limit; index += increment {
-		indices = append(indices, data.Int(index))
+		indices = append(indices, data.NewInt(int64(index)))
 		i++
 	}
 	return indices
@@ -176,3 +347,58 @@ func funcRange(v []data.Value) data.Value {
 func funcHasData(v []data.Value) data.Value {
 	return data.Bool(true)
 }
+
+// funcSlice returns the items of a list from start (inclusive) to end
+// (exclusive, or the end of the list if omitted).  As in javascript's
+// Array.slice, negative indexes count back from the end of the list.
+//
+// Streams are sliced lazily, so negative indexes are not supported for them.
+func funcSlice(v []data.Value) data.Value {
+	var start, end = int(v[1].(data.Int)), -1
+	if len(v) == 3 {
+		end = int(v[2].(data.Int))
+	}
+
+	if stream, ok := v[0].(*data.Stream); ok {
+		if start < 0 || end < 0 && len(v) == 3 {
+			panic("slice: negative indexes are not supported for streams")
+		}
+		return data.NewSeqStream(func(yield func(data.Value) bool) {
+			defer stream.Stop()
+			for i := 0; len(v) == 2 || i < end; i++ {
+				var val, ok = stream.Next()
+				if !ok || i >= start && !yield(val) {
+					return
+				}
+			}
+		})
+	}
+
+	var list, ok = v[0].(data.List)
+	if _, isNull := v[0].(data.Null); !ok && !isNull {
+		panic(fmt.Sprintf("slice: expected a list, got %T", v[0]))
+	}
+	if len(v) == 2 {
+		end = len(list)
+	}
+	start, end = sliceIndex(start, len(list)), sliceIndex(end, len(list))
+	if start >= end {
+		return data.List{}
+	}
+	return list[start:end:end]
+}
+
+// sliceIndex resolves a possibly negative index into a list of the given
+// length, clamping it to the bounds of the list.
+func sliceIndex(i, length int) int {
+	if i < 0 {
+		i += length
+	}
+	if i < 0 {
+		return 0
+	}
+	if i > length {
+		return length
+	}
+	return i
+}
@@ -1,9 +1,12 @@
 package soyhtml
 
 import (
+	"bytes"
+	"errors"
 	"testing"
 
 	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/errortypes"
 )
 
 var rangeTests = []struct{ args, result []int }{
@@ -62,6 +65,49 @@ func TestStrContains(t *testing.T) {
 	}
 }
 
+func TestStrMatches(t *testing.T) {
+	var tests = []struct {
+		str, pattern string
+		result       bool
+	}{
+		{"", "", true},
+		{"abc", "b", true},
+		{"abc", "^b", false},
+		{"abc", "^a.c$", true},
+		{"héllo", "^h.llo$", true},
+		{"a\nb", "a.b", false},
+		{"ABC", "(?i)abc", true},
+	}
+	for _, test := range tests {
+		actual := funcStrMatches([]data.Value{data.New(test.str), data.New(test.pattern)})
+		if actual != data.Bool(test.result) {
+			t.Errorf("strMatches(%q, %q) => %v, expected %v", test.str, test.pattern, actual, test.result)
+		}
+	}
+}
+
+func TestStrReplaceAll(t *testing.T) {
+	var tests = []struct {
+		str, pattern string
+		replacement  interface{}
+		result       string
+	}{
+		{"abc", "x", "-", "abc"},
+		{"abc", "x*", "-", "-a-b-c-"},
+		{"a  b   c", " +", " ", "a b c"},
+		{"a-b", "(-)", "$1", "a$1b"},
+		{"1,2", ",", 0, "102"},
+	}
+	for _, test := range tests {
+		actual := funcStrReplaceAll([]data.Value{
+			data.New(test.str), data.New(test.pattern), data.New(test.replacement)})
+		if actual != data.String(test.result) {
+			t.Errorf("strReplaceAll(%q, %q, %v) => %q, expected %q",
+				test.str, test.pattern, test.replacement, actual, test.result)
+		}
+	}
+}
+
 func TestRound(t *testing.T) {
 	type i []interface{}
 	var tests = []struct {
@@ -272,3 +318,97 @@ func TestKeys(t *testing.T) {
 		}
 	}
 }
+
+func TestSlice(t *testing.T) {
+	var list = data.List{data.Int(0), data.Int(1), data.Int(2), data.Int(3)}
+	var tests = []struct {
+		args   []int
+		result []int
+	}{
+		{[]int{0}, []int{0, 1, 2, 3}},
+		{[]int{1, 3}, []int{1, 2}},
+		{[]int{-2}, []int{2, 3}},
+		{[]int{0, -1}, []int{0, 1, 2}},
+		{[]int{-10, 10}, []int{0, 1, 2, 3}},
+		{[]int{3, 1}, []int{}},
+		{[]int{4}, []int{}},
+	}
+	for _, test := range tests {
+		var args = []data.Value{list}
+		for _, a := range test.args {
+			args = append(args, data.Int(a))
+		}
+		if result := funcSlice(args); !listEquals(result.(data.List), test.result) {
+			t.Errorf("slice(%v) => %v, expected %v", test.args, result, test.result)
+		}
+
+		// Streams give the same result for non-negative indexes.
+		if test.args[0] < 0 || len(test.args) == 2 && test.args[1] < 0 {
+			continue
+		}
+		var i = 0
+		args[0] = data.NewStream(func() (data.Value, bool) {
+			if i == len(list) {
+				return nil, false
+			}
+			i++
+			return list[i-1], true
+		})
+		var stream = funcSlice(args).(*data.Stream)
+		var result data.List
+		for item, ok := stream.Next(); ok; item, ok = stream.Next() {
+			result = append(result, item)
+		}
+		if !listEquals(result, test.result) {
+			t.Errorf("slice(stream, %v) => %v, expected %v", test.args, result, test.result)
+		}
+	}
+}
+
+func listEquals(list data.List, ints []int) bool {
+	if len(list) != len(ints) {
+		return false
+	}
+	for i := range ints {
+		if list[i] != data.Int(ints[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestErrFunc(t *testing.T) {
+	var errNotFound = errors.New("user not found")
+	var tofu = newTestTofu(t, `{namespace test}
+/** @param id */
+{template .user}
+  {userName($id)}
+{/template}`).WithFuncs(map[string]Func{
+		"userName": ErrFunc(func(args []data.Value) (data.Value, error) {
+			if args[0].(data.Int) != 1 {
+				return nil, errNotFound
+			}
+			return data.String("Rob"), nil
+		}, 1),
+	})
+
+	var buf bytes.Buffer
+	if err := tofu.Render(&buf, "test.user", data.Map{"id": data.Int(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "Rob" {
+		t.Errorf("expected %q, got %q", "Rob", buf.String())
+	}
+
+	var err = tofu.Render(&buf, "test.user", data.Map{"id": data.Int(2)})
+	if !errors.Is(err, errNotFound) || !errors.Is(err, errortypes.ErrRender) {
+		t.Errorf("expected a render error wrapping %v, got %v", errNotFound, err)
+	}
+	var rerr *RenderError
+	if !errors.As(err, &rerr) || rerr.Template != "test.user" || rerr.Panic != errNotFound {
+		t.Errorf("expected a RenderError in test.user for %v, got %#v", errNotFound, err)
+	}
+	if pos := errortypes.ToErrFilePos(err); pos == nil || pos.Line() != 4 {
+		t.Errorf("expected an error on line 4, got %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package soyhtml
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/robfig/soy/data"
+)
+
+// IncludeMode selects how calls marked fragment="true" are rendered.
+type IncludeMode int
+
+const (
+	// IncludeInline renders fragment calls inline, like any other call.
+	IncludeInline IncludeMode = iota
+
+	// IncludeESI replaces each fragment call with an edge side include tag:
+	//	<esi:include src="/fragment?template=ns.tmpl&amp;params=..."/>
+	IncludeESI
+
+	// IncludeSSI replaces each fragment call with a server side include:
+	//	<!--#include virtual="/fragment?template=ns.tmpl&amp;params=..." -->
+	IncludeSSI
+)
+
+// includes holds the include configuration of a render.
+type includes struct {
+	mode     IncludeMode
+	endpoint string
+	key      []byte // signs the params, if non-nil
+}
+
+// WithIncludes sets how calls marked fragment="true" are rendered.  Unless
+// the mode is IncludeInline, each one is replaced by an include of the given
+// endpoint, with the template name and params in the query string, so that a
+// CDN or web server may assemble the page from separately cached fragments.
+// The endpoint is expected to be served by a FragmentHandler, or by a
+// SignedFragmentHandler if the includes are signed.
+func (r *Renderer) WithIncludes(mode IncludeMode, endpoint string) *Renderer {
+	r.includes.mode = mode
+	r.includes.endpoint = endpoint
+	return r
+}
+
+// SignIncludes signs the params of each include with the given key, so that
+// the fragment endpoint renders only the templates and data that were
+// included by a page.  See SignFragmentParams.
+func (r *Renderer) SignIncludes(key []byte) *Renderer {
+	r.includes.key = key
+	return r
+}
+
+// isInclude returns true if the given call should be rendered as an include.
+func (inc *includes) isInclude(fragment bool) bool {
+	return fragment && inc.mode != IncludeInline
+}
+
+// writeInclude writes an include of the named template with the given params
+// in place of rendering it.
+func (s *state) writeInclude(name string, params data.Map) {
+	var token string
+	var err error
+	if s.includes.key != nil {
+		token, err = SignFragmentParams(s.includes.key, name, params)
+	} else {
+		token, err = EncodeFragmentParams(params)
+	}
+	if err != nil {
+		s.errorf("failed to encode the params of fragment %s: %v", name, err)
+	}
+	var src = s.includes.endpoint + "?" + url.Values{
+		"template": {name},
+		"params":   {token},
+	}.Encode()
+
+	var tag string
+	switch s.includes.mode {
+	case IncludeESI:
+		tag = fmt.Sprintf(`<esi:include src="%s"/>`, html.EscapeString(src))
+	case IncludeSSI:
+		tag = fmt.Sprintf(`<!--#include virtual="%s" -->`, html.EscapeString(src))
+	default:
+		s.errorf("unknown include mode: %d", s.includes.mode)
+	}
+	if _, err := io.WriteString(s.wr, tag); err != nil {
+		s.errorf("%s", err)
+	}
+}
+
+// EncodeFragmentParams serializes the params of a fragment call to a token
+// suitable for use in a URL.
+func EncodeFragmentParams(params data.Map) (string, error) {
+	var buf, err = json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// DecodeFragmentParams returns the params serialized by EncodeFragmentParams.
+func DecodeFragmentParams(token string) (params data.Map, err error) {
+	var buf []byte
+	if buf, err = base64.RawURLEncoding.DecodeString(token); err != nil {
+		return nil, err
+	}
+	val, err := data.TryNew(json.RawMessage(buf))
+	if err != nil {
+		return nil, fmt.Errorf("invalid fragment params: %v", err)
+	}
+	params, ok := val.(data.Map)
+	if !ok {
+		return nil, fmt.Errorf("invalid fragment params: expected a map")
+	}
+	return params, nil
+}
+
+// FragmentHandler returns a handler that renders a single fragment, given the
+// "template" and "params" query parameters written by WithIncludes.
+//
+// The params are not authenticated, so the handler renders any template in
+// the Tofu with any data.  It should be reachable only by the cache that
+// assembles the pages; otherwise, use SignedFragmentHandler.
+func (tofu *Tofu) FragmentHandler() http.Handler {
+	return tofu.fragmentHandler(func(_, token string) (data.Map, error) {
+		return DecodeFragmentParams(token)
+	})
+}
+
+// SignedFragmentHandler returns a handler that renders a single fragment, like
+// FragmentHandler, but only if its params were signed with the given key by
+// SignIncludes.  Requests with a forged or oversized token are forbidden.
+func (tofu *Tofu) SignedFragmentHandler(key []byte) http.Handler {
+	return tofu.fragmentHandler(func(name, token string) (data.Map, error) {
+		return VerifyFragmentParams(key, name, token)
+	})
+}
+
+// fragmentHandler returns a handler that renders a single fragment, using
+// decode to get the params from the token.
+func (tofu *Tofu) fragmentHandler(decode func(name, token string) (data.Map, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var query = r.URL.Query()
+		var name = query.Get("template")
+		var params, err = decode(name, query.Get("params"))
+		switch {
+		case errors.Is(err, ErrFragmentSignature), errors.Is(err, ErrFragmentTokenSize):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var buf bytes.Buffer
+		err = tofu.Render(&buf, name, params)
+		switch {
+		case errors.Is(err, ErrTemplateNotFound):
+			http.NotFound(w, r)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			buf.WriteTo(w)
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package soyhtml
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/robfig/soy/data"
+)
+
+const includeTestSoy = `{namespace test}
+/** @param user */
+{template .page}
+  <div>{call .greeting fragment="true"}{param name: $user.name /}{/call}</div>
+{/template}
+
+/** @param name */
+{template .greeting}Hello {$name}{/template}`
+
+func TestIncludes(t *testing.T) {
+	var tofu = newTestTofu(t, includeTestSoy)
+	var user = data.Map{"user": data.Map{"name": data.String("Rob")}}
+	var token, err = EncodeFragmentParams(data.Map{"name": data.String("Rob")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var src = "/fragment?params=" + token + "&amp;template=test.greeting"
+
+	var tests = []struct {
+		mode     IncludeMode
+		expected string
+	}{
+		{IncludeInline, `<div>Hello Rob</div>`},
+		{IncludeESI, `<div><esi:include src="` + src + `"/></div>`},
+		{IncludeSSI, `<div><!--#include virtual="` + src + `" --></div>`},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		err = tofu.NewRenderer("test.page").
+			WithIncludes(test.mode, "/fragment").
+			Execute(&buf, user)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if buf.String() != test.expected {
+			t.Errorf("mode %d: expected\n%s\ngot\n%s", test.mode, test.expected, buf.String())
+		}
+	}
+}
+
+func TestFragmentHandler(t *testing.T) {
+	var tofu = newTestTofu(t, includeTestSoy)
+	var token, err = EncodeFragmentParams(data.Map{"name": data.String("Rob")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		template, params string
+		code             int
+		body             string
+	}{
+		{"test.greeting", token, http.StatusOK, "Hello Rob"},
+		{"test.missing", token, http.StatusNotFound, "404 page not found\n"},
+		{"test.greeting", "!!!", http.StatusBadRequest, ""},
+		{"test.greeting", "", http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		var query = url.Values{"template": {test.template}, "params": {test.params}}
+		var req = httptest.NewRequest("GET", "/fragment?"+query.Encode(), nil)
+		var rec = httptest.NewRecorder()
+		tofu.FragmentHandler().ServeHTTP(rec, req)
+		if rec.Code != test.code {
+			t.Errorf("%v: expected status %d, got %d", query, test.code, rec.Code)
+		}
+		if test.body != "" && rec.Body.String() != test.body {
+			t.Errorf("%v: expected %q, got %q", query, test.body, rec.Body.String())
+		}
+	}
+}
+
+func TestFragmentParams(t *testing.T) {
+	var params = data.Map{
+		"s": data.String("a&b"),
+		"i": data.Int(3),
+		"f": data.Float(1.5),
+		"l": data.List{data.Bool(true), data.Null{}},
+		"m": data.Map{"k": data.String("v")},
+	}
+	var token, err = EncodeFragmentParams(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := DecodeFragmentParams(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, params) {
+		t.Errorf("expected %v, got %v", params, actual)
+	}
+}
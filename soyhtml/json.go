@@ -0,0 +1,80 @@
+package soyhtml
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrInvalidJSON is returned by RenderJSON when Options.ValidateJSON is set and
+// the output of the template does not parse as JSON.
+var ErrInvalidJSON = errors.New("soyhtml: template rendered invalid JSON")
+
+// RenderJSON renders the named template, which must be declared
+// kind="text", as a JSON response, using the given object as context like
+// Render.  Values should be printed with the json directive, so that they are
+// quoted and escaped as JSON:
+//
+//	{template .config kind="text"}
+//	  {lb}"user": {$user|json}, "flags": {$flags|json}{rb}
+//	{/template}
+//
+// The output is buffered, so that nothing is written to the response if the
+// render fails.  If Options.ValidateJSON is set, the output must also parse as
+// JSON, and the error identifies the line and column where it does not.
+// Otherwise, the response is written with a Content-Type of application/json.
+func (tofu *Tofu) RenderJSON(w http.ResponseWriter, name string, obj interface{}) error {
+	if tmpl, err := tofu.template(name); err == nil && tmpl.Node.Kind != "text" {
+		var kind = tmpl.Node.Kind
+		if kind == "" {
+			kind = "html"
+		}
+		return fmt.Errorf("soyhtml: RenderJSON requires a template of kind=\"text\", but %s is of kind %q",
+			name, kind)
+	}
+
+	var buf = getBuffer()
+	defer putBuffer(buf)
+	if err := tofu.Render(buf, name, obj); err != nil {
+		return err
+	}
+	if tofu.opts.ValidateJSON {
+		if err := validateJSON(name, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	var header = w.Header()
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	header.Set("X-Content-Type-Options", "nosniff")
+	var _, err = buf.WriteTo(w)
+	return err
+}
+
+// validateJSON returns an error identifying the position of the first syntax
+// error in the output of the named template, if it is not valid JSON.
+func validateJSON(name string, out []byte) error {
+	if json.Valid(out) {
+		return nil
+	}
+	var err = json.Unmarshal(out, new(interface{}))
+
+	// The offset of a syntax error follows the offending byte.  Otherwise, the
+	// output ended early.
+	var index = len(out)
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) && syntaxErr.Offset > 0 {
+		index = int(syntaxErr.Offset) - 1
+	}
+	var before = out[:index]
+	var line = bytes.Count(before, []byte("\n")) + 1
+	var start = bytes.LastIndexByte(before, '\n') + 1
+	var end = bytes.IndexByte(out[start:], '\n')
+	if end < 0 {
+		end = len(out) - start
+	}
+	var col = len(before) - start + 1
+	return fmt.Errorf("%w: %s, line %d, column %d: %v\n%s\n%*s^",
+		ErrInvalidJSON, name, line, col, err, out[start:start+end], col-1, "")
+}
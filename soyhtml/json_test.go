@@ -0,0 +1,92 @@
+package soyhtml
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/robfig/soy/data"
+)
+
+const jsonTestSoy = `{namespace test}
+/** @param user @param flags */
+{template .config kind="text"}
+{lb}
+  "user": {$user|json},
+  "flags": [{foreach $flag in $flags}{$flag|json},{/foreach}]
+{rb}
+{/template}
+
+{template .page}<p>hi</p>{/template}`
+
+func TestRenderJSON(t *testing.T) {
+	var tests = []struct {
+		validate bool
+		name     string
+		flags    data.List
+		expected string
+		err      string
+	}{
+		{false, "test.config", data.List{},
+			`{"user": "rob", "flags": []}`, ""},
+		{true, "test.config", data.List{},
+			`{"user": "rob", "flags": []}`, ""},
+
+		// the trailing comma is caught only if validating
+		{false, "test.config", data.List{data.String("a")},
+			`{"user": "rob", "flags": ["a",]}`, ""},
+		{true, "test.config", data.List{data.String("a")}, "",
+			"soyhtml: template rendered invalid JSON: test.config, line 1, column 31: " +
+				"invalid character ']' looking for beginning of value\n" +
+				`{"user": "rob", "flags": ["a",]}` + "\n" +
+				"                              ^"},
+
+		{false, "test.page", nil, "",
+			`soyhtml: RenderJSON requires a template of kind="text", but test.page is of kind "html"`},
+		{false, "test.missing", nil, "", ErrTemplateNotFound.Error()},
+	}
+	for _, test := range tests {
+		var tofu = newTestTofu(t, jsonTestSoy).WithOptions(Options{ValidateJSON: test.validate})
+		var w = httptest.NewRecorder()
+		var err = tofu.RenderJSON(w, test.name, data.Map{
+			"user":  data.String("rob"),
+			"flags": test.flags,
+		})
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s %v: expected error\n%s\ngot\n%v", test.name, test.flags, test.err, err)
+			}
+			if w.Body.Len() > 0 {
+				t.Errorf("%s %v: expected no output on error, got %q", test.name, test.flags, w.Body)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %v: %v", test.name, test.flags, err)
+			continue
+		}
+		if w.Body.String() != test.expected {
+			t.Errorf("%s %v: expected\n%s\ngot\n%s", test.name, test.flags, test.expected, w.Body)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+			t.Errorf("%s %v: unexpected content type %q", test.name, test.flags, ct)
+		}
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	for _, out := range []string{"", "{", `{"a": 1,}`, "[1]\n[2]"} {
+		var err = validateJSON("test", []byte(out))
+		if !errors.Is(err, ErrInvalidJSON) {
+			t.Errorf("%q: expected ErrInvalidJSON, got %v", out, err)
+		}
+	}
+	if err := validateJSON("test", []byte(" {\"a\": [1, 2]}\n")); err != nil {
+		t.Error(err)
+	}
+	var err = validateJSON("test", []byte("{\n\"a\": 1,\n}"))
+	if err == nil || !strings.Contains(err.Error(), "line 3, column 1") {
+		t.Errorf("expected the error at line 3, column 1, got %v", err)
+	}
+}
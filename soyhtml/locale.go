@@ -0,0 +1,48 @@
+package soyhtml
+
+import (
+	"strings"
+
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/soymsg"
+)
+
+// localeFunc is a builtin function that depends on the message bundle of the
+// render.  Functions provided by the user with the same name take precedence.
+type localeFunc struct {
+	Apply           func(msgs soymsg.Bundle, args []data.Value) data.Value
+	ValidArgLengths []int
+}
+
+var localeFuncs = map[string]localeFunc{
+	"currentLocale": {funcCurrentLocale, []int{0}},
+	"currentDir":    {funcCurrentDir, []int{0}},
+}
+
+// rtlLanguages are the languages written right to left.
+var rtlLanguages = map[string]bool{
+	"ar": true, "ckb": true, "dv": true, "fa": true, "he": true, "iw": true,
+	"ps": true, "sd": true, "ug": true, "ur": true, "yi": true,
+}
+
+// funcCurrentLocale returns the locale of the message bundle, e.g. for the lang
+// attribute of the <html> element, or "" if rendering without one.
+func funcCurrentLocale(msgs soymsg.Bundle, _ []data.Value) data.Value {
+	if msgs == nil {
+		return data.String("")
+	}
+	return data.String(msgs.Locale())
+}
+
+// funcCurrentDir returns the direction of the message bundle's locale, "rtl"
+// or "ltr", e.g. for the dir attribute of the <html> element.
+func funcCurrentDir(msgs soymsg.Bundle, _ []data.Value) data.Value {
+	var locale = string(funcCurrentLocale(msgs, nil).(data.String))
+	if i := strings.IndexAny(locale, "-_"); i != -1 {
+		locale = locale[:i]
+	}
+	if rtlLanguages[strings.ToLower(locale)] {
+		return data.String("rtl")
+	}
+	return data.String("ltr")
+}
@@ -0,0 +1,46 @@
+package soyhtml
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/robfig/soy/soymsg"
+)
+
+// localeBundle is a message bundle with no messages.
+type localeBundle string
+
+func (b localeBundle) Message(id uint64) *soymsg.Message { return nil }
+func (b localeBundle) Locale() string                    { return string(b) }
+func (b localeBundle) PluralCase(n int) int              { return 0 }
+
+func TestLocale(t *testing.T) {
+	var tofu = newTestTofu(t, `{namespace test}
+/** */
+{template .page}
+  <html lang="{currentLocale()}" dir="{currentDir()}">
+{/template}`)
+	var tests = []struct {
+		msgs     soymsg.Bundle
+		expected string
+	}{
+		{nil, `<html lang="" dir="ltr">`},
+		{localeBundle("en-US"), `<html lang="en-US" dir="ltr">`},
+		{localeBundle("ar"), `<html lang="ar" dir="rtl">`},
+		{localeBundle("he_IL"), `<html lang="he_IL" dir="rtl">`},
+		{localeBundle("FA-ir"), `<html lang="FA-ir" dir="rtl">`},
+		{localeBundle("fr"), `<html lang="fr" dir="ltr">`},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		var err = tofu.NewRenderer("test.page").
+			WithMessages(test.msgs).
+			Execute(&buf, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.msgs, test.expected, buf.String())
+		}
+	}
+}
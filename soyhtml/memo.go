@@ -0,0 +1,68 @@
+package soyhtml
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/robfig/soy/data"
+)
+
+// MemoStats counts the calls to a memoized function.
+type MemoStats struct {
+	Hits   int64 // calls answered with the result of an earlier call
+	Misses int64 // calls that invoked the function
+}
+
+// Memoize marks the named functions as memoizable: within a single render,
+// repeated calls to one of them with identical arguments return the result of
+// the first call, rather than calling the function again.  It is intended for
+// functions that are relatively expensive but return the same result for the
+// same arguments over the course of a request, e.g. message lookups or feature
+// flags.
+func (tofu *Tofu) Memoize(names ...string) *Tofu {
+	if tofu.memo == nil {
+		tofu.memo = make(map[string]*MemoStats, len(names))
+	}
+	for _, name := range names {
+		if tofu.memo[name] == nil {
+			tofu.memo[name] = new(MemoStats)
+		}
+	}
+	return tofu
+}
+
+// MemoStats returns the number of calls to each memoized function that were
+// and were not answered from the per-render cache, across all renders by this
+// Tofu, e.g. to export as metrics.
+func (tofu *Tofu) MemoStats() map[string]MemoStats {
+	var stats = make(map[string]MemoStats, len(tofu.memo))
+	for name, s := range tofu.memo {
+		stats[name] = MemoStats{atomic.LoadInt64(&s.Hits), atomic.LoadInt64(&s.Misses)}
+	}
+	return stats
+}
+
+// memo holds the results of the memoized functions called during a render.
+type memo struct {
+	stats   map[string]*MemoStats // memoized function name => stats
+	results map[string]data.Value // function call => result
+}
+
+// isMemoized returns true if calls to the named function are memoized.
+func (m *memo) isMemoized(name string) bool {
+	return m != nil && m.stats[name] != nil
+}
+
+// call returns the result of an earlier call to the named function with the
+// same args, or else the result of apply.
+func (m *memo) call(name string, args []data.Value, apply func() data.Value) data.Value {
+	var key = fmt.Sprintf("%s%#v", name, args)
+	if val, ok := m.results[key]; ok {
+		atomic.AddInt64(&m.stats[name].Hits, 1)
+		return val
+	}
+	atomic.AddInt64(&m.stats[name].Misses, 1)
+	var val = apply()
+	m.results[key] = val
+	return val
+}
@@ -0,0 +1,48 @@
+package soyhtml
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/robfig/soy/data"
+)
+
+func TestMemoize(t *testing.T) {
+	var calls = make(map[string]int)
+	var counter = func(name string) Func {
+		return Func{func(args []data.Value) data.Value {
+			calls[name]++
+			return data.Bool(args[0].String() == "on")
+		}, []int{1}}
+	}
+	var tofu = newTestTofu(t, `{namespace test}
+{template .page}
+  {if flag('on')}a{/if}{if flag('on')}b{/if}{if flag('off')}c{/if}
+  {if other('on')}d{/if}{if other('on')}e{/if}
+  {call .sub /}
+{/template}
+
+{template .sub}
+  {if flag('on')}f{/if}
+{/template}`).
+		WithFuncs(map[string]Func{"flag": counter("flag"), "other": counter("other")}).
+		Memoize("flag")
+
+	for i := 0; i < 2; i++ {
+		var buf bytes.Buffer
+		if err := tofu.Render(&buf, "test.page", nil); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != "abdef" {
+			t.Errorf("expected %q, got %q", "abdef", buf.String())
+		}
+	}
+
+	if calls["flag"] != 4 || calls["other"] != 4 {
+		t.Errorf("expected 4 calls to flag and other, got %v", calls)
+	}
+	var stats = tofu.MemoStats()
+	if len(stats) != 1 || stats["flag"] != (MemoStats{Hits: 4, Misses: 4}) {
+		t.Errorf("unexpected stats: %v", stats)
+	}
+}
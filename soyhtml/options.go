@@ -0,0 +1,127 @@
+package soyhtml
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/robfig/soy/errortypes"
+	"github.com/robfig/soy/template"
+)
+
+// Options controls the behavior of rendering.  The zero value gives the
+// default behavior.
+type Options struct {
+	// LenientData renders print tags whose expressions evaluate to undefined
+	// as the empty string, rather than failing the render.
+	LenientData bool
+
+	// DetailedErrors adds an excerpt of the template source, marking the
+	// position of the failure, to render errors.
+	DetailedErrors bool
+
+	// PoolBuffers renders into a pooled buffer, which is written to the
+	// output only once rendering succeeds.  This avoids writing partial
+	// output on failure and reduces small writes to the output.
+	PoolBuffers bool
+
+	// PoolScopes reuses the maps that hold the variables of loops, lets, and
+	// calls, within a render and across renders, rather than allocating them
+	// anew.  This reduces the garbage produced by renders of templates with
+	// many loops and calls.
+	PoolScopes bool
+
+	// CacheTemplates caches the lookup of templates by name.  It must not be
+	// used with a registry that is modified after rendering begins (e.g. by
+	// watching files).
+	CacheTemplates bool
+
+	// Deterministic makes the output depend only on the template and its data,
+	// so that it may be compared against golden files in tests.  The random
+	// functions (randomInt) are seeded identically for each render, maps are
+	// iterated in sorted key order even if SortMapKeys is nil, and the time
+	// functions (now) use a fixed time unless the Renderer is given a Clock.
+	Deterministic bool
+
+	// ValidateJSON checks that the output of RenderJSON parses as JSON, and
+	// fails the render if not, e.g. because of a trailing comma left by a
+	// loop.  It parses the entire output, so it is intended for development.
+	ValidateJSON bool
+}
+
+// WithOptions sets the options used by renderers created by the Tofu.
+func (tofu *Tofu) WithOptions(opts Options) *Tofu {
+	tofu.opts = opts
+	tofu.cache = nil
+	if opts.CacheTemplates {
+		tofu.cache = new(sync.Map)
+	}
+	return tofu
+}
+
+// template returns the named template, using the cache if enabled.
+func (tofu *Tofu) template(name string) (template.Template, error) {
+	if tofu.cache == nil {
+		return tofu.registry.Lookup(name)
+	}
+	if tmpl, ok := tofu.cache.Load(name); ok {
+		return tmpl.(template.Template), nil
+	}
+	var tmpl, err = tofu.registry.Lookup(name)
+	if err == nil {
+		tofu.cache.Store(name, tmpl)
+	}
+	return tmpl, err
+}
+
+// maxPooledBuffer is the capacity above which buffers are not returned to the
+// pool, so that an occasional large render does not pin memory.
+const maxPooledBuffer = 64 << 10
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// withExcerpt adds an excerpt of the source at the error's position to the
+// error message, if the position and source are known.
+func withExcerpt(reg *template.Registry, err error) error {
+	var pos = errortypes.ToErrFilePos(err)
+	if pos == nil || pos.Line() < 1 {
+		return err
+	}
+	var src string
+	for _, soyfile := range reg.SoyFiles {
+		if soyfile.Name == pos.File() {
+			src = soyfile.Text
+			break
+		}
+	}
+	var lines = strings.Split(src, "\n")
+	if pos.Line() > len(lines) {
+		return err
+	}
+
+	var buf bytes.Buffer
+	var width = len(fmt.Sprint(pos.Line()))
+	if pos.Line() > 1 {
+		fmt.Fprintf(&buf, "\n%*d | %s", width, pos.Line()-1, lines[pos.Line()-2])
+	}
+	fmt.Fprintf(&buf, "\n%*d | %s", width, pos.Line(), lines[pos.Line()-1])
+	if pos.Col() > 0 {
+		fmt.Fprintf(&buf, "\n%*s | %s^", width, "", strings.Repeat(" ", pos.Col()-1))
+	}
+	return errortypes.NewErrFilePosf(pos.File(), pos.Line(), pos.Col(), "%w\n%s", err, buf.String())
+}
@@ -0,0 +1,162 @@
+package soyhtml
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/parse"
+	"github.com/robfig/soy/template"
+)
+
+func TestOptions(t *testing.T) {
+	var tree, err = parse.SoyFile("options.soy", `{namespace test}
+/** @param? name */
+{template .hello}
+  Hello {$name}!
+{/template}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var registry = template.Registry{}
+	if err = registry.Add(tree); err != nil {
+		t.Fatal(err)
+	}
+
+	// By default, the undefined name fails the render after writing the
+	// preceding output.
+	var buf bytes.Buffer
+	err = NewTofu(&registry).Render(&buf, "test.hello", nil)
+	if err == nil || buf.String() != "Hello " {
+		t.Errorf("expected an error and partial output, got %v and %q", err, buf.String())
+	}
+
+	// Pooled buffers do not write partial output.
+	buf.Reset()
+	err = NewTofu(&registry).WithOptions(Options{PoolBuffers: true}).Render(&buf, "test.hello", nil)
+	if err == nil || buf.String() != "" {
+		t.Errorf("expected an error and no output, got %v and %q", err, buf.String())
+	}
+
+	// Detailed errors include the source.
+	err = NewTofu(&registry).WithOptions(Options{DetailedErrors: true}).Render(&buf, "test.hello", nil)
+	if err == nil || !strings.Contains(err.Error(), "4 |   Hello {$name}!") {
+		t.Errorf("expected an excerpt of the source, got %v", err)
+	}
+
+	// Lenient data prints nothing.
+	var tofu = NewTofu(&registry).WithOptions(Options{
+		LenientData:    true,
+		PoolBuffers:    true,
+		CacheTemplates: true,
+	})
+	for i := 0; i < 2; i++ {
+		buf.Reset()
+		if err = tofu.Render(&buf, "test.hello", nil); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != "Hello !" {
+			t.Errorf("expected %q, got %q", "Hello !", buf.String())
+		}
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	defer func(sortMapKeys func([]string)) { SortMapKeys = sortMapKeys }(SortMapKeys)
+	SortMapKeys = nil
+
+	var tofu = newTestTofu(t, `{namespace test}
+/** @param m */
+{template .random}
+  {for $i in range(20)}{randomInt(1000)},{/for}
+  {foreach $k in $m}{$k}{/foreach}
+  {foreach $k in keys($m)}{$k}{/foreach}
+{/template}`).WithOptions(Options{Deterministic: true})
+	var m = map[string]int{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5, "f": 6, "g": 7, "h": 8}
+
+	var first string
+	for i := 0; i < 5; i++ {
+		var buf bytes.Buffer
+		if err := tofu.Render(&buf, "test.random", map[string]interface{}{"m": m}); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(buf.String(), "abcdefghabcdefgh") {
+			t.Errorf("expected sorted keys, got %q", buf.String())
+		}
+		if i == 0 {
+			first = buf.String()
+		} else if buf.String() != first {
+			t.Errorf("expected the same output for each render, got %q and %q", first, buf.String())
+		}
+	}
+}
+
+const scopesTemplate = `{namespace test}
+/** @param items @param user */
+{template .page}
+  {let $title: 'Items' /}
+  {foreach $item in $items}
+    {call .item data="all"}{param item: $item /}{param index: index($item) /}{param title: $title /}{/call}
+  {/foreach}
+  {call .user data="$user"}{param title: $title /}{/call}
+  {call .user}{param name: 'anonymous' /}{param title: $title /}{/call}
+{/template}
+
+/** @param item @param index @param title */
+{template .item}
+  {let $label}{$title} {$index}{/let}
+  {for $i in range(2)}[{$label}.{$i}: {$item}]{/for}
+{/template}
+
+/** @param name @param title */
+{template .user}
+  {let $greeting: 'Hello ' + $name /}
+  ({$title}: {$greeting})
+{/template}`
+
+func TestPoolScopes(t *testing.T) {
+	var expected = "[Items 0.0: a][Items 0.1: a][Items 1.0: b][Items 1.1: b]" +
+		"(Items: Hello bob)(Items: Hello anonymous)"
+	var tofu = newTestTofu(t, scopesTemplate).WithOptions(Options{PoolScopes: true})
+	var user = data.Map{"name": data.String("bob")}
+	var obj = data.Map{"items": data.New([]string{"a", "b"}), "user": user}
+	for i := 0; i < 3; i++ {
+		var buf bytes.Buffer
+		if err := tofu.Render(&buf, "test.page", obj); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != expected {
+			t.Errorf("expected %q, got %q", expected, buf.String())
+		}
+	}
+
+	// The data passed in is not modified.
+	if len(obj) != 2 || len(user) != 1 {
+		t.Errorf("expected the data to be unmodified, got %v", obj)
+	}
+}
+
+func BenchmarkPoolScopes(b *testing.B) {
+	var items = make([]string, 100)
+	for i := range items {
+		items[i] = "item"
+	}
+	var obj = data.New(map[string]interface{}{
+		"items": items,
+		"user":  map[string]interface{}{"name": "bob"},
+	}).(data.Map)
+	for _, pool := range []bool{false, true} {
+		var tofu = newTestTofu(b, scopesTemplate).WithOptions(Options{PoolScopes: pool})
+		b.Run(fmt.Sprint("pool=", pool), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := tofu.Render(io.Discard, "test.page", obj); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package soyhtml
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+
+	"github.com/robfig/soy/errortypes"
+)
+
+// RenderError is returned when rendering panics, e.g. in a custom function, a
+// print directive, or the conversion of data.  The panic is isolated to the
+// render that caused it, and is reported along with the stack at the time.
+// It is also returned for the error of a function created by ErrFunc, which is
+// then its Panic value, and which it wraps.
+//
+// Errors returned from Execute may be identified as a RenderError with
+// errors.As.  It is also an errortypes.ErrFilePos identified as
+// errortypes.ErrRender.
+type RenderError struct {
+	Template string      // fully-qualified name of the template being rendered
+	Panic    interface{} // the value passed to panic
+	Stack    []byte      // the stack of the goroutine that panicked
+
+	// Calls is the template call stack at the time of the panic, from the
+	// rendered template to the node that panicked, e.g. to identify the team
+	// that owns the templates involved.  It is empty if the panic was outside
+	// of any template.
+	Calls []Frame
+
+	err error // the message and position, if known
+}
+
+// Frame is a template in the call stack of a render, and the position of the
+// node that it was executing: a call, or the node that panicked.
+type Frame struct {
+	Template string // fully-qualified template name
+	File     string
+	Line     int
+	Col      int
+}
+
+func (f Frame) String() string {
+	return fmt.Sprintf("%s (%s:%d:%d)", f.Template, f.File, f.Line, f.Col)
+}
+
+// CallStack formats the template call stack, one frame per line, starting
+// with the template that panicked.
+func (e *RenderError) CallStack() string {
+	var lines = make([]string, len(e.Calls))
+	for i, frame := range e.Calls {
+		lines[len(lines)-1-i] = frame.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *RenderError) Error() string { return e.err.Error() }
+func (e *RenderError) Unwrap() error { return e.err }
+
+// File returns the name of the file containing the template that panicked, or
+// the empty string if it is not known.
+func (e *RenderError) File() string {
+	if pos := errortypes.ToErrFilePos(e.err); pos != nil {
+		return pos.File()
+	}
+	return ""
+}
+
+// Line returns the line number of the node being rendered, or 0 if it is not
+// known.
+func (e *RenderError) Line() int {
+	if pos := errortypes.ToErrFilePos(e.err); pos != nil {
+		return pos.Line()
+	}
+	return 0
+}
+
+// Col returns the column number of the node being rendered, or 0 if it is not
+// known.
+func (e *RenderError) Col() int {
+	if pos := errortypes.ToErrFilePos(e.err); pos != nil {
+		return pos.Col()
+	}
+	return 0
+}
+
+// newRenderError returns a RenderError for a panic outside of any template,
+// e.g. while converting the data passed to Render.  It must be called from the
+// deferred function that recovered, so that the stack is that of the panic.
+func newRenderError(name string, e interface{}) *RenderError {
+	return &RenderError{name, e, debug.Stack(), nil,
+		errortypes.Wrap(fmt.Errorf("template %s: %v", name, e), errortypes.ErrRender)}
+}
+
+// recoverRender converts a panic that escaped the templates, e.g. from a filter
+// or the writer, into a RenderError.
+func recoverRender(name string, errp *error) {
+	if e := recover(); e != nil {
+		*errp = newRenderError(name, e)
+	}
+}
+
+// recoverError converts a value recovered from a panic while rendering into an
+// error.  Errors raised by the renderer itself, and RenderErrors from called
+// templates, are returned as they are; anything else is a new RenderError for
+// the current node.  It must be called from the deferred function that
+// recovered, so that the stack is that of the panic.
+func (s *state) recoverError(e interface{}) (err error, isNew bool) {
+	if err, ok := e.(error); ok {
+		var pos errortypes.ErrFilePos
+		if errors.As(err, &pos) {
+			return err, false
+		}
+		return s.renderError(e, "%w", err), true
+	}
+	return s.renderError(e, "%v", e), true
+}
+
+// panicf terminates processing with a RenderError for the recovered value e,
+// described by the given message.
+func (s *state) panicf(e interface{}, format string, args ...interface{}) {
+	panic(s.renderError(e, format, args...))
+}
+
+// renderError returns a RenderError at the current node for the recovered
+// value e.
+func (s *state) renderError(e interface{}, format string, args ...interface{}) *RenderError {
+	format = fmt.Sprintf("%s: %s", s.callAnnotation(), format)
+	var name string
+	var calls []Frame
+	if s.tmpl.Node != nil {
+		name = s.tmpl.Node.Name
+		calls = []Frame{s.frame()}
+	}
+	return &RenderError{
+		name,
+		e,
+		debug.Stack(),
+		calls,
+		errortypes.Wrap(s.errFromNode(format, args...), errortypes.ErrRender),
+	}
+}
+
+// frame returns the current template and node as a frame of the call stack.
+func (s *state) frame() Frame {
+	var name = s.tmpl.Node.Name
+	return Frame{
+		name,
+		s.registry.Filename(name),
+		s.registry.LineNumber(name, s.node),
+		s.registry.ColNumber(name, s.node),
+	}
+}
+
+// addCaller adds the current template, which called the template that
+// panicked, to the call stack of the given error if it is a RenderError.
+func (s *state) addCaller(err error) {
+	var rerr *RenderError
+	if s.tmpl.Node != nil && errors.As(err, &rerr) && len(rerr.Calls) > 0 {
+		rerr.Calls = append([]Frame{s.frame()}, rerr.Calls...)
+	}
+}
@@ -0,0 +1,128 @@
+package soyhtml
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/errortypes"
+)
+
+func TestRenderError(t *testing.T) {
+	var tofu = newTestTofu(t, `{namespace test}
+{template .boom}{boom()}{/template}
+{template .index}{index()}{/template}
+{template .truncate}{'abc'|truncate:'x'}{/template}
+{template .caller}
+  {call .boom /}
+{/template}`).WithFuncs(map[string]Func{
+		"boom":  {func([]data.Value) data.Value { panic("boom") }, []int{0}},
+		"index": {func(args []data.Value) data.Value { return args[0] }, []int{0}},
+	})
+
+	var tests = []struct {
+		name     string
+		template string // template that panicked
+		panic    string
+		line     int
+	}{
+		{"test.boom", "test.boom", "boom", 2},
+		{"test.index", "test.index", "index out of range", 3},
+		{"test.truncate", "test.truncate", "is not an integer", 4},
+		{"test.caller", "test.boom", "boom", 2},
+	}
+	for _, test := range tests {
+		var err = tofu.Render(&bytes.Buffer{}, test.name, nil)
+		var rerr *RenderError
+		if !errors.As(err, &rerr) {
+			t.Errorf("%v: expected a RenderError, got %v", test.name, err)
+			continue
+		}
+		if rerr.Template != test.template || !strings.Contains(fmt.Sprint(rerr.Panic), test.panic) {
+			t.Errorf("%v: expected a panic %q in %v, got %q in %v",
+				test.name, test.panic, test.template, rerr.Panic, rerr.Template)
+		}
+		if rerr.Line() != test.line {
+			t.Errorf("%v: expected line %d, got %d", test.name, test.line, rerr.Line())
+		}
+		if !bytes.Contains(rerr.Stack, []byte("goroutine")) {
+			t.Errorf("%v: expected a stack, got %s", test.name, rerr.Stack)
+		}
+		if !errors.Is(err, errortypes.ErrRender) {
+			t.Errorf("%v: expected ErrRender, got %v", test.name, err)
+		}
+	}
+}
+
+func TestRenderErrorCalls(t *testing.T) {
+	var tofu = newTestTofu(t, `{namespace test}
+{template .page}
+  <div>{call .list /}</div>
+{/template}
+{template .list}
+  {foreach $i in range(2)}
+    {call .item}{param i: $i /}{/call}
+  {/foreach}
+{/template}
+/** @param i */
+{template .item}
+  {if $i == 1}{boom()}{/if}
+{/template}`).WithFuncs(map[string]Func{
+		"boom": {func([]data.Value) data.Value { panic("boom") }, []int{0}},
+	})
+
+	var err = tofu.Render(&bytes.Buffer{}, "test.page", nil)
+	var rerr *RenderError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected a RenderError, got %v", err)
+	}
+	var expected = []Frame{
+		{"test.page", "test.soy", 3, 14},
+		{"test.list", "test.soy", 7, 11},
+		{"test.item", "test.soy", 12, 21},
+	}
+	if !reflect.DeepEqual(rerr.Calls, expected) {
+		t.Errorf("expected calls\n%v\ngot\n%v", expected, rerr.Calls)
+	}
+	var stack = "test.item (test.soy:12:21)\ntest.list (test.soy:7:11)\ntest.page (test.soy:3:14)"
+	if rerr.CallStack() != stack {
+		t.Errorf("expected call stack\n%s\ngot\n%s", stack, rerr.CallStack())
+	}
+}
+
+func TestRenderErrorData(t *testing.T) {
+	var tofu = newTestTofu(t, `{namespace test}
+{template .page}{/template}`)
+	var err = tofu.Render(&bytes.Buffer{}, "test.page", json.RawMessage("{"))
+	var rerr *RenderError
+	if !errors.As(err, &rerr) || rerr.Template != "test.page" {
+		t.Errorf("expected a RenderError, got %v", err)
+	}
+}
+
+type panicWriter struct{}
+
+func (panicWriter) Write([]byte) (int, error) { panic("write") }
+
+func TestRenderErrorPoolBuffers(t *testing.T) {
+	var tofu = newTestTofu(t, `{namespace test}
+{template .page}hello{/template}`).WithOptions(Options{PoolBuffers: true})
+	var err = tofu.NewRenderer("test.page").Execute(panicWriter{}, nil)
+	var rerr *RenderError
+	if !errors.As(err, &rerr) || rerr.Panic != "write" {
+		t.Fatalf("expected a RenderError, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err = tofu.NewRenderer("test.page").Execute(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "hello" {
+		t.Errorf("expected %q, got %q", "hello", buf.String())
+	}
+}
@@ -0,0 +1,121 @@
+package soyhtml
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/robfig/soy/data"
+)
+
+// Preloads collects the assets that a render refers to with assetUrl(), so that
+// the server may ask the browser to fetch them early with Link headers (or a
+// 103 Early Hints response) before sending the page:
+//
+//	<link rel="stylesheet" href="{assetUrl('/css/site.css')}">
+//	<img src="{assetUrl($hero.url, 'image')}">
+//
+// assetUrl returns its URL unchanged, and, in the generated javascript, has no
+// other effect.
+//
+// Only the URLs passed to assetUrl() are collected, not every URL that the
+// render prints: most of those (e.g. the href of a link to another page) are
+// not subresources of the page, and preloading them would waste bandwidth.
+type Preloads struct {
+	Assets []Asset // in order of first use, without duplicates
+}
+
+// Asset is a URL used by a render, with the type of content that it refers
+// to, as given to assetUrl() or guessed from the extension of its path.
+type Asset struct {
+	URL string
+	As  string // the "as" of the preload, e.g. "style", or "" if unknown
+}
+
+// CollectPreloads records the assets printed by assetUrl() during the render
+// into the given Preloads, replacing its contents.  Assets within fragments
+// served from a FragmentStore are not recorded, since they are not rendered.
+func (r *Renderer) CollectPreloads(p *Preloads) *Renderer {
+	r.preloads = p
+	return r
+}
+
+// LinkHeader returns the value of a Link header that preloads the assets, or
+// "" if there are none.  Assets of an unknown type are omitted, since browsers
+// ignore preloads without an "as".  Characters of the URLs that would end a
+// link or the header (e.g. ">", ";", ",", and newlines) are percent-encoded.
+func (p *Preloads) LinkHeader() string {
+	var links []string
+	for _, asset := range p.Assets {
+		if asset.As == "" {
+			continue
+		}
+		var link = "<" + linkURL(asset.URL) + ">; rel=preload; as=" + asset.As
+		if asset.As == "font" {
+			link += "; crossorigin" // fonts are always fetched in CORS mode
+		}
+		links = append(links, link)
+	}
+	return strings.Join(links, ", ")
+}
+
+// linkURL percent-encodes the characters of the given URL that may not appear
+// within the <> of a Link header, or that separate its parameters and links.
+func linkURL(u string) string {
+	var buf strings.Builder
+	for i := 0; i < len(u); i++ {
+		switch c := u[i]; {
+		case c <= ' ', c >= 0x7f, strings.IndexByte(`"<>;,`, c) != -1:
+			fmt.Fprintf(&buf, "%%%02X", c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+// add records the given asset, unless its URL was already recorded.
+func (p *Preloads) add(asset Asset) {
+	for _, a := range p.Assets {
+		if a.URL == asset.URL {
+			return
+		}
+	}
+	p.Assets = append(p.Assets, asset)
+}
+
+// preloadAs maps file extensions to the type of content they hold.
+var preloadAs = map[string]string{
+	".css":   "style",
+	".js":    "script",
+	".mjs":   "script",
+	".woff":  "font",
+	".woff2": "font",
+	".ttf":   "font",
+	".otf":   "font",
+	".png":   "image",
+	".jpg":   "image",
+	".jpeg":  "image",
+	".gif":   "image",
+	".svg":   "image",
+	".webp":  "image",
+	".avif":  "image",
+}
+
+// funcAssetUrl returns the given URL, recording it as an asset of the given
+// type (or that of its extension) if collecting preloads.
+func funcAssetUrl(p *Preloads, args []data.Value) data.Value {
+	var u = args[0].String()
+	if p == nil {
+		return data.String(u)
+	}
+	var as string
+	if len(args) > 1 {
+		as = args[1].String()
+	} else if parsed, err := url.Parse(u); err == nil {
+		as = preloadAs[strings.ToLower(path.Ext(parsed.Path))]
+	}
+	p.add(Asset{u, as})
+	return data.String(u)
+}
@@ -0,0 +1,69 @@
+package soyhtml
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/robfig/soy/data"
+)
+
+func TestPreloads(t *testing.T) {
+	var tofu = newTestTofu(t, `{namespace test}
+/** @param hero */
+{template .page}
+  <link rel="stylesheet" href="{assetUrl('/css/site.css')}">
+  <img src="{assetUrl($hero, 'image')}">
+  {call .footer /}
+{/template}
+
+{template .footer}
+  <script src="{assetUrl('/js/app.js?v=2')}"></script>
+  <link rel="stylesheet" href="{assetUrl('/css/site.css')}">
+  <a href="{assetUrl('/terms')}">Terms</a>
+  <link rel="preload" href="{assetUrl('/fonts/a.WOFF2')}">
+{/template}`)
+
+	var preloads = Preloads{Assets: []Asset{{"/stale", "style"}}}
+	var buf bytes.Buffer
+	var err = tofu.NewRenderer("test.page").
+		CollectPreloads(&preloads).
+		Execute(&buf, data.Map{"hero": data.String("/img/hero")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected = []Asset{
+		{"/css/site.css", "style"},
+		{"/img/hero", "image"},
+		{"/js/app.js?v=2", "script"},
+		{"/terms", ""},
+		{"/fonts/a.WOFF2", "font"},
+	}
+	if !reflect.DeepEqual(preloads.Assets, expected) {
+		t.Errorf("expected %v, got %v", expected, preloads.Assets)
+	}
+	var link = "</css/site.css>; rel=preload; as=style, </img/hero>; rel=preload; as=image, " +
+		"</js/app.js?v=2>; rel=preload; as=script, </fonts/a.WOFF2>; rel=preload; as=font; crossorigin"
+	if preloads.LinkHeader() != link {
+		t.Errorf("expected Link header\n%s\ngot\n%s", link, preloads.LinkHeader())
+	}
+
+	// Without collecting, assetUrl only returns the URL.
+	var plain bytes.Buffer
+	if err = tofu.NewRenderer("test.page").Execute(&plain, data.Map{"hero": data.String("/img/hero")}); err != nil {
+		t.Fatal(err)
+	}
+	if plain.String() != buf.String() {
+		t.Errorf("expected the same output, got\n%s\nand\n%s", buf.String(), plain.String())
+	}
+	if (&Preloads{}).LinkHeader() != "" {
+		t.Errorf("expected an empty Link header")
+	}
+
+	// Characters that would end the link or the header are percent-encoded.
+	var unsafe = Preloads{Assets: []Asset{{"/a>;b,c d\r\nX: y.css", "style"}}}
+	if link = unsafe.LinkHeader(); link != "</a%3E%3Bb%2Cc%20d%0D%0AX:%20y.css>; rel=preload; as=style" {
+		t.Errorf("unexpected Link header %s", link)
+	}
+}
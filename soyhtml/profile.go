@@ -0,0 +1,168 @@
+package soyhtml
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/soy/ast"
+	soyt "github.com/robfig/soy/template"
+)
+
+// Profiler measures the time spent executing each print tag and call while
+// rendering.  Like an AccessRecorder, it is intended to be attached to
+// renderers in production for a sample of requests, so that the report may be
+// used to find the most expensive parts of templates, e.g. to decide which to
+// cache or optimize first.
+//
+// A Profiler is safe for concurrent use by multiple renderers.
+type Profiler struct {
+	sampleRate int
+
+	mu    sync.Mutex
+	seen  int
+	nodes map[ast.Node]*NodeProfile
+}
+
+// NodeProfile summarizes the executions of a single print tag or call across
+// the sampled renders.
+type NodeProfile struct {
+	Template string        // fully-qualified name of the template containing the node
+	Line     int           // line number of the node
+	Node     string        // the node, e.g. "{$user.name}" or "{call .footer}"
+	Count    int           // number of executions
+	Total    time.Duration // total time of the executions, including called templates
+}
+
+// NewProfiler returns a profiler that samples one out of every sampleRate
+// renders.  A sampleRate of 1 or less profiles every render.
+func NewProfiler(sampleRate int) *Profiler {
+	return &Profiler{
+		sampleRate: sampleRate,
+		nodes:      make(map[ast.Node]*NodeProfile),
+	}
+}
+
+// sample returns true if the next render should be profiled.
+func (p *Profiler) sample() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seen++
+	return p.sampleRate <= 1 || p.seen%p.sampleRate == 0
+}
+
+// merge adds the executions from a single render to the totals.
+func (p *Profiler) merge(log *profileLog, registry *soyt.Registry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for node, entry := range log.nodes {
+		var np, ok = p.nodes[node]
+		if !ok {
+			np = &NodeProfile{
+				Template: entry.tmpl,
+				Line:     registry.LineNumber(entry.tmpl, node),
+				Node:     profileNodeString(node),
+			}
+			p.nodes[node] = np
+		}
+		np.Count += entry.count
+		np.Total += entry.total
+	}
+}
+
+// Report returns the n print tags and calls with the greatest total time,
+// most expensive first.  If n is 0 or less, all of them are returned.
+func (p *Profiler) Report(n int) []NodeProfile {
+	p.mu.Lock()
+	var report = make([]NodeProfile, 0, len(p.nodes))
+	for _, np := range p.nodes {
+		report = append(report, *np)
+	}
+	p.mu.Unlock()
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Total != report[j].Total {
+			return report[i].Total > report[j].Total
+		}
+		if report[i].Template != report[j].Template {
+			return report[i].Template < report[j].Template
+		}
+		return report[i].Line < report[j].Line
+	})
+	if n > 0 && n < len(report) {
+		report = report[:n]
+	}
+	return report
+}
+
+// WriteReport writes the report of the n most expensive print tags and calls
+// in a human-readable form to the given writer.
+func (p *Profiler) WriteReport(wr io.Writer, n int) error {
+	for _, np := range p.Report(n) {
+		var _, err = fmt.Fprintf(wr, "%v\t%d\t%s:%d\t%s\n",
+			np.Total, np.Count, np.Template, np.Line, np.Node)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxProfileNode is the length above which nodes are abbreviated in reports.
+const maxProfileNode = 60
+
+// profileNodeString returns the node as shown in reports.  Calls are shown
+// without their params.
+func profileNodeString(node ast.Node) string {
+	var str string
+	if call, ok := node.(*ast.CallNode); ok {
+		str = "{call " + call.Name + "}"
+	} else {
+		str = node.String()
+	}
+	if len(str) > maxProfileNode {
+		str = str[:maxProfileNode-3] + "..."
+	}
+	return str
+}
+
+// profileLog records the executions of print tags and calls during a single
+// render.
+type profileLog struct {
+	nodes map[ast.Node]*profileEntry
+}
+
+// profileEntry accumulates the executions of a single node.
+type profileEntry struct {
+	tmpl  string
+	count int
+	total time.Duration
+}
+
+func newProfileLog() *profileLog {
+	return &profileLog{make(map[ast.Node]*profileEntry)}
+}
+
+// begin returns the start time of a node's execution, if profiling.
+func (l *profileLog) begin() time.Time {
+	if l == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// end records the execution of the given node in the given template, which
+// began at the given time, if profiling.
+func (l *profileLog) end(tmpl soyt.Template, node ast.Node, began time.Time) {
+	if l == nil {
+		return
+	}
+	var entry, ok = l.nodes[node]
+	if !ok {
+		entry = &profileEntry{tmpl: tmpl.Node.Name}
+		l.nodes[node] = entry
+	}
+	entry.count++
+	entry.total += time.Since(began)
+}
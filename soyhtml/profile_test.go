@@ -0,0 +1,73 @@
+package soyhtml
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/robfig/soy/data"
+)
+
+func TestProfiler(t *testing.T) {
+	var tofu = newTestTofu(t, `{namespace test}
+/** @param items */
+{template .page}
+  {foreach $item in $items}
+    {call .item}{param item: $item /}{/call}
+  {/foreach}
+  {length($items)}
+{/template}
+
+/** @param item */
+{template .item}
+  {$item}
+{/template}`)
+
+	var prof = NewProfiler(2)
+	var obj = data.Map{"items": data.New([]string{"a", "b", "c"})}
+	for i := 0; i < 4; i++ {
+		var err = tofu.NewRenderer("test.page").Profile(prof).Execute(ioutil.Discard, obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Two of the four renders are sampled.
+	var report = prof.Report(0)
+	var expected = []NodeProfile{
+		{"test.page", 5, "{call test.item}", 6, 0},
+		{"test.item", 12, "{$item}", 6, 0},
+		{"test.page", 7, "{length($items)}", 2, 0},
+	}
+	if len(report) != len(expected) {
+		t.Fatalf("expected %d nodes, got %v", len(expected), report)
+	}
+	var byNode = make(map[string]NodeProfile)
+	for _, np := range report {
+		byNode[np.Node] = np
+	}
+	for _, exp := range expected {
+		var np, ok = byNode[exp.Node]
+		if !ok || np.Template != exp.Template || np.Line != exp.Line || np.Count != exp.Count {
+			t.Errorf("expected %v, got %v", exp, np)
+		}
+	}
+
+	// Calls include the time of the called template.
+	if byNode["{call test.item}"].Total < byNode["{$item}"].Total {
+		t.Errorf("expected the call to include the called template, got %v", report)
+	}
+	if len(prof.Report(1)) != 1 {
+		t.Errorf("expected the report to be limited to 1 node")
+	}
+
+	var buf bytes.Buffer
+	if err := prof.WriteReport(&buf, 2); err != nil {
+		t.Fatal(err)
+	}
+	var lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(buf.String(), "\t6\ttest.page:5\t{call test.item}\n") {
+		t.Errorf("unexpected report:\n%s", buf.String())
+	}
+}
@@ -2,15 +2,22 @@
 package soyhtml
 
 import (
+	"context"
 	"errors"
 	"io"
+	"sort"
+	"time"
 
 	"github.com/robfig/soy/ast"
 	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/errortypes"
 	"github.com/robfig/soy/soymsg"
 )
 
-var ErrTemplateNotFound = errors.New("template not found")
+// ErrTemplateNotFound is returned when rendering a template that does not
+// exist.  Errors returned from Execute may also be identified as it, or as the
+// other errortypes kinds, with errors.Is.
+var ErrTemplateNotFound = errortypes.ErrTemplateNotFound
 
 // Renderer provides parameters to template execution.
 // At minimum, Registry and Template are required to render a template..
@@ -19,6 +26,21 @@ type Renderer struct {
 	name string   // fully-qualified name of the template to render
 	ij   data.Map // data for the $ij map
 	msgs soymsg.Bundle
+	opts Options
+
+	access   *AccessRecorder // records data paths read, if non-nil
+	profiler *Profiler       // profiles the executions of nodes, if non-nil
+
+	filters  []Filter
+	fallback bool  // true if rendering a template resolved by a Fallback
+	clock    Clock // provides the time of the render, if non-nil
+
+	fragments *fragments // calls to render as fragments, if non-nil
+	includes  includes   // how to render fragment="true" calls
+	sourceMap *SourceMap // records the source map of the output, if non-nil
+	preloads  *Preloads  // collects the assets used, if non-nil
+
+	ctx context.Context // the context of the render, given to the Tracer
 }
 
 // Inject sets the given data map as the $ij injected data.
@@ -33,6 +55,28 @@ func (r *Renderer) WithMessages(bundle soymsg.Bundle) *Renderer {
 	return r
 }
 
+// RecordAccess records the data paths read by templates during execution to
+// the given recorder, subject to its sample rate.
+func (r *Renderer) RecordAccess(rec *AccessRecorder) *Renderer {
+	r.access = rec
+	return r
+}
+
+// Profile measures the time spent executing print tags and calls to the given
+// profiler, subject to its sample rate.
+func (r *Renderer) Profile(p *Profiler) *Renderer {
+	r.profiler = p
+	return r
+}
+
+// isNotFound returns true if the error of a template lookup is that the
+// template does not exist, rather than that it failed to load, which may be
+// because a template that it calls does not exist.
+func isNotFound(err error) bool {
+	return errors.Is(err, ErrTemplateNotFound) &&
+		!errors.Is(err, errortypes.ErrParse) && !errors.Is(err, errortypes.ErrType)
+}
+
 // Execute applies a parsed template to the specified data object,
 // and writes the output to wr.
 func (t Renderer) Execute(wr io.Writer, obj data.Map) (err error) {
@@ -43,18 +87,85 @@ func (t Renderer) Execute(wr io.Writer, obj data.Map) (err error) {
 		return errors.New("Template name required")
 	}
 
-	var tmpl, ok = t.tofu.registry.Template(t.name)
-	if !ok {
+	var tmpl, lookupErr = t.tofu.template(t.name)
+	if isNotFound(lookupErr) {
+		if t.tofu.fallback != nil && !t.fallback {
+			if tofu, name, ok := t.tofu.fallback(t.name); ok && tofu != nil {
+				t.tofu, t.name, t.fallback = tofu, name, true
+				return t.Execute(wr, obj)
+			}
+		}
 		return ErrTemplateNotFound
 	}
+	if lookupErr != nil {
+		return lookupErr
+	}
+	var ctx = t.ctx
+	if t.tofu.tracer != nil {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		var end func(error)
+		ctx, end = t.tofu.tracer.StartTemplate(ctx, t.name)
+		defer func() { end(err) }()
+	}
+	defer recoverRender(t.name, &err)
+	if t.opts.DetailedErrors {
+		defer func() {
+			if err != nil {
+				err = withExcerpt(t.tofu.registry, err)
+			}
+		}()
+	}
+	if t.opts.PoolBuffers {
+		var buf, out = getBuffer(), wr
+		defer func() {
+			if e := recover(); e != nil {
+				panic(e) // drop the buffer, since it may still be in use
+			}
+			if err == nil {
+				_, err = out.Write(buf.Bytes())
+			}
+			if err == nil {
+				putBuffer(buf)
+			}
+		}()
+		wr = buf
+	}
+	if len(t.filters) > 0 {
+		var closers []io.WriteCloser
+		wr, closers = t.filter(wr, tmpl.Node.Kind)
+		defer func() {
+			for _, c := range closers {
+				if cerr := c.Close(); err == nil {
+					err = cerr
+				}
+			}
+		}()
+	}
+
+	var mapper *sourceMapper
+	if t.sourceMap != nil {
+		mapper = &sourceMapper{t.sourceMap, &countingWriter{wr, 0}}
+		t.sourceMap.Segments = nil
+		wr = mapper.wr
+	}
+	if t.preloads != nil {
+		t.preloads.Assets = nil
+	}
 
 	var autoescapeMode = tmpl.Namespace.Autoescape
 	if autoescapeMode == ast.AutoescapeUnspecified {
 		autoescapeMode = ast.AutoescapeOn
 	}
 
+	var arena *frameArena
+	if t.opts.PoolScopes {
+		arena = arenaPool.Get().(*frameArena)
+		defer arenaPool.Put(arena)
+	}
 	var initialScope = newScope(obj)
-	initialScope.enter()
+	initialScope.enter(arena)
 
 	state := &state{
 		tmpl:       tmpl,
@@ -65,8 +176,48 @@ func (t Renderer) Execute(wr io.Writer, obj data.Map) (err error) {
 		context:    initialScope,
 		ij:         t.ij,
 		msgs:       t.msgs,
+		lenient:    t.opts.LenientData,
+		funcs:      t.tofu.funcs,
+		fragments:  t.fragments,
+		includes:   &t.includes,
+		sourceMap:  mapper,
+		arena:      arena,
+		preloads:   t.preloads,
+		ctx:        ctx,
+		tracer:     t.tofu.tracer,
+
+		ignoreBudgets: t.opts.Deterministic,
+	}
+	switch {
+	case t.clock != nil:
+		state.now = t.clock.Now()
+	case t.opts.Deterministic:
+		state.now = deterministicTime
+	default:
+		state.now = time.Now()
+	}
+	if t.tofu.memo != nil {
+		state.memo = &memo{t.tofu.memo, make(map[string]data.Value)}
+	}
+	if t.opts.Deterministic {
+		state.funcs = deterministicFuncs(state.funcs)
+		state.sortKeys = sort.Strings
+	}
+	if t.access != nil && t.access.sample() {
+		state.access = newAccessLog()
+		defer t.access.merge(state.access)
+	}
+	if t.profiler != nil && t.profiler.sample() {
+		state.profile = newProfileLog()
+		defer t.profiler.merge(state.profile, t.tofu.registry)
 	}
+	defer func() {
+		if _, ok := err.(*RenderError); !ok {
+			err = errortypes.Wrap(err, errortypes.ErrRender)
+		}
+	}()
 	defer state.errRecover(&err)
 	state.walk(tmpl.Node)
+	state.context.release(arena, 1)
 	return
 }
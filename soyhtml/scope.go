@@ -1,6 +1,10 @@
 package soyhtml
 
-import "github.com/robfig/soy/data"
+import (
+	"sync"
+
+	"github.com/robfig/soy/data"
+)
 
 // scope handles variable assignment and lookup within a template.
 // it is a stack of data maps, each of which corresponds to variable scope.
@@ -17,16 +21,25 @@ func newScope(m data.Map) scope {
 	return scope{{m, false}}
 }
 
-// push creates a new scope
-func (s *scope) push() {
-	*s = append(*s, scopeframe{make(data.Map), false})
+// push creates a new scope, using a map from the given arena if non-nil.
+func (s *scope) push(a *frameArena) {
+	*s = append(*s, scopeframe{a.get(), false})
 }
 
-// pop discards the last scope pushed.
-func (s *scope) pop() {
+// pop discards the last scope pushed, returning its map to the given arena.
+func (s *scope) pop(a *frameArena) {
+	a.put((*s)[len(*s)-1].vars)
 	*s = (*s)[:len(*s)-1]
 }
 
+// release returns the maps of the frames from the given index on to the
+// arena, once the scope is no longer used.
+func (s scope) release(a *frameArena, from int) {
+	for _, frame := range s[from:] {
+		a.put(frame.vars)
+	}
+}
+
 // set adds a new binding to the deepest scope
 func (s scope) set(k string, v data.Value) {
 	s[len(s)-1].vars[k] = v
@@ -54,9 +67,55 @@ func (s scope) alldata() scope {
 	panic("impossible")
 }
 
+// flatten returns a map of all the bindings visible in the scope.
+func (s scope) flatten() data.Map {
+	var m = make(data.Map)
+	for _, frame := range s {
+		for k, v := range frame.vars {
+			m[k] = v
+		}
+	}
+	return m
+}
+
 // enter records that this is the frame where we enter a template.
 // only the frames up to here will be passed in the next data="all"
-func (s *scope) enter() {
+func (s *scope) enter(a *frameArena) {
 	(*s)[len(*s)-1].entered = true
-	s.push()
+	s.push(a)
+}
+
+// maxArenaFrames is the number of free maps above which maps are not kept by
+// an arena, so that an occasional deeply nested render does not pin memory.
+const maxArenaFrames = 256
+
+// frameArena holds the maps of frames that have been popped, so that they may
+// be reused by later frames of the render and, via arenaPool, of later
+// renders.  A nil arena allocates and discards maps instead.
+type frameArena struct {
+	free []data.Map
+}
+
+var arenaPool = sync.Pool{
+	New: func() interface{} { return new(frameArena) },
+}
+
+// get returns an empty map.
+func (a *frameArena) get() data.Map {
+	if a == nil || len(a.free) == 0 {
+		return make(data.Map)
+	}
+	var m = a.free[len(a.free)-1]
+	a.free = a.free[:len(a.free)-1]
+	return m
+}
+
+// put clears the given map, which must no longer be used, and keeps it for
+// reuse.
+func (a *frameArena) put(m data.Map) {
+	if a == nil || len(a.free) == maxArenaFrames {
+		return
+	}
+	clear(m)
+	a.free = append(a.free, m)
 }
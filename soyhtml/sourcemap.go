@@ -0,0 +1,93 @@
+package soyhtml
+
+import (
+	"io"
+	"sort"
+
+	"github.com/robfig/soy/ast"
+)
+
+// SourceMap maps ranges of the output of a render to the positions in the
+// templates that produced them, e.g. for a developer tool that shows the
+// template line that produced an element of the page.
+type SourceMap struct {
+	Segments []Segment `json:"segments"` // in order of output, not overlapping
+}
+
+// Segment is a range of output produced by a single template node: raw text, a
+// print tag, or the text of a message.  Its position is the one that would be
+// reported for an error at the node.
+type Segment struct {
+	Start    int    `json:"start"` // byte offset of the start of the range
+	End      int    `json:"end"`   // byte offset just past the end of the range
+	Template string `json:"template"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Col      int    `json:"col"`
+}
+
+// Lookup returns the segment containing the given byte offset of the output.
+func (m *SourceMap) Lookup(offset int) (Segment, bool) {
+	var i = sort.Search(len(m.Segments), func(i int) bool {
+		return m.Segments[i].End > offset
+	})
+	if i < len(m.Segments) && m.Segments[i].Start <= offset {
+		return m.Segments[i], true
+	}
+	return Segment{}, false
+}
+
+// WithSourceMap records a mapping from the output of the render to the
+// template positions that produced it into the given source map, replacing
+// its contents.  The offsets are of the output of the templates, before it is
+// transformed by any filters.  Recording the map slows rendering, so it is
+// intended for development.
+func (r *Renderer) WithSourceMap(m *SourceMap) *Renderer {
+	r.sourceMap = m
+	return r
+}
+
+// sourceMapper records the source map of a render.
+type sourceMapper struct {
+	m  *SourceMap
+	wr *countingWriter // the output of the render
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	io.Writer
+	n int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	var n, err = w.Writer.Write(p)
+	w.n += n
+	return n, err
+}
+
+// outputOffset returns the number of bytes written to the output so far, or -1
+// if no source map is being recorded or the current output is not the output
+// of the render (e.g. while rendering the content of a {let}).
+func (s *state) outputOffset() int {
+	if s.sourceMap == nil || s.wr != io.Writer(s.sourceMap.wr) {
+		return -1
+	}
+	return s.sourceMap.wr.n
+}
+
+// mapOutput records that the output written since the given offset (returned
+// by outputOffset) was produced by the given node.
+func (s *state) mapOutput(node ast.Node, start int) {
+	if start < 0 || s.sourceMap.wr.n == start {
+		return
+	}
+	var name = s.tmpl.Node.Name
+	s.sourceMap.m.Segments = append(s.sourceMap.m.Segments, Segment{
+		Start:    start,
+		End:      s.sourceMap.wr.n,
+		Template: name,
+		File:     s.registry.Filename(name),
+		Line:     s.registry.LineNumber(name, node),
+		Col:      s.registry.ColNumber(name, node),
+	})
+}
@@ -0,0 +1,56 @@
+package soyhtml
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/robfig/soy/data"
+)
+
+func TestSourceMap(t *testing.T) {
+	var tofu = newTestTofu(t, `{namespace test}
+/** @param name */
+{template .page}
+<h1>{$name}</h1>{let $x}ignored{/let}
+{call .footer /}
+{/template}
+
+{template .footer}<p>footer</p>{/template}`)
+
+	var buf bytes.Buffer
+	var m SourceMap
+	var err = tofu.NewRenderer("test.page").
+		WithSourceMap(&m).
+		Execute(&buf, data.Map{"name": data.String("Rob")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The positions are those reported in errors.
+	type segment struct {
+		text, template string
+		line           int
+	}
+	var expected = []segment{
+		{"<h1>", "test.page", 4},
+		{"Rob", "test.page", 4},
+		{"</h1>", "test.page", 4},
+		{"<p>footer</p>", "test.footer", 8},
+	}
+	if len(m.Segments) != len(expected) {
+		t.Fatalf("expected %d segments, got %+v", len(expected), m.Segments)
+	}
+	for i, seg := range m.Segments {
+		var actual = segment{buf.String()[seg.Start:seg.End], seg.Template, seg.Line}
+		if actual != expected[i] || seg.File != "test.soy" {
+			t.Errorf("segment %d: expected %+v, got %+v in %v", i, expected[i], actual, seg.File)
+		}
+	}
+
+	if seg, ok := m.Lookup(5); !ok || seg != m.Segments[1] {
+		t.Errorf("expected offset 5 to be in {$name}, got %+v", seg)
+	}
+	if _, ok := m.Lookup(buf.Len()); ok {
+		t.Errorf("expected no segment past the end of the output")
+	}
+}
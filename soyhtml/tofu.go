@@ -3,21 +3,64 @@ package soyhtml
 import (
 	"fmt"
 	"io"
+	"sync"
 
 	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/soymsg"
 	"github.com/robfig/soy/template"
 )
 
 // Tofu is a bundle of compiled soy, ready to render to HTML.
 type Tofu struct {
 	registry *template.Registry
+	opts     Options
+	cache    *sync.Map // template name => template.Template, if caching
+	funcs    map[string]Func
+	msgs     soymsg.Bundle
+	fallback Fallback
+	memo     map[string]*MemoStats // memoized function name => stats
+	tracer   Tracer
 }
 
+// Fallback resolves the name of a template that was not found to a template
+// to render instead: the template with the returned name in the returned Tofu,
+// which may be a different Tofu (e.g. a secondary bundle) or the same one (e.g.
+// to render a generic error template).  It returns false if there is no
+// replacement.
+type Fallback func(name string) (tofu *Tofu, replacement string, ok bool)
+
 // NewTofu returns a new instance that is ready to provide HTML rendering
 // services for the given templates, with the default functions and print
 // directives.
 func NewTofu(registry *template.Registry) *Tofu {
-	return &Tofu{registry}
+	return &Tofu{registry: registry}
+}
+
+// WithFuncs adds functions that are available to templates rendered by this
+// Tofu, in addition to (and taking precedence over) the global Funcs.
+func (tofu *Tofu) WithFuncs(funcs map[string]Func) *Tofu {
+	if tofu.funcs == nil {
+		tofu.funcs = make(map[string]Func, len(funcs))
+	}
+	for name, fn := range funcs {
+		tofu.funcs[name] = fn
+	}
+	return tofu
+}
+
+// WithMessages sets the message bundle used by renderers created by this Tofu,
+// unless overridden by Renderer.WithMessages.
+func (tofu *Tofu) WithMessages(bundle soymsg.Bundle) *Tofu {
+	tofu.msgs = bundle
+	return tofu
+}
+
+// WithFallback sets the function used to resolve templates that are rendered
+// but not found.  It applies to the template being rendered, not to templates
+// called by it, and it is not applied again to the replacement template.
+func (tofu *Tofu) WithFallback(fallback Fallback) *Tofu {
+	tofu.fallback = fallback
+	return tofu
 }
 
 // Render is a convenience function that executes the soy template of the given
@@ -28,12 +71,20 @@ func NewTofu(registry *template.Registry) *Tofu {
 // used. In particular, note that struct properties are converted to lowerCamel
 // by default, since that is the Soy naming convention. The caller may update
 // those options to change the behavior of this function.
-func (tofu Tofu) Render(wr io.Writer, name string, obj interface{}) error {
+func (tofu Tofu) Render(wr io.Writer, name string, obj interface{}) (err error) {
+	defer recoverRender(name, &err)
 	var m data.Map
 	if obj != nil {
-		var ok bool
-		m, ok = data.New(obj).(data.Map)
-		if !ok {
+		switch val := data.New(obj).(type) {
+		case data.Map:
+			m = val
+		case *data.OrderedMap:
+			m = val.Map
+		case *data.SyncMap:
+			m = val.Load()
+		case data.Null:
+			// e.g. a nil map or pointer to a struct
+		default:
 			return fmt.Errorf("invalid data type. expected map/struct, got %T", obj)
 		}
 	}
@@ -46,5 +97,7 @@ func (tofu *Tofu) NewRenderer(name string) *Renderer {
 	return &Renderer{
 		tofu: tofu,
 		name: name,
+		opts: tofu.opts,
+		msgs: tofu.msgs,
 	}
 }
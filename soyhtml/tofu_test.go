@@ -0,0 +1,105 @@
+package soyhtml
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/parse"
+	"github.com/robfig/soy/template"
+)
+
+func newTestTofu(t testing.TB, soy string) *Tofu {
+	var tree, err = parse.SoyFile("test.soy", soy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var registry = template.Registry{}
+	if err = registry.Add(tree); err != nil {
+		t.Fatal(err)
+	}
+	return NewTofu(&registry)
+}
+
+func TestFallback(t *testing.T) {
+	var (
+		secondary = newTestTofu(t, `{namespace legacy}
+{template .page}legacy page{/template}`)
+		primary = newTestTofu(t, `{namespace app}
+{template .page}app page{/template}
+/** @param name */
+{template .notFound}{$name} not found{/template}`)
+	)
+	primary.WithFallback(func(name string) (*Tofu, string, bool) {
+		if _, ok := secondary.registry.Template(name); ok {
+			return secondary, name, true
+		}
+		return primary, "app.notFound", true
+	})
+
+	var tests = []struct{ name, expected string }{
+		{"app.page", "app page"},
+		{"legacy.page", "legacy page"},
+		{"other.page", "Rob not found"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := primary.Render(&buf, test.name, map[string]string{"name": "Rob"}); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if buf.String() != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, buf.String())
+		}
+	}
+
+	// The fallback is not applied to its own result.
+	primary.WithFallback(func(name string) (*Tofu, string, bool) {
+		return primary, "app.missing", true
+	})
+	if err := primary.Render(&bytes.Buffer{}, "other.page", nil); err != ErrTemplateNotFound {
+		t.Errorf("expected ErrTemplateNotFound, got %v", err)
+	}
+}
+
+func TestRenderNilData(t *testing.T) {
+	var tofu = newTestTofu(t, `{namespace test}
+{template .page}page{/template}`)
+	type page struct{ Title string }
+	for _, obj := range []interface{}{nil, map[string]interface{}(nil), (*page)(nil)} {
+		var buf bytes.Buffer
+		if err := tofu.Render(&buf, "test.page", obj); err != nil || buf.String() != "page" {
+			t.Errorf("%#v: expected %q, got %q and %v", obj, "page", buf.String(), err)
+		}
+	}
+}
+
+func TestRenderSyncMap(t *testing.T) {
+	var tofu = newTestTofu(t, `{namespace test}
+{template .flags}
+  {let $flags: $ij.flags /}
+  {foreach $k in keys($flags)}{$k}={$flags[$k]} {/foreach}
+  {if $flags.beta}beta{/if}
+{/template}`)
+	var flags = data.NewSyncMap(data.Map{"beta": data.Bool(true)})
+
+	var done = make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			flags.Set("beta", data.NewBool(i%2 == 0))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		var buf bytes.Buffer
+		var err = tofu.NewRenderer("test.flags").
+			Inject(data.Map{"flags": flags}).
+			Execute(&buf, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out := buf.String(); out != "beta=true beta" && out != "beta=false " {
+			t.Errorf("unexpected output %q", out)
+		}
+	}
+	<-done
+}
@@ -0,0 +1,69 @@
+package soyhtml
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/robfig/soy/data"
+)
+
+// MaxFragmentTokenSize is the maximum length, in bytes, of a signed fragment
+// token.  It bounds the size of the include URLs, and the work done by the
+// fragment endpoint to verify a request.
+var MaxFragmentTokenSize = 4096
+
+var (
+	// ErrFragmentSignature is returned when verifying a fragment token that
+	// was not signed with the key, or not for the requested template.
+	ErrFragmentSignature = errors.New("soyhtml: invalid fragment token signature")
+
+	// ErrFragmentTokenSize is returned when signing or verifying a fragment
+	// token longer than MaxFragmentTokenSize.
+	ErrFragmentTokenSize = errors.New("soyhtml: fragment token exceeds MaxFragmentTokenSize")
+)
+
+// SignFragmentParams serializes the params of a call to the named template to
+// a token that is authenticated with an HMAC-SHA256 of the given key.  The
+// token is valid only for that template.
+func SignFragmentParams(key []byte, name string, params data.Map) (string, error) {
+	var payload, err = EncodeFragmentParams(params)
+	if err != nil {
+		return "", err
+	}
+	var token = payload + "." + base64.RawURLEncoding.EncodeToString(fragmentMAC(key, name, payload))
+	if len(token) > MaxFragmentTokenSize {
+		return "", ErrFragmentTokenSize
+	}
+	return token, nil
+}
+
+// VerifyFragmentParams returns the params in a token produced by
+// SignFragmentParams with the same key and template name.
+func VerifyFragmentParams(key []byte, name, token string) (data.Map, error) {
+	if len(token) > MaxFragmentTokenSize {
+		return nil, ErrFragmentTokenSize
+	}
+	var dot = strings.LastIndexByte(token, '.')
+	if dot == -1 {
+		return nil, ErrFragmentSignature
+	}
+	var mac, err = base64.RawURLEncoding.DecodeString(token[dot+1:])
+	if err != nil || !hmac.Equal(mac, fragmentMAC(key, name, token[:dot])) {
+		return nil, ErrFragmentSignature
+	}
+	return DecodeFragmentParams(token[:dot])
+}
+
+// fragmentMAC returns the signature of the given payload for the named
+// template.
+func fragmentMAC(key []byte, name, payload string) []byte {
+	var mac = hmac.New(sha256.New, key)
+	io.WriteString(mac, name)
+	mac.Write([]byte{0})
+	io.WriteString(mac, payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,89 @@
+package soyhtml
+
+import (
+	"bytes"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/robfig/soy/data"
+)
+
+func TestSignFragmentParams(t *testing.T) {
+	var key = []byte("secret")
+	var params = data.Map{"name": data.String("Rob")}
+	var token, err = SignFragmentParams(key, "test.greeting", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := VerifyFragmentParams(key, "test.greeting", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, params) {
+		t.Errorf("expected %v, got %v", params, actual)
+	}
+
+	var forged, _ = EncodeFragmentParams(data.Map{"name": data.String("Eve")})
+	var tests = []struct {
+		key, name, token string
+		err              error
+	}{
+		{"other", "test.greeting", token, ErrFragmentSignature},
+		{"secret", "test.page", token, ErrFragmentSignature},
+		{"secret", "test.greeting", forged + token[strings.IndexByte(token, '.'):], ErrFragmentSignature},
+		{"secret", "test.greeting", forged, ErrFragmentSignature},
+		{"secret", "test.greeting", token + strings.Repeat("x", MaxFragmentTokenSize), ErrFragmentTokenSize},
+	}
+	for _, test := range tests {
+		if _, err := VerifyFragmentParams([]byte(test.key), test.name, test.token); err != test.err {
+			t.Errorf("%v %v %v: expected %v, got %v", test.key, test.name, test.token, test.err, err)
+		}
+	}
+
+	var large = data.Map{"name": data.String(strings.Repeat("x", MaxFragmentTokenSize))}
+	if _, err := SignFragmentParams(key, "test.greeting", large); err != ErrFragmentTokenSize {
+		t.Errorf("expected ErrFragmentTokenSize, got %v", err)
+	}
+}
+
+func TestSignedFragmentHandler(t *testing.T) {
+	var tofu = newTestTofu(t, includeTestSoy)
+	var key = []byte("secret")
+
+	var buf bytes.Buffer
+	var err = tofu.NewRenderer("test.page").
+		WithIncludes(IncludeESI, "/fragment").
+		SignIncludes(key).
+		Execute(&buf, data.Map{"user": data.Map{"name": data.String("Rob")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var src = regexp.MustCompile(`src="([^"]*)"`).FindStringSubmatch(buf.String())
+	if src == nil {
+		t.Fatalf("no include found in %s", buf.String())
+	}
+
+	var tests = []struct {
+		url  string
+		code int
+	}{
+		{html.UnescapeString(src[1]), http.StatusOK},
+		{strings.Replace(html.UnescapeString(src[1]), "test.greeting", "test.page", 1), http.StatusForbidden},
+		{"/fragment?template=test.greeting&params=e30", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		var rec = httptest.NewRecorder()
+		tofu.SignedFragmentHandler(key).ServeHTTP(rec, httptest.NewRequest("GET", test.url, nil))
+		if rec.Code != test.code {
+			t.Errorf("%v: expected status %d, got %d", test.url, test.code, rec.Code)
+		}
+		if test.code == http.StatusOK && rec.Body.String() != "Hello Rob" {
+			t.Errorf("%v: expected %q, got %q", test.url, "Hello Rob", rec.Body.String())
+		}
+	}
+}
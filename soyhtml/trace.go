@@ -0,0 +1,59 @@
+package soyhtml
+
+import (
+	"context"
+	"fmt"
+)
+
+// Tracer observes the execution of templates, e.g. to record each render and
+// template call as a span of a distributed trace, or to record their latency
+// and errors as metrics.  The soyotel module (github.com/robfig/soy/soyotel)
+// provides one for OpenTelemetry, which is not a dependency of this module.
+//
+// A Tracer must be safe for concurrent use by multiple renders.
+type Tracer interface {
+	// StartTemplate is called as the named template begins executing, either
+	// because it is rendered or called, with the context of the render or of
+	// the calling template.  It returns the context for the templates that it
+	// calls, and a function to call once it finishes, with the error that
+	// failed it, if any.
+	StartTemplate(ctx context.Context, name string) (context.Context, func(err error))
+}
+
+// WithTracer sets the tracer that observes the templates executed by renderers
+// created by the Tofu.
+func (tofu *Tofu) WithTracer(tracer Tracer) *Tofu {
+	tofu.tracer = tracer
+	return tofu
+}
+
+// WithContext sets the context of the render, which is given to the Tracer,
+// e.g. so that the spans of templates are children of that of the request.
+func (r *Renderer) WithContext(ctx context.Context) *Renderer {
+	r.ctx = ctx
+	return r
+}
+
+// startCall starts tracing the call of the named template by the given state,
+// setting the context of the called template's state.  It returns a function
+// to defer until the call finishes, or nil if not tracing.
+func (s *state) startCall(callee *state, name string) func() {
+	if s.tracer == nil {
+		return nil
+	}
+	var end func(error)
+	callee.ctx, end = s.tracer.StartTemplate(s.ctx, name)
+	return func() {
+		var e = recover()
+		if e == nil {
+			end(nil)
+			return
+		}
+		var err, ok = e.(error)
+		if !ok {
+			err = fmt.Errorf("%v", e)
+		}
+		end(err)
+		panic(e)
+	}
+}
@@ -0,0 +1,80 @@
+package soyhtml
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/robfig/soy/data"
+)
+
+type parentKey struct{}
+
+// testTracer records each template as "parent>name", and its error, if any.
+type testTracer struct {
+	mu    sync.Mutex
+	spans []string
+}
+
+func (t *testTracer) StartTemplate(ctx context.Context, name string) (context.Context, func(error)) {
+	var parent, _ = ctx.Value(parentKey{}).(string)
+	return context.WithValue(ctx, parentKey{}, name), func(err error) {
+		var span = parent + ">" + name
+		if err != nil {
+			span += " failed"
+		}
+		t.mu.Lock()
+		t.spans = append(t.spans, span)
+		t.mu.Unlock()
+	}
+}
+
+func TestTracer(t *testing.T) {
+	var tracer = new(testTracer)
+	var tofu = newTestTofu(t, `{namespace test}
+/** @param items */
+{template .page}
+  {foreach $item in $items}{call .item}{param item: $item /}{/call}{/foreach}
+{/template}
+
+/** @param item */
+{template .item}{call .name data="all" /}{/template}
+
+/** @param item */
+{template .name}{$item.name}{/template}`).WithTracer(tracer)
+
+	var ctx = context.WithValue(context.Background(), parentKey{}, "request")
+	var buf bytes.Buffer
+	var err = tofu.NewRenderer("test.page").
+		WithContext(ctx).
+		Execute(&buf, data.Map{"items": data.List{
+			data.Map{"name": data.String("a")},
+			data.String("b"),
+		}})
+	if err == nil || !strings.Contains(err.Error(), "test.name") {
+		t.Errorf("expected the render to fail in test.name, got %v", err)
+	}
+	var expected = []string{
+		"test.item>test.name",
+		"test.page>test.item",
+		"test.item>test.name failed",
+		"test.page>test.item failed",
+		"request>test.page failed",
+	}
+	if !reflect.DeepEqual(tracer.spans, expected) {
+		t.Errorf("expected spans\n%v\ngot\n%v", expected, tracer.spans)
+	}
+
+	// Renders without a context start from the background context.
+	tracer.spans = nil
+	if err = tofu.NewRenderer("test.page").Execute(&buf, data.Map{"items": data.List{}}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(tracer.spans) != "[>test.page]" {
+		t.Errorf("expected a single span, got %v", tracer.spans)
+	}
+}
@@ -20,4 +20,6 @@ var PrintDirectives = map[string]PrintDirective{
 	"bidiSpanWrap":      {"soy.$$bidiSpanWrap", false},
 	"bidiUnicodeWrap":   {"soy.$$bidiUnicodeWrap", false},
 	"json":              {"JSON.stringify", true},
+
+	"filterHtmlAttributes": {"soy.$$filterHtmlAttributes", true},
 }
@@ -11,6 +11,7 @@ import (
 
 	"github.com/robfig/soy/ast"
 	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/parsepasses"
 	"github.com/robfig/soy/soymsg"
 )
 
@@ -27,6 +28,7 @@ type state struct {
 	options      Options
 	funcsCalled  map[string]string
 	funcsInFile  map[string]bool
+	callees      []string // templates called from the file, if providing namespaces
 }
 
 func difference(a map[string]string, b map[string]bool) []string {
@@ -128,6 +130,14 @@ func (s *state) walk(node ast.Node) {
 		s.writeRawText([]byte(node.Suffix))
 	case *ast.DebuggerNode:
 		s.jsln("debugger;")
+	case *ast.KeyNode:
+		// keys are only used by incremental DOM
+	case *ast.AssertNode:
+		if s.options.StripAsserts {
+			break
+		}
+		s.jsln("if (!(", node.Expr, ")) throw new Error(",
+			&ast.StringNode{node.Pos, "", "assertion failed: " + node.Message}, ");")
 	case *ast.LogNode:
 		s.bufferName += "_"
 		s.jsln("var ", s.bufferName, " = '';")
@@ -168,6 +178,8 @@ func (s *state) walk(node ast.Node) {
 		s.js(node.String())
 	case *ast.GlobalNode:
 		s.visitGlobal(node)
+	case *ast.ConstantNode:
+		s.walk(s.nodeFromValue(node.Pos, node.Value))
 	case *ast.ListLiteralNode:
 		s.js("[")
 		for i, item := range node.Items {
@@ -217,19 +229,34 @@ func (s *state) walk(node ast.Node) {
 	case *ast.ModNode:
 		s.op("%", node)
 
+		// Bitwise operators ----------
+		// Javascript's own operators truncate to 32 bits, so soyutils provides
+		// helpers with the same 64-bit semantics as the server.
+	case *ast.ShiftLeftNode:
+		s.js("soy.$$shiftLeft(", node.Arg1, ", ", node.Arg2, ")")
+	case *ast.ShiftRightNode:
+		s.js("soy.$$shiftRight(", node.Arg1, ", ", node.Arg2, ")")
+	case *ast.BitAndNode:
+		s.js("soy.$$bitAnd(", node.Arg1, ", ", node.Arg2, ")")
+	case *ast.BitOrNode:
+		s.js("soy.$$bitOr(", node.Arg1, ", ", node.Arg2, ")")
+	case *ast.BitXorNode:
+		s.js("soy.$$bitXor(", node.Arg1, ", ", node.Arg2, ")")
+
 		// Arithmetic comparisons ----------
 	case *ast.EqNode:
-		s.op("==", node)
+		// Lists and maps are compared by their elements, as on the server.
+		s.js("soy.$$equals(", node.Arg1, ", ", node.Arg2, ")")
 	case *ast.NotEqNode:
-		s.op("!=", node)
+		s.js("!soy.$$equals(", node.Arg1, ", ", node.Arg2, ")")
 	case *ast.LtNode:
-		s.op("<", node)
+		s.compare("<", node)
 	case *ast.LteNode:
-		s.op("<=", node)
+		s.compare("<=", node)
 	case *ast.GtNode:
-		s.op(">", node)
+		s.compare(">", node)
 	case *ast.GteNode:
-		s.op(">=", node)
+		s.compare(">=", node)
 
 	// Boolean operators ----------
 	case *ast.NotNode:
@@ -239,8 +266,13 @@ func (s *state) walk(node ast.Node) {
 	case *ast.OrNode:
 		s.op("||", node)
 	case *ast.ElvisNode:
-		// ?: is specified to check for null.
-		s.js("((", node.Arg1, ") != null ? ", node.Arg1, " : ", node.Arg2, ")")
+		// ?: is specified to check for null.  Its first operand is evaluated
+		// only once, in case it calls a function with side effects.
+		if isReference(node.Arg1) {
+			s.js("((", node.Arg1, ") != null ? ", node.Arg1, " : ", node.Arg2, ")")
+		} else {
+			s.js("(function($$elvis) { return $$elvis != null ? $$elvis : ", node.Arg2, "; })(", node.Arg1, ")")
+		}
 	case *ast.TernNode:
 		s.js("((", node.Arg1, ") ?", node.Arg2, ":", node.Arg3, ")")
 
@@ -253,6 +285,9 @@ func (s *state) visitSoyFile(node *ast.SoyFileNode) {
 	s.jsln("// This file was automatically generated from ", node.Name, ".")
 	s.jsln("// Please don't edit this file by hand.")
 	s.jsln("")
+	if s.options.ProvideRequireSoyNamespaces {
+		s.callees = parsepasses.Callees(node)
+	}
 	s.visitChildren(node)
 }
 
@@ -266,6 +301,21 @@ func (s *state) visitNamespace(node *ast.NamespaceNode) {
 	s.namespace = node.Name
 	s.autoescape = node.Autoescape
 
+	if s.options.ProvideRequireSoyNamespaces {
+		s.jsln("goog.provide('", node.Name, "');")
+		s.jsln("")
+		s.jsln("goog.require('soy');")
+		var required = map[string]bool{node.Name: true}
+		for _, callee := range s.callees {
+			var ns = callee[:strings.LastIndex(callee, ".")]
+			if !required[ns] {
+				required[ns] = true
+				s.jsln("goog.require('", ns, "');")
+			}
+		}
+		return
+	}
+
 	// iterate through the dot segments.
 	var i = 0
 	for i < len(node.Name) {
@@ -377,6 +427,8 @@ func (s *state) visitFunction(node *ast.FunctionNode) {
 		return
 	}
 
+	// The loop functions refer to the position in the list returned by
+	// soy.$$getForeachItems, which for a map is its sorted keys.
 	switch node.Name {
 	case "isFirst":
 		// TODO: Add compile-time check that this is only called on loop variable.
@@ -399,29 +451,48 @@ func (s *state) visitDataRef(node *ast.DataRefNode) {
 	} else {
 		expr = "opt_data." + node.Key
 	}
+	s.js(s.dataRefAccess(expr, node.Access))
+}
+
+// dataRefAccess returns the javascript for the given accesses of expr.
+// Nullsafe access makes this complicated.
+// FOO.BAR?.BAZ => (FOO.BAR == null ? null : FOO.BAR.BAZ)
+// A prefix that is indexed by an expression, which may call a function, is
+// passed to a function instead, so that it is evaluated only once.
+// FOO[BAR()]?.BAZ => (function(ref1) { return (ref1 == null) ? null : ref1.BAZ; })(FOO[BAR()])
+func (s *state) dataRefAccess(expr string, access []ast.Node) string {
+	var conds string
+	var evaluated = false
+	for i, accessNode := range access {
+		var nullsafe bool
+		switch node := accessNode.(type) {
+		case *ast.DataRefIndexNode:
+			nullsafe = node.NullSafe
+		case *ast.DataRefKeyNode:
+			nullsafe = node.NullSafe
+		case *ast.DataRefExprNode:
+			nullsafe = node.NullSafe
+		}
+		if nullsafe && evaluated {
+			var ref = s.scope.tempvar("ref")
+			return conds + "(function(" + ref + ") { return " +
+				s.dataRefAccess(ref, access[i:]) + "; })(" + expr + ")"
+		}
+		if nullsafe {
+			conds += "(" + expr + " == null) ? null : "
+		}
 
-	// Nullsafe access makes this complicated.
-	// FOO.BAR?.BAZ => (FOO.BAR == null ? null : FOO.BAR.BAZ)
-	for _, accessNode := range node.Access {
 		switch node := accessNode.(type) {
 		case *ast.DataRefIndexNode:
-			if node.NullSafe {
-				s.js("(", expr, " == null) ? null : ")
-			}
 			expr += "[" + strconv.Itoa(node.Index) + "]"
 		case *ast.DataRefKeyNode:
-			if node.NullSafe {
-				s.js("(", expr, " == null) ? null : ")
-			}
 			expr += "." + node.Key
 		case *ast.DataRefExprNode:
-			if node.NullSafe {
-				s.js("(", expr, " == null) ? null : ")
-			}
 			expr += "[" + s.block(node.Arg) + "]"
+			evaluated = true
 		}
 	}
-	s.js(expr)
+	return conds + expr
 }
 
 func (s *state) visitCall(node *ast.CallNode) {
@@ -446,7 +517,11 @@ func (s *state) visitCall(node *ast.CallNode) {
 				s.bufferName = s.scope.makevar("param")
 				s.jsln("var ", s.bufferName, " = '';")
 				s.walk(param.Content)
-				dataExpr += param.Key + ": " + s.bufferName
+				if ordain, ok := ordainFuncs[param.Kind]; ok {
+					dataExpr += param.Key + ": soydata.VERY_UNSAFE." + ordain + "(" + s.bufferName + ")"
+				} else {
+					dataExpr += param.Key + ": " + s.bufferName
+				}
 				s.bufferName = oldBufferName
 			}
 		}
@@ -459,6 +534,16 @@ func (s *state) visitCall(node *ast.CallNode) {
 	}
 }
 
+// ordainFuncs maps the kinds of {param} blocks to the soydata functions that
+// mark their content as sanitized content of that kind.
+var ordainFuncs = map[string]string{
+	"html":       "ordainSanitizedHtml",
+	"js":         "ordainSanitizedJs",
+	"uri":        "ordainSanitizedUri",
+	"css":        "ordainSanitizedCss",
+	"attributes": "ordainSanitizedHtmlAttribute",
+}
+
 func (s *state) visitIf(node *ast.IfNode) {
 	s.indent()
 	for i, branch := range node.Conds {
@@ -523,7 +608,7 @@ func (s *state) visitForeach(node *ast.ForNode) {
 		itemListLen,
 		itemIndex = s.scope.pushForEach(node.Var)
 	defer s.scope.pop()
-	s.jsln("var ", itemList, " = ", node.List, ";")
+	s.jsln("var ", itemList, " = soy.$$getForeachItems(", node.List, ");")
 	s.jsln("var ", itemListLen, " = ", itemList, ".length;")
 	if node.IfEmpty != nil {
 		s.jsln("if (", itemListLen, " > 0) {")
@@ -680,8 +765,15 @@ func (s *state) nodeFromValue(pos ast.Pos, val data.Value) ast.Node {
 		return &ast.IntNode{pos, int64(val)}
 	case data.Float:
 		return &ast.FloatNode{pos, float64(val)}
+	case data.BigInt:
+		// Like a BigInt marshaled to JSON, it is rounded to a javascript number.
+		return &ast.FloatNode{pos, float64(val.Float())}
 	case data.String:
 		return &ast.StringNode{pos, "<unused>", string(val)}
+	case *data.Lazy, *data.SyncMap:
+		return s.nodeFromValue(pos, data.Resolve(val))
+	case *data.Stream:
+		s.errorf("stream value can not be converted to node")
 	case data.List:
 		var items = make([]ast.Node, len(val))
 		for i, item := range val {
@@ -694,6 +786,10 @@ func (s *state) nodeFromValue(pos ast.Pos, val data.Value) ast.Node {
 			items[k] = s.nodeFromValue(pos, v)
 		}
 		return &ast.MapLiteralNode{pos, items}
+	case *data.OrderedMap:
+		return s.nodeFromValue(pos, val.Map)
+	case data.Sanitized:
+		return &ast.StringNode{pos, "<unused>", val.String()}
 	}
 	panic("unreachable")
 }
@@ -718,11 +814,35 @@ func (s *state) block(node ast.Node) string {
 	return buf.String()
 }
 
+// isReference returns true if the node is a literal or a data reference whose
+// evaluation has no side effects, so that it may be evaluated more than once.
+func isReference(node ast.Node) bool {
+	switch node := node.(type) {
+	case *ast.NullNode, *ast.BoolNode, *ast.IntNode, *ast.FloatNode, *ast.StringNode, *ast.GlobalNode:
+		return true
+	case *ast.DataRefNode:
+		for _, access := range node.Access {
+			if _, ok := access.(*ast.DataRefExprNode); ok {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
 func (s *state) op(symbol string, node ast.ParentNode) {
 	var children = node.Children()
 	s.js("((", children[0], ") ", symbol, " (", children[1], "))")
 }
 
+// compare writes a comparison, which orders strings by soy.$$compareStrings
+// rather than by javascript's own UTF-16 code unit order.
+func (s *state) compare(symbol string, node ast.ParentNode) {
+	var children = node.Children()
+	s.js("(soy.$$compare(", children[0], ", ", children[1], ") ", symbol, " 0)")
+}
+
 func (s *state) indent() {
 	for i := 0; i < s.indentLevels; i++ {
 		s.wr.Write([]byte("  "))
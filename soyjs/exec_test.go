@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math/big"
 	"os"
 	"strings"
 	"testing"
@@ -101,7 +102,14 @@ func TestExpressions(t *testing.T) {
 		// exprtest("bools5", "{null == $foo}", "false"),  // DIFFERENCE
 		exprtest("bools6", "{null == null}", "true"),
 		// exprtest("bools7", "{$foo == $foo}", "true"),  // DIFFERENCE
+		exprtest("deep equality", "{[1, ['a': [2.0]]] == [1, ['a': [2]]]} {[1] != [1, 2]} {['a': 1] == ['b': 1]}", "true true false"),
 		exprtest("comparisons", `{0.5<=1 ? null?:'hello' : (1!=1)}`, "hello"),
+		exprtest("string comparison", "{'a' < 'b'} {'b' <= 'a'} {'abc' > 'ab'} {'B' < 'a'} {'a' >= 'a'}", "true false true true true"),
+		exprtest("string comparison by code point", "{'\uff61' < '\U0001F600'} {'\U0001F600' > '\uffff'}", "true true"),
+		// exprtest("string comparison mixed", `{'a' < 1}`, "").fails(),  // DIFFERENCE
+		exprtest("strMatches", `{strMatches('order-123', '^order-\\d+$')} {strMatches('Order-1', '^order')}`, "true false"),
+		exprtest("strReplaceAll", `{strReplaceAll('a1b22c', '[0-9]+', '#')} {strReplaceAll('a.b', '\\.', '$1')}`, "a#b#c a$1b"),
+		exprtest("strMatches invalid pattern", `{strMatches('a', '(')}`, "").fails(),
 		exprtest("stringconcat", `{'hello' + 'world'}`, "helloworld"),
 		exprtest("mixedconcat", `{5 + 'world'}`, "5world"),
 		exprtest("elvis", `{null?:'hello'}`, "hello"), // elvis does isNonnull check on first arg
@@ -110,6 +118,21 @@ func TestExpressions(t *testing.T) {
 		exprtest("elvis4", `{false?:'hello'}`, "false"), // false is non-null
 		exprtest("negate", `{-(1+1)}`, "-2"),
 		exprtest("negate float", `{-(1+1.5)}`, "-2.5"),
+		exprtest("bitwise", `{6 & 3} {6 | 3} {6 ^ 3} {1 << 4} {-16 >> 2} {0 | -1}`, "2 7 5 16 -4 -1"),
+		exprtest("bitwise precedence", `{1 | 6 & 3 ^ 1} {1 + 1 << 2} {(6 | 1)|escapeHtml}`, "3 8 7"),
+		// DIFFERENCE: results beyond 2^53 are rounded, e.g. 1 << 63
+		exprtest("bitwise 64 bits", `{1 << 40} {(1 << 62) >> 61} {-1 >> 63} {-(1 << 52) & -2}`, "1099511627776 2 -1 -4503599627370496"),
+		// DIFFERENCE: 1.0 is indistinguishable from 1, so only fractions fail.
+		exprtest("bitwise non integer", `{1.5 & 1}`, "").fails(),
+		exprtest("bitwise string", `{'1' | 1}`, "").fails(),
+		exprtest("fractional shift count", `{1 << 1.5}`, "").fails(),
+		exprtest("bitwise or function", `{1 | max(2, 4)} {round(1.5) | 4|escapeHtml}`, "5 6"),
+		exprtest("shift count", `{1 << 64}`, "").fails(),
+		exprtest("negative shift count", `{1 >> -1}`, "").fails(),
+		exprtest("relative time", "{formatRelativeTime(now() - 3 * 60 * 60 * 1000)}", "3 hours ago"),
+		exprtest("locale", "{currentLocale()}:{currentDir()}", ":ltr"),
+		exprtest("slice", `{slice([1, 2, 3, 4], 1, 3)}`, "2,3"),
+		exprtest("slice negative", `{slice([1, 2, 3, 4], -2)}`, "3,4"),
 
 		// short-circuiting
 		exprtest("shortcircuit precondition undef key fails", "{$undef.key}", "").fails(),
@@ -118,6 +141,37 @@ func TestExpressions(t *testing.T) {
 	})
 }
 
+func TestEnums(t *testing.T) {
+	data.RegisterEnum("test.Status", map[int32]string{0: "UNKNOWN", 1: "ACTIVE", 2: "DELETED"})
+	runExecTests(t, []execTest{
+		exprtest("enumName", "{enumName('test.Status', 1)} {enumName('test.Status', 3) ?: 'new'}", "ACTIVE new"),
+		exprtest("enumValue", "{enumValue('test.Status', 'DELETED')} {enumValue('test.Status', 'x') ?: -1}", "2 -1"),
+		exprtestwdata("enum data", "{enumName('test.Status', $status)}", "DELETED", d{"status": 2}),
+		exprtestwdata("enum name data", "{enumName('test.Status', $status)} {enumName('test.Status', 'NEW') ?: 'new'}",
+			"ACTIVE new", d{"status": "ACTIVE"}),
+		exprtest("enum other data", "{enumName('test.Status', 1.5) ?: 'none'} {enumName('test.Status', true) ?: 'none'}",
+			"none none"),
+		exprtest("enum not registered", "{enumName('test.Missing', 1)}", "").fails(),
+		exprtest("enum not literal", "{enumName('test.' + 'Status', 1)}", "").fails(),
+	})
+}
+
+func TestFloatPrinting(t *testing.T) {
+	runExecTests(t, []execTest{
+		exprtest("integral floats", "{1.0} {1000000.0} {1000000.0 * 1000000.0 * 1000000000.0}", "1 1000000 1e+21"),
+		exprtest("small floats", "{0.5} {0.000001} {0.0000001} {0.00000015}", "0.5 0.000001 1e-7 1.5e-7"),
+		exprtest("negative zero", "{-0.0} {-1.0 * 0.0}", "0 0"),
+		exprtest("nan and infinity", "{0 / 0} {1 / 0} {-1 / 0}", "NaN Infinity -Infinity"),
+		exprtest("nan is falsy", "{if 0 / 0}y{else}n{/if} {0 / 0 ?: 'x'} {not (0 / 0)}", "n NaN true"),
+	})
+}
+
+func TestAssetUrl(t *testing.T) {
+	runExecTests(t, []execTest{
+		exprtest("assetUrl", "{assetUrl('/site.css')} {assetUrl('/logo', 'image')} {assetUrl(1)}", "/site.css /logo 1"),
+	})
+}
+
 func TestIf(t *testing.T) {
 	runExecTests(t, multidatatest("if", `
 {if $zoo}{$zoo}{/if}
@@ -177,16 +231,34 @@ func TestForeach(t *testing.T) {
 			"goose": []interface{}{d{"numKids": 1}, d{"numKids": 2}},
 			"foo":   d{"booze": []interface{}{}},
 		}, "1 goslings.\n2 goslings.\nSorry, no booze."},
+		{d{
+			"goose": nil, // null is treated as an empty list
+			"foo":   d{"booze": []d(nil)},
+		}, "Sorry, no booze."},
 	}, []errortest{
 		{nil},                           // non-null-safe eval of $foo.booze fails
 		{d{"foo": nil}},                 // ditto
 		{d{"foo": d{}}},                 // $foo.booze must be a list
 		{d{"foo": d{"booze": "str"}}},   // $foo.booze must be list
 		{d{"foo": d{"booze": 5}}},       // $foo.booze must be list
-		{d{"foo": d{"booze": d{}}}},     // $foo.booze must be list
+		{d{"foo": d{"booze": d{}}}},     // $goose must be list
 		{d{"foo": d{"booze": true}}},    // $foo.booze must be list
 		{d{"foo": d{"booze": []d{{}}}}}, // $boo.name fails
 	}))
+
+	runExecTests(t, multidatatest("foreachmap", `
+{foreach $key in $map}
+  {if isFirst($key)}[{/if}
+  {index($key)}.{$key}: {$map[$key]}
+  {if isLast($key)}]{else}, {/if}
+{ifempty}
+  empty
+{/foreach}
+{sp}{foreach $key in keys($map)}{$key}{/foreach}`, []datatest{
+		{d{"map": d{"c": 3, "a": 1, "b": 2}}, "[0.a: 1, 1.b: 2, 2.c: 3] abc"},
+		{d{"map": d{"a": 1}}, "[0.a: 1] a"},
+		{d{"map": d{}}, "empty "},
+	}, nil))
 }
 
 func TestFor(t *testing.T) {
@@ -199,9 +271,11 @@ func TestFor(t *testing.T) {
 		{d{"items": []interface{}{}}, ""},
 		{d{"items": []interface{}{"car"}}, "1: car\n"},
 		{d{"items": []interface{}{"car", "boat"}}, "1: car\n2: boat\n"},
+		{d{"items": nil}, ""},           // null is treated as an empty list
+		{d{"items": []string(nil)}, ""}, // as is a nil slice
 	}, []errortest{
-		{d{}},             // undefined is not a valid slice
-		{d{"items": nil}}, // null is not a valid slice
+		// DIFFERENCE: length() treats undefined as an empty list, like null.
+		// {d{}}, // undefined is not a valid slice
 		// DIFFERENCE: JS function iterates through the string "a" instead of throwing an error.
 		// {d{"items": "a"}}, // string is not a valid slice
 	}))
@@ -282,6 +356,59 @@ func TestCall(t *testing.T) {
 	})
 }
 
+func TestSanitizedContent(t *testing.T) {
+	var input = `{namespace test}
+
+/** @param str */
+{template .main}
+{call .wrap}{param body kind="html"}<i>{$str}</i>{/param}{/call}
+{/template}
+
+/** @param body */
+{template .wrap}<p>{$body}</p>{/template}`
+	runExecTests(t, []execTest{
+		{"sanitized", "test.main", input,
+			`<p><i>&lt;b&gt;</i></p>`,
+			d{"str": "<b>"}, true},
+	})
+}
+
+func TestCallAttributes(t *testing.T) {
+	var input = `{namespace test}
+
+/** @param label */
+{template .main}
+{call .button}
+  {param attrs kind="attributes"}title="{$label}" disabled{/param}
+  {param label: $label/}
+{/call}
+{call .button}
+  {param attrs kind="attributes"}class="primary"{/param}
+  {param label: $label/}
+{/call}
+{/template}
+
+/**
+ * @param attrs Attributes forwarded to the button.
+ * @param label
+ */
+{template .button}
+<button {$attrs|filterHtmlAttributes}type="button">{$label}</button>
+{/template}`
+	runExecTests(t, []execTest{
+		{"attributes", "test.main", input,
+			`<button title="&quot;&gt;&lt;b&gt;" disabled type="button">&quot;&gt;&lt;b&gt;</button>` +
+				`<button class="primary"type="button">&quot;&gt;&lt;b&gt;</button>`,
+			d{"label": `"><b>`}, true},
+		exprtestwdata("filterHtmlAttributes name", "<input {$name|filterHtmlAttributes}>",
+			"<input checked>", d{"name": "checked"}),
+		exprtestwdata("filterHtmlAttributes unsafe name", "<input {$name|filterHtmlAttributes}>",
+			"<input zSoyz>", d{"name": "onclick"}),
+		exprtestwdata("filterHtmlAttributes unsafe string", "<input {$name|filterHtmlAttributes}>",
+			"<input zSoyz>", d{"name": `x="y"`}),
+	})
+}
+
 func TestDataRefs(t *testing.T) {
 	runExecTests(t, []execTest{
 		// single key
@@ -407,7 +534,33 @@ func TestSpecialChars(t *testing.T) {
 		exprtest("nil avoids space", "abc{nil}\ndef", "abcdef"),
 		exprtest("without sp there is no space", "abc\n<a>", "abc<a>"),
 		exprtest("sp adds space", "abc{sp}\n<a>", "abc <a>"),
+		exprtestwdata("key", `<li>{key $id}{$id}</li>`, `<li>1</li>`, d{"id": 1}),
+	})
+}
+
+func TestAssert(t *testing.T) {
+	var failed = exprtestwdata("assert failed", `{assert $id > 0, "id must be positive"}{$id}`, ``, d{"id": 0})
+	failed.ok = false
+	runExecTests(t, []execTest{
+		exprtestwdata("assert", `{assert $id > 0, "id must be positive"}{$id}`, `1`, d{"id": 1}),
+		exprtestwdata("assert single quotes", `{assert $id, 'id is required'}{$id}`, `1`, d{"id": 1}),
+		failed,
 	})
+
+	// The asserts may be omitted from the generated javascript.
+	var soyfile, err = parse.SoyFile("assert.soy", `{namespace test}
+/** @param id */
+{template .assert}{assert $id > 0, "id must be positive"}{$id}{/template}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = Write(&buf, soyfile, Options{StripAsserts: true}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "assertion failed") {
+		t.Errorf("expected the assert to be stripped, got:\n%s", buf.String())
+	}
 }
 
 func TestForeachElvis(t *testing.T) {
@@ -491,8 +644,14 @@ func TestGlobals(t *testing.T) {
 	globals["app.global_str"] = data.New("abc")
 	globals["GLOBAL_INT"] = data.New(5)
 	globals["global.nil"] = data.New(nil)
+	globals["global.big"] = data.NewBigInt(new(big.Int).Lsh(big.NewInt(1), 64))
+	globals["global.lazy"] = data.NewLazy(func() data.Value { return data.String("lazy") })
+	globals["global.stream"] = data.NewSeqStream(func(yield func(data.Value) bool) {})
 	runExecTests(t, []execTest{
 		exprtest("global", `{app.global_str} {GLOBAL_INT + 2} {global.nil?:'hi'}`, `abc 7 hi`),
+		exprtest("global bigint", `{global.big}`, `18446744073709552000`), // DIFFERENCE: rounded
+		exprtest("global lazy", `{global.lazy}`, `lazy`),
+		exprtest("global stream", `{global.stream}`, ``).fails(),
 	})
 }
 
@@ -637,6 +796,35 @@ func TestHelloWorld(t *testing.T) {
 	})
 }
 
+// TestMarkupDeclarations renders an HTML email with a doctype and conditional
+// comments.
+func TestMarkupDeclarations(t *testing.T) {
+	// Doctypes and (conditional) comments are raw text, so they are passed
+	// through unchanged, while values printed within them are still escaped.
+	runExecTests(t, []execTest{
+		{"doctype and conditional comments", "test.email", `{namespace test}
+
+/** @param title */
+{template .email}
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN"
+    "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">
+<html>
+<!--[if gte mso 9]><xml><o:OfficeDocumentSettings/></xml><![endif]-->
+<!--[if IE]><p class="ie">{$title}</p><![endif]-->
+<!--[if !mso]><!--><b>{$title}</b><!--<![endif]-->
+<!-- a comment -->
+</html>
+{/template}`,
+			`<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" ` +
+				`"http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd"><html>` +
+				`<!--[if gte mso 9]><xml><o:OfficeDocumentSettings/></xml><![endif]-->` +
+				`<!--[if IE]><p class="ie">Q&amp;A</p><![endif]-->` +
+				`<!--[if !mso]><!--><b>Q&amp;A</b><!--<![endif]-->` +
+				`<!-- a comment --></html>`,
+			d{"title": "Q&A"}, true},
+	})
+}
+
 var identicalParamNameTemplate = `
 {namespace test}
 
@@ -1107,6 +1295,53 @@ export function say__hello(opt_data, opt_sb, opt_ijData) {
 	}
 }
 
+func TestProvideRequireSoyNamespaces(t *testing.T) {
+	bundle := soy.NewBundle()
+	bundle.AddTemplateString("test.soy", `{namespace test.ns}
+{template .page}
+	{call say.hello /}{call .page2 /}
+{/template}
+{template .page2}
+{/template}`)
+	bundle.AddTemplateString("say_hello.soy", `{namespace say}
+{template .hello}
+	Hello World!
+{/template}`)
+	registry, err := bundle.Compile()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := `// This file was automatically generated from test.soy.
+// Please don't edit this file by hand.
+
+goog.provide('test.ns');
+
+goog.require('soy');
+goog.require('say');
+
+test.ns.page = function(opt_data, opt_sb, opt_ijData) {
+  var output = '';
+  output += say.hello({}, opt_sb, opt_ijData);
+  output += test.ns.page2({}, opt_sb, opt_ijData);
+  return output;
+};
+
+test.ns.page2 = function(opt_data, opt_sb, opt_ijData) {
+  var output = '';
+  return output;
+};`
+	var buf bytes.Buffer
+	err = Write(&buf, registry.SoyFiles[0], Options{ProvideRequireSoyNamespaces: true})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if a, e := strings.TrimSpace(buf.String()), strings.TrimSpace(expected); a != e {
+		t.Errorf("did not get expected results:\n%v", diff.LineDiff(e, a))
+	}
+}
+
 var pluralFuncBodies = map[string]string{
 	"en": `
 	if (n > 1) {
@@ -1181,7 +1416,9 @@ TESTS_LOOP:
 			// TODO: Should loop over SoyFiles and add to buffer
 			err = Write(&buf, registry.SoyFiles[0], Options{Messages: test.msgs})
 			if err != nil {
-				t.Errorf("%s: write error: %v", test.name, err)
+				if test.ok {
+					t.Errorf("%s: write error: %v", test.name, err)
+				}
 				continue TESTS_LOOP
 			}
 
@@ -1221,19 +1458,22 @@ func initJs(t *testing.T) *otto.Otto {
 	// remove any non-otto compatible regular expressions
 	var soyutilsBuf bytes.Buffer
 	var scanner = bufio.NewScanner(soyutilsFile)
-	var i = 1
 	for scanner.Scan() {
-		switch i {
-		case 2565, 2579, 2586:
+		switch line := scanner.Text(); {
+		case strings.HasPrefix(line, "soy.esc.$$FILTER_FOR_FILTER_CSS_VALUE_ ="),
+			strings.HasPrefix(line, "soy.esc.$$FILTER_FOR_FILTER_HTML_ELEMENT_NAME_ ="):
 			// skip these regexes
-			// soy.esc.$$FILTER_FOR_FILTER_CSS_VALUE_
-			// soy.esc.$$FILTER_FOR_FILTER_HTML_ATTRIBUTES_
-			// soy.esc.$$FILTER_FOR_FILTER_HTML_ELEMENT_NAME_
+		case strings.HasPrefix(line, "soy.esc.$$FILTER_FOR_FILTER_HTML_ATTRIBUTES_ ="):
+			// replace the negative lookahead with an equivalent test
+			soyutilsBuf.WriteString(`soy.esc.$$FILTER_FOR_FILTER_HTML_ATTRIBUTES_ = {test: function(str) {
+  return /^[a-z0-9_$:-]*$/i.test(str) &&
+      !/^(?:style|on|action|archive|background|cite|classid|codebase|data|dsync|href|longdesc|src|usemap)/i.test(str);
+}};
+`)
 		default:
 			soyutilsBuf.Write(scanner.Bytes())
 			soyutilsBuf.Write([]byte("\n"))
 		}
-		i++
 	}
 	// load the soyutils library
 	_, err = otto.Run(soyutilsBuf.String())
@@ -1,7 +1,12 @@
 package soyjs
 
 import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
 	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/data"
 )
 
 // JSWriter is provided to functions to write to the generated javascript.
@@ -35,7 +40,17 @@ var funcs = []Func{
 	{"max", funcMax, []int{2}},
 	{"randomInt", funcRandomInt, []int{1}},
 	{"strContains", funcStrContains, []int{2}},
+	{"strMatches", builtinFunc("strMatches"), []int{2}},
+	{"strReplaceAll", builtinFunc("strReplaceAll"), []int{3}},
 	{"hasData", funcHasData, []int{0}},
+	{"slice", funcSlice, []int{2, 3}},
+	{"enumName", funcEnumName, []int{2}},
+	{"enumValue", funcEnumValue, []int{2}},
+	{"now", builtinFunc("now"), []int{0}},
+	{"formatRelativeTime", builtinFunc("formatRelativeTime"), []int{1}},
+	{"assetUrl", builtinFunc("assetUrl"), []int{1, 2}},
+	{"currentLocale", builtinFunc("currentLocale"), []int{0}},
+	{"currentDir", builtinFunc("currentDir"), []int{0}},
 	{"bidiGlobalDir", funcBidiGlobalDir, []int{0}},
 	{"bidiDirAttr", funcBidiDirAttr, []int{0}},
 	{"bidiStartEdge", funcBidiStartEdge, []int{0}},
@@ -71,8 +86,17 @@ func funcIsNonnull(js JSWriter, args []ast.Node) {
 	js.Write(args[0], "!= null")
 }
 
+// funcSlice and funcLength treat null, e.g. from a nil slice, as an empty list.
+func funcSlice(js JSWriter, args []ast.Node) {
+	if len(args) == 2 {
+		js.Write("(", args[0], " || []).slice(", args[1], ")")
+		return
+	}
+	js.Write("(", args[0], " || []).slice(", args[1], ",", args[2], ")")
+}
+
 func funcLength(js JSWriter, args []ast.Node) {
-	js.Write(args[0], ".length")
+	js.Write("(", args[0], " || []).length")
 }
 
 func funcRound(js JSWriter, args []ast.Node) {
@@ -80,8 +104,8 @@ func funcRound(js JSWriter, args []ast.Node) {
 	case 1:
 		js.Write("Math.round(", args[0], ")")
 	default:
-		js.Write(
-			"Math.round(", args[0], "* Math.pow(10, ", args[1], ")) / Math.pow(10, ", args[1], ")")
+		js.Write("(function(x, p) { return Math.round(x * p) / p; })(",
+			args[0], ", Math.pow(10, ", args[1], "))")
 	}
 }
 
@@ -109,6 +133,39 @@ func funcStrContains(js JSWriter, args []ast.Node) {
 	js.Write(args[0], ".indexOf(", args[1], ") != -1")
 }
 
+// literalEnum returns the enum named by the given string literal, which must
+// be registered when the javascript is generated.
+func literalEnum(node ast.Node) *data.Enum {
+	var name, ok = node.(*ast.StringNode)
+	if !ok {
+		panic(fmt.Errorf("%v: the enum must be given by a string literal", node))
+	}
+	enum, ok := data.LookupEnum(name.Value)
+	if !ok {
+		panic(fmt.Errorf("enum %q is not registered", name.Value))
+	}
+	return enum
+}
+
+// funcEnumName writes a lookup of the number in a table of the enum's names,
+// so that the client need not register the enum itself.
+func funcEnumName(js JSWriter, args []ast.Node) {
+	var enum = literalEnum(args[0])
+	var names = make(map[string]string, len(enum.Names))
+	for num, name := range enum.Names {
+		names[strconv.Itoa(int(num))] = name
+	}
+	var table, _ = json.Marshal(names)
+	var values, _ = json.Marshal(enum.Values)
+	js.Write("soy.$$enumName(", string(table), ", ", string(values), ", ", args[1], ")")
+}
+
+// funcEnumValue writes a lookup of the name in a table of the enum's numbers.
+func funcEnumValue(js JSWriter, args []ast.Node) {
+	var table, _ = json.Marshal(literalEnum(args[0]).Values)
+	js.Write("soy.$$enumLookup(", string(table), ", ", args[1], ")")
+}
+
 func funcHasData(js JSWriter, args []ast.Node) {
 	js.Write("true")
 }
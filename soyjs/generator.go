@@ -14,6 +14,14 @@ import (
 type Options struct {
 	Messages  soymsg.Bundle
 	Formatter JSFormatter
+
+	// ProvideRequireSoyNamespaces generates goog.provide for the file's
+	// namespace and goog.require for the namespaces it uses, rather than
+	// declaring the namespace objects directly.
+	ProvideRequireSoyNamespaces bool
+
+	// StripAsserts omits the {assert} commands from the generated javascript.
+	StripAsserts bool
 }
 
 // Generator provides an interface to a template registry capable of generating
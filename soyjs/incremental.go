@@ -0,0 +1,46 @@
+package soyjs
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/template"
+)
+
+// Incremental generates the javascript for successive versions of a registry,
+// such as those compiled by a soy.Bundle that watches its files, regenerating
+// only the files that changed.
+type Incremental struct {
+	Store      Store
+	Options    Options
+	OutputName func(filename string) string // name of the javascript for a soy file
+
+	generated map[string]*ast.SoyFileNode // soy file last generated, by name
+}
+
+// Generate writes the javascript for each soy file in the registry that was
+// added or re-parsed since the last call, and returns the names of the
+// javascript files written.
+func (inc *Incremental) Generate(reg *template.Registry) ([]string, error) {
+	if inc.generated == nil {
+		inc.generated = make(map[string]*ast.SoyFileNode)
+	}
+	var written []string
+	for _, soyfile := range reg.SoyFiles {
+		if inc.generated[soyfile.Name] == soyfile {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := Write(&buf, soyfile, inc.Options); err != nil {
+			return written, fmt.Errorf("%s: %v", soyfile.Name, err)
+		}
+		var name = inc.OutputName(soyfile.Name)
+		if err := inc.Store.Put(name, buf.Bytes()); err != nil {
+			return written, err
+		}
+		inc.generated[soyfile.Name] = soyfile
+		written = append(written, name)
+	}
+	return written, nil
+}
@@ -0,0 +1,54 @@
+package soyjs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/robfig/soy/parse"
+	"github.com/robfig/soy/template"
+)
+
+func TestIncremental(t *testing.T) {
+	var registry = template.Registry{}
+	var add = func(filename, content string) {
+		var soyfile, err = parse.SoyFile(filename, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		registry.Remove(filename)
+		if err = registry.Add(soyfile); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("a.soy", "{namespace a}\n{template .a}a{/template}")
+	add("b.soy", "{namespace b}\n{template .b}b{/template}")
+
+	var store = make(MemStore)
+	var inc = &Incremental{
+		Store:      store,
+		OutputName: func(filename string) string { return strings.TrimSuffix(filename, ".soy") + ".js" },
+	}
+	var generate = func(expected ...string) {
+		t.Helper()
+		var written, err = inc.Generate(&registry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(written, expected) {
+			t.Errorf("expected %v written, got %v", expected, written)
+		}
+	}
+
+	generate("a.js", "b.js")
+	generate()
+
+	add("b.soy", "{namespace b}\n{template .b}b2{/template}")
+	generate("b.js")
+	if !strings.Contains(string(store["b.js"]), "b2") {
+		t.Errorf("b.js was not regenerated: %s", store["b.js"])
+	}
+
+	add("c.soy", "{namespace c}\n{template .c}c{/template}")
+	generate("c.js")
+}
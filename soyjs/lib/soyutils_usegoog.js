@@ -464,6 +464,295 @@ soy.$$augmentMap = function(baseMap, additionalMap) {
 };
 
 
+/**
+ * Splits an integer into the words of its 64-bit two's complement
+ * representation.  Throws if the operand is not an integer.
+ *
+ * @param {*} x The integer.
+ * @return {!Array.<number>} The signed high word and the unsigned low word.
+ * @private
+ */
+soy.$$int64Words_ = function(x) {
+  if (typeof x != 'number' || x % 1 !== 0) {
+    throw Error('operands of bitwise operators must be integers, got ' + x);
+  }
+  var hi = Math.floor(x / 4294967296);
+  return [hi | 0, (x - hi * 4294967296) >>> 0];
+};
+
+
+/**
+ * Joins the words of a 64-bit two's complement integer into a number.
+ * Results beyond +/-2^53 are rounded, as with any other number.
+ *
+ * @param {number} hi The high word.
+ * @param {number} lo The low word.
+ * @return {number} The integer.
+ * @private
+ */
+soy.$$int64Value_ = function(hi, lo) {
+  return (hi | 0) * 4294967296 + (lo >>> 0);
+};
+
+
+/**
+ * Checks that a shift count is an integer in [0, 63].
+ *
+ * @param {number} n The shift count.
+ * @private
+ */
+soy.$$checkShiftCount_ = function(n) {
+  if (!(n >= 0 && n <= 63 && n % 1 === 0)) {
+    throw Error('shift count out of range: ' + n);
+  }
+};
+
+
+/**
+ * Implements the Soy '&' operator on 64-bit integers.
+ *
+ * @param {number} a The first operand.
+ * @param {number} b The second operand.
+ * @return {number} The bitwise and of the operands.
+ */
+soy.$$bitAnd = function(a, b) {
+  a = soy.$$int64Words_(a);
+  b = soy.$$int64Words_(b);
+  return soy.$$int64Value_(a[0] & b[0], a[1] & b[1]);
+};
+
+
+/**
+ * Implements the Soy '|' operator on 64-bit integers.
+ *
+ * @param {number} a The first operand.
+ * @param {number} b The second operand.
+ * @return {number} The bitwise or of the operands.
+ */
+soy.$$bitOr = function(a, b) {
+  a = soy.$$int64Words_(a);
+  b = soy.$$int64Words_(b);
+  return soy.$$int64Value_(a[0] | b[0], a[1] | b[1]);
+};
+
+
+/**
+ * Implements the Soy '^' operator on 64-bit integers.
+ *
+ * @param {number} a The first operand.
+ * @param {number} b The second operand.
+ * @return {number} The bitwise exclusive or of the operands.
+ */
+soy.$$bitXor = function(a, b) {
+  a = soy.$$int64Words_(a);
+  b = soy.$$int64Words_(b);
+  return soy.$$int64Value_(a[0] ^ b[0], a[1] ^ b[1]);
+};
+
+
+/**
+ * Implements the Soy '<<' operator on 64-bit integers.
+ *
+ * @param {number} x The integer to shift.
+ * @param {number} n The shift count, in [0, 63].
+ * @return {number} The shifted integer.
+ */
+soy.$$shiftLeft = function(x, n) {
+  soy.$$checkShiftCount_(n);
+  var words = soy.$$int64Words_(x), hi = words[0], lo = words[1];
+  if (n >= 32) {
+    hi = lo << (n - 32);
+    lo = 0;
+  } else if (n > 0) {
+    hi = (hi << n) | (lo >>> (32 - n));
+    lo = lo << n;
+  }
+  return soy.$$int64Value_(hi, lo);
+};
+
+
+/**
+ * Implements the Soy '>>' operator on 64-bit integers, which is an arithmetic
+ * (sign-extending) shift.
+ *
+ * @param {number} x The integer to shift.
+ * @param {number} n The shift count, in [0, 63].
+ * @return {number} The shifted integer.
+ */
+soy.$$shiftRight = function(x, n) {
+  soy.$$checkShiftCount_(n);
+  var words = soy.$$int64Words_(x), hi = words[0], lo = words[1];
+  if (n >= 32) {
+    lo = hi >> (n - 32);
+    hi = hi >> 31;
+  } else if (n > 0) {
+    lo = (lo >>> n) | (hi << (32 - n));
+    hi = hi >> n;
+  }
+  return soy.$$int64Value_(hi, lo);
+};
+
+
+/**
+ * Implements the Soy equality operators (== and !=), which compare lists and
+ * maps by their elements, as the server does, rather than by reference.
+ * Other values are compared with javascript's own == operator, except that
+ * sanitized content is compared by its kind and content.
+ *
+ * @param {*} a The first operand.
+ * @param {*} b The second operand.
+ * @return {boolean} Whether the operands are equal.
+ */
+soy.$$equals = function(a, b) {
+  if (a == b) {
+    return true;
+  }
+  if (!a || !b || typeof a != 'object' || typeof b != 'object') {
+    return false;
+  }
+  if (Array.isArray(a) || Array.isArray(b)) {
+    if (!Array.isArray(a) || !Array.isArray(b) || a.length != b.length) {
+      return false;
+    }
+    for (var i = 0; i < a.length; i++) {
+      if (!soy.$$equals(a[i], b[i])) {
+        return false;
+      }
+    }
+    return true;
+  }
+  var proto = Object.getPrototypeOf(a);
+  if (proto != Object.prototype && proto != null ||
+      Object.getPrototypeOf(b) != proto) {
+    return a.contentKind === b.contentKind && String(a) == String(b);
+  }
+  var keys = Object.keys(a);
+  if (keys.length != Object.keys(b).length) {
+    return false;
+  }
+  for (var i = 0; i < keys.length; i++) {
+    if (!Object.prototype.hasOwnProperty.call(b, keys[i]) ||
+        !soy.$$equals(a[keys[i]], b[keys[i]])) {
+      return false;
+    }
+  }
+  return true;
+};
+
+
+/**
+ * Compares two values for the Soy comparison operators (<, <=, >, >=).  Two
+ * strings are compared with soy.$$compareStrings, and other values as numbers.
+ *
+ * @param {*} a The first operand.
+ * @param {*} b The second operand.
+ * @return {number} A negative number, zero, or a positive number if a is less
+ *     than, equal to, or greater than b, or NaN if they are unordered.
+ */
+soy.$$compare = function(a, b) {
+  if (typeof a == 'string' && typeof b == 'string') {
+    return soy.$$compareStrings(a, b);
+  }
+  return a < b ? -1 : a > b ? 1 : a == b ? 0 : NaN;
+};
+
+
+/**
+ * Orders strings for the Soy comparison operators.  By default, strings are
+ * compared by code point, rather than by UTF-16 code unit as javascript's own
+ * operators do, to match the server.  It may be replaced by a locale-aware
+ * collation, e.g. new Intl.Collator(locale).compare, to match a collation
+ * used on the server.
+ *
+ * @param {string} a The first string.
+ * @param {string} b The second string.
+ * @return {number} A negative number, zero, or a positive number if a sorts
+ *     before, the same as, or after b.
+ */
+soy.$$compareStrings = function(a, b) {
+  var n = Math.min(a.length, b.length);
+  for (var i = 0; i < n; i++) {
+    var x = a.charCodeAt(i), y = b.charCodeAt(i);
+    if (x != y) {
+      // Surrogates (D800-DFFF) encode code points above FFFF, so they are
+      // moved after the code units E000-FFFF.
+      if (x >= 0xD800 && y >= 0xD800) {
+        x += x < 0xE000 ? 0x2000 : -0x800;
+        y += y < 0xE000 ? 0x2000 : -0x800;
+      }
+      return x - y;
+    }
+  }
+  return a.length - b.length;
+};
+
+
+/**
+ * Implements the Soy strMatches function, returning true if the string
+ * contains a match of the regular expression.  Patterns should use the syntax
+ * shared by RE2 and javascript, to match the server.
+ *
+ * @param {string} str The string to search.
+ * @param {string} pattern The regular expression.
+ * @return {boolean} True if the string contains a match.
+ */
+soy.$$strMatches = function(str, pattern) {
+  return new RegExp(pattern).test(str);
+};
+
+
+/**
+ * Implements the Soy strReplaceAll function, replacing all matches of the
+ * regular expression in the string.  The replacement is literal: unlike
+ * String.prototype.replace, it may not refer to groups with $.
+ *
+ * @param {string} str The string to search.
+ * @param {string} pattern The regular expression.
+ * @param {*} replacement The replacement for each match.
+ * @return {string} The string with each match replaced.
+ */
+soy.$$strReplaceAll = function(str, pattern, replacement) {
+  replacement = String(replacement);
+  return str.replace(new RegExp(pattern, 'g'), function() {
+    return replacement;
+  });
+};
+
+
+/**
+ * Implements the Soy enumName and enumValue functions, looking up a number or
+ * name in a table generated from the enum.
+ *
+ * @param {!Object} table The names by number, or numbers by name.
+ * @param {*} key The number or name to look up.
+ * @return {?string|?number} The name or number, or null if the key is not
+ *     defined by the enum.
+ */
+soy.$$enumLookup = function(table, key) {
+  return Object.prototype.hasOwnProperty.call(table, key) ? table[key] : null;
+};
+
+
+/**
+ * Implements the Soy enumName function: looks up the name of a number, or
+ * returns a name unchanged if it is defined by the enum.
+ *
+ * @param {!Object} names The names by number.
+ * @param {!Object} values The numbers by name.
+ * @param {*} key The number or name to look up.
+ * @return {?string} The name, or null if the key is not defined by the enum.
+ */
+soy.$$enumName = function(names, values, key) {
+  if (typeof key == 'number') {
+    return soy.$$enumLookup(names, key);
+  }
+  if (typeof key == 'string') {
+    return soy.$$enumLookup(values, key) === null ? null : key;
+  }
+  return null;
+};
+
+
 /**
  * Checks that the given map key is a string.
  * @param {*} key Key to check.
@@ -480,7 +769,7 @@ soy.$$checkMapKey = function(key) {
 
 
 /**
- * Gets the keys in a map as an array. There are no guarantees on the order.
+ * Gets the keys in a map as an array, ordered by soy.$$compareMapKeys.
  * @param {Object} map The map to get the keys of.
  * @return {Array.<string>} The array of keys in the given map.
  */
@@ -489,10 +778,128 @@ soy.$$getMapKeys = function(map) {
   for (var key in map) {
     mapKeys.push(key);
   }
+  if (soy.$$compareMapKeys !== null) {
+    mapKeys.sort(soy.$$compareMapKeys);
+  }
   return mapKeys;
 };
 
 
+/**
+ * The comparison function (as for Array.prototype.sort) that determines the
+ * order of the keys returned by soy.$$getMapKeys, and so the order in which
+ * a {foreach} iterates a map.  If undefined, the keys are sorted lexically,
+ * as they are by the Go renderer.  If null, the keys are left in the order in
+ * which they are enumerated.
+ * @type {?function(string, string): number|undefined}
+ */
+soy.$$compareMapKeys = undefined;
+
+
+/**
+ * Gets the items iterated by a {foreach}: the given list itself, or the keys
+ * of the given map.  Null is treated as an empty list.
+ * @param {Array|Object} listOrMap The list or map to iterate.
+ * @return {Array} The items to iterate.
+ */
+soy.$$getForeachItems = function(listOrMap) {
+  if (listOrMap === null) {
+    return [];
+  }
+  if (listOrMap === undefined ||
+      Object.prototype.toString.call(listOrMap) == '[object Array]') {
+    return listOrMap;
+  }
+  return soy.$$getMapKeys(listOrMap);
+};
+
+
+/**
+ * Returns the URL of an asset, for the assetUrl() function.  The Go renderer
+ * also records the URL so that the server may preload it; this does not, but
+ * it may be replaced, e.g. to rewrite the URLs of assets to a CDN.
+ * @param {*} url The URL of the asset.
+ * @param {string=} opt_as The type of content of the asset, e.g. "style".
+ * @return {string} The URL.
+ */
+soy.$$assetUrl = function(url, opt_as) {
+  return String(url);
+};
+
+
+/**
+ * Returns the current time, in milliseconds since the epoch, for the now()
+ * and formatRelativeTime() functions.  It may be replaced to provide a fixed
+ * time, e.g. in tests.
+ * @return {number} The current time.
+ */
+soy.$$now = function() {
+  return new Date().getTime();
+};
+
+
+/**
+ * Describes the given time relative to the current time, e.g. "5 minutes ago"
+ * or "in 2 days".  This must match the formatRelativeTime function of the Go
+ * renderer.
+ * @param {number} timestamp The time, in milliseconds since the epoch.
+ * @return {string} The relative time.
+ */
+soy.$$formatRelativeTime = function(timestamp) {
+  var ms = timestamp < 0 ? Math.ceil(timestamp) : Math.floor(timestamp);
+  var seconds = (ms - ms % 1000) / 1000 - Math.floor(soy.$$now() / 1000);
+  var future = seconds > 0;
+  if (!future) {
+    seconds = -seconds;
+  }
+  var units = [
+    [365 * 24 * 60 * 60, 'year'],
+    [30 * 24 * 60 * 60, 'month'],
+    [24 * 60 * 60, 'day'],
+    [60 * 60, 'hour'],
+    [60, 'minute']
+  ];
+  for (var i = 0; i < units.length; i++) {
+    if (seconds >= units[i][0]) {
+      var n = Math.floor(seconds / units[i][0]);
+      var unit = units[i][1] + (n != 1 ? 's' : '');
+      return future ? 'in ' + n + ' ' + unit : n + ' ' + unit + ' ago';
+    }
+  }
+  return 'just now';
+};
+
+
+/**
+ * The locale of the messages in the templates, for the currentLocale() and
+ * currentDir() functions.  It should be set to the locale of the message
+ * bundle that the templates were compiled with.
+ * @type {string}
+ */
+soy.$$locale = goog.LOCALE;
+
+
+/**
+ * Returns the locale of the messages in the templates.
+ * @return {string} The locale, e.g. "en-US".
+ */
+soy.$$currentLocale = function() {
+  return soy.$$locale;
+};
+
+
+/**
+ * Returns the direction of the locale of the messages in the templates.  This
+ * must match the currentDir function of the Go renderer.
+ * @return {string} "rtl" or "ltr".
+ */
+soy.$$currentDir = function() {
+  var lang = soy.$$locale.split(/[-_]/)[0].toLowerCase();
+  var rtl = /^(ar|ckb|dv|fa|he|iw|ps|sd|ug|ur|yi)$/.test(lang);
+  return rtl ? 'rtl' : 'ltr';
+};
+
+
 /**
  * Gets a consistent unique id for the given delegate template name. Two calls
  * to this function will return the same id if and only if the input names are
@@ -0,0 +1,69 @@
+package soyjs
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// Manifest describes the templates for which javascript is generated, for
+// use by build tooling (e.g. to map server routes to client bundles).
+type Manifest struct {
+	Templates []ManifestTemplate `json:"templates"`
+
+	// Files maps the name of each javascript file to its content-hashed
+	// name, if written by WriteAll.
+	Files map[string]string `json:"files,omitempty"`
+}
+
+// ManifestTemplate describes a single generated template.
+type ManifestTemplate struct {
+	Name       string          `json:"name"`
+	Kind       string          `json:"kind"`
+	Params     []ManifestParam `json:"params"`
+	SourceFile string          `json:"sourceFile"`
+	OutputFile string          `json:"outputFile"`
+}
+
+// ManifestParam describes a param declared by a template.
+type ManifestParam struct {
+	Name     string `json:"name"`
+	Optional bool   `json:"optional,omitempty"`
+}
+
+// Manifest returns a description of the templates in the registry.  The
+// outputFile function is given the name of each soy file, and returns the path
+// of the javascript file generated for it.
+func (gen *Generator) Manifest(outputFile func(filename string) string) Manifest {
+	var manifest = Manifest{Templates: []ManifestTemplate{}}
+	for _, t := range gen.registry.Templates {
+		var filename = gen.registry.Filename(t.Node.Name)
+		var kind = t.Node.Kind
+		if kind == "" {
+			kind = "html"
+		}
+		var params = []ManifestParam{}
+		for _, param := range t.Doc.Params {
+			params = append(params, ManifestParam{param.Name, param.Optional})
+		}
+		manifest.Templates = append(manifest.Templates, ManifestTemplate{
+			Name:       t.Node.Name,
+			Kind:       kind,
+			Params:     params,
+			SourceFile: filename,
+			OutputFile: outputFile(filename),
+		})
+	}
+	sort.Slice(manifest.Templates, func(i, j int) bool {
+		return manifest.Templates[i].Name < manifest.Templates[j].Name
+	})
+	return manifest
+}
+
+// WriteManifest writes the manifest of the templates in the registry to out,
+// as JSON.  See Manifest.
+func (gen *Generator) WriteManifest(out io.Writer, outputFile func(filename string) string) error {
+	var enc = json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(gen.Manifest(outputFile))
+}
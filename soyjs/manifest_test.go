@@ -0,0 +1,70 @@
+package soyjs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/robfig/soy/parse"
+	"github.com/robfig/soy/template"
+)
+
+func TestManifest(t *testing.T) {
+	var registry = template.Registry{}
+	for filename, soy := range map[string]string{
+		"page.soy": `{namespace page}
+/**
+ * @param title
+ * @param? user
+ */
+{template .page}{$title}{$user}{/template}`,
+		"widgets/text.soy": `{namespace widgets}
+{template .label kind="text"}label{/template}`,
+	} {
+		var soyfile, err = parse.SoyFile(filename, soy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = registry.Add(soyfile); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	var err = NewGenerator(&registry).WriteManifest(&buf, func(filename string) string {
+		return "js/" + strings.TrimSuffix(filename, ".soy") + ".js"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected = `{
+  "templates": [
+    {
+      "name": "page.page",
+      "kind": "html",
+      "params": [
+        {
+          "name": "title"
+        },
+        {
+          "name": "user",
+          "optional": true
+        }
+      ],
+      "sourceFile": "page.soy",
+      "outputFile": "js/page.js"
+    },
+    {
+      "name": "widgets.label",
+      "kind": "text",
+      "params": [],
+      "sourceFile": "widgets/text.soy",
+      "outputFile": "js/widgets/text.js"
+    }
+  ]
+}
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
@@ -26,6 +26,13 @@ func (s *scope) makevar(varname string) string {
 	return genName
 }
 
+// tempvar generates and returns a new JS name for a temporary variable, which
+// is not mapped to any soy variable.
+func (s *scope) tempvar(varname string) string {
+	s.n++
+	return varname + strconv.Itoa(s.n)
+}
+
 func (s *scope) lookup(varname string) string {
 	for i := range s.stack {
 		val, ok := s.stack[len(s.stack)-i-1][varname]
@@ -0,0 +1,310 @@
+// soytojs is a tool to compile Soy templates to javascript.
+//
+// Its flags follow those of the official compiler (SoyToJsSrcCompiler), so
+// that existing build scripts may switch to it without being rewritten.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/robfig/soy"
+	"github.com/robfig/soy/parse"
+	"github.com/robfig/soy/parsepasses"
+	"github.com/robfig/soy/soyjs"
+	"github.com/robfig/soy/template"
+)
+
+var (
+	outputPathFormat = flag.String("outputPathFormat", "",
+		"A format string that specifies how to build the path to each output file. "+
+			"It may include the tokens {INPUT_PREFIX}, {INPUT_DIRECTORY}, {INPUT_FILE_NAME}, "+
+			"and {INPUT_FILE_NAME_NO_EXT}.")
+	srcs                   = flag.String("srcs", "", "The list of source Soy files, separated by commas.")
+	inputPrefix            = flag.String("inputPrefix", "", "If provided, this path prefix is prepended to each input file path.")
+	compileTimeGlobalsFile = flag.String("compileTimeGlobalsFile", "",
+		"The path to a file containing the mappings for global names to be substituted at compile time.")
+	shouldProvideRequireSoyNamespaces = flag.Bool("shouldProvideRequireSoyNamespaces", false,
+		"Whether to generate goog.provide() and goog.require() calls for Soy namespaces.")
+	codeStyle                 = flag.String("codeStyle", "concat", "The code style to use. Only 'concat' is supported; 'stringbuilder' is treated as 'concat'.")
+	cssHandlingScheme         = flag.String("cssHandlingScheme", "literal", "The scheme to use for handling 'css' commands. Only 'literal' is supported.")
+	bidiGlobalDir             = flag.Int("bidiGlobalDir", 0, "The bidi global directionality (ltr=1, rtl=-1). Only ltr is supported.")
+	shouldGenerateGoogMsgDefs = flag.Bool("shouldGenerateGoogMsgDefs", false,
+		"Whether to generate goog.getMsg() definitions for messages. Not supported.")
+	shouldGenerateJsdoc = flag.Bool("shouldGenerateJsdoc", false,
+		"Whether to generate JSDoc for the templates. Not supported; ignored.")
+	isUsingIjData = flag.Bool("isUsingIjData", false,
+		"Whether injected data is used. Injected data is always allowed; setting it to false is not supported.")
+	locales = flag.String("locales", "", "Comma-delimited list of locales to generate. Not supported.")
+
+	stripAsserts    = flag.Bool("stripAsserts", false, "Whether to omit {assert} commands from the generated javascript.")
+	jsFormat        = flag.String("jsFormat", "es5", "The javascript format to generate: 'es5' or 'es6'.")
+	manifest        = flag.String("manifest", "", "If provided, the path to which to write a JSON manifest of the generated templates.")
+	hashOutputNames = flag.Bool("hashOutputNames", false,
+		"Whether to insert a hash of each output file's content into its name, as recorded in the manifest.")
+	watch = flag.Bool("watch", false,
+		"Whether to keep running, regenerating the output for each input file when it changes. "+
+			"The output files written are reported to stdout as a line of JSON, e.g. for live reload.")
+)
+
+func usage() {
+	fmt.Fprint(os.Stderr, `soytojs is a tool to compile Soy templates to javascript.
+
+Usage:
+
+	./soytojs --outputPathFormat FORMAT [FLAGS] [INPUTFILE]...
+
+Input files may be given as arguments or with --srcs.
+
+Flags:
+
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	var inputs = flag.Args()
+	if *srcs != "" {
+		inputs = append(inputs, strings.Split(*srcs, ",")...)
+	}
+	if len(inputs) == 0 || *outputPathFormat == "" {
+		usage()
+		os.Exit(1)
+	}
+	if err := checkFlags(os.Stderr); err != nil {
+		exit(err)
+	}
+
+	var options = soyjs.Options{
+		ProvideRequireSoyNamespaces: *shouldProvideRequireSoyNamespaces,
+		StripAsserts:                *stripAsserts,
+	}
+	if *jsFormat == "es6" {
+		options.Formatter = &soyjs.ES6Formatter{}
+	}
+
+	if *watch {
+		watchFiles(inputs, options)
+		return
+	}
+
+	// Parse all the sources.
+	var registry = template.Registry{}
+	for _, input := range inputs {
+		var filename = *inputPrefix + input
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			exit(err)
+		}
+		tree, err := parse.SoyFile(filename, string(content))
+		if err != nil {
+			exit(err)
+		}
+		if err = registry.Add(tree); err != nil {
+			exit(err)
+		}
+	}
+	if err := parsepasses.CheckDataRefs(registry); err != nil {
+		exit(err)
+	}
+	if *compileTimeGlobalsFile != "" {
+		var f, err = os.Open(*compileTimeGlobalsFile)
+		if err != nil {
+			exit(err)
+		}
+		globals, err := soy.ParseGlobals(f)
+		f.Close()
+		if err != nil {
+			exit(err)
+		}
+		if err = parsepasses.SetGlobals(registry, globals); err != nil {
+			exit(err)
+		}
+	}
+	parsepasses.ProcessMessages(registry)
+
+	// Generate the javascript for each file.
+	if *hashOutputNames {
+		var outputPaths = make(map[string]string)
+		for _, input := range inputs {
+			outputPaths[*inputPrefix+input] = filepath.ToSlash(outputPath(input))
+		}
+		var _, err = soyjs.NewGenerator(&registry).WriteAll(soyjs.DirStore(""), options,
+			func(filename string) string { return outputPaths[filename] },
+			filepath.ToSlash(*manifest))
+		if err != nil {
+			exit(err)
+		}
+		return
+	}
+
+	var outputPaths = make(map[string]string)
+	for i, soyfile := range registry.SoyFiles {
+		var buf bytes.Buffer
+		if err := soyjs.Write(&buf, soyfile, options); err != nil {
+			exit(fmt.Errorf("%s: %v", soyfile.Name, err))
+		}
+		var path = outputPath(inputs[i])
+		if err := writeFile(path, buf.Bytes()); err != nil {
+			exit(err)
+		}
+		outputPaths[soyfile.Name] = path
+	}
+
+	if err := writeManifest(&registry, outputPaths); err != nil {
+		exit(err)
+	}
+}
+
+// watchFiles generates the javascript for the inputs, and then regenerates it
+// for each one that changes, until the process is killed.  Each time, the paths
+// of the output files written are reported to stdout as a line of JSON:
+//
+//	{"files":["js/page.js"]}
+func watchFiles(inputs []string, options soyjs.Options) {
+	var outputPaths = make(map[string]string)
+	var bundle = soy.NewBundle().WatchFiles(true)
+	for _, input := range inputs {
+		var filename = *inputPrefix + input
+		outputPaths[filename] = outputPath(input)
+		bundle.AddTemplateFile(filename)
+	}
+	if *compileTimeGlobalsFile != "" {
+		bundle.AddGlobalsFile(*compileTimeGlobalsFile)
+	}
+
+	var inc = &soyjs.Incremental{
+		Store:      soyjs.DirStore(""),
+		Options:    options,
+		OutputName: func(filename string) string { return outputPaths[filename] },
+	}
+	var generate = func(registry *template.Registry) error {
+		var written, err = inc.Generate(registry)
+		if err == nil {
+			err = writeManifest(registry, outputPaths)
+		}
+		if len(written) > 0 {
+			json.NewEncoder(os.Stdout).Encode(struct {
+				Files []string `json:"files"`
+			}{written})
+		}
+		return err
+	}
+	bundle.SetRecompilationCallback(func(registry *template.Registry) {
+		if err := generate(registry); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	})
+
+	var registry, err = bundle.Compile()
+	if err != nil {
+		exit(err)
+	}
+	if err = generate(registry); err != nil {
+		exit(err)
+	}
+	select {}
+}
+
+// writeManifest writes the manifest of the generated templates to the path
+// given by --manifest, if any.
+func writeManifest(registry *template.Registry, outputPaths map[string]string) error {
+	if *manifest == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	var err = soyjs.NewGenerator(registry).WriteManifest(&buf, func(filename string) string {
+		return outputPaths[filename]
+	})
+	if err != nil {
+		return err
+	}
+	return writeFile(*manifest, buf.Bytes())
+}
+
+// checkFlags returns an error for flags that request behavior that is not
+// supported, and writes a warning to w for those that are ignored.
+func checkFlags(w io.Writer) error {
+	switch {
+	case *codeStyle != "concat" && *codeStyle != "stringbuilder":
+		return fmt.Errorf("invalid --codeStyle %q", *codeStyle)
+	case *cssHandlingScheme != "literal":
+		return fmt.Errorf("unsupported --cssHandlingScheme %q: only 'literal' is supported", *cssHandlingScheme)
+	case *bidiGlobalDir < 0:
+		return fmt.Errorf("unsupported --bidiGlobalDir %d: only ltr is supported", *bidiGlobalDir)
+	case *shouldGenerateGoogMsgDefs:
+		return fmt.Errorf("unsupported --shouldGenerateGoogMsgDefs")
+	case *locales != "" || strings.Contains(*outputPathFormat, "{LOCALE"):
+		return fmt.Errorf("unsupported --locales: localized output is not supported")
+	case *jsFormat != "es5" && *jsFormat != "es6":
+		return fmt.Errorf("invalid --jsFormat %q", *jsFormat)
+	case *watch && *hashOutputNames:
+		return fmt.Errorf("unsupported --hashOutputNames with --watch")
+	}
+	if *codeStyle == "stringbuilder" {
+		fmt.Fprintln(w, "warning: --codeStyle stringbuilder is not supported; generating concat")
+	}
+	if *shouldGenerateJsdoc {
+		fmt.Fprintln(w, "warning: --shouldGenerateJsdoc is not supported; ignored")
+	}
+	if isFlagSet("isUsingIjData") && !*isUsingIjData {
+		fmt.Fprintln(w, "warning: --isUsingIjData=false is not supported; templates may use $ij")
+	}
+	return nil
+}
+
+// isFlagSet returns true if the named flag was given on the command line.
+func isFlagSet(name string) bool {
+	var set bool
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// outputPath returns the path of the output file for the given input file,
+// according to the --outputPathFormat.
+func outputPath(input string) string {
+	var (
+		dir       = filepath.Dir(input)
+		name      = filepath.Base(input)
+		nameNoExt = strings.TrimSuffix(name, filepath.Ext(name))
+	)
+	if dir == "." {
+		dir = ""
+	} else {
+		dir += string(filepath.Separator)
+	}
+	return strings.NewReplacer(
+		"{INPUT_PREFIX}", *inputPrefix,
+		"{INPUT_DIRECTORY}", dir,
+		"{INPUT_FILE_NAME}", name,
+		"{INPUT_FILE_NAME_NO_EXT}", nameNoExt,
+	).Replace(*outputPathFormat)
+}
+
+// writeFile writes the content to the given path, creating its directory if
+// necessary.
+func writeFile(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0644)
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
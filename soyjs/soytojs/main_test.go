@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+)
+
+// parseFlags resets the flags of the tool to their defaults and parses the
+// given arguments, as flag.Parse would, into a new flag.CommandLine.
+func parseFlags(t *testing.T, commandLine *flag.FlagSet, args []string) {
+	var fs = flag.NewFlagSet("soytojs", flag.ContinueOnError)
+	commandLine.VisitAll(func(f *flag.Flag) {
+		if !strings.HasPrefix(f.Name, "test.") {
+			f.Value.Set(f.DefValue)
+			fs.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	flag.CommandLine = fs
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckFlags(t *testing.T) {
+	var tests = []struct {
+		args    []string
+		err     string
+		warning string
+	}{
+		{nil, "", ""},
+		{[]string{"--codeStyle", "concat", "--isUsingIjData"}, "", ""},
+		{[]string{"--codeStyle", "stringbuilder"}, "", "--codeStyle stringbuilder is not supported"},
+		{[]string{"--codeStyle", "other"}, `invalid --codeStyle "other"`, ""},
+		{[]string{"--isUsingIjData=false"}, "", "--isUsingIjData=false is not supported"},
+		{[]string{"--shouldGenerateJsdoc"}, "", "--shouldGenerateJsdoc is not supported"},
+		{[]string{"--cssHandlingScheme", "goog"}, "unsupported --cssHandlingScheme", ""},
+		{[]string{"--bidiGlobalDir", "-1"}, "unsupported --bidiGlobalDir", ""},
+		{[]string{"--shouldGenerateGoogMsgDefs"}, "unsupported --shouldGenerateGoogMsgDefs", ""},
+		{[]string{"--locales", "en,fr"}, "unsupported --locales", ""},
+		{[]string{"--jsFormat", "es3"}, `invalid --jsFormat "es3"`, ""},
+		{[]string{"--watch", "--hashOutputNames"}, "unsupported --hashOutputNames with --watch", ""},
+	}
+	var commandLine = flag.CommandLine
+	defer func() { flag.CommandLine = commandLine }()
+	for _, test := range tests {
+		parseFlags(t, commandLine, test.args)
+		var warnings bytes.Buffer
+		var err = checkFlags(&warnings)
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%v: expected error %q, got %v", test.args, test.err, err)
+		}
+		if test.warning == "" && warnings.Len() > 0 || !strings.Contains(warnings.String(), test.warning) {
+			t.Errorf("%v: expected warning %q, got %q", test.args, test.warning, warnings.String())
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package soyjs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Store saves generated files, e.g. to a directory, to memory, or to a blob
+// store such as S3.
+type Store interface {
+	// Put saves the content under the given slash-separated name.
+	Put(name string, content []byte) error
+}
+
+// DirStore is a Store that writes files under the directory it names, creating
+// subdirectories as necessary.
+type DirStore string
+
+func (dir DirStore) Put(name string, content []byte) error {
+	var filename = filepath.Join(string(dir), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, content, 0644)
+}
+
+// MemStore is a Store that keeps files in memory, by name.
+type MemStore map[string][]byte
+
+func (m MemStore) Put(name string, content []byte) error {
+	m[name] = content
+	return nil
+}
+
+// StoreFunc adapts a function to a Store, e.g. to upload to a blob store.
+type StoreFunc func(name string, content []byte) error
+
+func (fn StoreFunc) Put(name string, content []byte) error {
+	return fn(name, content)
+}
+
+// HashedName returns the name with a hash of the content inserted before its
+// extension, e.g. "js/page.js" becomes "js/page.1a2b3c4d.js", so that the file
+// may be cached indefinitely.
+func HashedName(name string, content []byte) string {
+	var sum = sha256.Sum256(content)
+	var ext = path.Ext(name)
+	return name[:len(name)-len(ext)] + "." + hex.EncodeToString(sum[:4]) + ext
+}
+
+// WriteAll generates the javascript for each soy file in the registry and puts
+// it in the store under a content-hashed name (see HashedName).  The
+// outputName function is given the name of each soy file, and returns the
+// unhashed name of its javascript file.
+//
+// The returned manifest records the hashed name of each file, and is also put
+// in the store as JSON under manifestName, if it is not empty.  Since it is
+// written last, the presence of the manifest indicates that all the files it
+// refers to have been stored.
+func (gen *Generator) WriteAll(store Store, opts Options, outputName func(filename string) string, manifestName string) (Manifest, error) {
+	var files = make(map[string]string)
+	for _, soyfile := range gen.registry.SoyFiles {
+		var buf bytes.Buffer
+		if err := Write(&buf, soyfile, opts); err != nil {
+			return Manifest{}, fmt.Errorf("%s: %v", soyfile.Name, err)
+		}
+		var name = outputName(soyfile.Name)
+		var hashed = HashedName(name, buf.Bytes())
+		if err := store.Put(hashed, buf.Bytes()); err != nil {
+			return Manifest{}, err
+		}
+		files[name] = hashed
+	}
+
+	var manifest = gen.Manifest(func(filename string) string {
+		return files[outputName(filename)]
+	})
+	manifest.Files = files
+	if manifestName == "" {
+		return manifest, nil
+	}
+	var buf, err = json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return Manifest{}, err
+	}
+	return manifest, store.Put(manifestName, append(buf, '\n'))
+}
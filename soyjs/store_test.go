@@ -0,0 +1,91 @@
+package soyjs
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/robfig/soy/parse"
+	"github.com/robfig/soy/template"
+)
+
+func TestHashedName(t *testing.T) {
+	var tests = []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"page.js", "", "page.e3b0c442.js"},
+		{"js/page.js", "abc", "js/page.ba7816bf.js"},
+		{"v1.2/page", "abc", "v1.2/page.ba7816bf"},
+	}
+	for _, test := range tests {
+		var actual = HashedName(test.name, []byte(test.content))
+		if actual != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestWriteAll(t *testing.T) {
+	var registry = template.Registry{}
+	for _, soy := range []struct{ filename, content string }{
+		{"page.soy", "{namespace page}\n{template .page}<h1>page</h1>{/template}"},
+		{"widgets/button.soy", "{namespace widgets}\n{template .button}<button></button>{/template}"},
+	} {
+		var soyfile, err = parse.SoyFile(soy.filename, soy.content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = registry.Add(soyfile); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var store = make(MemStore)
+	var manifest, err = NewGenerator(&registry).WriteAll(store, Options{}, func(filename string) string {
+		return "js/" + filename + ".js"
+	}, "manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hashed = regexp.MustCompile(`^js/(page|widgets/button)\.soy\.[0-9a-f]{8}\.js$`)
+	if len(manifest.Files) != 2 {
+		t.Fatalf("expected 2 files, got %v", manifest.Files)
+	}
+	for name, hashedName := range manifest.Files {
+		if !hashed.MatchString(hashedName) {
+			t.Errorf("%s: unexpected hashed name %q", name, hashedName)
+		}
+		var content, ok = store[hashedName]
+		if !ok {
+			t.Errorf("%s: not stored", hashedName)
+		} else if HashedName(name, content) != hashedName {
+			t.Errorf("%s: hash does not match content", hashedName)
+		}
+	}
+	for _, tmpl := range manifest.Templates {
+		if _, ok := store[tmpl.OutputFile]; !ok {
+			t.Errorf("%s: output file %q not stored", tmpl.Name, tmpl.OutputFile)
+		}
+	}
+
+	var stored Manifest
+	if err = json.Unmarshal(store["manifest.json"], &stored); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stored, manifest) {
+		t.Errorf("expected stored manifest %v, got %v", manifest, stored)
+	}
+
+	var errFull = errors.New("store is full")
+	_, err = NewGenerator(&registry).WriteAll(StoreFunc(func(string, []byte) error {
+		return errFull
+	}), Options{}, func(filename string) string { return filename + ".js" }, "")
+	if err != errFull {
+		t.Errorf("expected %v, got %v", errFull, err)
+	}
+}
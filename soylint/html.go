@@ -0,0 +1,105 @@
+package soylint
+
+import (
+	"strings"
+
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/internal/htmltok"
+)
+
+// dynamic stands in for output that is only known at render time, such as
+// {print} and {call}, in the HTML of a template.
+const dynamic = '\x00'
+
+// tag is an HTML start or end tag found in the raw text of a template.
+type tag struct {
+	name    string
+	end     bool              // true for an end tag
+	attrs   map[string]string // static attribute values, by lowercase name
+	dynamic map[string]bool   // attributes with a value computed at render time
+	unknown bool              // true if the tag has attributes computed at render time
+	node    ast.Node          // node containing the start of the tag
+}
+
+// has returns true if the tag has the named attribute, static or dynamic.
+func (t *tag) has(name string) bool {
+	_, ok := t.attrs[name]
+	return ok || t.dynamic[name]
+}
+
+// segment records the node that produced the HTML starting at an offset.
+type segment struct {
+	start int
+	node  ast.Node
+}
+
+// matchTags returns the HTML tags in the template body, in order.  The body is
+// read as if every branch of each conditional and loop were rendered once, and
+// tags that span {print} and other commands are matched across them.
+func matchTags(body ast.Node) []*tag {
+	var html strings.Builder
+	var segments []segment
+	ast.Inspect(body, func(node ast.Node) bool {
+		var text string
+		switch node := node.(type) {
+		case *ast.RawTextNode:
+			text = string(node.Text)
+		case *ast.MsgHtmlTagNode:
+			text = string(node.Text)
+		case *ast.PrintNode, *ast.CallNode, *ast.CssNode:
+			text = string(dynamic)
+		default:
+			return true
+		}
+		segments = append(segments, segment{html.Len(), node})
+		html.WriteString(text)
+		return false
+	})
+
+	var tags []*tag
+	for _, tok := range htmltok.Tokenize(html.String()) {
+		switch tok.Kind {
+		case htmltok.EndTag:
+			if tok.Data != "" {
+				tags = append(tags, &tag{name: tok.Data, end: true, node: nodeAt(segments, tok.Offset)})
+			}
+		case htmltok.StartTag:
+			tags = append(tags, newTag(tok, nodeAt(segments, tok.Offset)))
+		}
+	}
+	return tags
+}
+
+// newTag returns the tag for the given start tag token, separating the
+// attributes whose values are computed at render time.
+func newTag(tok htmltok.Token, node ast.Node) *tag {
+	var t = &tag{
+		name:    tok.Data,
+		attrs:   make(map[string]string),
+		dynamic: make(map[string]bool),
+		node:    node,
+	}
+	for _, attr := range tok.Attrs {
+		switch {
+		case strings.ContainsRune(attr.Name, dynamic):
+			t.unknown = true
+		case strings.ContainsRune(attr.Value, dynamic):
+			t.dynamic[attr.Name] = true
+		default:
+			t.attrs[attr.Name] = attr.Value
+		}
+	}
+	return t
+}
+
+// nodeAt returns the node that produced the HTML at the given offset.
+func nodeAt(segments []segment, offset int) ast.Node {
+	var node ast.Node
+	for _, seg := range segments {
+		if seg.start > offset {
+			break
+		}
+		node = seg.node
+	}
+	return node
+}
@@ -0,0 +1,227 @@
+// Package soylint reports likely problems in Soy templates that are not errors
+// in the language, such as accessibility problems in the HTML they render, or
+// templates too large or complex to maintain (see Measure).
+//
+// Each rule has a severity, which may be configured:
+//
+//	var issues = soylint.Lint(registry, soylint.Options{
+//		Config: soylint.Config{
+//			soylint.PositiveTabindex: soylint.Error,
+//			soylint.LabelAssociation: soylint.Off,
+//		},
+//	})
+package soylint
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/template"
+)
+
+// Severity is how serious a rule's issues are.
+type Severity int
+
+const (
+	Off     Severity = iota // the rule is not checked
+	Warning                 // the issue should be fixed
+	Error                   // the issue must be fixed
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Off:
+		return "off"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// The names of the rules.
+const (
+	// ImgAlt reports <img> elements with no text alternative: an alt,
+	// aria-label, or aria-labelledby attribute.  Decorative images should have
+	// alt="".
+	ImgAlt = "img-alt"
+
+	// LabelAssociation reports form controls with no label: they are neither
+	// within a <label>, nor the target of a <label for>, nor given an
+	// aria-label, aria-labelledby, or title attribute.
+	LabelAssociation = "label-association"
+
+	// PositiveTabindex reports elements with a tabindex greater than zero,
+	// which overrides the document's tab order.
+	PositiveTabindex = "positive-tabindex"
+
+	// The complexity rules report templates whose Metrics exceed the
+	// Limits, and so are likely to be hard to maintain.
+	TemplateSize   = "template-size"         // Nodes
+	NestingDepth   = "nesting-depth"         // Nesting
+	ParamCount     = "param-count"           // Params
+	CallFanOut     = "call-fan-out"          // Calls
+	ExprComplexity = "expression-complexity" // Expr
+)
+
+// Config maps rule names to the severity to report their issues with.  Rules
+// that are not present have their DefaultConfig severity.
+type Config map[string]Severity
+
+// DefaultConfig is the severity of each rule, unless configured otherwise.
+var DefaultConfig = Config{
+	ImgAlt:           Error,
+	LabelAssociation: Warning,
+	PositiveTabindex: Warning,
+	TemplateSize:     Warning,
+	NestingDepth:     Warning,
+	ParamCount:       Warning,
+	CallFanOut:       Warning,
+	ExprComplexity:   Warning,
+}
+
+// Options controls the rules checked by Lint.  The zero value checks each
+// rule with its DefaultConfig severity and the DefaultLimits.
+type Options struct {
+	// Config is the severity of each rule.
+	Config Config
+
+	// Limits are the limits checked by the complexity rules, or nil for the
+	// DefaultLimits.
+	Limits *Limits
+}
+
+// Issue is a problem found in a template.
+type Issue struct {
+	Rule      string
+	Severity  Severity
+	Template  string // fully-qualified name of the template
+	File      string
+	Line, Col int
+	Message   string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s: %s (%s)",
+		i.File, i.Line, i.Col, i.Severity, i.Template, i.Message, i.Rule)
+}
+
+// Lint checks each template in the registry against the rules, and returns
+// the issues found in the order of the templates.  Since the HTML of a template
+// is read as written, without rendering it, issues that depend on attributes
+// computed at render time are not reported.
+func Lint(reg template.Registry, opts Options) []Issue {
+	var severity = func(rule string) Severity {
+		if s, ok := opts.Config[rule]; ok {
+			return s
+		}
+		return DefaultConfig[rule]
+	}
+	var limits = DefaultLimits
+	if opts.Limits != nil {
+		limits = *opts.Limits
+	}
+
+	var issues []Issue
+	for _, t := range reg.Templates {
+		var name = t.Node.Name
+		var report = func(rule string, node ast.Node, format string, args ...interface{}) {
+			var s = severity(rule)
+			if s == Off {
+				return
+			}
+			issues = append(issues, Issue{
+				Rule:     rule,
+				Severity: s,
+				Template: name,
+				File:     reg.Filename(name),
+				Line:     reg.LineNumber(name, node),
+				Col:      reg.ColNumber(name, node),
+				Message:  fmt.Sprintf(format, args...),
+			})
+		}
+
+		var tags = matchTags(t.Node.Body)
+		var labelled = labelledIDs(tags)
+		var labels = 0 // depth of open <label> elements
+		for _, tag := range tags {
+			if tag.name == "label" {
+				if !tag.end {
+					labels++
+				} else if labels > 0 {
+					labels--
+				}
+				continue
+			}
+			if tag.end {
+				continue
+			}
+
+			if tag.name == "img" && !tag.unknown &&
+				!tag.has("alt") && !tag.has("aria-label") && !tag.has("aria-labelledby") {
+				report(ImgAlt, tag.node, "<img> has no alt attribute")
+			}
+			if isLabelable(tag) && labels == 0 && !tag.unknown &&
+				!tag.has("aria-label") && !tag.has("aria-labelledby") && !tag.has("title") &&
+				!tag.dynamic["id"] && !labelled[tag.attrs["id"]] {
+				report(LabelAssociation, tag.node, "<%s> has no associated <label>", tag.name)
+			}
+			if n, err := strconv.Atoi(strings.TrimSpace(tag.attrs["tabindex"])); err == nil && n > 0 {
+				report(PositiveTabindex, tag.node, "<%s> has a positive tabindex (%d)", tag.name, n)
+			}
+		}
+
+		var m = measure(t)
+		var checks = []struct {
+			rule         string
+			value, limit int
+			node         ast.Node
+			what         string
+		}{
+			{TemplateSize, m.Nodes, limits.Nodes, t.Node, "nodes"},
+			{NestingDepth, m.Nesting, limits.Nesting, m.deepest, "levels of nested blocks"},
+			{ParamCount, m.Params, limits.Params, t.Node, "params"},
+			{CallFanOut, m.Calls, limits.Calls, t.Node, "templates called"},
+			{ExprComplexity, m.Expr, limits.Expr, m.expr, "nodes in an expression"},
+		}
+		for _, check := range checks {
+			if check.limit > 0 && check.value > check.limit {
+				report(check.rule, check.node, "%d %s (limit %d)", check.value, check.what, check.limit)
+			}
+		}
+	}
+	return issues
+}
+
+// labelledIDs returns the ids referenced by <label for> in the given tags.
+func labelledIDs(tags []*tag) map[string]bool {
+	var ids = make(map[string]bool)
+	for _, tag := range tags {
+		if tag.name == "label" && !tag.end && tag.attrs["for"] != "" {
+			ids[tag.attrs["for"]] = true
+		}
+	}
+	return ids
+}
+
+// isLabelable returns true if the tag is a form control that should have a
+// label.
+func isLabelable(t *tag) bool {
+	switch t.name {
+	case "select", "textarea":
+		return true
+	case "input":
+		if t.dynamic["type"] {
+			return false
+		}
+		switch strings.ToLower(t.attrs["type"]) {
+		case "hidden", "submit", "reset", "button", "image":
+			return false
+		}
+		return true
+	}
+	return false
+}
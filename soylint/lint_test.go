@@ -0,0 +1,117 @@
+package soylint
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/robfig/soy/parse"
+	"github.com/robfig/soy/template"
+)
+
+type lintTest struct {
+	name   string
+	body   string
+	issues []string // rule names
+}
+
+func TestLint(t *testing.T) {
+	runLintTests(t, Options{}, []lintTest{
+		{"img alt", `<img src="a.png" alt="A"><img src="b.png" alt=""><img src="c.png">`,
+			[]string{ImgAlt}},
+		{"img aria", `<img src="a.png" aria-label="A"><img src="b.png" aria-labelledby="b">`, nil},
+		{"img dynamic alt", `<img src="a.png" alt="{$alt}">`, nil},
+		{"img conditional alt", `<img src="a.png" {if $alt}alt="{$alt}"{/if}>`, nil},
+		{"img dynamic attrs", `<img src="a.png" {$attrs |noAutoescape}>`, nil},
+		{"img in msg", `{msg desc=""}<img src="a.png">{/msg}`, []string{ImgAlt}},
+		{"img in comment", `<!-- <img src="a.png"> -->`, nil},
+		{"img in script", `<script>var s = '<img src="a.png">';</script><img src="b.png" alt="">`, nil},
+
+		{"label wrapped", `<label>Name <input name="name"></label>`, nil},
+		{"label for", `<label for="name">Name</label><input id="name" name="name">`, nil},
+		{"label for later", `<input id="name"><label for="name">Name</label>`, nil},
+		{"label missing", `<label>Name</label><input name="name">`, []string{LabelAssociation}},
+		{"label wrong id", `<label for="a">A</label><input id="b">`, []string{LabelAssociation}},
+		{"label aria", `<input aria-label="Search"><select title="Size"></select>`, nil},
+		{"label kinds", `<textarea></textarea><select></select><input type="checkbox">`,
+			[]string{LabelAssociation, LabelAssociation, LabelAssociation}},
+		{"label exempt", `<input type="hidden"><input type="submit"><INPUT TYPE="Button">`, nil},
+		{"label dynamic id", `<label for="{$id}">A</label><input id="{$id}">`, nil},
+
+		{"tabindex", `<div tabindex="0"></div><div tabindex="-1"></div><a tabindex="3" href="#">a</a>`,
+			[]string{PositiveTabindex}},
+		{"tabindex unquoted", `<div tabindex=2></div>`, []string{PositiveTabindex}},
+		{"tabindex dynamic", `<div tabindex="{$i}"></div>`, nil},
+	})
+}
+
+func TestLintConfig(t *testing.T) {
+	var body = `<img src="a.png"><input name="a"><div tabindex="1"></div>`
+	var reg = registry(t, body)
+
+	var issues = Lint(reg, Options{Config: Config{ImgAlt: Warning, LabelAssociation: Off}})
+	var severities []Severity
+	for _, issue := range issues {
+		severities = append(severities, issue.Severity)
+	}
+	if expected := []Severity{Warning, Warning}; !reflect.DeepEqual(severities, expected) {
+		t.Errorf("expected %v, got %v", expected, severities)
+	}
+
+	issues = Lint(reg, Options{})
+	if len(issues) != 3 {
+		t.Fatalf("expected 3 issues, got %v", issues)
+	}
+	var expected = `test.soy:4:2: error: test.lint: <img> has no alt attribute (img-alt)`
+	if issues[0].String() != expected {
+		t.Errorf("expected %q, got %q", expected, issues[0].String())
+	}
+}
+
+func TestLintComplexity(t *testing.T) {
+	var limits = Limits{Nodes: 14, Nesting: 2, Calls: 1, Expr: 3}
+	runLintTests(t, Options{Limits: &limits}, []lintTest{
+		{"simple", `{if $a}{$a + 1}{/if}`, nil},
+		{"nesting", `{if $a}{foreach $b in $a}{if $b}x{/if}{/foreach}{/if}`, []string{NestingDepth}},
+		{"calls", `{call .a /}{call .b /}{call .a /}`, []string{CallFanOut}},
+		{"expr", `{$a + $b * 2}`, []string{ExprComplexity}},
+		{"size", `{if $a}a{/if}{if $b}b{/if}{if $c}c{/if}`, []string{TemplateSize}},
+	})
+
+	limits.Nesting = 0
+	runLintTests(t, Options{Config: Config{TemplateSize: Off}, Limits: &limits}, []lintTest{
+		{"unchecked", `{if $a}{foreach $b in $a}{if $b}x{/if}{/foreach}{/if}`, nil},
+	})
+
+	var issues = Lint(registry(t, "\n{$a + $b * 2}"), Options{Limits: &Limits{Expr: 3}})
+	var expected = `test.soy:4:7: warning: test.lint: 5 nodes in an expression (limit 3) (expression-complexity)`
+	if len(issues) != 1 || issues[0].String() != expected {
+		t.Errorf("expected %q, got %v", expected, issues)
+	}
+}
+
+func runLintTests(t *testing.T, opts Options, tests []lintTest) {
+	for _, test := range tests {
+		var rules []string
+		for _, issue := range Lint(registry(t, test.body), opts) {
+			rules = append(rules, issue.Rule)
+		}
+		if !reflect.DeepEqual(rules, test.issues) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.issues, rules)
+		}
+	}
+}
+
+func registry(t *testing.T, body string) template.Registry {
+	var soyfile, err = parse.SoyFile("test.soy", `{namespace test}
+{template .lint}
+`+body+`
+{/template}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reg template.Registry
+	if err = reg.Add(soyfile); err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
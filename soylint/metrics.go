@@ -0,0 +1,115 @@
+package soylint
+
+import (
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/template"
+)
+
+// Metrics measures the size and complexity of a template.
+type Metrics struct {
+	Template string // fully-qualified name of the template
+	Nodes    int    // number of nodes in the template, including expressions
+	Nesting  int    // deepest nesting of blocks: {if}, {switch}, {foreach}, {msg}, etc
+	Params   int    // number of params declared
+	Calls    int    // number of distinct templates called
+	Expr     int    // number of nodes in the most complex expression
+
+	deepest ast.Node // the most deeply nested block
+	expr    ast.Node // the most complex expression
+}
+
+// Limits are the greatest values of each metric that a template may have
+// before it is reported by the complexity rules.  A limit of zero is not
+// checked.
+type Limits struct {
+	Nodes, Nesting, Params, Calls, Expr int
+}
+
+// DefaultLimits are the limits checked by Lint unless Options.Limits is set.
+var DefaultLimits = Limits{
+	Nodes:   500,
+	Nesting: 6,
+	Params:  15,
+	Calls:   12,
+	Expr:    20,
+}
+
+// Measure returns the metrics of each template in the registry, in the order
+// of the templates.
+func Measure(reg template.Registry) []Metrics {
+	var metrics = make([]Metrics, len(reg.Templates))
+	for i, t := range reg.Templates {
+		metrics[i] = measure(t)
+	}
+	return metrics
+}
+
+// measure returns the metrics of the given template.
+func measure(t template.Template) Metrics {
+	var m = Metrics{Template: t.Node.Name, deepest: t.Node}
+	if t.Doc != nil {
+		m.Params = len(t.Doc.Params)
+	}
+	var called = make(map[string]bool)
+	var walk func(node ast.Node, depth int)
+	walk = func(node ast.Node, depth int) {
+		if node == nil {
+			return
+		}
+		m.Nodes++
+		switch node := node.(type) {
+		case *ast.CallNode:
+			called[node.Name] = true
+		case *ast.IfNode, *ast.SwitchNode, *ast.ForNode, *ast.MsgNode, *ast.MsgPluralNode,
+			*ast.LetContentNode, *ast.CallParamContentNode:
+			depth++
+			if depth > m.Nesting {
+				m.Nesting, m.deepest = depth, node
+			}
+		}
+		var parent, ok = node.(ast.ParentNode)
+		if !ok {
+			return
+		}
+		for _, child := range parent.Children() {
+			if child == nil || isStatement(child) {
+				walk(child, depth)
+				continue
+			}
+			var size = exprSize(child)
+			m.Nodes += size
+			if size > m.Expr {
+				m.Expr, m.expr = size, child
+			}
+		}
+	}
+	walk(t.Node.Body, 0)
+	m.Calls = len(called)
+	return m
+}
+
+// exprSize returns the number of nodes in the given expression.
+func exprSize(expr ast.Node) int {
+	var size = 0
+	ast.Inspect(expr, func(ast.Node) bool {
+		size++
+		return true
+	})
+	return size
+}
+
+// isStatement returns true if the node is a command or text in the template,
+// rather than an expression within one.
+func isStatement(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.ListNode, *ast.RawTextNode, *ast.PrintNode, *ast.PrintDirectiveNode,
+		*ast.LiteralNode, *ast.CssNode, *ast.LogNode, *ast.DebuggerNode, *ast.AssertNode,
+		*ast.KeyNode, *ast.LetValueNode, *ast.LetContentNode,
+		*ast.MsgNode, *ast.MsgPlaceholderNode, *ast.MsgHtmlTagNode, *ast.MsgPluralNode,
+		*ast.MsgPluralCaseNode, *ast.CallNode, *ast.CallParamValueNode,
+		*ast.CallParamContentNode, *ast.IfNode, *ast.IfCondNode, *ast.SwitchNode,
+		*ast.SwitchCaseNode, *ast.ForNode:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package soylint
+
+import (
+	"testing"
+
+	"github.com/robfig/soy/parse"
+	"github.com/robfig/soy/template"
+)
+
+func TestMeasure(t *testing.T) {
+	var soyfile, err = parse.SoyFile("test.soy", `{namespace test}
+
+/**
+ * @param items
+ * @param? title
+ */
+{template .list}
+{if $title}<h1>{$title}</h1>{/if}
+{foreach $item in $items}
+  {if $item.visible and ($item.count > 0 or $item.pinned)}
+    {call .item data="$item" /}
+  {else}
+    {call .item}{param title kind="text"}{if $title}{$title}{/if}{/param}{/call}
+  {/if}
+  {call test.other.empty /}
+{/foreach}
+{/template}
+
+{template .item}
+Hello
+{/template}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reg template.Registry
+	if err = reg.Add(soyfile); err != nil {
+		t.Fatal(err)
+	}
+
+	var metrics = Measure(reg)
+	if len(metrics) != 2 {
+		t.Fatalf("expected 2 templates, got %v", metrics)
+	}
+	var list = metrics[0]
+	if list.Template != "test.list" || list.Params != 2 || list.Calls != 2 || list.Nesting != 4 {
+		t.Errorf("unexpected metrics: %+v", list)
+	}
+	// $item.visible and ($item.count > 0 or $item.pinned): and, or, >, 0, and
+	// three data refs with a key each.
+	if list.Expr != 10 {
+		t.Errorf("expected an expression of 10 nodes, got %d (%v)", list.Expr, list.expr)
+	}
+	if list.Nodes <= list.Expr {
+		t.Errorf("expected more nodes than in the expression, got %d", list.Nodes)
+	}
+
+	var item = metrics[1]
+	if item.Params != 0 || item.Calls != 0 || item.Nesting != 0 || item.Expr != 0 || item.Nodes != 2 {
+		t.Errorf("unexpected metrics: %+v", item)
+	}
+}
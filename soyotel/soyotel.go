@@ -0,0 +1,72 @@
+// Package soyotel records the templates executed by soyhtml with OpenTelemetry:
+// each render and template call as a span, and its duration as a metric.
+//
+// It is a separate module, so that programs that do not use it do not depend
+// on OpenTelemetry.  To use it, set it as the Tracer of a Tofu:
+//
+//	tracer, err := soyotel.New(otel.GetTracerProvider(), otel.GetMeterProvider())
+//	if err != nil { ... }
+//	tofu.WithTracer(tracer)
+//
+// Renderers given a context with WithContext record the spans of their
+// templates as children of the span of that context, e.g. that of the request.
+package soyotel
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the name of the instrumentation scope of the spans and metrics.
+const ScopeName = "github.com/robfig/soy/soyotel"
+
+// The names of the attributes of spans and metrics.
+const (
+	TemplateKey = attribute.Key("soy.template") // the fully-qualified template name
+	ErrorKey    = attribute.Key("soy.error")    // whether the template failed
+)
+
+// DurationName is the name of the histogram of template durations, in seconds.
+const DurationName = "soy.template.duration"
+
+// Tracer implements soyhtml.Tracer, recording each template as a span named
+// "soy " followed by the template name, and its duration in the histogram.
+// It is safe for concurrent use.
+type Tracer struct {
+	tracer   trace.Tracer
+	duration metric.Float64Histogram
+}
+
+// New returns a Tracer that records spans with the given TracerProvider and
+// metrics with the given MeterProvider.
+func New(tp trace.TracerProvider, mp metric.MeterProvider) (*Tracer, error) {
+	var duration, err = mp.Meter(ScopeName).Float64Histogram(DurationName,
+		metric.WithDescription("The time taken to execute a soy template, including the templates it calls."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	return &Tracer{tp.Tracer(ScopeName), duration}, nil
+}
+
+// StartTemplate starts the span of the named template.
+func (t *Tracer) StartTemplate(ctx context.Context, name string) (context.Context, func(error)) {
+	var start = time.Now()
+	ctx, span := t.tracer.Start(ctx, "soy "+name,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(TemplateKey.String(name)))
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		t.duration.Record(ctx, time.Since(start).Seconds(),
+			metric.WithAttributes(TemplateKey.String(name), ErrorKey.Bool(err != nil)))
+	}
+}
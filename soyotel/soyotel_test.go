@@ -0,0 +1,69 @@
+package soyotel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/robfig/soy/soyhtml"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ soyhtml.Tracer = (*Tracer)(nil)
+
+func TestTracer(t *testing.T) {
+	var spans = tracetest.NewSpanRecorder()
+	var reader = sdkmetric.NewManualReader()
+	var tracer, err = New(
+		sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)),
+		sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A page that calls an item, which fails.
+	var ctx, endPage = tracer.StartTemplate(context.Background(), "test.page")
+	var _, endItem = tracer.StartTemplate(ctx, "test.item")
+	endItem(errors.New("failed"))
+	endPage(nil)
+
+	var ended = spans.Ended()
+	if len(ended) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(ended))
+	}
+	var item, page = ended[0], ended[1]
+	if item.Name() != "soy test.item" || page.Name() != "soy test.page" {
+		t.Errorf("unexpected span names: %q, %q", item.Name(), page.Name())
+	}
+	if item.Parent().SpanID() != page.SpanContext().SpanID() {
+		t.Error("expected the item's span to be a child of the page's")
+	}
+	if item.Status().Code != codes.Error || page.Status().Code != codes.Unset {
+		t.Errorf("unexpected statuses: %v, %v", item.Status(), page.Status())
+	}
+	if attrs := page.Attributes(); len(attrs) != 1 || attrs[0] != TemplateKey.String("test.page") {
+		t.Errorf("unexpected attributes: %v", attrs)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err = reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	var hist = rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Histogram[float64])
+	var failed = make(map[string]bool)
+	for _, point := range hist.DataPoints {
+		var name, _ = point.Attributes.Value(TemplateKey)
+		var isErr, _ = point.Attributes.Value(ErrorKey)
+		failed[name.AsString()] = isErr.AsBool()
+		if point.Count != 1 {
+			t.Errorf("%s: expected 1 measurement, got %d", name.AsString(), point.Count)
+		}
+	}
+	if len(failed) != 2 || !failed["test.item"] || failed["test.page"] {
+		t.Errorf("unexpected measurements: %v", failed)
+	}
+}
@@ -0,0 +1,130 @@
+package soytest
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/soyhtml"
+	"github.com/robfig/soy/template"
+)
+
+// Failure is a render of a template that failed in Fuzz.
+type Failure struct {
+	Template string   // fully-qualified name of the template
+	Case     string   // "empty", "null", or "random N"
+	Data     data.Map // the data with which the template was rendered
+	Err      error    // the error returned by the render
+}
+
+// Panicked returns true if the render panicked, e.g. in a function given
+// unexpected data, rather than failing with an error raised by the template,
+// such as printing an undefined value.
+func (f Failure) Panicked() bool {
+	var renderErr *soyhtml.RenderError
+	return errors.As(f.Err, &renderErr)
+}
+
+func (f Failure) String() string {
+	return fmt.Sprintf("%s (%s data %v): %v", f.Template, f.Case, f.Data, f.Err)
+}
+
+// Fuzz renders every template in the registry with data that its authors may
+// not have expected, and returns the renders that failed, in order to find
+// templates that are missing guards against null or unexpected data.  Each
+// template is rendered:
+//
+//   - "empty": with no data
+//   - "null": with each of its params null
+//   - "random 1" to "random n": with each of its params a random value of a
+//     random type, including nested lists and maps
+//
+// The templates are rendered by the given tofu, or by a new one for the
+// registry if nil.  The random data is the same for each call.
+//
+//	for _, failure := range soytest.Fuzz(registry, nil, 10) {
+//		t.Error(failure)
+//	}
+func Fuzz(reg *template.Registry, tofu *soyhtml.Tofu, n int) []Failure {
+	if tofu == nil {
+		tofu = soyhtml.NewTofu(reg)
+	}
+	var rnd = rand.New(rand.NewSource(1))
+	var failures []Failure
+	for _, t := range reg.Templates {
+		var params []string
+		if t.Doc != nil {
+			for _, param := range t.Doc.Params {
+				params = append(params, param.Name)
+			}
+		}
+		var cases = []fuzzCase{
+			{"empty", data.Map{}},
+			{"null", fillMap(params, func() data.Value { return data.Null{} })},
+		}
+		for i := 1; i <= n; i++ {
+			cases = append(cases, fuzzCase{fmt.Sprintf("random %d", i),
+				fillMap(params, func() data.Value { return randomValue(rnd, 2) })})
+		}
+		for _, c := range cases {
+			if err := tofu.NewRenderer(t.Node.Name).Execute(ioutil.Discard, c.data); err != nil {
+				failures = append(failures, Failure{t.Node.Name, c.name, c.data, err})
+			}
+		}
+	}
+	return failures
+}
+
+// fuzzCase is the data for one render of a template by Fuzz.
+type fuzzCase struct {
+	name string
+	data data.Map
+}
+
+// fillMap returns a map of the given keys to values returned by val.
+func fillMap(keys []string, val func() data.Value) data.Map {
+	var m = make(data.Map, len(keys))
+	for _, key := range keys {
+		m[key] = val()
+	}
+	return m
+}
+
+// fuzzKeys are the keys of random maps.  Templates are unlikely to access
+// them, so that accesses of the map's fields find them undefined.
+var fuzzKeys = []string{"a", "b", "c"}
+
+// randomValue returns a value of a random type, which is nested no more than
+// the given depth.
+func randomValue(rnd *rand.Rand, depth int) data.Value {
+	var kinds = 7
+	if depth == 0 {
+		kinds = 5 // no lists or maps
+	}
+	switch rnd.Intn(kinds) {
+	case 0:
+		return data.Null{}
+	case 1:
+		return data.Bool(rnd.Intn(2) == 0)
+	case 2:
+		return data.Int(rnd.Intn(201) - 100)
+	case 3:
+		return data.Float(rnd.NormFloat64() * 100)
+	case 4:
+		var strs = []string{"", "a", "<b>&amp;\"'", "\u202eé\U0001f600"}
+		return data.String(strs[rnd.Intn(len(strs))])
+	case 5:
+		var list = make(data.List, rnd.Intn(3))
+		for i := range list {
+			list[i] = randomValue(rnd, depth-1)
+		}
+		return list
+	}
+	var m = make(data.Map)
+	for _, key := range fuzzKeys[:rnd.Intn(len(fuzzKeys)+1)] {
+		m[key] = randomValue(rnd, depth-1)
+	}
+	return m
+}
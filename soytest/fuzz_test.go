@@ -0,0 +1,69 @@
+package soytest
+
+import (
+	"testing"
+
+	"github.com/robfig/soy"
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/soyhtml"
+)
+
+func TestFuzz(t *testing.T) {
+	var funcs = map[string]soyhtml.Func{
+		"double": {func(args []data.Value) data.Value {
+			return args[0].(data.Int) * 2
+		}, []int{1}},
+	}
+	var reg, err = soy.NewBundle(soy.WithFuncs(funcs)).
+		AddTemplateString("fuzz.soy", `{namespace fuzz}
+
+/** @param? name */
+{template .guarded}
+Hello {$name ?: 'world'}
+{/template}
+
+/** @param user */
+{template .unguarded}
+Hello {$user.name}
+{/template}
+
+/** @param n */
+{template .doubled}
+{if $n}{double($n)}{/if}
+{/template}
+
+{template .static}
+Hello
+{/template}
+`).Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var failures = Fuzz(reg, soyhtml.NewTofu(reg).WithFuncs(funcs), 20)
+	var cases = make(map[string]map[string]bool)
+	for _, failure := range failures {
+		if cases[failure.Template] == nil {
+			cases[failure.Template] = make(map[string]bool)
+		}
+		cases[failure.Template][failure.Case] = true
+		if failure.Panicked() != (failure.Template == "fuzz.doubled") {
+			t.Errorf("%v: unexpected Panicked: %v", failure, failure.Panicked())
+		}
+	}
+
+	if len(cases["fuzz.guarded"]) > 0 || len(cases["fuzz.static"]) > 0 {
+		t.Errorf("expected guarded templates to render, got %v", failures)
+	}
+	if !cases["fuzz.unguarded"]["empty"] || !cases["fuzz.unguarded"]["null"] {
+		t.Errorf("expected fuzz.unguarded to fail with empty and null data, got %v", cases["fuzz.unguarded"])
+	}
+	if cases["fuzz.doubled"]["empty"] || cases["fuzz.doubled"]["null"] || len(cases["fuzz.doubled"]) == 0 {
+		t.Errorf("expected fuzz.doubled to fail with only random data, got %v", cases["fuzz.doubled"])
+	}
+
+	var again = Fuzz(reg, soyhtml.NewTofu(reg).WithFuncs(funcs), 20)
+	if len(again) != len(failures) {
+		t.Errorf("expected the same failures each time, got %d and %d", len(failures), len(again))
+	}
+}
@@ -0,0 +1,86 @@
+// Package soytest compiles inline soy for use in tests, e.g. table-driven
+// tests of custom functions and print directives, without creating template
+// files or setting up a full bundle.
+//
+//	var tmpl = soytest.MustCompile(`/** @param x */{template .t}{$x|myDirective}{/template}`)
+//	if out := tmpl.MustRender(map[string]interface{}{"x": 1}); out != "..." {
+//		t.Errorf(...)
+//	}
+//
+// Fuzz renders every template in a registry with empty, null, and randomly
+// typed data, to find templates that are missing null guards.
+package soytest
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/robfig/soy"
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/parse"
+	"github.com/robfig/soy/soyhtml"
+)
+
+// Namespace is the namespace given to soy compiled without one.
+const Namespace = "soytest"
+
+// Template is a compiled soy file, ready to render.
+type Template struct {
+	Tofu *soyhtml.Tofu
+	Name string // fully-qualified name of the first template in the file
+}
+
+// Compile compiles the given soy into a bundle with the given options, and
+// returns its first template.  The {namespace} declaration may be omitted, in
+// which case the Namespace is used.
+func Compile(src string, opts ...soy.Option) (*Template, error) {
+	if !strings.HasPrefix(strings.TrimSpace(src), "{namespace") {
+		src = "{namespace " + Namespace + "}\n" + src
+	}
+	var tree, err = parse.SoyFile("soytest.soy", src)
+	if err != nil {
+		return nil, err
+	}
+	tofu, err := soy.NewBundle(opts...).
+		AddTemplateString("soytest.soy", src).
+		CompileToTofu()
+	if err != nil {
+		return nil, err
+	}
+	var tmpl = &Template{Tofu: tofu}
+	for _, node := range tree.Body {
+		if node, ok := node.(*ast.TemplateNode); ok {
+			tmpl.Name = node.Name
+			break
+		}
+	}
+	return tmpl, nil
+}
+
+// MustCompile is like Compile, but panics if the soy does not compile.
+func MustCompile(src string, opts ...soy.Option) *Template {
+	var tmpl, err = Compile(src, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return tmpl
+}
+
+// Render renders the template with the given data, which may be a data.Map,
+// map, or struct, as accepted by soyhtml.Tofu.Render.
+func (t *Template) Render(data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Tofu.Render(&buf, t.Name, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// MustRender is like Render, but panics if rendering fails.
+func (t *Template) MustRender(data interface{}) string {
+	var out, err = t.Render(data)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
@@ -0,0 +1,48 @@
+package soytest
+
+import (
+	"testing"
+
+	"github.com/robfig/soy"
+	"github.com/robfig/soy/data"
+	"github.com/robfig/soy/soyhtml"
+)
+
+func TestMustCompile(t *testing.T) {
+	var shout = soy.WithFuncs(map[string]soyhtml.Func{
+		"shout": {func(args []data.Value) data.Value {
+			return data.String(args[0].String() + "!")
+		}, []int{1}},
+	})
+	var tests = []struct {
+		soy      string
+		data     interface{}
+		expected string
+	}{
+		{`/** @param name */{template .t}Hello {$name}{/template}`, map[string]interface{}{"name": "Rob"}, "Hello Rob"},
+		{`/** @param x */{template .t}{shout($x)}{/template}`, data.Map{"x": data.String("hi")}, "hi!"},
+		{`/** @param x */{template .t}{$x|truncate:3}{/template}{template .u}{/template}`, map[string]string{"x": "abcdef"}, "abc"},
+		{`{namespace other}{template .t}{'<b>'|noAutoescape}{/template}`, nil, "<b>"},
+	}
+	for _, test := range tests {
+		var actual = MustCompile(test.soy, shout).MustRender(test.data)
+		if actual != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.soy, test.expected, actual)
+		}
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	if _, err := Compile(`{template .t}{if}{/template}`); err == nil {
+		t.Error("expected a parse error")
+	}
+	if _, err := MustCompile(`/** @param x */{template .t}{$x.y}{/template}`).Render(map[string]interface{}{}); err == nil {
+		t.Error("expected a render error")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("expected MustCompile to panic")
+		}
+	}()
+	MustCompile(`{template .t}`)
+}
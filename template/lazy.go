@@ -0,0 +1,291 @@
+package template
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/errortypes"
+	"github.com/robfig/soy/parse"
+)
+
+// lazyRegistry holds the files registered with AddLazy.  It is shared by all
+// copies of a Registry, so that a file parsed on behalf of one copy (e.g. the
+// one held by a renderer) is not parsed again for another.
+type lazyRegistry struct {
+	files      map[string]*lazyFile // by file name
+	byTemplate map[string]*lazyFile // by fully-qualified template name
+	onLoad     func(Registry) error
+	onWarmup   func(Registry, []string) error
+}
+
+// lazyFile is a soy file whose templates have been registered by name, but
+// whose content is not parsed until one of them is needed.
+type lazyFile struct {
+	name      string
+	content   string
+	names     []string // fully-qualified names of the templates in the file
+	onLoad    func(Registry) error
+	once      sync.Once
+	soyfile   *ast.SoyFileNode
+	templates []Template
+	err       error
+	checkOnce sync.Once
+	checkErr  error
+}
+
+var (
+	namespaceHeader = regexp.MustCompile(`\{namespace\s+([\w.]+)`)
+	templateHeader  = regexp.MustCompile(`\{template\s+(?:name=")?(\.?[\w.]+)`)
+)
+
+// AddLazy registers the templates in the given soy file without parsing it.
+// Only the namespace and template names are read up front; the file is
+// parsed the first time one of its templates is looked up (typically at its
+// first render).  This reduces start-up time for programs that use only a
+// small subset of a large bundle.
+//
+// Because the file is not parsed, syntax errors in it are not reported until it
+// is loaded, and its templates are not included in Templates (or checked by
+// passes that iterate over it) until then.  Use Warmup to load templates
+// ahead of time.
+func (r *Registry) AddLazy(filename, content string) error {
+	var ns = namespaceHeader.FindStringSubmatch(content)
+	if ns == nil {
+		return fmt.Errorf("%s: namespace required", filename)
+	}
+	var file = &lazyFile{name: filename, content: content}
+	for _, m := range templateHeader.FindAllStringSubmatch(content, -1) {
+		var name = m[1]
+		if strings.HasPrefix(name, ".") {
+			name = ns[1] + name
+		}
+		file.names = append(file.names, name)
+	}
+
+	if r.lazy == nil {
+		r.lazy = &lazyRegistry{
+			files:      make(map[string]*lazyFile),
+			byTemplate: make(map[string]*lazyFile),
+		}
+	}
+	file.onLoad = r.lazy.onLoad
+	r.lazy.files[filename] = file
+	for _, name := range file.names {
+		r.lazy.byTemplate[name] = file
+	}
+	return nil
+}
+
+// OnLoad sets a function to be called with a registry containing the templates
+// of each lazily registered file, after it is parsed and before it is used.  It may be used
+// to apply the processing that would have been applied to eagerly parsed
+// templates, such as setting globals.  It applies to files registered after
+// it is set.
+func (r *Registry) OnLoad(fn func(loaded Registry) error) {
+	if r.lazy == nil {
+		r.lazy = &lazyRegistry{
+			files:      make(map[string]*lazyFile),
+			byTemplate: make(map[string]*lazyFile),
+		}
+	}
+	r.lazy.onLoad = fn
+}
+
+// OnWarmup sets a function to be called by Warmup with the registry and the
+// names of the templates that were loaded.  It may be used to check them, as
+// would have been done for eagerly parsed templates.  It is also called by
+// Lookup with the templates of each lazily registered file, the first time
+// one of them is looked up.
+func (r *Registry) OnWarmup(fn func(reg Registry, names []string) error) {
+	if r.lazy == nil {
+		r.lazy = &lazyRegistry{
+			files:      make(map[string]*lazyFile),
+			byTemplate: make(map[string]*lazyFile),
+		}
+	}
+	r.lazy.onWarmup = fn
+}
+
+// Warmup loads the files containing the named templates, or all lazily
+// registered files if no names are given, so that the first render of those
+// templates does not incur the cost of parsing them.  The loaded templates are
+// added to Templates and checked by the OnWarmup function, if any.  If the
+// check fails, the registry is left unchanged.
+//
+// Warmup modifies the registry, so it should be called before the registry is
+// used to render templates.
+func (r *Registry) Warmup(names ...string) error {
+	var files = make(map[string]*lazyFile)
+	if len(names) == 0 && r.lazy != nil {
+		files = r.lazy.files
+	}
+	for _, name := range names {
+		if file, ok := r.lazyFileOf(name); ok {
+			files[file.name] = file
+		} else if _, ok := r.Template(name); !ok {
+			return fmt.Errorf("template %q not found", name)
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	var filenames []string
+	for filename := range files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	// Add the loaded files to a copy of the registry.
+	var (
+		warm   = *r
+		loaded []string
+	)
+	warm.sourceByTemplateName = copyMap(r.sourceByTemplateName)
+	warm.fileByTemplateName = copyMap(r.fileByTemplateName)
+	warm.SoyFiles = append([]*ast.SoyFileNode(nil), r.SoyFiles...)
+	warm.Templates = append([]Template(nil), r.Templates...)
+	for _, filename := range filenames {
+		var file = files[filename]
+		var templates, err = file.load()
+		if err != nil {
+			return err
+		}
+		warm.SoyFiles = append(warm.SoyFiles, file.soyfile)
+		for _, t := range templates {
+			warm.Templates = append(warm.Templates, t)
+			warm.sourceByTemplateName[t.Node.Name] = file.content
+			warm.fileByTemplateName[t.Node.Name] = file.name
+			loaded = append(loaded, t.Node.Name)
+		}
+	}
+	warm.lazy = r.lazy.without(files)
+
+	if warm.lazy.onWarmup != nil {
+		if err := warm.lazy.onWarmup(warm, loaded); err != nil {
+			return err
+		}
+	}
+	*r = warm
+	return nil
+}
+
+// copyMap returns a copy of the given map.
+func copyMap(m map[string]string) map[string]string {
+	var c = make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// load parses the file, if it has not been already.
+func (f *lazyFile) load() ([]Template, error) {
+	f.once.Do(func() {
+		var soyfile, err = parse.SoyFile(f.name, f.content)
+		if err != nil {
+			f.err = err
+			return
+		}
+		var reg Registry
+		if err = reg.Add(soyfile); err != nil {
+			f.err = errortypes.Wrap(fmt.Errorf("%s: %w", f.name, err), errortypes.ErrParse)
+			return
+		}
+		if f.onLoad != nil {
+			if err = f.onLoad(reg); err != nil {
+				f.err = fmt.Errorf("%s: %w", f.name, err)
+				return
+			}
+		}
+		f.soyfile, f.templates = soyfile, reg.Templates
+	})
+	return f.templates, f.err
+}
+
+// check calls the given OnWarmup function with the templates of the file, if
+// it has not been already.
+func (f *lazyFile) check(reg Registry, onWarmup func(Registry, []string) error) error {
+	f.checkOnce.Do(func() {
+		if onWarmup == nil {
+			return
+		}
+		var names = make([]string, len(f.templates))
+		for i, t := range f.templates {
+			names[i] = t.Node.Name
+		}
+		f.checkErr = onWarmup(reg, names)
+	})
+	return f.checkErr
+}
+
+// lazyTemplate returns the named template from a lazily registered file,
+// loading the file if necessary, and checking it with the OnWarmup function
+// if check is true.
+func (r *Registry) lazyTemplate(name string, check bool) (Template, error) {
+	var file, ok = r.lazyFileOf(name)
+	if !ok {
+		return Template{}, errNotFound(name)
+	}
+	var templates, err = file.load()
+	if err != nil {
+		return Template{}, err
+	}
+	if check {
+		if err = file.check(*r, r.lazy.onWarmup); err != nil {
+			return Template{}, err
+		}
+	}
+	for _, t := range templates {
+		if t.Node.Name == name {
+			return t, nil
+		}
+	}
+	return Template{}, errNotFound(name)
+}
+
+// lazyFileOf returns the lazily registered file containing the named template.
+func (r *Registry) lazyFileOf(name string) (*lazyFile, bool) {
+	if r.lazy == nil {
+		return nil, false
+	}
+	var file, ok = r.lazy.byTemplate[name]
+	return file, ok
+}
+
+// removeLazy removes the named file from the lazily registered files, without
+// affecting other copies of the registry.  It returns the removed file, or nil
+// if it was not found.
+func (r *Registry) removeLazy(filename string) *lazyFile {
+	if r.lazy == nil || r.lazy.files[filename] == nil {
+		return nil
+	}
+	var removed = r.lazy.files[filename]
+	r.lazy = r.lazy.without(map[string]*lazyFile{filename: removed})
+	return removed
+}
+
+// without returns a copy of the lazy registry, minus the given files.
+func (l *lazyRegistry) without(files map[string]*lazyFile) *lazyRegistry {
+	var lazy = &lazyRegistry{
+		files:      make(map[string]*lazyFile),
+		byTemplate: make(map[string]*lazyFile),
+		onLoad:     l.onLoad,
+		onWarmup:   l.onWarmup,
+	}
+	for name, file := range l.files {
+		if files[name] == nil {
+			lazy.files[name] = file
+		}
+	}
+	for name, file := range l.byTemplate {
+		if files[file.name] == nil {
+			lazy.byTemplate[name] = file
+		}
+	}
+	return lazy
+}
@@ -0,0 +1,145 @@
+package template
+
+import (
+	"reflect"
+
+	"github.com/robfig/soy/ast"
+)
+
+// MemoryUsage is an estimate of the memory retained by a registry, in bytes.
+//
+// The estimate is computed by walking the parse trees and adding up the sizes
+// of the nodes, slices, maps and strings that they refer to.  It does not
+// account for allocator overhead, and strings that share memory with the
+// source text (e.g. identifiers) are counted separately, so it is meant for
+// comparing templates and files against each other rather than as an exact
+// figure.
+type MemoryUsage struct {
+	Total      int64            // the entire registry
+	Files      map[string]int64 // by file name, including the source text
+	Namespaces map[string]int64 // by namespace, the sum of its files
+	Templates  map[string]int64 // by template name, including its SoyDoc
+}
+
+// MemoryUsage returns an estimate of the memory retained by the parsed
+// templates in the registry.
+func (r *Registry) MemoryUsage() MemoryUsage {
+	var usage = MemoryUsage{
+		Files:      make(map[string]int64),
+		Namespaces: make(map[string]int64),
+		Templates:  make(map[string]int64),
+	}
+
+	// Size the templates first, so that the nodes they share with their
+	// files are attributed to both.
+	for _, t := range r.Templates {
+		var s = newSizer()
+		usage.Templates[t.Node.Name] = s.sizeOf(reflect.ValueOf(t.Node)) +
+			s.sizeOf(reflect.ValueOf(t.Doc))
+	}
+
+	var s = newSizer()
+	for _, soyfile := range r.SoyFiles {
+		var size = s.sizeOf(reflect.ValueOf(soyfile))
+		usage.Files[soyfile.Name] += size
+		usage.Total += size
+		for _, node := range soyfile.Body {
+			if ns, ok := node.(*ast.NamespaceNode); ok {
+				usage.Namespaces[ns.Name] += size
+				break
+			}
+		}
+	}
+
+	// The lookup maps share their strings with the files, so only the entries
+	// themselves are counted.
+	var entrySize = int64(2*reflect.TypeOf("").Size()) + mapEntryOverhead
+	usage.Total += s.sizeOf(reflect.ValueOf(r.Templates)) +
+		int64(len(r.sourceByTemplateName)+len(r.fileByTemplateName))*entrySize
+	return usage
+}
+
+// mapEntryOverhead approximates the per-entry bookkeeping of a Go map.
+const mapEntryOverhead = 8
+
+// sizer computes the memory referenced by values, counting each pointer,
+// slice, and map only once.
+type sizer struct {
+	seen map[uintptr]bool
+}
+
+func newSizer() *sizer {
+	return &sizer{make(map[uintptr]bool)}
+}
+
+// sizeOf returns the size of the given value itself (as if stored in a
+// variable) plus everything it refers to.
+func (s *sizer) sizeOf(v reflect.Value) int64 {
+	if !v.IsValid() {
+		return 0
+	}
+	return int64(v.Type().Size()) + s.referenced(v)
+}
+
+// referenced returns the size of the memory referred to by the value, not
+// including the value itself.
+func (s *sizer) referenced(v reflect.Value) int64 {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || s.seen[v.Pointer()] {
+			return 0
+		}
+		s.seen[v.Pointer()] = true
+		return s.sizeOf(v.Elem())
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		var elem = v.Elem()
+		switch elem.Kind() {
+		case reflect.Ptr, reflect.Map:
+			// Pointer-shaped values are stored in the interface directly.
+			return s.referenced(elem)
+		}
+		return s.sizeOf(elem)
+	case reflect.Slice:
+		if v.IsNil() || v.Cap() == 0 || s.seen[v.Pointer()] {
+			return 0
+		}
+		s.seen[v.Pointer()] = true
+		var size = int64(v.Cap()) * int64(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			size += s.referenced(v.Index(i))
+		}
+		return size
+	case reflect.Map:
+		if v.IsNil() || s.seen[v.Pointer()] {
+			return 0
+		}
+		s.seen[v.Pointer()] = true
+		var (
+			entrySize = int64(v.Type().Key().Size()+v.Type().Elem().Size()) + mapEntryOverhead
+			size      = int64(v.Len()) * entrySize
+			iter      = v.MapRange()
+		)
+		for iter.Next() {
+			size += s.referenced(iter.Key()) + s.referenced(iter.Value())
+		}
+		return size
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Struct:
+		var size int64
+		for i := 0; i < v.NumField(); i++ {
+			size += s.referenced(v.Field(i))
+		}
+		return size
+	case reflect.Array:
+		var size int64
+		for i := 0; i < v.Len(); i++ {
+			size += s.referenced(v.Index(i))
+		}
+		return size
+	}
+	return 0
+}
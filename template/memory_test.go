@@ -0,0 +1,47 @@
+package template
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/robfig/soy/parse"
+)
+
+func TestMemoryUsage(t *testing.T) {
+	var reg Registry
+	for name, src := range map[string]string{
+		"small.soy": `{namespace small}
+{template .tiny}hi{/template}`,
+		"large.soy": `{namespace large}
+/** @param x */
+{template .large}` + strings.Repeat("{if $x}{$x.y.z}{else}text{/if}", 100) + `{/template}
+{template .tiny}hi{/template}`,
+	} {
+		var tree, err = parse.SoyFile(name, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = reg.Add(tree); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var usage = reg.MemoryUsage()
+	if usage.Templates["large.large"] <= 10*usage.Templates["large.tiny"] {
+		t.Errorf("expected large.large (%d) to be much larger than large.tiny (%d)",
+			usage.Templates["large.large"], usage.Templates["large.tiny"])
+	}
+	if usage.Templates["large.tiny"] != usage.Templates["small.tiny"] {
+		t.Errorf("expected identical templates to have the same size, got %d and %d",
+			usage.Templates["large.tiny"], usage.Templates["small.tiny"])
+	}
+	if usage.Files["large.soy"] <= usage.Templates["large.large"]+usage.Templates["large.tiny"] {
+		t.Errorf("expected file (%d) to include its templates and source", usage.Files["large.soy"])
+	}
+	if usage.Namespaces["large"] != usage.Files["large.soy"] {
+		t.Errorf("expected namespace size %d, got %d", usage.Files["large.soy"], usage.Namespaces["large"])
+	}
+	if usage.Total <= usage.Files["large.soy"]+usage.Files["small.soy"] {
+		t.Errorf("expected total (%d) to include all files", usage.Total)
+	}
+}
@@ -2,11 +2,15 @@
 package template
 
 import (
+	"errors"
 	"fmt"
+	"iter"
 	"log"
+	"sort"
 	"strings"
 
 	"github.com/robfig/soy/ast"
+	"github.com/robfig/soy/errortypes"
 )
 
 // Registry provides convenient access to a collection of parsed Soy templates.
@@ -17,6 +21,9 @@ type Registry struct {
 	// sourceByTemplateName maps FQ template name to the input source it came from.
 	sourceByTemplateName map[string]string
 	fileByTemplateName   map[string]string
+
+	// lazy holds the files registered with AddLazy, if any.
+	lazy *lazyRegistry
 }
 
 // Add the given soy file node (and all contained templates) to this registry.
@@ -65,21 +72,146 @@ func (r *Registry) Add(soyfile *ast.SoyFileNode) error {
 	return nil
 }
 
+// Remove removes the named file, and all of the templates it contains, from
+// the registry.  It returns the removed file, or nil if it was not found.
+//
+// The registry's slices and maps are copied rather than modified in place, so
+// that a copy of the registry made before the call (e.g. one in use by a
+// renderer) is unaffected.
+//
+// A file registered with AddLazy is removed as well; the parsed file is
+// returned only if it had been loaded.
+func (r *Registry) Remove(filename string) *ast.SoyFileNode {
+	var removed *ast.SoyFileNode
+	var soyFiles []*ast.SoyFileNode
+	for _, soyfile := range r.SoyFiles {
+		if soyfile.Name == filename && removed == nil {
+			removed = soyfile
+			continue
+		}
+		soyFiles = append(soyFiles, soyfile)
+	}
+	if removed == nil {
+		if file := r.removeLazy(filename); file != nil {
+			removed = file.soyfile
+		}
+	}
+
+	var templates []Template
+	var sourceByTemplateName = make(map[string]string, len(r.sourceByTemplateName))
+	var fileByTemplateName = make(map[string]string, len(r.fileByTemplateName))
+	for _, t := range r.Templates {
+		if r.fileByTemplateName[t.Node.Name] == filename {
+			continue
+		}
+		templates = append(templates, t)
+		sourceByTemplateName[t.Node.Name] = r.sourceByTemplateName[t.Node.Name]
+		fileByTemplateName[t.Node.Name] = r.fileByTemplateName[t.Node.Name]
+	}
+	r.SoyFiles = soyFiles
+	r.Templates = templates
+	r.sourceByTemplateName = sourceByTemplateName
+	r.fileByTemplateName = fileByTemplateName
+	return removed
+}
+
 // Template allows lookup by (fully-qualified) template name.
 // The resulting template is returned and a boolean indicating if it was found.
+// A lazily registered file that fails to load is logged, and its templates
+// are not found; use Lookup to get the error instead.
 func (r *Registry) Template(name string) (Template, bool) {
 	for _, t := range r.Templates {
 		if t.Node.Name == name {
 			return t, true
 		}
 	}
-	return Template{}, false
+	var t, err = r.lazyTemplate(name, false)
+	if err != nil && !errors.Is(err, errortypes.ErrTemplateNotFound) {
+		log.Println(err)
+	}
+	return t, err == nil
+}
+
+// Lookup returns the named template, or an error identified as
+// errortypes.ErrTemplateNotFound if there is none.  Unlike Template, it
+// returns the error of a lazily registered file that fails to parse or to pass
+// the OnWarmup check, which is made the first time one of its templates is
+// looked up, rather than reporting the template as not found.
+func (r *Registry) Lookup(name string) (Template, error) {
+	for _, t := range r.Templates {
+		if t.Node.Name == name {
+			return t, nil
+		}
+	}
+	return r.lazyTemplate(name, true)
+}
+
+func errNotFound(name string) error {
+	return errortypes.Wrap(fmt.Errorf("template %q not found", name), errortypes.ErrTemplateNotFound)
+}
+
+// All returns an iterator over the templates in the registry.  The templates of
+// lazily registered files follow the others, and each of those files is parsed
+// only once the iteration reaches it, so that stopping early avoids parsing
+// the rest.  Files that fail to parse are skipped, as by Template.
+func (r *Registry) All() iter.Seq[Template] {
+	return func(yield func(Template) bool) {
+		for _, t := range r.Templates {
+			if !yield(t) {
+				return
+			}
+		}
+		for _, file := range r.lazyFiles() {
+			var templates, err = file.load()
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			for _, t := range templates {
+				if !yield(t) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Names returns an iterator over the fully-qualified names of the templates in
+// the registry, in the order of All, without parsing lazily registered files.
+func (r *Registry) Names() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, t := range r.Templates {
+			if !yield(t.Node.Name) {
+				return
+			}
+		}
+		for _, file := range r.lazyFiles() {
+			for _, name := range file.names {
+				if !yield(name) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// lazyFiles returns the lazily registered files, ordered by name.
+func (r *Registry) lazyFiles() []*lazyFile {
+	if r.lazy == nil {
+		return nil
+	}
+	var files = make([]*lazyFile, 0, len(r.lazy.files))
+	for _, file := range r.lazy.files {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files
 }
 
 // LineNumber computes the line number in the input source for the given node
 // within the given template.
 func (r *Registry) LineNumber(templateName string, node ast.Node) int {
-	var src, ok = r.sourceByTemplateName[templateName]
+	var src, ok = r.source(templateName)
 	if !ok {
 		log.Println("template not found:", templateName)
 		return 0
@@ -90,7 +222,7 @@ func (r *Registry) LineNumber(templateName string, node ast.Node) int {
 // ColNumber computes the column number in the relevant line of input source for the given node
 // within the given template.
 func (r *Registry) ColNumber(templateName string, node ast.Node) int {
-	var src, ok = r.sourceByTemplateName[templateName]
+	var src, ok = r.source(templateName)
 	if !ok {
 		log.Println("template not found:", templateName)
 		return 0
@@ -102,8 +234,22 @@ func (r *Registry) ColNumber(templateName string, node ast.Node) int {
 func (r *Registry) Filename(templateName string) string {
 	var f, ok = r.fileByTemplateName[templateName]
 	if !ok {
+		if file, ok := r.lazyFileOf(templateName); ok {
+			return file.name
+		}
 		log.Println("template not found:", templateName)
 		return ""
 	}
 	return f
 }
+
+// source returns the input source containing the specified template.
+func (r *Registry) source(templateName string) (string, bool) {
+	if src, ok := r.sourceByTemplateName[templateName]; ok {
+		return src, true
+	}
+	if file, ok := r.lazyFileOf(templateName); ok {
+		return file.content, true
+	}
+	return "", false
+}
@@ -0,0 +1,98 @@
+package template
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/robfig/soy/parse"
+)
+
+func TestAll(t *testing.T) {
+	var tree, err = parse.SoyFile("page.soy", `{namespace page}
+{template .page}{/template}
+{template .footer}{/template}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var registry Registry
+	if err = registry.Add(tree); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []struct{ name, content string }{
+		{"widget.soy", `{namespace widget}{template .hello}{/template}`},
+		{"broken.soy", `{namespace broken}{template .oops}{if}{/template}`},
+	} {
+		if err = registry.AddLazy(file.name, file.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Names does not parse the lazily registered files.
+	var names []string
+	for name := range registry.Names() {
+		names = append(names, name)
+	}
+	var expected = []string{"page.page", "page.footer", "broken.oops", "widget.hello"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected names %v, got %v", expected, names)
+	}
+	if file, _ := registry.lazyFileOf("widget.hello"); file.soyfile != nil {
+		t.Errorf("expected widget.soy not to be parsed")
+	}
+
+	// Stopping early does not parse the remaining files.
+	for tmpl := range registry.All() {
+		if tmpl.Node.Name == "page.footer" {
+			break
+		}
+	}
+	if file, _ := registry.lazyFileOf("widget.hello"); file.soyfile != nil {
+		t.Errorf("expected widget.soy not to be parsed")
+	}
+
+	// All parses them as it reaches them, skipping those that fail.
+	names = nil
+	for tmpl := range registry.All() {
+		names = append(names, tmpl.Node.Name)
+	}
+	expected = []string{"page.page", "page.footer", "widget.hello"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected templates %v, got %v", expected, names)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	var registry Registry
+	for _, file := range []struct{ name, content string }{
+		{"page.soy", `{namespace page}{template .page}{/template}`},
+		{"widget.soy", `{namespace widget}{template .hello}{/template}`},
+	} {
+		var tree, err = parse.SoyFile(file.name, file.content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = registry.Add(tree); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Adding to a copy after a Remove leaves the original unchanged, whether
+	// or not the file was found.
+	for _, filename := range []string{"widget.soy", "missing.soy"} {
+		var tree, err = parse.SoyFile("other.soy", `{namespace other}{template .other}{/template}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var cp = registry
+		cp.Remove(filename)
+		if err = cp.Add(tree); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := registry.Template("other.other"); ok || registry.Filename("other.other") != "" {
+			t.Errorf("%s: expected the original registry to be unchanged", filename)
+		}
+		if cp.Filename("other.other") != "other.soy" {
+			t.Errorf("%s: expected other.other to be added to the copy", filename)
+		}
+	}
+}
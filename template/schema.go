@@ -0,0 +1,121 @@
+package template
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/robfig/soy/ast"
+)
+
+// Schema is a machine-readable description of the templates in a registry,
+// for use by tooling and by tests of the data contract written in other
+// languages.  It is serialized as JSON by WriteSchema.
+type Schema struct {
+	Templates []TemplateSchema `json:"templates"`
+}
+
+// TemplateSchema describes a single template.
+type TemplateSchema struct {
+	Name     string          `json:"name"`
+	File     string          `json:"file"`
+	Kind     string          `json:"kind"`
+	Private  bool            `json:"private,omitempty"`
+	Params   []ParamSchema   `json:"params"`
+	Calls    []string        `json:"calls"`    // names of the templates {call}ed
+	Messages []MessageSchema `json:"messages"` // {msg}s, in order of appearance
+	Globals  []string        `json:"globals"`  // names of the globals referenced
+
+	// NamespaceAttrs are the attributes of the file's {namespace} declaration,
+	// e.g. requirecss, including any not known to this package.
+	NamespaceAttrs map[string]string `json:"namespaceAttrs,omitempty"`
+}
+
+// ParamSchema describes a param declared by a template.
+type ParamSchema struct {
+	Name     string `json:"name"`
+	Optional bool   `json:"optional,omitempty"`
+}
+
+// MessageSchema describes a {msg} within a template.  The ID is only set once
+// messages have been processed (as they are by Bundle.Compile); it is
+// formatted as a decimal string since it may exceed the precision of a
+// javascript number.
+type MessageSchema struct {
+	ID      string `json:"id,omitempty"`
+	Meaning string `json:"meaning,omitempty"`
+	Desc    string `json:"desc"`
+}
+
+// Schema returns a description of the templates in the registry, sorted by
+// name.  Templates registered with AddLazy are only included once they have
+// been loaded, so call Warmup first to describe all of them.
+func (r *Registry) Schema() Schema {
+	var schema = Schema{Templates: []TemplateSchema{}}
+	for _, t := range r.Templates {
+		var kind = t.Node.Kind
+		if kind == "" {
+			kind = "html"
+		}
+		var ts = TemplateSchema{
+			Name:     t.Node.Name,
+			File:     r.Filename(t.Node.Name),
+			Kind:     kind,
+			Private:  t.Node.Private,
+			Params:   []ParamSchema{},
+			Calls:    []string{},
+			Messages: []MessageSchema{},
+			Globals:  []string{},
+		}
+		if t.Namespace != nil && len(t.Namespace.Attrs) > 0 {
+			ts.NamespaceAttrs = t.Namespace.Attrs
+		}
+		for _, param := range t.Doc.Params {
+			ts.Params = append(ts.Params, ParamSchema{param.Name, param.Optional})
+		}
+		var calls, globals = make(map[string]bool), make(map[string]bool)
+		var visit func(ast.Node)
+		visit = func(node ast.Node) {
+			switch node := node.(type) {
+			case *ast.CallNode:
+				if !calls[node.Name] {
+					calls[node.Name] = true
+					ts.Calls = append(ts.Calls, node.Name)
+				}
+			case *ast.GlobalNode:
+				if !globals[node.Name] {
+					globals[node.Name] = true
+					ts.Globals = append(ts.Globals, node.Name)
+				}
+			case *ast.MsgNode:
+				var msg = MessageSchema{Meaning: node.Meaning, Desc: node.Desc}
+				if node.ID != 0 {
+					msg.ID = strconv.FormatUint(node.ID, 10)
+				}
+				ts.Messages = append(ts.Messages, msg)
+			}
+			if parent, ok := node.(ast.ParentNode); ok {
+				for _, child := range parent.Children() {
+					visit(child)
+				}
+			}
+		}
+		visit(t.Node)
+		sort.Strings(ts.Calls)
+		sort.Strings(ts.Globals)
+		schema.Templates = append(schema.Templates, ts)
+	}
+	sort.Slice(schema.Templates, func(i, j int) bool {
+		return schema.Templates[i].Name < schema.Templates[j].Name
+	})
+	return schema
+}
+
+// WriteSchema writes the schema of the templates in the registry to out, as
+// JSON.  See Schema.
+func (r *Registry) WriteSchema(out io.Writer) error {
+	var enc = json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r.Schema())
+}
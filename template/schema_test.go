@@ -0,0 +1,78 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/robfig/soy/parse"
+)
+
+func TestSchema(t *testing.T) {
+	var tree, err = parse.SoyFile("page.soy", `{namespace page requirecss="page.css"}
+
+/**
+ * @param name
+ * @param? title
+ */
+{template .page}
+  {msg desc="Greeting" meaning="noun"}Hello {$name}{/msg}
+  {call .footer}{param year: app.year/}{/call}
+  {call .footer/}
+{/template}
+
+{template .footer kind="text" private="true"}
+  {msg desc="Copyright"}(c) {app.year} {app.name}{/msg}
+{/template}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reg Registry
+	if err = reg.Add(tree); err != nil {
+		t.Fatal(err)
+	}
+
+	var expected = Schema{Templates: []TemplateSchema{
+		{
+			Name:     "page.footer",
+			File:     "page.soy",
+			Kind:     "text",
+			Private:  true,
+			Params:   []ParamSchema{},
+			Calls:    []string{},
+			Messages: []MessageSchema{{Desc: "Copyright"}},
+			Globals:  []string{"app.name", "app.year"},
+
+			NamespaceAttrs: map[string]string{"requirecss": "page.css"},
+		},
+		{
+			Name:     "page.page",
+			File:     "page.soy",
+			Kind:     "html",
+			Params:   []ParamSchema{{"name", false}, {"title", true}},
+			Calls:    []string{"page.footer"},
+			Messages: []MessageSchema{{Meaning: "noun", Desc: "Greeting"}},
+			Globals:  []string{"app.year"},
+
+			NamespaceAttrs: map[string]string{"requirecss": "page.css"},
+		},
+	}}
+	var schema = reg.Schema()
+	if !reflect.DeepEqual(schema, expected) {
+		t.Errorf("expected\n%+v\ngot\n%+v", expected, schema)
+	}
+
+	// The JSON round-trips.
+	var buf bytes.Buffer
+	if err = reg.WriteSchema(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Schema
+	if err = json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("expected\n%+v\ngot\n%+v", expected, decoded)
+	}
+}